@@ -3,16 +3,39 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
 	"os"
 	"runtime"
 	"time"
 
 	"github.com/urfave/cli/v3"
 
+	"github.com/davexpro/backup/internal/app"
+	"github.com/davexpro/backup/internal/approve"
+	"github.com/davexpro/backup/internal/bench"
+	"github.com/davexpro/backup/internal/catalog"
+	"github.com/davexpro/backup/internal/chat"
+	"github.com/davexpro/backup/internal/compliance"
+	"github.com/davexpro/backup/internal/compose"
+	"github.com/davexpro/backup/internal/daemon"
+	"github.com/davexpro/backup/internal/extract"
 	"github.com/davexpro/backup/internal/gitlab"
+	"github.com/davexpro/backup/internal/host"
+	"github.com/davexpro/backup/internal/ldap"
 	"github.com/davexpro/backup/internal/mysql"
+	"github.com/davexpro/backup/internal/notify"
+	"github.com/davexpro/backup/internal/pause"
+	"github.com/davexpro/backup/internal/pkg/helper"
+	"github.com/davexpro/backup/internal/plugin"
+	"github.com/davexpro/backup/internal/prune"
+	"github.com/davexpro/backup/internal/rabbitmq"
+	"github.com/davexpro/backup/internal/rekey"
+	"github.com/davexpro/backup/internal/replicate"
 	"github.com/davexpro/backup/internal/setup"
+	"github.com/davexpro/backup/internal/share"
+	"github.com/davexpro/backup/internal/site"
+	"github.com/davexpro/backup/internal/spool"
+	"github.com/davexpro/backup/internal/vault"
+	"github.com/davexpro/backup/internal/volume"
 )
 
 var (
@@ -21,15 +44,19 @@ var (
 	startTime = time.Now()
 )
 
-func printVersion() {
+// printVersion prints the build information, as a log line with --output
+// json so the output stays one JSON object per line.
+func printVersion(format string) {
+	if format == "json" {
+		helper.Infof("built %s, date %s, magic %s", runtime.Version(), date, magic)
+		return
+	}
 	fmt.Printf("%10s : %s\n", "built", runtime.Version())
 	fmt.Printf("%10s : %s\n", "date", date)
 	fmt.Printf("%10s : %s\n", "magic", magic)
 }
 
 func main() {
-	printVersion()
-
 	cmd := &cli.Command{
 		Name:  "backup",
 		Usage: "MySQL backup tool with separate compression, SHA256, MinIO upload, retention policy and history logging",
@@ -44,15 +71,95 @@ func main() {
 				Name:  "only-dump",
 				Usage: "Only backup data to local directory, do not upload to cloud",
 			},
+			&cli.StringFlag{
+				Name:    "log-level",
+				Value:   "info",
+				Usage:   "Minimum log level: debug, info, warn or error",
+				Sources: cli.EnvVars("BACKUP_LOG_LEVEL"),
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Value:   "text",
+				Usage:   "Output format of logs (stderr) and command results (stdout): text or json",
+				Sources: cli.EnvVars("BACKUP_OUTPUT"),
+			},
+			&cli.StringFlag{
+				Name:    "command-log",
+				Usage:   "Keep the full output of external commands (mysqlsh, zip, ...) in a log file per run in `DIR`",
+				Sources: cli.EnvVars("BACKUP_COMMAND_LOG"),
+			},
+			&cli.BoolFlag{
+				Name:  "confirm-large-delete",
+				Usage: "Allow retention to delete more backups than retention.confirm_threshold",
+			},
+			&cli.StringFlag{
+				Name:   "fault-inject",
+				Usage:  "Inject faults for testing, e.g. upload-every=3,corrupt,kill-dump=30s",
+				Hidden: true,
+			},
+		},
+		Before: func(ctx context.Context, c *cli.Command) (context.Context, error) {
+			if err := helper.SetupLogging(c.String("log-level"), c.String("output")); err != nil {
+				return ctx, err
+			}
+			printVersion(c.String("output"))
+			opts := helper.Options{
+				OnlyDump:            c.Bool("only-dump"),
+				ConfirmLargeDeletes: c.Bool("confirm-large-delete"),
+				JSON:                c.String("output") == "json",
+			}
+			if spec := c.String("fault-inject"); spec != "" {
+				faults, err := helper.ParseFaults(spec)
+				if err != nil {
+					return ctx, err
+				}
+				helper.Warnf("fault injection enabled: %+v", faults)
+				opts.Faults = faults
+			}
+			if dir := c.String("command-log"); dir != "" {
+				helper.SetCommandLogDir(dir)
+			}
+			return helper.WithOptions(ctx, opts), nil
 		},
 		Commands: []*cli.Command{
 			setup.Command,
 			mysql.Command,
 			gitlab.Command,
+			compose.Command,
+			volume.Command,
+			host.Command,
+			site.Command,
+			chat.Command,
+			app.Command,
+			ldap.Command,
+			vault.Command,
+			rabbitmq.Command,
+			plugin.Command,
+			catalog.Command,
+			catalog.ChainCommand,
+			catalog.MergeCommand,
+			catalog.ReconcileCommand,
+			catalog.RepairCommand,
+			prune.Command,
+			replicate.Command,
+			extract.Command,
+			rekey.Command,
+			notify.Command,
+			bench.Command,
+			spool.Command,
+			share.Command,
+			daemon.Command,
+			pause.Command,
+			pause.ResumeCommand,
+			approve.Command,
+			compliance.Command,
 		},
 	}
 
-	if err := cmd.Run(context.Background(), os.Args); err != nil {
-		log.Fatal(err)
+	err := cmd.Run(context.Background(), os.Args)
+	helper.FlushNotifications() // Messages still waiting in a telegram.batch_window
+	if err != nil {
+		helper.Errorf("%v", err)
+		os.Exit(1)
 	}
 }
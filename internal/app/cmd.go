@@ -0,0 +1,66 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var Command = &cli.Command{
+	Name:  "app",
+	Usage: "Back up applications as SQLite snapshots plus their config directory (e.g. Home Assistant)",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "Only back up the app with this name",
+		},
+	},
+	Action: run,
+}
+
+func run(ctx context.Context, c *cli.Command) error {
+	// 1. Check required tools
+	if err := helper.CheckTools("zip", "sqlite3"); err != nil {
+		return err
+	}
+
+	// 2. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	apps := cfg.Apps
+	if name := c.String("name"); name != "" {
+		apps = nil
+		for _, app := range cfg.Apps {
+			if app.Name == name {
+				apps = append(apps, app)
+			}
+		}
+	}
+	if len(apps) == 0 {
+		return fmt.Errorf("no matching apps configured")
+	}
+
+	// 3. File locking
+	unlock, err := helper.AcquireLock(cfg.LockFile)
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+	defer unlock()
+
+	// 4. Initialize storage
+	notifier := helper.NewNotifier(cfg)
+	store, err := helper.NewStorage(cfg, helper.OptionsFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	// 5. Create and run worker
+	helper.Infof("Starting app backup of %d apps", len(apps))
+	return NewWorker(cfg, store, notifier, helper.OptionsFrom(ctx)).Run(ctx, apps)
+}
@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// Directories inside an app artifact.
+const (
+	databaseDir = "databases" // Snapshots of the SQLite databases
+	configDir   = "config"    // Copy of the config directory
+)
+
+// Worker backs up applications as SQLite snapshots plus their config directory.
+type Worker struct {
+	cfg      *config.Config
+	store    helper.Storage
+	notifier *helper.TelegramSender
+	pipeline *helper.Pipeline
+	onlyDump bool
+}
+
+// NewWorker creates a new app worker.
+func NewWorker(cfg *config.Config, store helper.Storage, notifier *helper.TelegramSender, opts helper.Options) *Worker {
+	return &Worker{
+		cfg:      cfg,
+		store:    store,
+		notifier: notifier,
+		pipeline: helper.NewPipeline(cfg, store, opts),
+		onlyDump: opts.OnlyDump,
+	}
+}
+
+// Run backs up the given apps, each as its own artifact.
+func (w *Worker) Run(ctx context.Context, apps []config.AppConfig) error {
+	if helper.CheckPaused(w.cfg, w.notifier, "app") {
+		return nil
+	}
+	stop := w.pipeline.Start()
+	defer stop()
+	if err := w.pipeline.SelfTest(ctx, w.notifier, "app"); err != nil {
+		return err
+	}
+	w.pipeline.FlushSpool(ctx)
+
+	var results []helper.BackupResult
+	successCount, failCount := 0, 0
+	for _, app := range apps {
+		start := time.Now()
+		result := w.backupApp(ctx, app, start)
+		result.Duration = time.Since(start)
+		results = append(results, result)
+		if result.Success {
+			successCount++
+		} else {
+			failCount++
+			helper.Errorf("backup of %s failed: %v", result.Database, result.Error)
+		}
+	}
+
+	w.pipeline.PruneLocal(ctx)
+	w.pipeline.Report(w.notifier, "app", results, successCount, failCount)
+
+	if failCount > 0 {
+		return fmt.Errorf("app backup completed with %d failures", failCount)
+	}
+	return nil
+}
+
+func (w *Worker) backupApp(ctx context.Context, app config.AppConfig, start time.Time) helper.BackupResult {
+	name := "app_" + app.Name
+	stageDir := filepath.Join(w.cfg.Backup.TempDir, fmt.Sprintf("%s_%s", helper.EscapeName(name), start.Format(helper.TimestampLayout)))
+	if err := os.MkdirAll(filepath.Join(stageDir, databaseDir), 0700); err != nil {
+		return helper.BackupResult{Database: name, Success: false, Error: fmt.Errorf("failed to create temp dir: %w", err)}
+	}
+	defer os.RemoveAll(stageDir)
+
+	for _, db := range app.Databases {
+		dst := filepath.Join(stageDir, databaseDir, filepath.Base(db))
+		if err := snapshot(ctx, db, dst); err != nil {
+			return helper.BackupResult{Database: name, Success: false, Error: err}
+		}
+	}
+
+	if app.ConfigDir != "" {
+		exclude := append(databaseFiles(app), app.Exclude...)
+		if err := helper.CopyTree(app.ConfigDir, filepath.Join(stageDir, configDir), exclude); err != nil {
+			return helper.BackupResult{Database: name, Success: false, Error: fmt.Errorf("failed to copy config dir: %w", err)}
+		}
+	}
+
+	result := w.pipeline.Ship(ctx, name, stageDir, start, false)
+	result.Database = name
+	return result
+}
+
+// snapshot copies a live SQLite database with the online backup API, which
+// yields a consistent copy even while the application keeps writing.
+func snapshot(ctx context.Context, db, dst string) error {
+	helper.Infof("Snapshotting SQLite database %s", db)
+	if _, err := os.Stat(db); err != nil {
+		return fmt.Errorf("database %s: %w", db, err)
+	}
+	// Wait for writers holding the lock instead of failing with SQLITE_BUSY
+	backup := fmt.Sprintf(".backup '%s'", strings.ReplaceAll(dst, "'", "''"))
+	if _, err := helper.Run(ctx, helper.Command{Name: "sqlite3", Args: []string{"-cmd", ".timeout 60000", db, backup}}); err != nil {
+		return fmt.Errorf("sqlite3 backup of %s failed: %w", db, err)
+	}
+
+	output, err := helper.Run(ctx, helper.Command{Name: "sqlite3", Args: []string{dst, "PRAGMA integrity_check;"}})
+	if err != nil || strings.TrimSpace(string(output)) != "ok" {
+		return fmt.Errorf("snapshot of %s failed the integrity check: %s", db, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// databaseFiles returns exclude patterns for the databases inside the config
+// directory, including their journal files, which are replaced by snapshots.
+func databaseFiles(app config.AppConfig) []string {
+	var patterns []string
+	for _, db := range app.Databases {
+		rel, err := filepath.Rel(app.ConfigDir, db)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		patterns = append(patterns, rel, rel+"-wal", rel+"-shm", rel+"-journal")
+	}
+	return patterns
+}
@@ -0,0 +1,45 @@
+package approve
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var Command = &cli.Command{
+	Name:      "approve",
+	Usage:     "Approve a destructive operation waiting for a second operator (approval.threshold)",
+	ArgsUsage: "TOKEN",
+	Action:    run,
+}
+
+func run(ctx context.Context, c *cli.Command) error {
+	token := c.Args().First()
+	if token == "" {
+		return fmt.Errorf("the approval token sent through the notifier is required")
+	}
+
+	// 1. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// 2. Approve
+	approval, err := helper.Approve(cfg, token)
+	if err != nil {
+		return err
+	}
+	helper.Infof("Approved: %s (requested by %s); it runs on its next attempt", approval.Summary, approval.RequestedBy)
+
+	notifier := helper.NewNotifier(cfg)
+	message := fmt.Sprintf("✅ %s approved by %s", approval.Summary, approval.ApprovedBy)
+	if err := notifier.SendJob(approval.Action, message); err != nil {
+		helper.Errorf("failed to send notification: %v", err)
+	}
+	return nil
+}
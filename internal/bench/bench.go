@@ -0,0 +1,297 @@
+package bench
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/mysql"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// Result is the throughput of one benchmarked stage.
+type Result struct {
+	Stage    string
+	Bytes    int64         // Input bytes processed
+	Output   int64         // Output bytes, for compression stages
+	Duration time.Duration // Wall time of the stage
+}
+
+// Throughput returns the input throughput in MiB/s.
+func (r Result) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / float64(1<<20) / r.Duration.Seconds()
+}
+
+// Ratio returns the compressed size relative to the input.
+func (r Result) Ratio() float64 {
+	if r.Bytes == 0 || r.Output == 0 {
+		return 1
+	}
+	return float64(r.Output) / float64(r.Bytes)
+}
+
+// codec is an in-process compressor benchmarked against the sample data.
+type codec struct {
+	name   string
+	family string // mysql.compression value the codec stands for
+	writer func(w io.Writer) (io.WriteCloser, error)
+}
+
+var codecs = []codec{
+	{"zstd fastest", "zstd", zstdWriter(zstd.SpeedFastest)},
+	{"zstd default", "zstd", zstdWriter(zstd.SpeedDefault)},
+	{"zstd better", "zstd", zstdWriter(zstd.SpeedBetterCompression)},
+	{"gzip 1", "gzip", gzipWriter(gzip.BestSpeed)},
+	{"gzip 6", "gzip", gzipWriter(gzip.DefaultCompression)},
+	{"gzip 9", "gzip", gzipWriter(gzip.BestCompression)},
+}
+
+func zstdWriter(level zstd.EncoderLevel) func(io.Writer) (io.WriteCloser, error) {
+	return func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1))
+	}
+}
+
+func gzipWriter(level int) func(io.Writer) (io.WriteCloser, error) {
+	return func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, level)
+	}
+}
+
+// Bench measures the throughput of the backup stages on the current host.
+type Bench struct {
+	cfg   *config.Config
+	store helper.Storage // Nil skips the upload stage
+	size  int64
+}
+
+// NewBench creates a new benchmark over size bytes of sample data.
+func NewBench(cfg *config.Config, store helper.Storage, size int64) *Bench {
+	return &Bench{cfg: cfg, store: store, size: size}
+}
+
+// Report holds the results of a benchmark run.
+type Report struct {
+	Compression []Result
+	Zip         Result
+	Hash        Result
+	Upload      *Result
+	Dump        *Result
+}
+
+// Run executes the benchmark. When database is set, a real dump of it is
+// measured as well.
+func (b *Bench) Run(ctx context.Context, database string) (*Report, error) {
+	workDir, err := os.MkdirTemp(b.cfg.Backup.TempDir, "bench_")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create work dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	samplePath := filepath.Join(workDir, "sample.tsv")
+	if err := writeSample(samplePath, b.size); err != nil {
+		return nil, fmt.Errorf("failed to generate sample data: %w", err)
+	}
+
+	report := &Report{}
+
+	// 1. Dump
+	if database != "" {
+		res, err := b.dump(ctx, database, filepath.Join(workDir, "dump"))
+		if err != nil {
+			return nil, err
+		}
+		report.Dump = &res
+	}
+
+	// 2. Compression codecs
+	for _, c := range codecs {
+		res, err := compress(samplePath, c)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.name, err)
+		}
+		report.Compression = append(report.Compression, res)
+	}
+
+	// 3. Zip stage, as run by the pipeline
+	zipPath := filepath.Join(workDir, "sample.zip")
+	start := time.Now()
+	if err := helper.ZipEncrypt(ctx, b.cfg.Backup.Priority, b.cfg.Encryption.Password, samplePath, zipPath); err != nil {
+		return nil, err
+	}
+	report.Zip = Result{Stage: "zip", Bytes: b.size, Output: fileSize(zipPath), Duration: time.Since(start)}
+
+	// 4. Hashing from disk
+	start = time.Now()
+	if _, _, err := helper.CalculateSHA256(ctx, zipPath, 0); err != nil {
+		return nil, err
+	}
+	report.Hash = Result{Stage: "sha256", Bytes: report.Zip.Output, Duration: time.Since(start)}
+
+	// 5. Upload
+	if b.store != nil {
+		res, err := b.upload(ctx, zipPath)
+		if err != nil {
+			return nil, err
+		}
+		report.Upload = &res
+	}
+
+	return report, nil
+}
+
+func (b *Bench) dump(ctx context.Context, database, dir string) (Result, error) {
+	worker := mysql.NewWorker(b.cfg, b.store, nil, helper.Options{OnlyDump: true})
+	start := time.Now()
+	if err := worker.Dump(ctx, database, dir); err != nil {
+		return Result{}, err
+	}
+	return Result{Stage: "dump " + database, Bytes: dirSize(dir), Duration: time.Since(start)}, nil
+}
+
+func (b *Bench) upload(ctx context.Context, path string) (Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Result{}, err
+	}
+	defer file.Close()
+
+	now := time.Now()
+	key := b.store.ObjectKey("bench", now, fmt.Sprintf("bench_%s.tmp", now.Format(helper.TimestampLayout)))
+	start := time.Now()
+	uploaded, err := helper.UploadHashed(ctx, b.store, key, file)
+	if err != nil {
+		return Result{}, err
+	}
+	res := Result{Stage: "upload", Bytes: uploaded.Size, Duration: time.Since(start)}
+
+	if err := b.store.Delete(ctx, key); err != nil {
+		helper.Warnf("failed to remove benchmark object %s: %v", key, err)
+	}
+	return res, nil
+}
+
+func compress(path string, c codec) (Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Result{}, err
+	}
+	defer file.Close()
+
+	counter := &countingWriter{}
+	start := time.Now()
+	w, err := c.writer(counter)
+	if err != nil {
+		return Result{}, err
+	}
+	n, err := io.Copy(w, file)
+	if err != nil {
+		return Result{}, err
+	}
+	if err := w.Close(); err != nil {
+		return Result{}, err
+	}
+	return Result{Stage: c.name, Bytes: n, Output: counter.n, Duration: time.Since(start)}, nil
+}
+
+// Recommend derives config suggestions from the report.
+func (r *Report) Recommend() []string {
+	var recs []string
+
+	// Pick the codec with the best end-to-end rate: compression and upload
+	// run back to back, so a better ratio pays off on slow links
+	best, bestRate := "", 0.0
+	for i, res := range r.Compression {
+		rate := res.Throughput()
+		if r.Upload != nil {
+			rate = 1 / (1/rate + res.Ratio()/r.Upload.Throughput())
+		}
+		if rate > bestRate {
+			best, bestRate = codecs[i].family, rate
+		}
+	}
+	if best != "" {
+		recs = append(recs, fmt.Sprintf("mysql.compression: %s (~%.0f MiB/s end to end)", best, bestRate))
+	}
+
+	cpus := runtime.NumCPU()
+	threads := cpus
+	if threads > 16 {
+		threads = 16
+	}
+	recs = append(recs, fmt.Sprintf("mysql.threads: %d (%d CPUs)", threads, cpus))
+	if cpus <= 2 {
+		recs = append(recs, "mysql.priority / backup.priority: nice 10 with ionice_class idle to keep a small host responsive")
+	}
+
+	if r.Upload != nil && r.Hash.Throughput() > 2*r.Upload.Throughput() {
+		recs = append(recs, fmt.Sprintf("backup.io_limit_mb: %d (uploads are the bottleneck; capping reads frees disk IO at no cost)", int(r.Upload.Throughput())+1))
+	}
+	if r.Upload != nil && r.Zip.Throughput() < r.Upload.Throughput() {
+		recs = append(recs, "backup.priority.cpus: leave unset (zip is slower than upload and needs the CPU)")
+	}
+	return recs
+}
+
+// writeSample generates dump-like TSV rows, roughly as compressible as real table data.
+func writeSample(path string, size int64) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel", "india", "juliet"}
+	var written int64
+	for id := 1; written < size; id++ {
+		line := fmt.Sprintf("%d\t%s_%s\tuser%d@example.com\t%d.%02d\t2024-%02d-%02d %02d:%02d:%02d\t%x\n",
+			id, words[rng.Intn(len(words))], words[rng.Intn(len(words))], rng.Intn(1000000),
+			rng.Intn(100000), rng.Intn(100), rng.Intn(12)+1, rng.Intn(28)+1,
+			rng.Intn(24), rng.Intn(60), rng.Intn(60), rng.Uint64())
+		n, err := file.WriteString(line)
+		if err != nil {
+			return err
+		}
+		written += int64(n)
+	}
+	return file.Close()
+}
+
+type countingWriter struct{ n int64 }
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			size += fileSize(path)
+		}
+		return nil
+	})
+	return size
+}
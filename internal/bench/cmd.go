@@ -0,0 +1,124 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var Command = &cli.Command{
+	Name:  "bench",
+	Usage: "Measure dump, compression, hashing and upload throughput and recommend settings",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "size",
+			Value: 256,
+			Usage: "Size of the generated sample data in MiB",
+		},
+		&cli.StringFlag{
+			Name:  "database",
+			Usage: "Also measure a real dump of this database",
+		},
+		&cli.BoolFlag{
+			Name:  "skip-upload",
+			Usage: "Do not measure upload throughput",
+		},
+	},
+	Action: run,
+}
+
+func run(ctx context.Context, c *cli.Command) error {
+	// 1. Check required tools
+	if err := helper.CheckTools("zip"); err != nil {
+		return err
+	}
+
+	// 2. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// 3. Initialize storage
+	var store helper.Storage
+	if !c.Bool("skip-upload") && !c.Bool("only-dump") {
+		store, err = helper.NewStorage(cfg, helper.OptionsFrom(ctx))
+		if err != nil {
+			return fmt.Errorf("failed to initialize storage: %w", err)
+		}
+	}
+
+	// 4. Run the benchmark
+	report, err := NewBench(cfg, store, int64(c.Int("size"))<<20).Run(ctx, c.String("database"))
+	if err != nil {
+		return err
+	}
+	if helper.OptionsFrom(ctx).JSON {
+		return helper.PrintJSON(report.summary())
+	}
+	printReport(report)
+	return nil
+}
+
+// stageJSON is a benchmark stage as printed with --output json.
+type stageJSON struct {
+	Stage      string   `json:"stage"`
+	Throughput float64  `json:"mib_per_s"`
+	Ratio      *float64 `json:"ratio,omitempty"`
+}
+
+// summary returns the report as printed with --output json.
+func (r *Report) summary() interface{} {
+	var stages []stageJSON
+	row := func(res Result, ratio bool) {
+		stage := stageJSON{Stage: res.Stage, Throughput: res.Throughput()}
+		if ratio {
+			value := res.Ratio()
+			stage.Ratio = &value
+		}
+		stages = append(stages, stage)
+	}
+	if r.Dump != nil {
+		row(*r.Dump, false)
+	}
+	for _, res := range r.Compression {
+		row(res, true)
+	}
+	row(r.Zip, true)
+	row(r.Hash, false)
+	if r.Upload != nil {
+		row(*r.Upload, false)
+	}
+	return map[string]interface{}{"stages": stages, "recommended": r.Recommend()}
+}
+
+func printReport(r *Report) {
+	fmt.Printf("%-16s  %10s  %8s\n", "STAGE", "MiB/s", "RATIO")
+	row := func(res Result, ratio bool) {
+		if ratio {
+			fmt.Printf("%-16s  %10.1f  %8.3f\n", res.Stage, res.Throughput(), res.Ratio())
+		} else {
+			fmt.Printf("%-16s  %10.1f  %8s\n", res.Stage, res.Throughput(), "-")
+		}
+	}
+	if r.Dump != nil {
+		row(*r.Dump, false)
+	}
+	for _, res := range r.Compression {
+		row(res, true)
+	}
+	row(r.Zip, true)
+	row(r.Hash, false)
+	if r.Upload != nil {
+		row(*r.Upload, false)
+	}
+
+	fmt.Println("\nRecommended settings:")
+	for _, rec := range r.Recommend() {
+		fmt.Printf("  %s\n", rec)
+	}
+}
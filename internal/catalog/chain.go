@@ -0,0 +1,95 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var ChainCommand = &cli.Command{
+	Name:  "chain",
+	Usage: "Show the chain of backups (full, incremental, binlog) needed to restore a database to a point in time",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "database",
+			Usage:    "Database (or other backup name) to restore",
+			Required: true,
+		},
+		&cli.TimestampFlag{
+			Name:   "at",
+			Usage:  "Point in time to restore to (default: now)",
+			Config: cli.TimestampConfig{Layouts: []string{time.RFC3339, time.DateTime, time.DateOnly}},
+		},
+	},
+	Action: chain,
+}
+
+func chain(ctx context.Context, c *cli.Command) error {
+	at := c.Timestamp("at")
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	// 1. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// 2. Initialize storage
+	store, err := helper.NewStorage(cfg, helper.OptionsFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	// 3. Resolve the chain of the latest backup at that time
+	key, err := Latest(ctx, store, c.String("database"), at)
+	if err != nil {
+		return err
+	}
+	links, err := helper.ResolveChain(ctx, store, key)
+	if err != nil {
+		return err
+	}
+
+	if helper.OptionsFrom(ctx).JSON {
+		return helper.PrintJSON(map[string]interface{}{"database": c.String("database"), "at": at, "chain": links})
+	}
+	for _, link := range links {
+		created, _ := helper.ArtifactTime(link.Key)
+		fmt.Printf("%s  %-11s  %s\n", created.Format(time.RFC3339), link.Kind(), link.Key)
+	}
+	fmt.Printf("\n%d backups needed to restore %s as of %s\n", len(links), c.String("database"), at.Format(time.RFC3339))
+	return nil
+}
+
+// Latest returns the key of the newest artifact of name created at or before at.
+func Latest(ctx context.Context, store helper.Storage, name string, at time.Time) (string, error) {
+	objects, err := store.List(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var latest string
+	var latestTime time.Time
+	for _, object := range objects {
+		if !helper.IsArtifactKey(object.Key) || strings.HasSuffix(object.Key, helper.ManifestSuffix) || helper.ArtifactName(object.Key) != name {
+			continue
+		}
+		created, ok := helper.ArtifactTime(object.Key)
+		if !ok || created.After(at) || created.Before(latestTime) {
+			continue
+		}
+		latest, latestTime = object.Key, created
+	}
+	if latest == "" {
+		return "", fmt.Errorf("no backup of %s found at or before %s", name, at.Format(time.RFC3339))
+	}
+	return latest, nil
+}
@@ -0,0 +1,59 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var Command = &cli.Command{
+	Name:  "find",
+	Usage: "Search stored backup manifests for a schema or table",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "table",
+			Usage: "Table to look for, optionally qualified as `SCHEMA.TABLE`",
+		},
+		&cli.StringFlag{
+			Name:  "schema",
+			Usage: "Schema to look for",
+		},
+	},
+	Action: run,
+}
+
+func run(ctx context.Context, c *cli.Command) error {
+	table, schema := c.String("table"), c.String("schema")
+	if table == "" && schema == "" {
+		return fmt.Errorf("either --table or --schema is required")
+	}
+
+	// 1. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// 2. Initialize storage
+	store, err := helper.NewStorage(cfg, helper.OptionsFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	// 3. Scan manifests
+	matches, err := Find(ctx, store, func(m *helper.Manifest) bool {
+		if table != "" && !m.HasTable(table) {
+			return false
+		}
+		return schema == "" || m.HasSchema(schema)
+	})
+	if err != nil {
+		return err
+	}
+
+	return printMatches(matches, helper.OptionsFrom(ctx).JSON)
+}
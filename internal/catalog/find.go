@@ -0,0 +1,74 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// Match is an artifact whose manifest satisfied a search.
+type Match struct {
+	Key      string           `json:"key"`
+	Manifest *helper.Manifest `json:"manifest"`
+}
+
+// Find scans all stored manifests and returns the artifacts accepted by filter,
+// ordered by creation time.
+func Find(ctx context.Context, store helper.Storage, filter func(*helper.Manifest) bool) ([]Match, error) {
+	objects, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []Match
+	for _, object := range objects {
+		if !strings.HasSuffix(object.Key, helper.ManifestSuffix) {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := store.Download(ctx, object.Key, &buf); err != nil {
+			helper.Warnf("skipping manifest %s: %v", object.Key, err)
+			continue
+		}
+		manifest, err := helper.ParseManifest(buf.Bytes())
+		if err != nil {
+			helper.Warnf("skipping manifest %s: %v", object.Key, err)
+			continue
+		}
+
+		if filter(manifest) {
+			matches = append(matches, Match{
+				Key:      strings.TrimSuffix(object.Key, helper.ManifestSuffix),
+				Manifest: manifest,
+			})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Manifest.CreatedAt.Before(matches[j].Manifest.CreatedAt)
+	})
+	return matches, nil
+}
+
+func printMatches(matches []Match, asJSON bool) error {
+	if asJSON {
+		return helper.PrintJSON(append([]Match{}, matches...))
+	}
+	if len(matches) == 0 {
+		fmt.Println("No backups found.")
+		return nil
+	}
+
+	for _, m := range matches {
+		fmt.Printf("%s  %-10s  %s\n", m.Manifest.CreatedAt.Format(time.RFC3339), helper.HumanizeSize(m.Manifest.Size), m.Key)
+	}
+	first, last := matches[0].Manifest.CreatedAt, matches[len(matches)-1].Manifest.CreatedAt
+	fmt.Printf("\n%d backups from %s to %s\n", len(matches), first.Format(time.RFC3339), last.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,60 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// storeManifest stores the manifest of an artifact of name listing schemas.
+func storeManifest(t *testing.T, store helper.Storage, name string, created time.Time, schemas map[string][]string) string {
+	t.Helper()
+	key := store.ObjectKey("mysql", created, helper.ArtifactFilename(name, created, helper.NewRunID(), ""))
+	data, err := (&helper.Manifest{Artifact: key, Source: "mysql", CreatedAt: created, Schemas: schemas}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Upload(context.Background(), helper.ManifestKey(key), bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestFindDottedNames(t *testing.T) {
+	store := helper.NewMemoryStorage("")
+	created := time.Date(2025, 3, 4, 5, 6, 7, 0, time.Local)
+	shop := storeManifest(t, store, "shop", created, map[string][]string{"shop": {"orders"}})
+	eu := storeManifest(t, store, "shop.eu", created.Add(time.Hour), map[string][]string{"shop.eu": {"orders", "v1.items"}})
+
+	for table, want := range map[string][]string{
+		"orders":           {shop, eu},
+		"shop.orders":      {shop},
+		"shop.eu.orders":   {eu},
+		"shop.eu.v1.items": {eu},
+		"eu.orders":        nil,
+	} {
+		matches, err := Find(context.Background(), store, func(m *helper.Manifest) bool { return m.HasTable(table) })
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, match := range matches {
+			got = append(got, match.Key)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("Find(%q) = %v, want %v", table, got, want)
+		}
+	}
+
+	matches, err := Find(context.Background(), store, func(m *helper.Manifest) bool { return m.HasSchema("shop.eu") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || helper.ArtifactName(matches[0].Key) != "shop.eu" {
+		t.Errorf("Find(schema shop.eu) = %v, want the artifact of shop.eu", matches)
+	}
+}
@@ -0,0 +1,159 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var MergeCommand = &cli.Command{
+	Name:  "merge",
+	Usage: "Combine the latest full backup of a database and its incrementals into a new synthetic full backup",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "database",
+			Usage:    "Database (or other backup name) whose chain to merge",
+			Required: true,
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Only show the backups that would be merged",
+		},
+	},
+	Action: merge,
+}
+
+func merge(ctx context.Context, c *cli.Command) error {
+	name := c.String("database")
+	if c.Bool("only-dump") {
+		return fmt.Errorf("backups are merged in remote storage, not with --only-dump")
+	}
+
+	// 1. Check required tools
+	if err := helper.CheckTools("zip", "unzip"); err != nil {
+		return err
+	}
+
+	// 2. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// 3. File locking
+	unlock, err := helper.AcquireLock(cfg.LockFile)
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+	defer unlock()
+
+	// 4. Initialize storage
+	notifier := helper.NewNotifier(cfg)
+	store, err := helper.NewStorage(cfg, helper.OptionsFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	// 5. Resolve the chain to merge
+	key, err := Latest(ctx, store, name, time.Now())
+	if err != nil {
+		return err
+	}
+	links, err := helper.ResolveChain(ctx, store, key)
+	if err != nil {
+		return err
+	}
+	links = Mergeable(links)
+	if len(links) < 2 {
+		helper.Infof("Nothing to merge: the chain of %s starts with %s and has no incremental backups to fold in", name, links[0].Key)
+		return nil
+	}
+	if helper.OptionsFrom(ctx).JSON {
+		if err := helper.PrintJSON(map[string]interface{}{"database": name, "dry_run": c.Bool("dry-run"), "chain": links}); err != nil {
+			return err
+		}
+		if c.Bool("dry-run") {
+			return nil
+		}
+	} else {
+		for _, link := range links {
+			fmt.Printf("%-11s  %s\n", link.Kind(), link.Key)
+		}
+		if c.Bool("dry-run") {
+			fmt.Printf("\n%d backups would be merged into a synthetic full backup of %s\n", len(links), name)
+			return nil
+		}
+	}
+
+	// 6. Merge and ship the synthetic full backup
+	pipeline := helper.NewPipeline(cfg, store, helper.OptionsFrom(ctx))
+	stop := pipeline.Start()
+	defer stop()
+	start := time.Now()
+	result := Merge(ctx, cfg, store, pipeline, name, links)
+	result.Duration = time.Since(start)
+	successCount, failCount := 1, 0
+	if !result.Success {
+		successCount, failCount = 0, 1
+	}
+	pipeline.Report(notifier, "merge", []helper.BackupResult{result}, successCount, failCount)
+	if !result.Success {
+		return fmt.Errorf("merge failed: %v", result.Error)
+	}
+	return nil
+}
+
+// Mergeable returns the part of a chain that can be merged: its full backup
+// followed by the incrementals up to the first binlog artifact, which is
+// replayed rather than unpacked and so stays on top of the merged backup.
+func Mergeable(links []helper.ChainLink) []helper.ChainLink {
+	for i, link := range links {
+		if i > 0 && link.Kind() != helper.ChainIncremental {
+			return links[:i]
+		}
+	}
+	return links
+}
+
+// Merge unpacks a full backup and then its incrementals on top of it, newer
+// files replacing older ones, and ships the result as a full backup of name
+// created at the time of the last incremental. The merged backups are left
+// to retention.
+func Merge(ctx context.Context, cfg *config.Config, store helper.Storage, pipeline *helper.Pipeline, name string, links []helper.ChainLink) helper.BackupResult {
+	workDir := filepath.Join(cfg.Backup.TempDir, fmt.Sprintf("merge_%d", time.Now().UnixNano()))
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return helper.BackupResult{Database: name, Success: false, Error: fmt.Errorf("failed to create work dir: %w", err)}
+	}
+	defer os.RemoveAll(workDir)
+
+	contentDir := filepath.Join(workDir, "content")
+	for i, link := range links {
+		helper.Infof("[%d/%d] Unpacking %s backup %s", i+1, len(links), link.Kind(), link.Key)
+		zipPath := filepath.Join(workDir, fmt.Sprintf("%d.zip", i))
+		if err := helper.DownloadFile(ctx, store, link.Key, zipPath); err != nil {
+			return helper.BackupResult{Database: name, Success: false, Error: err}
+		}
+		password, err := helper.ArtifactPassword(ctx, cfg, link.Manifest)
+		if err != nil {
+			return helper.BackupResult{Database: name, Success: false, Error: err}
+		}
+		if err := helper.Unzip(ctx, password, zipPath, contentDir); err != nil {
+			return helper.BackupResult{Database: name, Success: false, Error: fmt.Errorf("failed to unpack %s: %w", link.Key, err)}
+		}
+		os.Remove(zipPath)
+	}
+
+	created, ok := helper.ArtifactTime(links[len(links)-1].Key)
+	if !ok {
+		created = time.Now()
+	}
+	helper.Infof("Shipping synthetic full backup of %s as of %s", name, created.Format(time.RFC3339))
+	return pipeline.Ship(ctx, name, contentDir, created, false)
+}
@@ -0,0 +1,195 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// missingReason is the error recorded for ghost entries fixed by reconcile.
+const missingReason = "artifact missing from storage (found by reconcile)"
+
+var ReconcileCommand = &cli.Command{
+	Name:  "reconcile",
+	Usage: "Cross-check the backup history against the stored artifacts, reporting orphans and ghosts",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "fix",
+			Usage: "Record orphans in the history and mark ghosts as failed",
+		},
+	},
+	Action: reconcile,
+}
+
+// Reconciliation is the outcome of comparing the history with the storage.
+type Reconciliation struct {
+	Orphans []helper.ObjectInfo   `json:"orphans"` // Artifacts stored without a history entry
+	Ghosts  []helper.HistoryEntry `json:"ghosts"`  // Successful entries whose artifact is missing
+	Pruned  int                   `json:"pruned"`  // Missing artifacts past their retention period, deleted by retention
+	Matched int                   `json:"matched"` // Artifacts both stored and in the history
+}
+
+func reconcile(ctx context.Context, c *cli.Command) error {
+	// 1. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	history := helper.NewHistoryRecorder(cfg)
+	if history == nil {
+		return fmt.Errorf("history.backend is not set")
+	}
+
+	// 2. Initialize storage
+	store, err := helper.NewStorage(cfg, helper.OptionsFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	// 3. Compare the history with the stored artifacts
+	result, err := Reconcile(ctx, cfg, store, history)
+	if err != nil {
+		return err
+	}
+	if err := printReconciliation(result, helper.OptionsFrom(ctx).JSON); err != nil {
+		return err
+	}
+
+	// 4. Fix the history
+	if !c.Bool("fix") {
+		if len(result.Ghosts) > 0 {
+			return fmt.Errorf("%d backups in the history are missing from storage; run with --fix to mark them as failed", len(result.Ghosts))
+		}
+		return nil
+	}
+	if err := fixHistory(ctx, store, history, result); err != nil {
+		return err
+	}
+	helper.Infof("History fixed: recorded %d orphans, marked %d ghosts as failed", len(result.Orphans), len(result.Ghosts))
+	return nil
+}
+
+// Reconcile compares the artifacts listed in the history with those in
+// storage. Entries are matched by artifact file name, so the layout of keys
+// does not matter. Missing artifacts past their retention period were deleted
+// by retention and are not ghosts.
+func Reconcile(ctx context.Context, cfg *config.Config, store helper.Storage, history helper.HistoryRecorder) (*Reconciliation, error) {
+	entries, err := history.Entries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	objects, err := store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	result := &Reconciliation{}
+	logged := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		logged[e.Artifact] = true
+	}
+	stored := make(map[string]bool)
+	for _, object := range objects {
+		if !helper.IsArtifactKey(object.Key) || strings.HasSuffix(object.Key, helper.ManifestSuffix) {
+			continue
+		}
+		filename := path.Base(object.Key)
+		stored[filename] = true
+		if logged[filename] {
+			result.Matched++
+		} else {
+			result.Orphans = append(result.Orphans, object)
+		}
+	}
+
+	now := time.Now()
+	retention := helper.ProfileRetention(cfg)
+	for _, e := range entries {
+		if !e.Success || stored[e.Artifact] {
+			continue
+		}
+		if pastRetention(retention, e, now) {
+			result.Pruned++
+			continue
+		}
+		result.Ghosts = append(result.Ghosts, e)
+	}
+
+	sort.Slice(result.Orphans, func(i, j int) bool {
+		return result.Orphans[i].Key < result.Orphans[j].Key
+	})
+	return result, nil
+}
+
+// pastRetention reports whether a history entry is older than the retention
+// period of its profile, so its artifact was deleted by retention.
+func pastRetention(retention helper.RetentionFunc, e helper.HistoryEntry, now time.Time) bool {
+	hours := retention(e.Artifact)
+	return hours > 0 && e.FinishedAt.Before(now.Add(-time.Duration(hours)*time.Hour))
+}
+
+// fixHistory records the orphans in the history, described by their
+// manifests when stored, and marks the ghosts as failed.
+func fixHistory(ctx context.Context, store helper.Storage, history helper.HistoryRecorder, result *Reconciliation) error {
+	entries := make([]helper.HistoryEntry, 0, len(result.Orphans))
+	for _, object := range result.Orphans {
+		entry := helper.HistoryEntry{
+			Job:        "reconcile",
+			Name:       helper.ArtifactName(object.Key),
+			RunID:      helper.ArtifactRunID(object.Key),
+			Artifact:   path.Base(object.Key),
+			Success:    true,
+			Size:       object.Size,
+			FinishedAt: object.LastModified,
+		}
+		if manifest, err := helper.LoadManifest(ctx, store, object.Key); err == nil {
+			entry.SHA256 = manifest.SHA256
+			entry.FinishedAt = manifest.CreatedAt
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) > 0 {
+		if err := history.Record(ctx, entries); err != nil {
+			return fmt.Errorf("failed to record orphans: %w", err)
+		}
+	}
+
+	ids := make([]int64, len(result.Ghosts))
+	for i, e := range result.Ghosts {
+		ids[i] = e.ID
+	}
+	if err := history.MarkMissing(ctx, ids, missingReason); err != nil {
+		return fmt.Errorf("failed to mark ghosts: %w", err)
+	}
+	return nil
+}
+
+func printReconciliation(result *Reconciliation, asJSON bool) error {
+	if asJSON {
+		return helper.PrintJSON(result)
+	}
+	if len(result.Orphans) > 0 {
+		fmt.Println("Orphans (stored, not in the history):")
+		for _, object := range result.Orphans {
+			fmt.Printf("  %s  %-10s  %s\n", object.LastModified.Format(time.RFC3339), helper.HumanizeSize(object.Size), object.Key)
+		}
+		fmt.Println()
+	}
+	if len(result.Ghosts) > 0 {
+		fmt.Println("Ghosts (in the history, missing from storage):")
+		for _, e := range result.Ghosts {
+			fmt.Printf("  %s  %-10s  %s (%s, run %s)\n", e.FinishedAt.Format(time.RFC3339), helper.HumanizeSize(e.Size), e.Artifact, e.Job, e.RunID)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("%d matched, %d orphans, %d ghosts, %d deleted by retention\n", result.Matched, len(result.Orphans), len(result.Ghosts), result.Pruned)
+	return nil
+}
@@ -0,0 +1,285 @@
+package catalog
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var RepairCommand = &cli.Command{
+	Name:  "repair-remote",
+	Usage: "Re-upload artifacts missing from storage, or failing checksum verification, from the local cache and upload queue",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "verify",
+			Usage: "Download the stored artifacts that have a local copy and compare their checksums, instead of only their sizes",
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Only list the artifacts that would be re-uploaded",
+		},
+	},
+	Action: repair,
+}
+
+// localCopy is an artifact kept on local disk, in the cache or the upload
+// queue, with what the history or its manifest says it should be.
+type localCopy struct {
+	path   string
+	key    string // Object key, known for queued artifacts
+	sha256 string // Expected checksum; empty when unknown
+	size   int64  // Expected size; zero when unknown
+}
+
+// Repair is the outcome of a repair run.
+type Repair struct {
+	Missing []string `json:"missing"` // Keys re-uploaded because they were missing from storage
+	Corrupt []string `json:"corrupt"` // Keys replaced because they failed size or checksum verification
+	Lost    []string `json:"lost"`    // Artifacts in the history, missing from storage without a local copy
+	Failed  int      `json:"failed"`  // Artifacts whose local copy was unusable or could not be uploaded
+}
+
+func repair(ctx context.Context, c *cli.Command) error {
+	// 1. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.Cache.Dir == "" && cfg.Backup.SpoolDir == "" {
+		return fmt.Errorf("neither cache.dir nor backup.spool_dir is configured, so there are no local copies to repair from")
+	}
+
+	// 2. File locking
+	unlock, err := helper.AcquireLock(cfg.LockFile)
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+	defer unlock()
+
+	// 3. Initialize storage
+	store, err := helper.NewStorage(cfg, helper.OptionsFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	// 4. Re-upload the missing and corrupt artifacts
+	result, err := RepairRemote(ctx, cfg, store, c.Bool("verify"), c.Bool("dry-run"))
+	if err != nil {
+		return err
+	}
+	verb := "Re-uploaded"
+	if c.Bool("dry-run") {
+		verb = "Would re-upload"
+	}
+	helper.Infof("%s %d missing and %d corrupt artifacts; %d lost without a local copy, %d failed",
+		verb, len(result.Missing), len(result.Corrupt), len(result.Lost), result.Failed)
+	if helper.OptionsFrom(ctx).JSON {
+		if err := helper.PrintJSON(map[string]interface{}{"dry_run": c.Bool("dry-run"), "repair": result}); err != nil {
+			return err
+		}
+	} else {
+		for _, name := range result.Lost {
+			fmt.Printf("Lost: %s\n", name)
+		}
+	}
+	if len(result.Lost) > 0 || result.Failed > 0 {
+		return fmt.Errorf("storage could not be fully repaired")
+	}
+	return nil
+}
+
+// RepairRemote re-uploads the artifacts of the local cache and upload queue
+// that are missing from storage, or whose stored copy differs in size from
+// the history or manifest (or in checksum, with verify). Local copies are
+// checked against the expected checksum first, so a corrupt copy is never
+// uploaded. Successful history entries within retention that are missing
+// without a local copy are reported as lost.
+func RepairRemote(ctx context.Context, cfg *config.Config, store helper.Storage, verify, dryRun bool) (*Repair, error) {
+	var entries []helper.HistoryEntry
+	if history := helper.NewHistoryRecorder(cfg); history != nil {
+		var err error
+		if entries, err = history.Entries(ctx); err != nil {
+			return nil, fmt.Errorf("failed to read history: %w", err)
+		}
+	}
+	copies, err := localCopies(cfg, entries)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	stored := make(map[string]helper.ObjectInfo)
+	for _, object := range objects {
+		if helper.IsArtifactKey(object.Key) && !strings.HasSuffix(object.Key, helper.ManifestSuffix) {
+			stored[path.Base(object.Key)] = object
+		}
+	}
+
+	result := &Repair{}
+	names := make([]string, 0, len(copies))
+	for name := range copies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		cp := copies[name]
+		object, exists := stored[name]
+		key := object.Key
+		if !exists {
+			key = cp.key
+			if key == "" {
+				ts, _ := helper.ArtifactTime(name)
+				key = store.ObjectKey(helper.ArtifactName(name), ts, name)
+			}
+		} else if !damaged(ctx, store, object, cp, verify) {
+			continue
+		}
+
+		if dryRun {
+			if !helper.OptionsFrom(ctx).JSON {
+				state := "missing"
+				if exists {
+					state = "corrupt"
+				}
+				fmt.Printf("%-8s %-10s %s (from %s)\n", state, helper.HumanizeSize(object.Size), key, cp.path)
+			}
+		} else if err := reupload(ctx, cfg, store, key, cp, exists); err != nil {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			helper.Errorf("failed to repair %s: %v", key, err)
+			result.Failed++
+			continue
+		}
+		if exists {
+			result.Corrupt = append(result.Corrupt, key)
+		} else {
+			result.Missing = append(result.Missing, key)
+		}
+	}
+
+	now := time.Now()
+	retention := helper.ProfileRetention(cfg)
+	for _, e := range entries {
+		if e.Success && copies[e.Artifact] == nil && !pastRetention(retention, e, now) {
+			if _, ok := stored[e.Artifact]; !ok {
+				result.Lost = append(result.Lost, e.Artifact)
+			}
+		}
+	}
+	return result, nil
+}
+
+// localCopies collects the artifacts of the cache and the upload queue by
+// file name, with their expected checksum and size from the history, or
+// else from their manifests.
+func localCopies(cfg *config.Config, entries []helper.HistoryEntry) (map[string]*localCopy, error) {
+	copies := make(map[string]*localCopy)
+	if cache := helper.NewCache(cfg.Cache); cache != nil {
+		paths, err := cache.Artifacts()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cache: %w", err)
+		}
+		for _, p := range paths {
+			copies[filepath.Base(p)] = &localCopy{path: p}
+		}
+	}
+	if cfg.Backup.SpoolDir != "" {
+		spool := helper.NewSpool(cfg.Backup.SpoolDir, cfg.Backup.UploadChunkBytes())
+		queued, err := spool.Entries()
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range queued {
+			copies[entry.File] = &localCopy{path: spool.Path(entry), key: entry.Key}
+		}
+	}
+
+	for _, e := range entries {
+		if cp := copies[e.Artifact]; cp != nil && e.Success && e.SHA256 != "" {
+			cp.sha256, cp.size = e.SHA256, e.Size
+		}
+	}
+	for _, cp := range copies {
+		if cp.sha256 != "" {
+			continue
+		}
+		if manifest, err := helper.ReadManifestFile(cp.path); err == nil && manifest != nil {
+			cp.sha256, cp.size = manifest.SHA256, manifest.Size
+		}
+	}
+	return copies, nil
+}
+
+// damaged reports whether a stored artifact differs from what its local copy
+// should be: in size, or with verify in checksum. Unknown expectations pass.
+func damaged(ctx context.Context, store helper.Storage, object helper.ObjectInfo, cp *localCopy, verify bool) bool {
+	if cp.size > 0 && object.Size != cp.size {
+		return true
+	}
+	if !verify || cp.sha256 == "" {
+		return false
+	}
+	h := sha256.New()
+	if err := store.Download(ctx, object.Key, h); err != nil {
+		helper.Warnf("failed to verify %s: %v", object.Key, err)
+		return false
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)) != cp.sha256
+}
+
+// reupload checks a local copy against its expected checksum and uploads it
+// to key, replacing the stored copy when it exists. Its manifest is uploaded
+// too when storage lacks it.
+func reupload(ctx context.Context, cfg *config.Config, store helper.Storage, key string, cp *localCopy, replace bool) error {
+	if cp.sha256 != "" {
+		hash, _, err := helper.CalculateSHA256(ctx, cp.path, cfg.Backup.IOLimitBytes())
+		if err != nil {
+			return fmt.Errorf("failed to hash local copy: %w", err)
+		}
+		if hash != cp.sha256 {
+			return fmt.Errorf("local copy %s is corrupt too (SHA256 %s, expected %s)", cp.path, hash, cp.sha256)
+		}
+	}
+
+	file, err := os.Open(cp.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if replace {
+		err = store.Replace(ctx, key, file)
+	} else {
+		err = store.Upload(ctx, key, file)
+	}
+	if err != nil {
+		return err
+	}
+	helper.Infof("Repaired %s from %s", key, cp.path)
+
+	manifest, err := os.Open(helper.ManifestKey(cp.path))
+	if err != nil {
+		return nil // No local manifest
+	}
+	defer manifest.Close()
+	if exists, err := store.Exists(ctx, helper.ManifestKey(key)); err != nil || exists {
+		return err
+	}
+	return store.Upload(ctx, helper.ManifestKey(key), manifest)
+}
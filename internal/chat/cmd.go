@@ -0,0 +1,70 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var Command = &cli.Command{
+	Name:  "chat",
+	Usage: "Back up self-hosted chat servers (Zulip, Mattermost, Rocket.Chat)",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "Only back up the server with this name",
+		},
+	},
+	Action: run,
+}
+
+func run(ctx context.Context, c *cli.Command) error {
+	// 1. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	servers := cfg.Chat
+	if name := c.String("name"); name != "" {
+		servers = nil
+		for _, server := range cfg.Chat {
+			if server.Name == name {
+				servers = append(servers, server)
+			}
+		}
+	}
+	if len(servers) == 0 {
+		return fmt.Errorf("no matching chat servers configured")
+	}
+
+	// 2. Check required tools
+	tools := []string{"zip"}
+	for _, server := range servers {
+		tools = append(tools, RequiredTools(server)...)
+	}
+	if err := helper.CheckTools(tools...); err != nil {
+		return err
+	}
+
+	// 3. File locking
+	unlock, err := helper.AcquireLock(cfg.LockFile)
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+	defer unlock()
+
+	// 4. Initialize storage
+	notifier := helper.NewNotifier(cfg)
+	store, err := helper.NewStorage(cfg, helper.OptionsFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	// 5. Create and run worker
+	helper.Infof("Starting chat server backup of %d servers", len(servers))
+	return NewWorker(cfg, store, notifier, helper.OptionsFrom(ctx)).Run(ctx, servers)
+}
@@ -0,0 +1,218 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// dataDir holds the configured data directories inside an artifact, under their absolute paths.
+const dataDir = "data"
+
+// Worker backs up self-hosted chat servers.
+type Worker struct {
+	cfg      *config.Config
+	store    helper.Storage
+	notifier *helper.TelegramSender
+	pipeline *helper.Pipeline
+	onlyDump bool
+}
+
+// NewWorker creates a new chat server worker.
+func NewWorker(cfg *config.Config, store helper.Storage, notifier *helper.TelegramSender, opts helper.Options) *Worker {
+	return &Worker{
+		cfg:      cfg,
+		store:    store,
+		notifier: notifier,
+		pipeline: helper.NewPipeline(cfg, store, opts),
+		onlyDump: opts.OnlyDump,
+	}
+}
+
+// RequiredTools returns the external tools needed to back up a server.
+func RequiredTools(server config.ChatServer) []string {
+	switch server.Type {
+	case "zulip":
+		return []string{"su"}
+	case "mattermost":
+		return []string{"pg_dump"}
+	case "rocketchat":
+		return []string{"mongodump"}
+	}
+	return nil
+}
+
+// Run backs up the given servers, each as its own artifact.
+func (w *Worker) Run(ctx context.Context, servers []config.ChatServer) error {
+	if helper.CheckPaused(w.cfg, w.notifier, "chat") {
+		return nil
+	}
+	stop := w.pipeline.Start()
+	defer stop()
+	if err := w.pipeline.SelfTest(ctx, w.notifier, "chat"); err != nil {
+		return err
+	}
+	w.pipeline.FlushSpool(ctx)
+
+	var results []helper.BackupResult
+	successCount, failCount := 0, 0
+	for _, server := range servers {
+		start := time.Now()
+		result := w.backupServer(ctx, server, start)
+		result.Duration = time.Since(start)
+		results = append(results, result)
+		if result.Success {
+			successCount++
+		} else {
+			failCount++
+			helper.Errorf("backup of %s failed: %v", result.Database, result.Error)
+		}
+	}
+
+	w.pipeline.PruneLocal(ctx)
+	w.pipeline.Report(w.notifier, "chat", results, successCount, failCount)
+
+	if failCount > 0 {
+		return fmt.Errorf("chat backup completed with %d failures", failCount)
+	}
+	return nil
+}
+
+func (w *Worker) backupServer(ctx context.Context, server config.ChatServer, start time.Time) helper.BackupResult {
+	name := server.Type + "_" + server.Name
+	stageDir := filepath.Join(w.cfg.Backup.TempDir, fmt.Sprintf("%s_%s", helper.EscapeName(name), start.Format(helper.TimestampLayout)))
+	if err := os.MkdirAll(stageDir, 0700); err != nil {
+		return helper.BackupResult{Database: name, Success: false, Error: fmt.Errorf("failed to create temp dir: %w", err)}
+	}
+	defer os.RemoveAll(stageDir)
+
+	var err error
+	switch server.Type {
+	case "zulip":
+		err = dumpZulip(ctx, server, stageDir)
+	case "mattermost":
+		err = dumpMattermost(ctx, server, stageDir)
+	case "rocketchat":
+		err = dumpRocketChat(ctx, server, stageDir)
+	}
+	if err != nil {
+		return helper.BackupResult{Database: name, Success: false, Error: err}
+	}
+
+	for _, dir := range server.DataDirs {
+		helper.Infof("Copying %s", dir)
+		if err := helper.CopyDir(dir, filepath.Join(stageDir, dataDir, dir)); err != nil {
+			return helper.BackupResult{Database: name, Success: false, Error: fmt.Errorf("failed to copy %s: %w", dir, err)}
+		}
+	}
+
+	result := w.pipeline.Ship(ctx, name, stageDir, start, false)
+	result.Database = name
+	return result
+}
+
+// dumpZulip runs `manage.py backup`, which archives the database, uploads and
+// settings into a single tarball restorable with scripts/setup/restore-backup.
+func dumpZulip(ctx context.Context, server config.ChatServer, stageDir string) error {
+	// manage.py refuses to run as root, so the tarball is written to a
+	// directory owned by the Zulip user
+	outDir, err := os.MkdirTemp("", "zulip-backup-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(outDir)
+	if err := chownToUser(outDir, server.User); err != nil {
+		return err
+	}
+
+	output := filepath.Join(outDir, "zulip-backup.tar.gz")
+	helper.Infof("Running %s backup as %s", server.ManagePath, server.User)
+	// The paths are passed as positional parameters, never spliced into the script
+	args := []string{"-s", "/bin/sh", server.User, "-c", `exec "$0" backup --output="$1"`, server.ManagePath, output}
+	if _, err := helper.Run(ctx, helper.Command{Name: "su", Args: args}); err != nil {
+		return fmt.Errorf("zulip backup failed: %w", err)
+	}
+	return os.Rename(output, filepath.Join(stageDir, "zulip-backup.tar.gz"))
+}
+
+// dumpMattermost dumps the Mattermost database and copies its config
+// directory; the file store is included through data_dirs.
+func dumpMattermost(ctx context.Context, server config.ChatServer, stageDir string) error {
+	configDir := filepath.Join(server.InstallDir, "config")
+	databaseURL := server.DatabaseURL
+	if databaseURL == "" {
+		var err error
+		if databaseURL, err = mattermostDataSource(filepath.Join(configDir, "config.json")); err != nil {
+			return err
+		}
+	}
+	if !strings.HasPrefix(databaseURL, "postgres://") && !strings.HasPrefix(databaseURL, "postgresql://") {
+		return fmt.Errorf("unsupported mattermost database %q, only PostgreSQL is supported", strings.SplitN(databaseURL, ":", 2)[0])
+	}
+
+	helper.Infof("Dumping mattermost database")
+	args := []string{"--format=custom", "--file=" + filepath.Join(stageDir, "mattermost.dump"), databaseURL}
+	if _, err := helper.Run(ctx, helper.Command{Name: "pg_dump", Args: args}); err != nil {
+		return fmt.Errorf("pg_dump failed: %w", err)
+	}
+
+	if err := helper.CopyDir(configDir, filepath.Join(stageDir, "config")); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", configDir, err)
+	}
+	return nil
+}
+
+// mattermostDataSource reads the database URL from a Mattermost config.json.
+func mattermostDataSource(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read mattermost config: %w", err)
+	}
+	var cfg struct {
+		SqlSettings struct {
+			DataSource string `json:"DataSource"`
+		} `json:"SqlSettings"`
+	}
+	if err := sonic.Unmarshal(data, &cfg); err != nil {
+		return "", fmt.Errorf("failed to parse mattermost config: %w", err)
+	}
+	if cfg.SqlSettings.DataSource == "" {
+		return "", fmt.Errorf("no SqlSettings.DataSource in %s, set database_url", path)
+	}
+	return cfg.SqlSettings.DataSource, nil
+}
+
+// dumpRocketChat dumps the Rocket.Chat MongoDB database into a gzipped
+// archive restorable with `mongorestore --archive --gzip`.
+func dumpRocketChat(ctx context.Context, server config.ChatServer, stageDir string) error {
+	helper.Infof("Dumping rocket.chat database")
+	args := []string{"--uri=" + server.MongoURI, "--gzip", "--archive=" + filepath.Join(stageDir, "rocketchat.archive.gz")}
+	if _, err := helper.Run(ctx, helper.Command{Name: "mongodump", Args: args}); err != nil {
+		return fmt.Errorf("mongodump failed: %w", err)
+	}
+	return nil
+}
+
+// chownToUser gives the named user ownership of path.
+func chownToUser(path, name string) error {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return fmt.Errorf("failed to look up user %s: %w", name, err)
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+	gid, _ := strconv.Atoi(u.Gid)
+	if err := os.Chown(path, uid, gid); err != nil {
+		return fmt.Errorf("failed to chown %s to %s: %w", path, name, err)
+	}
+	return nil
+}
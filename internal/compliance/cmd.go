@@ -0,0 +1,93 @@
+package compliance
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/mysql"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var Command = &cli.Command{
+	Name:  "compliance",
+	Usage: "Restore the latest backups into a sandbox and publish a signed report of the outcome",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "Also write the report to this local file",
+		},
+	},
+	Action: run,
+}
+
+func run(ctx context.Context, c *cli.Command) error {
+	// 1. Check required tools
+	if err := helper.CheckTools("unzip"); err != nil {
+		return err
+	}
+
+	// 2. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if len(cfg.Compliance.Sources) == 0 {
+		return fmt.Errorf("compliance.sources is empty")
+	}
+	sandbox, err := mysql.NewSandboxWorker(cfg)
+	if err != nil {
+		return err
+	}
+
+	// 3. File locking
+	unlock, err := helper.AcquireLock(cfg.LockFile)
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+	defer unlock()
+
+	// 4. Initialize storage and notifier
+	store, err := helper.NewStorage(cfg, helper.OptionsFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	notifier := helper.NewNotifier(cfg)
+
+	// 5. Restore every source into the sandbox
+	report := &Report{CreatedAt: time.Now(), Sandbox: cfg.Compliance.Sandbox.Host}
+	for _, source := range cfg.Compliance.Sources {
+		helper.Infof("Restoring the latest backup of %s into the sandbox", source)
+		result := restoreLatest(ctx, cfg, store, sandbox, source)
+		if result.Err != nil {
+			helper.Errorf("compliance check of %s failed: %v", source, result.Err)
+		}
+		report.Sources = append(report.Sources, result)
+	}
+
+	// 6. Publish the report
+	key, err := publish(ctx, cfg, store, report, c.String("output"))
+	status, severity := "✅ passed", helper.SeveritySuccess
+	if !report.Passed() {
+		status, severity = "❌ failed", helper.SeverityAlert
+	}
+	message := fmt.Sprintf("📋 Compliance restore test %s: %d sources\nReport: %s", status, len(report.Sources), key)
+	if err != nil {
+		message += fmt.Sprintf("\nPublishing the report failed: %v", err)
+		severity = helper.SeverityAlert
+	}
+	if notifyErr := notifier.Notify("compliance", severity, message); notifyErr != nil {
+		helper.Errorf("failed to send notification: %v", notifyErr)
+	}
+	if err != nil {
+		return err
+	}
+	if !report.Passed() {
+		return fmt.Errorf("compliance restore test failed, see %s", key)
+	}
+	helper.Infof("Compliance restore test passed, report stored as %s", key)
+	return nil
+}
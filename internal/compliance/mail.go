@@ -0,0 +1,72 @@
+package compliance
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// mailPart is a part of a multipart email.
+type mailPart struct {
+	contentType, disposition string
+	content                  []byte
+}
+
+// sendMail emails the report, inline and as an attachment, with its
+// signature attached when there is one. smtp.SendMail upgrades to STARTTLS
+// when the server offers it.
+func sendMail(cfg config.SMTPConfig, to []string, subject, filename string, report, signature []byte) error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	fmt.Fprintf(&body, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&body, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+
+	parts := []mailPart{
+		{"text/plain; charset=utf-8", "inline", report},
+		{"text/markdown; charset=utf-8", fmt.Sprintf("attachment; filename=%q", filename), report},
+	}
+	if signature != nil {
+		parts = append(parts, mailPart{"application/octet-stream", fmt.Sprintf("attachment; filename=%q", filename+".sig"), signature})
+	}
+	for _, p := range parts {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Disposition":       {p.disposition},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return err
+		}
+		encoded := base64.StdEncoding.EncodeToString(p.content)
+		for len(encoded) > 76 {
+			fmt.Fprintf(part, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(part, "%s\r\n", encoded)
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	return smtp.SendMail(addr, auth, cfg.From, to, body.Bytes())
+}
@@ -0,0 +1,291 @@
+package compliance
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/mysql"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// Report is the outcome of a compliance run.
+type Report struct {
+	CreatedAt time.Time
+	Sandbox   string
+	Sources   []SourceResult
+}
+
+// SourceResult is the outcome of restoring the latest backup of a source.
+type SourceResult struct {
+	Source   string
+	Key      string
+	Manifest *helper.Manifest
+	Result   *mysql.SandboxResult
+	Duration time.Duration // Download, checks and restore
+	Err      error
+}
+
+// Passed reports whether the backup was restored and validated.
+func (r SourceResult) Passed() bool {
+	return r.Err == nil && r.Result != nil && r.Result.Passed()
+}
+
+// Passed reports whether every source passed.
+func (r *Report) Passed() bool {
+	for _, source := range r.Sources {
+		if !source.Passed() {
+			return false
+		}
+	}
+	return len(r.Sources) > 0
+}
+
+// restoreLatest downloads the latest full backup of source, checks its hash
+// and restores it into the sandbox.
+func restoreLatest(ctx context.Context, cfg *config.Config, store helper.Storage, sandbox *mysql.Worker, source string) SourceResult {
+	start := time.Now()
+	result := SourceResult{Source: source}
+	defer func() { result.Duration = time.Since(start) }()
+
+	result.Key, result.Manifest, result.Err = latestFull(ctx, store, source)
+	if result.Err != nil {
+		return result
+	}
+
+	workDir, err := os.MkdirTemp(cfg.Backup.TempDir, "compliance_*")
+	if err != nil {
+		result.Err = fmt.Errorf("failed to create work dir: %w", err)
+		return result
+	}
+	defer os.RemoveAll(workDir)
+
+	zipPath := filepath.Join(workDir, filepath.Base(result.Key))
+	if err := helper.DownloadFile(ctx, store, result.Key, zipPath); err != nil {
+		result.Err = fmt.Errorf("download failed: %w", err)
+		return result
+	}
+	if result.Manifest != nil {
+		hash, _, err := helper.CalculateSHA256(ctx, zipPath, 0)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		if hash != result.Manifest.SHA256 {
+			result.Err = fmt.Errorf("SHA256 mismatch: manifest records %s, downloaded %s", result.Manifest.SHA256, hash)
+			return result
+		}
+		// The sandbox restore reads the manifest next to the zip for its key
+		data, err := result.Manifest.Marshal()
+		if err == nil {
+			err = os.WriteFile(helper.ManifestKey(zipPath), data, 0600)
+		}
+		if err != nil {
+			result.Err = fmt.Errorf("failed to write manifest: %w", err)
+			return result
+		}
+	}
+
+	result.Result, result.Err = sandbox.SandboxRestore(ctx, zipPath, cfg.Compliance.Queries)
+	return result
+}
+
+// latestFull returns the newest full artifact of source and its manifest
+// (nil for artifacts stored without one).
+func latestFull(ctx context.Context, store helper.Storage, source string) (string, *helper.Manifest, error) {
+	objects, err := store.List(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	var keys []string
+	for _, object := range objects {
+		if helper.IsArtifactKey(object.Key) && helper.ArtifactName(object.Key) == source {
+			keys = append(keys, object.Key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		ta, _ := helper.ArtifactTime(a)
+		tb, _ := helper.ArtifactTime(b)
+		return tb.Compare(ta)
+	})
+	for _, key := range keys {
+		manifest, err := helper.LoadManifest(ctx, store, key)
+		if err != nil {
+			manifest = nil // No manifest: a full artifact
+		}
+		if (helper.ChainLink{Key: key, Manifest: manifest}).Kind() == helper.ChainFull {
+			return key, manifest, nil
+		}
+	}
+	return "", nil, fmt.Errorf("no full backup of %s found", source)
+}
+
+// Markdown renders the report.
+func (r *Report) Markdown() []byte {
+	var b bytes.Buffer
+	status := "PASSED"
+	if !r.Passed() {
+		status = "FAILED"
+	}
+	hostname, _ := os.Hostname()
+	fmt.Fprintf(&b, "# Backup restore test: %s\n\n", status)
+	fmt.Fprintf(&b, "- Generated: %s\n", r.CreatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Host: %s\n", hostname)
+	fmt.Fprintf(&b, "- Sandbox: %s\n", r.Sandbox)
+	if version := helper.ToolVersion(); version != "" {
+		fmt.Fprintf(&b, "- Tool version: %s\n", version)
+	}
+
+	b.WriteString("\n## Summary\n\n")
+	b.WriteString("| Source | Backup | Created | Restored | Rows matched | Queries passed | Duration |\n")
+	b.WriteString("|---|---|---|---|---|---|---|\n")
+	for _, s := range r.Sources {
+		backup, created, restored, rows, queries := "-", "-", "no", "-", "-"
+		if s.Key != "" {
+			backup = "`" + s.Key + "`"
+		}
+		if s.Manifest != nil {
+			created = s.Manifest.CreatedAt.UTC().Format(time.RFC3339)
+		}
+		if s.Result != nil {
+			restored = "yes"
+			matched := 0
+			for _, t := range s.Result.Tables {
+				if t.Matched() {
+					matched++
+				}
+			}
+			rows = fmt.Sprintf("%d/%d tables", matched, len(s.Result.Tables))
+			passed := 0
+			for _, q := range s.Result.Queries {
+				if q.Passed {
+					passed++
+				}
+			}
+			queries = fmt.Sprintf("%d/%d", passed, len(s.Result.Queries))
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s | %s |\n", s.Source, backup, created, restored, rows, queries, s.Duration.Round(time.Second))
+	}
+
+	for _, s := range r.Sources {
+		fmt.Fprintf(&b, "\n## %s\n\n", s.Source)
+		if s.Manifest != nil {
+			fmt.Fprintf(&b, "- SHA256: `%s`\n", s.Manifest.SHA256)
+			fmt.Fprintf(&b, "- Size: %s\n", helper.HumanizeSize(s.Manifest.Size))
+		}
+		if s.Err != nil {
+			fmt.Fprintf(&b, "- Error: %s\n", markdownCell(s.Err.Error()))
+			continue
+		}
+		fmt.Fprintf(&b, "- Restore duration: %s\n", s.Result.RestoreDuration.Round(time.Second))
+
+		b.WriteString("\n| Table | Rows in backup | Rows restored | Checksum | Status |\n")
+		b.WriteString("|---|---|---|---|---|\n")
+		for _, t := range s.Result.Tables {
+			ok := "OK"
+			if !t.Matched() {
+				ok = "MISMATCH"
+			}
+			fmt.Fprintf(&b, "| %s.%s | %d | %d | %s | %s |\n", markdownCell(t.Schema), markdownCell(t.Name), t.DumpRows, t.RestoredRows, t.Checksum, ok)
+		}
+		if len(s.Result.Queries) > 0 {
+			b.WriteString("\n| Validation query | Result | Status |\n")
+			b.WriteString("|---|---|---|\n")
+			for _, q := range s.Result.Queries {
+				ok, value := "OK", q.Value
+				if !q.Passed {
+					ok = "FAILED"
+				}
+				if q.Error != "" {
+					value = q.Error
+				}
+				fmt.Fprintf(&b, "| %s | %s | %s |\n", markdownCell(q.Name), markdownCell(value), ok)
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+// markdownCell escapes a value for a Markdown table cell.
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+// publish stores the report and its signature next to the backups, writes
+// them to output when set and emails them. It returns the report key.
+func publish(ctx context.Context, cfg *config.Config, store helper.Storage, report *Report, output string) (string, error) {
+	content := report.Markdown()
+	var signature []byte
+	if cfg.Compliance.SigningKey != "" {
+		key, err := loadSigningKey(cfg.Compliance.SigningKey)
+		if err != nil {
+			return "", err
+		}
+		signature = ed25519.Sign(key, content)
+	}
+
+	filename := fmt.Sprintf("compliance_%s.md", report.CreatedAt.Format(helper.TimestampLayout))
+	key := store.ObjectKey("compliance", report.CreatedAt, filename)
+	if err := store.Upload(ctx, key, bytes.NewReader(content)); err != nil {
+		return key, fmt.Errorf("failed to upload report: %w", err)
+	}
+	if signature != nil {
+		if err := store.Upload(ctx, key+".sig", bytes.NewReader(signature)); err != nil {
+			return key, fmt.Errorf("failed to upload report signature: %w", err)
+		}
+	}
+
+	if output != "" {
+		if err := os.WriteFile(output, content, 0644); err != nil {
+			return key, fmt.Errorf("failed to write report: %w", err)
+		}
+		if signature != nil {
+			if err := os.WriteFile(output+".sig", signature, 0644); err != nil {
+				return key, fmt.Errorf("failed to write report signature: %w", err)
+			}
+		}
+	}
+
+	if len(cfg.Compliance.EmailTo) > 0 {
+		subject := fmt.Sprintf("Backup restore test %s", report.CreatedAt.Format(time.DateOnly))
+		if !report.Passed() {
+			subject += ": FAILED"
+		}
+		if err := sendMail(cfg.SMTP, cfg.Compliance.EmailTo, subject, filename, content, signature); err != nil {
+			return key, fmt.Errorf("failed to email report: %w", err)
+		}
+		helper.Infof("Emailed report to %s", strings.Join(cfg.Compliance.EmailTo, ", "))
+	}
+	return key, nil
+}
+
+// loadSigningKey reads an Ed25519 private key in PKCS#8 PEM, as written by
+// `openssl genpkey -algorithm ed25519`.
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s is not PEM encoded", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	ed, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not an Ed25519 key", path)
+	}
+	return ed, nil
+}
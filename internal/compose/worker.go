@@ -0,0 +1,222 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// defaultFiles are the compose file names docker compose picks up by default.
+var defaultFiles = []string{
+	"compose.yaml", "compose.yml", "docker-compose.yml", "docker-compose.yaml",
+	"compose.override.yaml", "compose.override.yml", "docker-compose.override.yml", "docker-compose.override.yaml",
+}
+
+// bindDir holds bind-mounted files from outside the project directory inside an artifact.
+const bindDir = "_binds"
+
+// Worker archives the definitions of docker compose stacks.
+type Worker struct {
+	cfg      *config.Config
+	store    helper.Storage
+	notifier *helper.TelegramSender
+	pipeline *helper.Pipeline
+	onlyDump bool
+}
+
+// NewWorker creates a new compose stack worker.
+func NewWorker(cfg *config.Config, store helper.Storage, notifier *helper.TelegramSender, opts helper.Options) *Worker {
+	return &Worker{
+		cfg:      cfg,
+		store:    store,
+		notifier: notifier,
+		pipeline: helper.NewPipeline(cfg, store, opts),
+		onlyDump: opts.OnlyDump,
+	}
+}
+
+// Run backs up every configured stack as its own artifact.
+func (w *Worker) Run(ctx context.Context) error {
+	if helper.CheckPaused(w.cfg, w.notifier, "compose") {
+		return nil
+	}
+	stop := w.pipeline.Start()
+	defer stop()
+	if err := w.pipeline.SelfTest(ctx, w.notifier, "compose"); err != nil {
+		return err
+	}
+	w.pipeline.FlushSpool(ctx)
+
+	var results []helper.BackupResult
+	successCount, failCount := 0, 0
+	for _, stack := range w.cfg.Compose.Stacks {
+		start := time.Now()
+		result := w.backupStack(ctx, stack)
+		result.Duration = time.Since(start)
+		results = append(results, result)
+		if result.Success {
+			successCount++
+		} else {
+			failCount++
+			helper.Errorf("backup of %s failed: %v", result.Database, result.Error)
+		}
+	}
+
+	w.pipeline.PruneLocal(ctx)
+	w.pipeline.Report(w.notifier, "compose", results, successCount, failCount)
+
+	if failCount > 0 {
+		return fmt.Errorf("compose backup completed with %d failures", failCount)
+	}
+	return nil
+}
+
+func (w *Worker) backupStack(ctx context.Context, stack config.ComposeStack) helper.BackupResult {
+	start := time.Now()
+	stageDir := filepath.Join(w.cfg.Backup.TempDir, fmt.Sprintf("compose_%s_%s", helper.EscapeName(stack.Name), start.Format(helper.TimestampLayout)))
+	if err := os.MkdirAll(stageDir, 0700); err != nil {
+		return helper.BackupResult{Database: stack.Name, Success: false, Error: fmt.Errorf("failed to create temp dir: %w", err)}
+	}
+	defer os.RemoveAll(stageDir)
+
+	paths, err := stackPaths(stack)
+	if err != nil {
+		return helper.BackupResult{Database: stack.Name, Success: false, Error: err}
+	}
+	for _, path := range paths {
+		if err := stage(stack.Dir, path, stageDir); err != nil {
+			return helper.BackupResult{Database: stack.Name, Success: false, Error: fmt.Errorf("failed to stage %s: %w", path, err)}
+		}
+	}
+	helper.Infof("Staged %d paths of compose stack %s", len(paths), stack.Name)
+
+	result := w.pipeline.Ship(ctx, "compose_"+stack.Name, stageDir, start, false)
+	result.Database = stack.Name
+	return result
+}
+
+// stackPaths returns the absolute paths to archive for a stack: its compose
+// files, .env files, bind-mounted config files and the configured extra paths.
+func stackPaths(stack config.ComposeStack) ([]string, error) {
+	files := stack.Files
+	if len(files) == 0 {
+		for _, name := range defaultFiles {
+			if _, err := os.Stat(filepath.Join(stack.Dir, name)); err == nil {
+				files = append(files, name)
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no compose file found in %s", stack.Dir)
+	}
+
+	seen := make(map[string]bool)
+	var paths []string
+	add := func(path string) {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(stack.Dir, path)
+		}
+		path = filepath.Clean(path)
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	for _, file := range files {
+		add(file)
+		binds, err := bindMountFiles(filepath.Join(stack.Dir, file))
+		if err != nil {
+			return nil, err
+		}
+		for _, bind := range binds {
+			add(bind)
+		}
+	}
+
+	envFiles, _ := filepath.Glob(filepath.Join(stack.Dir, ".env*"))
+	for _, env := range envFiles {
+		add(env)
+	}
+	for _, extra := range stack.ExtraPaths {
+		add(extra)
+	}
+	return paths, nil
+}
+
+// bindMountFiles returns the bind-mount sources of a compose file that are
+// regular files, i.e. configs; bind-mounted directories usually hold data.
+func bindMountFiles(composeFile string) ([]string, error) {
+	data, err := os.ReadFile(composeFile)
+	if err != nil {
+		return nil, err
+	}
+	var project struct {
+		Services map[string]struct {
+			Volumes []interface{} `yaml:"volumes"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &project); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", composeFile, err)
+	}
+
+	dir := filepath.Dir(composeFile)
+	var files []string
+	for _, service := range project.Services {
+		for _, volume := range service.Volumes {
+			var source string
+			switch v := volume.(type) {
+			case string: // Short syntax: "source:target[:mode]"
+				source, _, _ = strings.Cut(v, ":")
+			case map[string]interface{}: // Long syntax
+				if v["type"] == "bind" {
+					source, _ = v["source"].(string)
+				}
+			}
+			// Named volumes have no path separators
+			if source == "" || !strings.ContainsAny(source, "/.~") {
+				continue
+			}
+			if strings.HasPrefix(source, "~/") {
+				home, _ := os.UserHomeDir()
+				source = filepath.Join(home, source[2:])
+			} else if !filepath.IsAbs(source) {
+				source = filepath.Join(dir, source)
+			}
+			if info, err := os.Stat(source); err == nil && info.Mode().IsRegular() {
+				files = append(files, source)
+			}
+		}
+	}
+	return files, nil
+}
+
+// stage copies path into stageDir, keeping paths relative to the project
+// directory and placing paths outside of it under _binds/<absolute path>.
+func stage(projectDir, path, stageDir string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	target := filepath.Join(stageDir, bindDir, path)
+	if rel, err := filepath.Rel(projectDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		target = filepath.Join(stageDir, rel)
+	}
+
+	if info.IsDir() {
+		return helper.CopyDir(path, target)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+	return helper.CopyFile(path, target)
+}
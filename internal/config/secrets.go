@@ -0,0 +1,97 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// keyringPrefix marks config values stored in the OS keyring ("keyring:<name>").
+const keyringPrefix = "keyring:"
+
+type KeyringConfig struct {
+	Service string `yaml:"service"` // Keyring service the secrets are stored under (default: backup)
+}
+
+// secretFields returns the config values that may reference the OS keyring.
+func (c *Config) secretFields() []*string {
+	return []*string{
+		&c.MySQL.Password,
+		&c.R2.AccessKey,
+		&c.R2.SecretKey,
+		&c.R2.PruneAccessKey,
+		&c.R2.PruneSecretKey,
+		&c.GDrive.ClientSecret,
+		&c.GDrive.RefreshToken,
+		&c.FTP.Password,
+		&c.Encryption.Password,
+		&c.Encryption.KMS.VaultToken,
+		&c.Telegram.BotToken,
+		&c.Telegram.Proxy,
+		&c.Compliance.Sandbox.Password,
+		&c.SMTP.Password,
+	}
+}
+
+// resolveSecrets replaces keyring references with the secrets stored in the
+// OS keyring, so plaintext secrets never need to be written to the config file.
+func (c *Config) resolveSecrets() error {
+	for _, field := range c.secretFields() {
+		name, ok := strings.CutPrefix(*field, keyringPrefix)
+		if !ok {
+			continue
+		}
+		secret, err := lookupKeyring(c.Keyring.Service, name)
+		if err != nil {
+			return fmt.Errorf("failed to read %q from keyring: %w", name, err)
+		}
+		*field = secret
+	}
+	return nil
+}
+
+// CommandEnv returns the environment of external commands: the inherited one
+// without the tool's own BACKUP_* variables (e.g. BACKUP_NEW_PASSWORD) and
+// locale settings, which are replaced by the C locale.
+func CommandEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, "BACKUP_") || strings.HasPrefix(name, "LC_") || name == "LANG" || name == "LANGUAGE" {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return append(env, "LC_ALL=C")
+}
+
+// lookupKeyring reads a secret via the Secret Service (Linux) or Keychain
+// (macOS). The lookup runs in the environment of other external commands, as
+// the config is loaded before helper.Run is usable.
+func lookupKeyring(service, name string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", name)
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", name, "-w")
+	default:
+		return "", fmt.Errorf("keyring is not supported on %s", runtime.GOOS)
+	}
+	cmd.Env = CommandEnv()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w, output: %s", cmd.Path, err, strings.TrimSpace(stderr.String()))
+	}
+	secret := strings.TrimRight(string(output), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("secret not found")
+	}
+	return secret, nil
+}
@@ -0,0 +1,61 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var Command = &cli.Command{
+	Name:   "daemon",
+	Usage:  "Run the jobs under schedule.jobs on their cron schedules",
+	Action: run,
+}
+
+func run(ctx context.Context, c *cli.Command) error {
+	// 1. Load config
+	configPath := c.String("config")
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := Validate(cfg); err != nil {
+		return err
+	}
+
+	// 2. File locking; jobs take their own locks
+	unlock, err := helper.AcquireLock(cfg.LockFile + ".daemon")
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+	defer unlock()
+
+	// 3. Stop scheduling on SIGINT/SIGTERM; a running job is cancelled too
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// 4. Run scheduler
+	globalArgs := []string{"--config", configPath, "--log-level", c.String("log-level"), "--output", c.String("output")}
+	if c.Bool("only-dump") {
+		globalArgs = append(globalArgs, "--only-dump")
+	}
+	if dir := c.String("command-log"); dir != "" {
+		globalArgs = append(globalArgs, "--command-log", dir)
+	}
+	d, err := New(cfg, globalArgs)
+	if err != nil {
+		return err
+	}
+	helper.Infof("Starting daemon with %d jobs", len(cfg.ScheduledJobs()))
+	if err := d.Run(ctx); err != nil {
+		return err
+	}
+	helper.Infof("Daemon stopped")
+	return nil
+}
@@ -0,0 +1,238 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// Daemon runs the scheduled jobs. Each run executes this binary with the
+// job's command, so jobs behave exactly like their cron entries would.
+//
+// Due jobs are queued and started in order as long as fewer than
+// max_concurrent_jobs are running and none of their locks is held by a
+// running job; later jobs whose locks are free may start ahead of blocked ones.
+type Daemon struct {
+	cfg        *config.Config
+	notifier   *helper.TelegramSender
+	globalArgs []string // Global flags passed on to every job
+	jobs       []*job
+	runs       lastRuns
+
+	queue   []*queued
+	running map[string]bool // Job names
+	held    map[string]bool // Locks of running jobs
+}
+
+// queued is a due run waiting for a free slot and its locks.
+type queued struct {
+	job      *job
+	queuedAt time.Time
+}
+
+// expired reports whether the run has waited longer than the job's queue timeout.
+func (q *queued) expired(now time.Time) bool {
+	return q.job.queueTimeout > 0 && now.Sub(q.queuedAt) > q.job.queueTimeout
+}
+
+// New creates a daemon for the jobs in cfg.Schedule and the scheduled mysql
+// profiles. The global flags, such as --config, are passed on to every job.
+func New(cfg *config.Config, globalArgs []string) (*Daemon, error) {
+	jobs, err := parseJobs(cfg.Schedule.Blackouts, cfg.ScheduledJobs())
+	if err != nil {
+		return nil, err
+	}
+	return &Daemon{
+		cfg:        cfg,
+		notifier:   helper.NewNotifier(cfg),
+		globalArgs: globalArgs,
+		jobs:       jobs,
+		runs:       loadLastRuns(cfg.Schedule.StateFile),
+		running:    make(map[string]bool),
+		held:       make(map[string]bool),
+	}, nil
+}
+
+// Run schedules the jobs until ctx is cancelled, then waits for running jobs
+// to exit.
+func (d *Daemon) Run(ctx context.Context) error {
+	now := time.Now()
+	for _, j := range d.jobs {
+		if last, ok := d.runs[j.Name]; ok {
+			j.plan(last, now)
+		} else {
+			j.at(j.schedule.Next(now))
+		}
+		helper.Infof("Job %s (%s) next runs at %s", j.Name, j.Cron, j.next.Format(time.RFC3339))
+	}
+
+	done := make(chan *job)
+	for {
+		d.enqueueDue(time.Now())
+		d.dispatch(ctx, time.Now(), done)
+
+		timer := time.NewTimer(time.Until(d.wakeup()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			for len(d.running) > 0 {
+				d.release(<-done)
+			}
+			return nil
+		case j := <-done:
+			timer.Stop()
+			d.release(j)
+		case <-timer.C:
+		}
+	}
+}
+
+// enqueueDue queues the jobs whose next run has come and plans their
+// following run.
+func (d *Daemon) enqueueDue(now time.Time) {
+	for _, j := range d.jobs {
+		if j.next.After(now) {
+			continue
+		}
+		scheduled := j.scheduled
+		switch spec, blackedOut := j.blackedOut(now); {
+		case blackedOut:
+			helper.Infof("Skipping job %s: inside blackout window %s", j.Name, spec)
+		case helper.CheckPaused(d.cfg, d.notifier, j.Name):
+		case d.running[j.Name] || d.isQueued(j):
+			helper.Infof("Skipping job %s: previous run has not finished", j.Name)
+		default:
+			d.queue = append(d.queue, &queued{job: j, queuedAt: now})
+			if len(d.running) > 0 {
+				helper.Infof("Queued job %s behind %d running jobs", j.Name, len(d.running))
+			}
+		}
+
+		d.runs[j.Name] = scheduled
+		if err := d.runs.save(d.cfg.Schedule.StateFile); err != nil {
+			helper.Warnf("failed to save schedule state: %v", err)
+		}
+		j.plan(scheduled, now)
+		helper.Infof("Job %s next runs at %s", j.Name, j.next.Format(time.RFC3339))
+	}
+}
+
+// dispatch starts queued runs that fit the concurrency limit and whose locks
+// are free, and drops runs that waited too long.
+func (d *Daemon) dispatch(ctx context.Context, now time.Time, done chan<- *job) {
+	var waiting []*queued
+	for _, q := range d.queue {
+		switch {
+		case q.expired(now):
+			helper.Infof("Dropping job %s: queued for longer than %s", q.job.Name, q.job.queueTimeout)
+		case len(d.running) < d.cfg.Schedule.MaxConcurrentJobs && d.locksFree(q.job):
+			d.acquire(q.job)
+			go func(j *job) {
+				d.runJob(ctx, j)
+				done <- j
+			}(q.job)
+		default:
+			waiting = append(waiting, q)
+		}
+	}
+	d.queue = waiting
+}
+
+// wakeup returns when the scheduler has to look at the jobs again: the next
+// planned run or the next queue timeout.
+func (d *Daemon) wakeup() time.Time {
+	next := d.jobs[0].next
+	for _, j := range d.jobs[1:] {
+		if j.next.Before(next) {
+			next = j.next
+		}
+	}
+	for _, q := range d.queue {
+		if q.job.queueTimeout > 0 {
+			if expiry := q.queuedAt.Add(q.job.queueTimeout); expiry.Before(next) {
+				next = expiry
+			}
+		}
+	}
+	return next
+}
+
+func (d *Daemon) isQueued(j *job) bool {
+	for _, q := range d.queue {
+		if q.job == j {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Daemon) locksFree(j *job) bool {
+	for _, lock := range j.Locks {
+		if d.held[lock] {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Daemon) acquire(j *job) {
+	d.running[j.Name] = true
+	for _, lock := range j.Locks {
+		d.held[lock] = true
+	}
+}
+
+func (d *Daemon) release(j *job) {
+	delete(d.running, j.Name)
+	for _, lock := range j.Locks {
+		delete(d.held, lock)
+	}
+}
+
+// runJob executes the job's command with this binary and config. Every job
+// gets its own lock file, so jobs may run concurrently while a job never
+// overlaps a manual run of itself.
+func (d *Daemon) runJob(ctx context.Context, j *job) {
+	exe, err := os.Executable()
+	if err != nil {
+		helper.Errorf("job %s failed: %v", j.Name, err)
+		return
+	}
+	args := append(append([]string(nil), d.globalArgs...), j.Command...)
+
+	if j.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.timeout)
+		defer cancel()
+	}
+
+	helper.Infof("Starting job %s: %v", j.Name, j.Command)
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, exe, args...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s.%s", config.LockFileEnv, d.cfg.LockFile, j.Name))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", j.timeout)
+		}
+		helper.Errorf("job %s failed after %s: %v", j.Name, time.Since(start).Round(time.Second), err)
+		return
+	}
+	helper.Infof("Job %s finished in %s", j.Name, time.Since(start).Round(time.Second))
+}
+
+// Validate checks that every job can be scheduled.
+func Validate(cfg *config.Config) error {
+	jobs := cfg.ScheduledJobs()
+	if len(jobs) == 0 {
+		return fmt.Errorf("no schedule.jobs or scheduled mysql.profiles configured")
+	}
+	_, err := parseJobs(cfg.Schedule.Blackouts, jobs)
+	return err
+}
@@ -0,0 +1,118 @@
+package daemon
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// window is a parsed blackout window.
+type window struct {
+	start    cron.Schedule
+	duration time.Duration
+	spec     string
+}
+
+// contains reports whether t falls inside the window, i.e. the window started
+// at most duration before t.
+func (w window) contains(t time.Time) bool {
+	return !w.start.Next(t.Add(-w.duration)).After(t)
+}
+
+// job is a scheduled job with its parsed schedule.
+type job struct {
+	config.ScheduledJob
+	schedule     cron.Schedule
+	blackouts    []window
+	timeout      time.Duration // Zero means no limit
+	queueTimeout time.Duration // Zero means wait forever
+	jitter       time.Duration // Upper bound of the random delay added to every run
+	scheduled    time.Time     // Firing the next run belongs to
+	next         time.Time     // When the next run starts: scheduled plus jitter
+}
+
+// blackedOut returns the spec of the blackout window containing t, if any.
+func (j *job) blackedOut(t time.Time) (string, bool) {
+	for _, w := range j.blackouts {
+		if w.contains(t) {
+			return w.spec, true
+		}
+	}
+	return "", false
+}
+
+// plan sets the next run of the job after one scheduled at prev. Missed
+// firings, because of downtime or a long previous run, are skipped or run
+// once right away depending on the catch-up policy.
+func (j *job) plan(prev, now time.Time) {
+	scheduled := j.schedule.Next(prev)
+	if scheduled.Before(now) {
+		if j.CatchUp == "once" {
+			scheduled = now
+		} else {
+			scheduled = j.schedule.Next(now)
+		}
+	}
+	j.at(scheduled)
+}
+
+// at schedules the next run for the firing at scheduled, delayed by a random
+// jitter so a fleet sharing one schedule does not start in the same second.
+func (j *job) at(scheduled time.Time) {
+	j.scheduled = scheduled
+	j.next = scheduled
+	if j.jitter > 0 {
+		j.next = j.next.Add(rand.N(j.jitter))
+	}
+}
+
+// parseJobs parses the cron expressions of the jobs, which the global
+// blackout windows apply to as well.
+func parseJobs(blackouts []config.BlackoutWindow, scheduled []config.ScheduledJob) ([]*job, error) {
+	global, err := parseWindows(blackouts)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*job
+	for _, sj := range scheduled {
+		schedule, err := cron.ParseStandard(sj.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron %q for job %q: %w", sj.Cron, sj.Name, err)
+		}
+		blackouts, err := parseWindows(sj.Blackouts)
+		if err != nil {
+			return nil, fmt.Errorf("job %q: %w", sj.Name, err)
+		}
+		// Durations are validated by LoadConfig
+		timeout, _ := time.ParseDuration(sj.Timeout)
+		queueTimeout, _ := time.ParseDuration(sj.QueueTimeout)
+		jitter, _ := time.ParseDuration(sj.Jitter)
+		jobs = append(jobs, &job{
+			ScheduledJob: sj,
+			schedule:     schedule,
+			blackouts:    append(blackouts, global...),
+			timeout:      timeout,
+			queueTimeout: queueTimeout,
+			jitter:       jitter,
+		})
+	}
+	return jobs, nil
+}
+
+func parseWindows(windows []config.BlackoutWindow) ([]window, error) {
+	var parsed []window
+	for _, w := range windows {
+		start, err := cron.ParseStandard(w.Start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blackout start %q: %w", w.Start, err)
+		}
+		duration, _ := time.ParseDuration(w.Duration) // Validated by LoadConfig
+		parsed = append(parsed, window{start: start, duration: duration, spec: fmt.Sprintf("%s for %s", w.Start, w.Duration)})
+	}
+	return parsed, nil
+}
@@ -0,0 +1,29 @@
+package daemon
+
+import (
+	"os"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// lastRuns maps job names to the scheduled time of their last run.
+type lastRuns map[string]time.Time
+
+// loadLastRuns reads the state file. A missing or unreadable file means no
+// job has run yet.
+func loadLastRuns(path string) lastRuns {
+	runs := make(lastRuns)
+	if data, err := os.ReadFile(path); err == nil {
+		sonic.Unmarshal(data, &runs)
+	}
+	return runs
+}
+
+func (r lastRuns) save(path string) error {
+	data, err := sonic.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,253 @@
+package extract
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/dumpfile"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// Extractor exports single tables from MySQL backups.
+type Extractor struct {
+	cfg     *config.Config
+	workDir string
+}
+
+// NewExtractor creates a new table extractor using workDir for unpacked files.
+func NewExtractor(cfg *config.Config, workDir string) *Extractor {
+	return &Extractor{
+		cfg:     cfg,
+		workDir: workDir,
+	}
+}
+
+// Extract writes the rows of schema.table found in inputPath (a dump directory
+// or zip file) to output in the given format and returns the row count.
+func (e *Extractor) Extract(ctx context.Context, inputPath, schema, table, format, output string) (int, error) {
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to access input path: %w", err)
+	}
+
+	dumpRoot := inputPath
+	password := e.cfg.Encryption.Password
+	if !info.IsDir() {
+		manifest, err := helper.ReadManifestFile(inputPath)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read manifest: %w", err)
+		}
+		if password, err = helper.ArtifactPassword(ctx, e.cfg, manifest); err != nil {
+			return 0, err
+		}
+
+		// Unpack the metadata first, then only the data files of the requested table
+		dumpRoot = filepath.Join(e.workDir, "dump")
+		if err := helper.Unzip(ctx, password, inputPath, dumpRoot, "*.json"); err != nil {
+			return 0, err
+		}
+	}
+
+	t, err := findTable(dumpRoot, schema, table)
+	if err != nil {
+		return 0, err
+	}
+
+	if !info.IsDir() {
+		pattern := "*" + filepath.Base(t.BasePath()) + "*"
+		if err := helper.Unzip(ctx, password, inputPath, dumpRoot, pattern); err != nil {
+			return 0, err
+		}
+	}
+
+	files, err := t.DataFiles()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list data files: %w", err)
+	}
+	if len(files) == 0 {
+		return 0, fmt.Errorf("no data files found for %s.%s", schema, table)
+	}
+	helper.Infof("Found %d data chunks for %s.%s", len(files), schema, table)
+
+	out, err := os.Create(output)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create output: %w", err)
+	}
+	defer out.Close()
+
+	var w rowWriter
+	switch format {
+	case "csv":
+		w, err = newCSVWriter(out, t.Columns)
+	case "parquet":
+		w, err = newParquetWriter(out, t.Name, t.Columns)
+	default:
+		err = fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, path := range files {
+		n, err := copyRows(t, path, w)
+		count += n
+		if err != nil {
+			return count, fmt.Errorf("failed to convert %s: %w", filepath.Base(path), err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return count, fmt.Errorf("failed to finish output: %w", err)
+	}
+	return count, out.Sync()
+}
+
+func findTable(root, schema, table string) (*dumpfile.Table, error) {
+	dumps, err := dumpfile.FindDumps(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dump metadata: %w", err)
+	}
+	for _, dump := range dumps {
+		if !dump.HasSchema(schema) {
+			continue
+		}
+		t, err := dump.Table(schema, table)
+		if err == nil {
+			return t, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("table %s.%s not found in backup", schema, table)
+}
+
+func copyRows(t *dumpfile.Table, path string, w rowWriter) (int, error) {
+	chunk, err := t.OpenChunk(path)
+	if err != nil {
+		return 0, err
+	}
+	defer chunk.Close()
+
+	reader := dumpfile.NewReader(chunk)
+	count := 0
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		if err := w.Write(row); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
+
+type rowWriter interface {
+	Write(row dumpfile.Row) error
+	Close() error
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	columns int
+	record  []string
+}
+
+func newCSVWriter(out io.Writer, columns []string) (*csvWriter, error) {
+	w := csv.NewWriter(out)
+	if err := w.Write(columns); err != nil {
+		return nil, err
+	}
+	return &csvWriter{w: w, columns: len(columns), record: make([]string, len(columns))}, nil
+}
+
+// Write writes a row; NULLs become empty fields.
+func (c *csvWriter) Write(row dumpfile.Row) error {
+	if len(row) != c.columns {
+		return fmt.Errorf("row has %d fields, expected %d", len(row), c.columns)
+	}
+	for i, v := range row {
+		c.record[i] = v.String
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type parquetWriter struct {
+	w       *parquet.Writer
+	indexes []int
+	batch   []parquet.Row
+}
+
+// newParquetWriter writes every column as an optional UTF-8 string.
+func newParquetWriter(out io.Writer, name string, columns []string) (*parquetWriter, error) {
+	group := parquet.Group{}
+	for _, column := range columns {
+		group[column] = parquet.Optional(parquet.String())
+	}
+	schema := parquet.NewSchema(strings.ToLower(name), group)
+
+	// Group fields are ordered by name, so map dump columns to leaf indexes
+	indexes := make([]int, len(columns))
+	for i, column := range columns {
+		leaf, ok := schema.Lookup(column)
+		if !ok {
+			return nil, fmt.Errorf("column %s missing from parquet schema", column)
+		}
+		indexes[i] = leaf.ColumnIndex
+	}
+
+	return &parquetWriter{w: parquet.NewWriter(out, schema), indexes: indexes}, nil
+}
+
+func (p *parquetWriter) Write(row dumpfile.Row) error {
+	if len(row) != len(p.indexes) {
+		return fmt.Errorf("row has %d fields, expected %d", len(row), len(p.indexes))
+	}
+	values := make(parquet.Row, len(row))
+	for i, v := range row {
+		index := p.indexes[i]
+		if v.Valid {
+			values[index] = parquet.ByteArrayValue([]byte(v.String)).Level(0, 1, index)
+		} else {
+			values[index] = parquet.NullValue().Level(0, 0, index)
+		}
+	}
+	p.batch = append(p.batch, values)
+	if len(p.batch) >= 1024 {
+		return p.flush()
+	}
+	return nil
+}
+
+func (p *parquetWriter) flush() error {
+	if _, err := p.w.WriteRows(p.batch); err != nil {
+		return err
+	}
+	p.batch = p.batch[:0]
+	return nil
+}
+
+func (p *parquetWriter) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	return p.w.Close()
+}
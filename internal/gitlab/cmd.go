@@ -3,7 +3,9 @@ package gitlab
 import (
 	"context"
 	"fmt"
-	"log"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/urfave/cli/v3"
 
@@ -12,14 +14,24 @@ import (
 )
 
 var Command = &cli.Command{
-	Name:   "gitlab",
-	Usage:  "Run GitLab backup workflow (Docker-based)",
+	Name:  "gitlab",
+	Usage: "Run GitLab backup workflow (Docker-based)",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "instance",
+			Usage: "Only back up this instance (repeatable, default: all due instances)",
+		},
+		&cli.BoolFlag{
+			Name:  "force",
+			Usage: "Back up instances even if their interval has not elapsed",
+		},
+	},
 	Action: run,
 }
 
 func run(ctx context.Context, c *cli.Command) error {
 	// 1. Check required tools
-	if err := helper.CheckTools("docker", "zip", "unzip"); err != nil {
+	if err := helper.CheckTools("zip", "unzip", "tar"); err != nil {
 		return err
 	}
 
@@ -37,24 +49,53 @@ func run(ctx context.Context, c *cli.Command) error {
 	}
 	defer unlock()
 
-	log.Printf("Starting GitLab backup workflow using config: %s", configPath)
-	log.Printf("GitLab container: %s", cfg.GitLab.ContainerName)
+	helper.Infof("Starting GitLab backup workflow using config: %s", configPath)
 
-	// 3. Initialize Telegram notifier
-	notifier := helper.NewTelegramSender(cfg.Telegram.BotToken, cfg.Telegram.ChatID)
+	// 4. Initialize Telegram notifier
+	notifier := helper.NewNotifier(cfg)
 
-	// 4. Initialize storage
-	store, err := helper.NewStorage(cfg.R2)
-	if err != nil {
-		return fmt.Errorf("failed to initialize storage: %w", err)
-	}
+	// 5. Back up every selected instance that is due
+	selected := c.StringSlice("instance")
+	runs := loadLastRuns(cfg.GitLab.StateFile)
+	var failed []string
+	for _, instance := range cfg.GitLab.AllInstances() {
+		if len(selected) > 0 && !slices.Contains(selected, instance.Name) {
+			continue
+		}
+		now := time.Now()
+		if !c.Bool("force") && len(selected) == 0 && !runs.due(instance, now) {
+			helper.Infof("Skipping GitLab instance %s: last backup at %s is within its %s interval", instance.Name, runs[instance.Name].Format(time.RFC3339), instance.Interval)
+			continue
+		}
+		helper.Infof("GitLab instance %s", instance.Name)
 
-	// 5. Create and run worker
-	worker := NewWorker(cfg, store, notifier, c.Bool("only-dump"))
-	if err := worker.Run(ctx); err != nil {
-		return err
+		// Each instance may upload under its own prefix, on mirrors too
+		storeCfg := *cfg
+		if instance.PathPrefix != "" {
+			storeCfg.R2.PathPrefix = instance.PathPrefix
+			storeCfg.B2.PathPrefix = instance.PathPrefix
+			storeCfg.WebDAV.PathPrefix = instance.PathPrefix
+		}
+		store, err := helper.NewStorage(&storeCfg, helper.OptionsFrom(ctx))
+		if err != nil {
+			return fmt.Errorf("failed to initialize storage: %w", err)
+		}
+
+		worker := NewWorker(&storeCfg, instance, store, notifier, helper.OptionsFrom(ctx))
+		if err := worker.Run(ctx); err != nil {
+			helper.Infof("%v", err)
+			failed = append(failed, instance.Name)
+			continue
+		}
+		runs[instance.Name] = now
+		if err := runs.save(cfg.GitLab.StateFile); err != nil {
+			helper.Warnf("failed to save GitLab state: %v", err)
+		}
 	}
 
-	log.Println("GitLab backup workflow completed successfully.")
+	if len(failed) > 0 {
+		return fmt.Errorf("GitLab backup failed for: %s", strings.Join(failed, ", "))
+	}
+	helper.Infof("GitLab backup workflow completed successfully.")
 	return nil
 }
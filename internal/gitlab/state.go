@@ -0,0 +1,41 @@
+package gitlab
+
+import (
+	"os"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// lastRuns maps instance names to the time of their last successful backup.
+type lastRuns map[string]time.Time
+
+// loadLastRuns reads the state file. A missing or unreadable file means no
+// instance has run yet.
+func loadLastRuns(path string) lastRuns {
+	runs := make(lastRuns)
+	if data, err := os.ReadFile(path); err == nil {
+		sonic.Unmarshal(data, &runs)
+	}
+	return runs
+}
+
+func (r lastRuns) save(path string) error {
+	data, err := sonic.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// due reports whether the instance's interval has elapsed since its last run.
+func (r lastRuns) due(instance config.GitLabInstance, now time.Time) bool {
+	if instance.Interval == "" {
+		return true
+	}
+	interval, _ := time.ParseDuration(instance.Interval) // Validated by LoadConfig
+	last, ok := r[instance.Name]
+	return !ok || now.Sub(last) >= interval
+}
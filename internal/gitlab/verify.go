@@ -0,0 +1,55 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// backupIDPattern matches the line gitlab-rake prints when a backup is created,
+// e.g. "Backup 1700000000_2023_11_14_16.5.1 is done."
+var backupIDPattern = regexp.MustCompile(`Backup (\S+) is done`)
+
+// parseBackupID returns the backup ID reported by gitlab-rake, or "" if none was reported.
+func parseBackupID(output string) string {
+	m := backupIDPattern.FindStringSubmatch(output)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// verifyBackup checks the fetched files: the data tarball must be readable and
+// match the backup ID reported by rake, and gitlab-secrets.json must be present,
+// since a restore without it cannot decrypt the database.
+func verifyBackup(ctx context.Context, dir, backupFilename, backupID string) error {
+	var problems []string
+
+	if backupID == "" {
+		helper.Warnf("gitlab-rake did not report a backup ID")
+	} else if want := backupID + "_gitlab_backup.tar"; backupFilename != want {
+		problems = append(problems, fmt.Sprintf("uploaded %s, but rake created backup %s", backupFilename, backupID))
+	}
+
+	if _, err := helper.Run(ctx, helper.Command{Name: "tar", Args: []string{"-tf", filepath.Join(dir, backupFilename)}}); err != nil {
+		problems = append(problems, fmt.Sprintf("tar listing failed: %v", err))
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "gitlab-secrets.json"))
+	if err != nil {
+		problems = append(problems, "gitlab-secrets.json is missing")
+	} else if info.Size() == 0 {
+		problems = append(problems, "gitlab-secrets.json is empty")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	helper.Infof("Verified GitLab backup %s", backupFilename)
+	return nil
+}
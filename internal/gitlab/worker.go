@@ -3,45 +3,64 @@ package gitlab
 import (
 	"context"
 	"fmt"
-	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/docker"
 	"github.com/davexpro/backup/internal/pkg/helper"
 )
 
-// Worker handles GitLab backup operations.
+// Worker handles GitLab backup operations for one instance.
 type Worker struct {
 	cfg      *config.Config
-	store    *helper.Storage
+	instance config.GitLabInstance
+	store    helper.Storage
 	notifier *helper.TelegramSender
+	pipeline *helper.Pipeline
 	onlyDump bool
 }
 
 // NewWorker creates a new GitLab backup worker.
-func NewWorker(cfg *config.Config, store *helper.Storage, notifier *helper.TelegramSender, onlyDump bool) *Worker {
+func NewWorker(cfg *config.Config, instance config.GitLabInstance, store helper.Storage, notifier *helper.TelegramSender, opts helper.Options) *Worker {
 	return &Worker{
 		cfg:      cfg,
+		instance: instance,
 		store:    store,
 		notifier: notifier,
-		onlyDump: onlyDump,
+		pipeline: helper.NewPipeline(cfg, store, opts),
+		onlyDump: opts.OnlyDump,
 	}
 }
 
 // Run executes the GitLab backup workflow.
 func (w *Worker) Run(ctx context.Context) error {
+	if helper.CheckPaused(w.cfg, w.notifier, w.instance.Name) {
+		return nil
+	}
+	stop := w.pipeline.Start()
+	defer stop()
+	// Verify storage before the long backup stage
+	if err := w.pipeline.SelfTest(ctx, w.notifier, w.instance.Name); err != nil {
+		return err
+	}
+	w.pipeline.FlushSpool(ctx)
+
 	start := time.Now()
 	result := w.backup(ctx)
 	result.Duration = time.Since(start)
 
-	helper.SendReport(w.notifier, []helper.BackupResult{result}, 1, 0)
+	successCount, failCount := 1, 0
+	if !result.Success {
+		successCount, failCount = 0, 1
+	}
+	w.pipeline.PruneLocal(ctx)
+	w.pipeline.Report(w.notifier, w.instance.Name, []helper.BackupResult{result}, successCount, failCount)
 
 	if !result.Success {
-		return fmt.Errorf("GitLab backup failed: %v", result.Error)
+		return fmt.Errorf("GitLab backup of %s failed: %v", w.instance.Name, result.Error)
 	}
 	return nil
 }
@@ -49,98 +68,104 @@ func (w *Worker) Run(ctx context.Context) error {
 func (w *Worker) backup(ctx context.Context) helper.BackupResult {
 	start := time.Now()
 	timestamp := start.Format("20060102_150405")
-	tempDir := filepath.Join(w.cfg.Backup.TempDir, fmt.Sprintf("gitlab_backup_%s", timestamp))
+	tempDir := filepath.Join(w.cfg.Backup.TempDir, fmt.Sprintf("%s_backup_%s", helper.EscapeName(w.instance.Name), timestamp))
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		return helper.BackupResult{Database: "gitlab", Success: false, Error: fmt.Errorf("failed to create temp dir: %w", err)}
+		return helper.BackupResult{Database: w.instance.Name, Success: false, Error: fmt.Errorf("failed to create temp dir: %w", err)}
 	}
 	// Cleanup based on config
 	if w.cfg.Backup.DeleteAfterUpload {
 		defer os.RemoveAll(tempDir)
 	} else {
-		log.Printf("Keeping temp directory: %s", tempDir)
+		helper.Infof("Keeping temp directory: %s", tempDir)
+	}
+
+	client, err := docker.NewClient(w.instance.Host)
+	if err != nil {
+		return helper.BackupResult{Database: w.instance.Name, Success: false, Error: err}
+	}
+	container, err := w.container(ctx, client)
+	if err != nil {
+		return helper.BackupResult{Database: w.instance.Name, Success: false, Error: err}
 	}
 
 	// 1. Trigger GitLab Backup via Rake
-	log.Println("Triggering GitLab rake backup...")
-	cmd := exec.CommandContext(ctx, "docker", "exec", w.cfg.GitLab.ContainerName, "gitlab-rake", "gitlab:backup:create")
-	output, err := cmd.CombinedOutput()
+	helper.Infof("Triggering GitLab rake backup...")
+	rakeCtx, cancel := context.WithTimeout(ctx, w.cfg.GitLab.RakeTimeoutDuration())
+	output, err := client.Exec(rakeCtx, container, "gitlab-rake", "gitlab:backup:create")
+	cancel()
 	if err != nil {
-		return helper.BackupResult{Database: "gitlab", Success: false, Error: fmt.Errorf("gitlab-rake failed: %w, output: %s", err, string(output))}
+		return helper.BackupResult{Database: w.instance.Name, Success: false, Error: fmt.Errorf("gitlab-rake failed: %w, output: %s", err, string(output))}
 	}
-	log.Printf("GitLab rake backup completed")
+	helper.Infof("GitLab rake backup completed")
+	backupID := parseBackupID(string(output))
 
 	// 2. Identify the backup file
-	findCmd := exec.CommandContext(ctx, "docker", "exec", w.cfg.GitLab.ContainerName, "bash", "-c", "ls -t /var/opt/gitlab/backups/*_gitlab_backup.tar | head -1")
-	findOutput, err := findCmd.CombinedOutput()
+	findCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	findOutput, err := client.Exec(findCtx, container, "bash", "-c", "ls -t /var/opt/gitlab/backups/*_gitlab_backup.tar | head -1")
+	cancel()
 	if err != nil {
-		return helper.BackupResult{Database: "gitlab", Success: false, Error: fmt.Errorf("failed to find backup file in container: %w, output: %s", err, string(findOutput))}
+		return helper.BackupResult{Database: w.instance.Name, Success: false, Error: fmt.Errorf("failed to find backup file in container: %w, output: %s", err, string(findOutput))}
 	}
 	remoteBackupPath := filepath.Clean(strings.TrimSpace(string(findOutput)))
-	if remoteBackupPath == "" {
-		return helper.BackupResult{Database: "gitlab", Success: false, Error: fmt.Errorf("no backup file found in container")}
+	if remoteBackupPath == "" || remoteBackupPath == "." {
+		return helper.BackupResult{Database: w.instance.Name, Success: false, Error: fmt.Errorf("no backup file found in container")}
 	}
 	backupFilename := filepath.Base(remoteBackupPath)
-	log.Printf("Found backup file: %s", backupFilename)
+	helper.Infof("Found backup file: %s", backupFilename)
 
 	// 3. Copy files from container to host
-	log.Printf("Copying backup file %s to host...", backupFilename)
-	cpCmd := exec.CommandContext(ctx, "docker", "cp", fmt.Sprintf("%s:%s", w.cfg.GitLab.ContainerName, remoteBackupPath), tempDir)
-	cpOutput, err := cpCmd.CombinedOutput()
-	if err != nil {
-		return helper.BackupResult{Database: "gitlab", Success: false, Error: fmt.Errorf("failed to copy backup file: %w, output: %s", err, string(cpOutput))}
+	helper.Infof("Copying backup file %s to host...", backupFilename)
+	copyCtx, cancel := context.WithTimeout(ctx, w.cfg.GitLab.CopyTimeoutDuration())
+	defer cancel()
+	if err := client.CopyFileFrom(copyCtx, container, remoteBackupPath, tempDir); err != nil {
+		return helper.BackupResult{Database: w.instance.Name, Success: false, Error: fmt.Errorf("failed to copy backup file: %w", err)}
 	}
 
-	log.Println("Copying GitLab configuration and secrets...")
+	helper.Infof("Copying GitLab configuration and secrets...")
 	configFiles := []string{"/etc/gitlab/gitlab.rb", "/etc/gitlab/gitlab-secrets.json"}
 	for _, f := range configFiles {
-		cpFileCmd := exec.CommandContext(ctx, "docker", "cp", fmt.Sprintf("%s:%s", w.cfg.GitLab.ContainerName, f), tempDir)
-		if cpErr := cpFileCmd.Run(); cpErr != nil {
-			log.Printf("Warning: failed to copy %s: %v", f, cpErr)
+		if cpErr := client.CopyFileFrom(copyCtx, container, f, tempDir); cpErr != nil {
+			helper.Warnf("failed to copy %s: %v", f, cpErr)
 		}
 	}
 
-	// 4. Zip & Encrypt all fetched files
-	zipFilename := fmt.Sprintf("gitlab_backup_%s.zip", timestamp)
-	localZipPath := filepath.Join(w.cfg.Backup.TempDir, zipFilename)
+	// 4. Zip, encrypt, hash and upload (or save locally) all fetched files
+	result := w.pipeline.Ship(ctx, w.instance.Name+"_backup", tempDir, start, true)
+	result.Database = w.instance.Name
+	if !result.Success {
+		return result
+	}
 
-	if err := helper.ZipEncryptFolder(ctx, w.cfg.Encryption.Password, tempDir, localZipPath); err != nil {
-		return helper.BackupResult{Database: "gitlab", Success: false, Error: fmt.Errorf("zip encryption failed: %w", err)}
+	// 5. Verify what was uploaded is restorable
+	if err := verifyBackup(ctx, tempDir, backupFilename, backupID); err != nil {
+		result.Success = false
+		result.Error = fmt.Errorf("uploaded backup failed verification: %w", err)
 	}
-	// Cleanup zip based on config
-	if w.cfg.Backup.DeleteAfterUpload {
-		defer os.Remove(localZipPath)
-	} else {
-		log.Printf("Keeping zip file: %s", localZipPath)
+	return result
+}
+
+// container returns the name of the instance's GitLab container, resolving
+// it from its docker compose labels when a compose service is configured.
+func (w *Worker) container(ctx context.Context, client *docker.Client) (string, error) {
+	if w.instance.ComposeService == "" {
+		return w.instance.ContainerName, nil
 	}
 
-	// 5. Calculate SHA256
-	hash, size, err := helper.CalculateSHA256(localZipPath)
+	labels := []string{"com.docker.compose.service=" + w.instance.ComposeService}
+	if w.instance.ComposeProject != "" {
+		labels = append(labels, "com.docker.compose.project="+w.instance.ComposeProject)
+	}
+	containers, err := client.ListContainers(ctx, labels...)
 	if err != nil {
-		return helper.BackupResult{Database: "gitlab", Success: false, Error: fmt.Errorf("hash calc failed: %w", err)}
+		return "", fmt.Errorf("failed to resolve compose service %s: %w", w.instance.ComposeService, err)
 	}
-
-	// 6. Handle Upload or Local Save
-	var uploadErr error
-	if w.onlyDump {
-		localDir := "local_backups"
-		os.MkdirAll(localDir, 0755)
-		finalPath := filepath.Join(localDir, zipFilename)
-		uploadErr = helper.CopyFile(localZipPath, finalPath)
-		log.Printf("Saved GitLab backup locally to %s", finalPath)
-	} else {
-		file, err := os.Open(localZipPath)
-		if err != nil {
-			return helper.BackupResult{Database: "gitlab", Success: false, Error: fmt.Errorf("open file failed: %w", err)}
-		}
-		defer file.Close()
-		uploadErr = w.store.Upload(ctx, zipFilename, file)
+	if len(containers) == 0 {
+		return "", fmt.Errorf("no running container for compose service %s (project %q)", w.instance.ComposeService, w.instance.ComposeProject)
 	}
-
-	return helper.BackupResult{
-		Database: "gitlab",
-		Success:  uploadErr == nil,
-		Size:     size,
-		SHA256:   hash,
-		Error:    uploadErr,
+	name := containers[0].Name()
+	if len(containers) > 1 {
+		helper.Warnf("compose service %s has %d containers, using %s", w.instance.ComposeService, len(containers), name)
 	}
+	helper.Infof("Resolved compose service %s to container %s", w.instance.ComposeService, name)
+	return name, nil
 }
@@ -0,0 +1,48 @@
+package host
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var Command = &cli.Command{
+	Name:   "etc",
+	Usage:  "Back up host configuration (/etc, crontabs, systemd units, installed packages)",
+	Action: run,
+}
+
+func run(ctx context.Context, c *cli.Command) error {
+	// 1. Check required tools
+	if err := helper.CheckTools("zip"); err != nil {
+		return err
+	}
+
+	// 2. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// 3. File locking
+	unlock, err := helper.AcquireLock(cfg.LockFile)
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+	defer unlock()
+
+	// 4. Initialize storage
+	notifier := helper.NewNotifier(cfg)
+	store, err := helper.NewStorage(cfg, helper.OptionsFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	// 5. Create and run worker
+	helper.Infof("Starting host configuration backup of %v", cfg.Host.Paths)
+	return NewWorker(cfg, store, notifier, helper.OptionsFrom(ctx)).Run(ctx)
+}
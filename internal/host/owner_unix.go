@@ -0,0 +1,16 @@
+//go:build !windows
+
+package host
+
+import (
+	"os"
+	"syscall"
+)
+
+// owner returns the numeric owner of a file.
+func owner(info os.FileInfo) (uint32, uint32) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Uid, st.Gid
+	}
+	return 0, 0
+}
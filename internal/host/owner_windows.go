@@ -0,0 +1,8 @@
+package host
+
+import "os"
+
+// owner returns the numeric owner of a file; Windows has no uid/gid.
+func owner(os.FileInfo) (uint32, uint32) {
+	return 0, 0
+}
@@ -0,0 +1,222 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// Files written next to the archived paths, describing what zip cannot keep.
+const (
+	packagesFile = "_packages.txt" // Installed packages (dpkg selections or rpm list)
+	symlinksFile = "_symlinks.txt" // "<link>\t<target>" for every symlink
+	metadataFile = "_metadata.tsv" // "<mode>\t<uid>\t<gid>\t<path>" for every archived entry
+)
+
+// Worker archives the host configuration.
+type Worker struct {
+	cfg      *config.Config
+	store    helper.Storage
+	notifier *helper.TelegramSender
+	pipeline *helper.Pipeline
+	onlyDump bool
+}
+
+// NewWorker creates a new host configuration worker.
+func NewWorker(cfg *config.Config, store helper.Storage, notifier *helper.TelegramSender, opts helper.Options) *Worker {
+	return &Worker{
+		cfg:      cfg,
+		store:    store,
+		notifier: notifier,
+		pipeline: helper.NewPipeline(cfg, store, opts),
+		onlyDump: opts.OnlyDump,
+	}
+}
+
+// Run archives the configured paths and the installed-package list as
+// "etc_<hostname>".
+func (w *Worker) Run(ctx context.Context) error {
+	if helper.CheckPaused(w.cfg, w.notifier, "etc") {
+		return nil
+	}
+	stop := w.pipeline.Start()
+	defer stop()
+	if err := w.pipeline.SelfTest(ctx, w.notifier, "etc"); err != nil {
+		return err
+	}
+	w.pipeline.FlushSpool(ctx)
+
+	start := time.Now()
+	result := w.backup(ctx, start)
+	result.Duration = time.Since(start)
+
+	successCount, failCount := 1, 0
+	if !result.Success {
+		successCount, failCount = 0, 1
+	}
+	w.pipeline.PruneLocal(ctx)
+	w.pipeline.Report(w.notifier, "etc", []helper.BackupResult{result}, successCount, failCount)
+
+	if !result.Success {
+		return fmt.Errorf("host configuration backup failed: %v", result.Error)
+	}
+	return nil
+}
+
+func (w *Worker) backup(ctx context.Context, start time.Time) helper.BackupResult {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	name := "etc_" + hostname
+
+	stageDir := filepath.Join(w.cfg.Backup.TempDir, fmt.Sprintf("%s_%s", helper.EscapeName(name), start.Format(helper.TimestampLayout)))
+	if err := os.MkdirAll(stageDir, 0700); err != nil {
+		return helper.BackupResult{Database: name, Success: false, Error: fmt.Errorf("failed to create temp dir: %w", err)}
+	}
+	defer os.RemoveAll(stageDir)
+
+	s := &stager{dir: stageDir, exclude: w.cfg.Host.Exclude}
+	for _, path := range w.cfg.Host.Paths {
+		if err := s.stage(path); err != nil {
+			return helper.BackupResult{Database: name, Success: false, Error: fmt.Errorf("failed to stage %s: %w", path, err)}
+		}
+	}
+	if err := s.writeIndexes(); err != nil {
+		return helper.BackupResult{Database: name, Success: false, Error: err}
+	}
+	if s.skipped > 0 {
+		helper.Warnf("skipped %d unreadable files (run as root to include them)", s.skipped)
+	}
+
+	if err := writePackages(ctx, filepath.Join(stageDir, packagesFile)); err != nil {
+		helper.Warnf("failed to list installed packages: %v", err)
+	}
+
+	helper.Infof("Staged %d files of host configuration", s.files)
+	result := w.pipeline.Ship(ctx, name, stageDir, start, false)
+	result.Database = name
+	return result
+}
+
+// stager copies host paths into a staging directory, keeping their absolute
+// layout and recording what zip would lose.
+type stager struct {
+	dir      string
+	exclude  []string
+	symlinks strings.Builder
+	metadata strings.Builder
+	files    int
+	skipped  int
+}
+
+func (s *stager) stage(root string) error {
+	if _, err := os.Lstat(root); os.IsNotExist(err) {
+		helper.Infof("Skipping missing path %s", root)
+		return nil
+	}
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsPermission(err) {
+				s.skipped++
+				return nil
+			}
+			return err
+		}
+		if s.excluded(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil // Vanished while walking
+		}
+		target := filepath.Join(s.dir, path)
+
+		switch {
+		case d.IsDir():
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return nil
+			}
+			fmt.Fprintf(&s.symlinks, "%s\t%s\n", path, link)
+			return nil
+		case info.Mode().IsRegular():
+			if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+				return err
+			}
+			if err := helper.CopyFile(path, target); err != nil {
+				if os.IsPermission(err) {
+					s.skipped++
+					return nil
+				}
+				return err
+			}
+			s.files++
+		default:
+			return nil // Sockets, devices and pipes
+		}
+
+		uid, gid := owner(info)
+		fmt.Fprintf(&s.metadata, "%#o\t%d\t%d\t%s\n", info.Mode().Perm(), uid, gid, path)
+		return nil
+	})
+}
+
+func (s *stager) excluded(path string) bool {
+	for _, pattern := range s.exclude {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *stager) writeIndexes() error {
+	if err := os.WriteFile(filepath.Join(s.dir, symlinksFile), []byte(s.symlinks.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write symlink index: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, metadataFile), []byte(s.metadata.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write metadata index: %w", err)
+	}
+	return nil
+}
+
+// writePackages records the installed packages with dpkg or rpm, whichever is present.
+func writePackages(ctx context.Context, path string) error {
+	var cmd helper.Command
+	if _, err := exec.LookPath("dpkg"); err == nil {
+		cmd = helper.Command{Name: "dpkg", Args: []string{"--get-selections"}}
+	} else if _, err := exec.LookPath("rpm"); err == nil {
+		cmd = helper.Command{Name: "rpm", Args: []string{"-qa", "--qf", "%{NAME}-%{VERSION}-%{RELEASE}.%{ARCH}\n"}}
+	} else {
+		return fmt.Errorf("neither dpkg nor rpm found")
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = f
+	if _, err := helper.Run(ctx, cmd); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,138 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// unsafeChars matches characters replaced when a suffix is used in an artifact name.
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// Worker exports OpenLDAP databases as LDIF with slapcat.
+type Worker struct {
+	cfg      *config.Config
+	store    helper.Storage
+	notifier *helper.TelegramSender
+	pipeline *helper.Pipeline
+	onlyDump bool
+}
+
+// NewWorker creates a new LDAP worker.
+func NewWorker(cfg *config.Config, store helper.Storage, notifier *helper.TelegramSender, opts helper.Options) *Worker {
+	return &Worker{
+		cfg:      cfg,
+		store:    store,
+		notifier: notifier,
+		pipeline: helper.NewPipeline(cfg, store, opts),
+		onlyDump: opts.OnlyDump,
+	}
+}
+
+// Run exports cn=config as "ldap_config" and every database suffix as
+// "ldap_<suffix>", each as its own artifact.
+func (w *Worker) Run(ctx context.Context) error {
+	if helper.CheckPaused(w.cfg, w.notifier, "ldap") {
+		return nil
+	}
+	stop := w.pipeline.Start()
+	defer stop()
+	if err := w.pipeline.SelfTest(ctx, w.notifier, "ldap"); err != nil {
+		return err
+	}
+	w.pipeline.FlushSpool(ctx)
+
+	var results []helper.BackupResult
+	successCount, failCount := 0, 0
+	record := func(result helper.BackupResult) {
+		results = append(results, result)
+		if result.Success {
+			successCount++
+		} else {
+			failCount++
+			helper.Errorf("backup of %s failed: %v", result.Database, result.Error)
+		}
+	}
+
+	// cn=config is database 0 and also tells which suffixes exist
+	start := time.Now()
+	configLDIF, result := w.export(ctx, "ldap_config", start, "-n", "0")
+	result.Duration = time.Since(start)
+	record(result)
+
+	suffixes := w.cfg.LDAP.Suffixes
+	if len(suffixes) == 0 {
+		suffixes = parseSuffixes(configLDIF)
+		helper.Infof("Found %d LDAP database suffixes: %v", len(suffixes), suffixes)
+	}
+	for _, suffix := range suffixes {
+		start := time.Now()
+		_, result := w.export(ctx, "ldap_"+artifactName(suffix), start, "-b", suffix)
+		result.Database = suffix
+		result.Duration = time.Since(start)
+		record(result)
+	}
+
+	w.pipeline.PruneLocal(ctx)
+	w.pipeline.Report(w.notifier, "ldap", results, successCount, failCount)
+
+	if failCount > 0 {
+		return fmt.Errorf("ldap backup completed with %d failures", failCount)
+	}
+	return nil
+}
+
+// export runs slapcat with the database selection args and ships the LDIF.
+// It returns the LDIF so cn=config can be inspected.
+func (w *Worker) export(ctx context.Context, name string, start time.Time, selection ...string) ([]byte, helper.BackupResult) {
+	stageDir := filepath.Join(w.cfg.Backup.TempDir, fmt.Sprintf("%s_%s", helper.EscapeName(name), start.Format(helper.TimestampLayout)))
+	if err := os.MkdirAll(stageDir, 0700); err != nil {
+		return nil, helper.BackupResult{Database: name, Success: false, Error: fmt.Errorf("failed to create temp dir: %w", err)}
+	}
+	defer os.RemoveAll(stageDir)
+
+	ldifPath := filepath.Join(stageDir, helper.EscapeName(name)+".ldif")
+	args := append([]string{"-o", "ldif-wrap=no", "-l", ldifPath}, selection...)
+	if w.cfg.LDAP.ConfigDir != "" {
+		args = append(args, "-F", w.cfg.LDAP.ConfigDir)
+	}
+	helper.Infof("Exporting %s with slapcat %s", name, strings.Join(selection, " "))
+	if _, err := helper.Run(ctx, helper.Command{Name: w.cfg.LDAP.SlapcatPath, Args: args}); err != nil {
+		return nil, helper.BackupResult{Database: name, Success: false, Error: fmt.Errorf("slapcat failed: %w", err)}
+	}
+	ldif, err := os.ReadFile(ldifPath)
+	if err != nil {
+		return nil, helper.BackupResult{Database: name, Success: false, Error: fmt.Errorf("failed to read LDIF: %w", err)}
+	}
+
+	result := w.pipeline.Ship(ctx, name, stageDir, start, true)
+	result.Database = name
+	return ldif, result
+}
+
+// parseSuffixes returns the olcSuffix values of an unwrapped cn=config LDIF.
+func parseSuffixes(ldif []byte) []string {
+	var suffixes []string
+	scanner := bufio.NewScanner(bytes.NewReader(ldif))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "olcSuffix: "); ok {
+			suffixes = append(suffixes, strings.TrimSpace(value))
+		}
+	}
+	return suffixes
+}
+
+// artifactName turns a suffix such as "dc=example,dc=com" into "dc_example_dc_com".
+func artifactName(suffix string) string {
+	return strings.Trim(unsafeChars.ReplaceAllString(strings.ToLower(suffix), "_"), "_")
+}
@@ -0,0 +1,202 @@
+package mysql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/dumpfile"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var (
+	fakeFirstNames = []string{"Alex", "Sam", "Jordan", "Taylor", "Morgan", "Casey", "Riley", "Jamie", "Avery", "Quinn"}
+	fakeLastNames  = []string{"Smith", "Miller", "Garcia", "Chen", "Novak", "Okafor", "Silva", "Larsen", "Kowalski", "Tanaka"}
+)
+
+// shipStaging copies a dump, masks the configured columns and ships the copy
+// as a separate "<name>_staging" artifact that is safe for non-prod environments.
+func (w *Worker) shipStaging(ctx context.Context, name, dumpDir string, timeNow time.Time, flatten bool) helper.BackupResult {
+	start := time.Now()
+	stagingName := name + "_staging"
+	stagingDir := dumpDir + "_staging"
+
+	if err := helper.CopyDir(dumpDir, stagingDir); err != nil {
+		return helper.BackupResult{Database: stagingName, Success: false, Error: fmt.Errorf("failed to copy dump: %w", err)}
+	}
+	defer os.RemoveAll(stagingDir)
+
+	if err := w.anonymize(stagingDir); err != nil {
+		return helper.BackupResult{Database: stagingName, Success: false, Error: fmt.Errorf("anonymization failed: %w", err)}
+	}
+
+	result := w.pipeline.Ship(ctx, stagingName, stagingDir, timeNow, flatten)
+	result.Duration = time.Since(start)
+	return result
+}
+
+// anonymize rewrites the masked columns of every dump found under dir in place.
+func (w *Worker) anonymize(dir string) error {
+	dumps, err := dumpfile.FindDumps(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, dump := range dumps {
+		for _, schema := range dump.Schemas {
+			for table, rules := range w.maskRules(schema) {
+				t, err := dump.Table(schema, table)
+				if os.IsNotExist(err) {
+					continue // Table not part of this dump
+				}
+				if err != nil {
+					return err
+				}
+				helper.Infof("Masking %d columns of %s.%s", len(rules), schema, table)
+				if err := w.maskTable(t, rules); err != nil {
+					return fmt.Errorf("%s.%s: %w", schema, table, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// maskRules returns the configured rules applying to a schema, grouped by table.
+func (w *Worker) maskRules(schema string) map[string][]config.MaskRule {
+	rules := make(map[string][]config.MaskRule)
+	for _, rule := range w.cfg.Anonymize.Rules {
+		table := rule.Table
+		if s, t, qualified := strings.Cut(rule.Table, "."); qualified {
+			if s != schema {
+				continue
+			}
+			table = t
+		}
+		rules[table] = append(rules[table], rule)
+	}
+	return rules
+}
+
+func (w *Worker) maskTable(t *dumpfile.Table, rules []config.MaskRule) error {
+	indexes := make([]int, len(rules))
+	for i, rule := range rules {
+		indexes[i] = -1
+		for j, column := range t.Columns {
+			if column == rule.Column {
+				indexes[i] = j
+				break
+			}
+		}
+		if indexes[i] < 0 {
+			return fmt.Errorf("column %s not found", rule.Column)
+		}
+	}
+
+	files, err := t.DataFiles()
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		if err := w.maskChunk(t, path, rules, indexes); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+	}
+	return nil
+}
+
+func (w *Worker) maskChunk(t *dumpfile.Table, path string, rules []config.MaskRule, indexes []int) error {
+	in, err := t.OpenChunk(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmpPath := path + ".tmp"
+	out, err := t.CreateChunk(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	reader := dumpfile.NewReader(in)
+	writer := dumpfile.NewWriter(out)
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			out.Close()
+			return err
+		}
+		for i, rule := range rules {
+			if indexes[i] < len(row) {
+				row[indexes[i]] = maskValue(rule, w.cfg.Anonymize.Salt, row[indexes[i]])
+			}
+		}
+		if err := writer.Write(row); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	// The index file records the uncompressed data size used by util.loadDump
+	idxPath := path + ".idx"
+	if _, err := os.Stat(idxPath); err == nil {
+		idx := make([]byte, 8)
+		binary.BigEndian.PutUint64(idx, uint64(writer.Written()))
+		if err := os.WriteFile(idxPath, idx, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maskValue replaces a value according to the rule. Generated values are
+// derived from the original so equal inputs stay equal (joins keep working).
+func maskValue(rule config.MaskRule, salt string, v sql.NullString) sql.NullString {
+	if !v.Valid {
+		return v
+	}
+
+	sum := sha256.Sum256([]byte(salt + "\x00" + v.String))
+	digest := hex.EncodeToString(sum[:])
+
+	switch rule.Method {
+	case "email":
+		return sql.NullString{String: fmt.Sprintf("user_%s@example.invalid", digest[:12]), Valid: true}
+	case "name":
+		first := fakeFirstNames[int(sum[0])%len(fakeFirstNames)]
+		last := fakeLastNames[int(sum[1])%len(fakeLastNames)]
+		return sql.NullString{String: first + " " + last, Valid: true}
+	case "token":
+		token := strings.Repeat(digest, len(v.String)/len(digest)+1)
+		return sql.NullString{String: token[:len(v.String)], Valid: true}
+	case "hash":
+		return sql.NullString{String: digest, Valid: true}
+	case "fixed":
+		return sql.NullString{String: rule.Value, Valid: true}
+	default: // null
+		return sql.NullString{}
+	}
+}
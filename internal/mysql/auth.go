@@ -0,0 +1,109 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// address returns the host and port of the server, from the SRV record of
+// mysql.srv when set.
+func (w *Worker) address() (string, int, error) {
+	w.resolveOnce.Do(func() {
+		w.host, w.port = w.cfg.MySQL.Host, w.cfg.MySQL.Port
+		if w.cfg.MySQL.SRV == "" {
+			return
+		}
+		w.host, w.port, w.resolveErr = helper.ResolveSRV(context.Background(), w.cfg.MySQL.SRV)
+		if w.resolveErr == nil {
+			helper.Infof("Resolved %s to %s", w.cfg.MySQL.SRV, net.JoinHostPort(w.host, strconv.Itoa(w.port)))
+		}
+	})
+	return w.host, w.port, w.resolveErr
+}
+
+// connArgs returns the mysqlsh connection arguments and a cleanup function.
+// Credentials come from a mysql_config_editor login path, a generated
+// defaults-extra-file, or inline flags, in that order of preference. The
+// option file arguments must come first on the mysqlsh command line.
+func (w *Worker) connArgs() ([]string, func(), error) {
+	my := w.cfg.MySQL
+	noop := func() {}
+	host, port, err := w.address()
+	if err != nil {
+		return nil, noop, err
+	}
+	if w.dumpHost != "" {
+		host, port = w.dumpHost, w.dumpPort
+	}
+
+	if my.LoginPath != "" {
+		args := []string{fmt.Sprintf("--login-path=%s", my.LoginPath)}
+		if my.SRV != "" {
+			// Flags given after a login path take precedence over it
+			args = append(args, fmt.Sprintf("--host=%s", host), fmt.Sprintf("--port=%d", port))
+		}
+		return args, noop, nil
+	}
+
+	if my.OptionFile {
+		f, err := os.CreateTemp(w.cfg.Backup.TempDir, "mysqlsh_*.cnf")
+		if err != nil {
+			return nil, noop, fmt.Errorf("failed to create option file: %w", err)
+		}
+		cleanup := func() { os.Remove(f.Name()) }
+
+		var b strings.Builder
+		b.WriteString("[client]\n")
+		fmt.Fprintf(&b, "user=%s\n", optionValue(my.User))
+		fmt.Fprintf(&b, "password=%s\n", optionValue(my.Password))
+		fmt.Fprintf(&b, "host=%s\n", optionValue(host))
+		fmt.Fprintf(&b, "port=%d\n", port)
+
+		// CreateTemp already uses 0600, so the password is never world-readable
+		if _, err := f.WriteString(b.String()); err != nil {
+			f.Close()
+			cleanup()
+			return nil, noop, fmt.Errorf("failed to write option file: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			cleanup()
+			return nil, noop, fmt.Errorf("failed to write option file: %w", err)
+		}
+		return []string{fmt.Sprintf("--defaults-extra-file=%s", f.Name())}, cleanup, nil
+	}
+
+	return []string{
+		fmt.Sprintf("--user=%s", my.User),
+		fmt.Sprintf("--password=%s", my.Password),
+		fmt.Sprintf("--host=%s", host),
+		fmt.Sprintf("--port=%d", port),
+	}, noop, nil
+}
+
+// serverArgs returns the connection arguments of connArgs, pointed at another
+// server.
+func (w *Worker) serverArgs(host string, port int) ([]string, func(), error) {
+	args, cleanup, err := w.connArgs()
+	if err != nil {
+		return nil, cleanup, err
+	}
+	// Flags given after a login path or option file take precedence over it
+	args = slices.DeleteFunc(args, func(arg string) bool {
+		return strings.HasPrefix(arg, "--host=") || strings.HasPrefix(arg, "--port=")
+	})
+	return append(args, fmt.Sprintf("--host=%s", host), fmt.Sprintf("--port=%d", port)), cleanup, nil
+}
+
+// optionValue quotes a value for a MySQL option file.
+func optionValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return `"` + v + `"`
+}
@@ -0,0 +1,164 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/davexpro/backup/internal/pkg/dumpfile"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// startCanary writes a fresh token to the canary table of dbName and waits
+// mysql.canary.wait for it to replicate. The dump taken next must contain it,
+// which catches dumps of a stale replica or of the wrong server.
+func (w *Worker) startCanary(ctx context.Context, dbName string) (string, error) {
+	token, err := w.writeCanary(ctx, dbName)
+	if err != nil {
+		return "", fmt.Errorf("failed to write canary: %w", err)
+	}
+	if wait := w.cfg.MySQL.Canary.WaitDuration(); wait > 0 {
+		helper.Infof("Waiting %s for the canary of %s to replicate", wait, dbName)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	return token, nil
+}
+
+// writeCanary replaces the row of the canary table of dbName with a new
+// token, on mysql.canary.host when set.
+func (w *Worker) writeCanary(ctx context.Context, dbName string) (string, error) {
+	token := time.Now().UTC().Format("20060102T150405Z") + "-" + helper.NewRunID()
+	table := quoteIdent(dbName) + "." + quoteIdent(w.cfg.MySQL.Canary.Table)
+	script := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id TINYINT PRIMARY KEY,
+		token VARCHAR(64) NOT NULL,
+		written_at DATETIME NOT NULL
+	);
+	REPLACE INTO %s (id, token, written_at) VALUES (1, '%s', UTC_TIMESTAMP());`, table, table, token)
+
+	args, cleanup, err := w.canaryArgs()
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	args = append(args, "--sql", "-e", script)
+
+	if _, err := helper.Run(ctx, helper.Command{Name: w.cfg.MySQL.ShellPath, Args: args}); err != nil {
+		return "", fmt.Errorf("mysqlsh failed: %w", err)
+	}
+	helper.Infof("Wrote canary %s to %s", token, table)
+	return token, nil
+}
+
+// canaryArgs returns the connection arguments for the canary write, pointed
+// at mysql.canary.host/port when set, and at mysql.host otherwise, even when
+// dumps are taken from a replica.
+func (w *Worker) canaryArgs() ([]string, func(), error) {
+	host, port, err := w.address()
+	if err != nil {
+		return nil, func() {}, err
+	}
+	canary := w.cfg.MySQL.Canary
+	if canary.Host != "" {
+		host = canary.Host
+	}
+	if canary.Port != 0 {
+		port = canary.Port
+	}
+	return w.serverArgs(host, port)
+}
+
+// verifyCanary checks that the dump in dir holds token in the canary table
+// of dbName.
+func verifyCanary(dir, dbName, table, token string) error {
+	dump, err := dumpfile.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read dump: %w", err)
+	}
+	t, err := dump.Table(dbName, table)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("canary table %s.%s is missing from the dump", dbName, table)
+	}
+	if err != nil {
+		return err
+	}
+	column := slices.Index(t.Columns, "token")
+	if column < 0 {
+		return fmt.Errorf("canary table %s.%s has no token column", dbName, table)
+	}
+
+	files, err := t.DataFiles()
+	if err != nil {
+		return err
+	}
+	var found []string
+	for _, path := range files {
+		tokens, err := readColumn(t, path, column)
+		if err != nil {
+			return fmt.Errorf("failed to read canary: %w", err)
+		}
+		found = append(found, tokens...)
+	}
+	if slices.Contains(found, token) {
+		helper.Infof("Canary %s found in the dump of %s", token, dbName)
+		return nil
+	}
+	if len(found) == 0 {
+		return fmt.Errorf("canary %s not found in the dump of %s (table is empty): the dump was taken from a stale replica or another server", token, dbName)
+	}
+	return fmt.Errorf("dump of %s holds canary %s instead of %s: the dump was taken from a stale replica or another server", dbName, strings.Join(found, ", "), token)
+}
+
+// readColumn returns the values of a column in a data chunk.
+func readColumn(t *dumpfile.Table, path string, column int) ([]string, error) {
+	in, err := t.OpenChunk(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	var values []string
+	reader := dumpfile.NewReader(in)
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if column < len(row) && row[column].Valid {
+			values = append(values, row[column].String)
+		}
+	}
+}
+
+// quoteIdent quotes a MySQL identifier.
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// jsString returns s as a JavaScript string literal, for mysqlsh scripts.
+func jsString(s string) string {
+	literal, _ := sonic.MarshalString(s) // Strings always encode
+	return literal
+}
+
+// jsList returns values as a JavaScript array literal, for mysqlsh scripts.
+func jsList(values []string) string {
+	if values == nil {
+		values = []string{}
+	}
+	literal, _ := sonic.MarshalString(values)
+	return literal
+}
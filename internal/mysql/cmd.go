@@ -3,7 +3,9 @@ package mysql
 import (
 	"context"
 	"fmt"
-	"log"
+	"os"
+	"path/filepath"
+	"slices"
 
 	"github.com/urfave/cli/v3"
 
@@ -18,15 +20,27 @@ var Command = &cli.Command{
 		{
 			Name:  "dump",
 			Usage: "Execute the MySQL backup workflow",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "profile",
+					Usage: "Dump only the databases of the mysql.profiles entry with this `MATCH`, as its scheduled job does",
+				},
+			},
 			Action: func(ctx context.Context, c *cli.Command) error {
-				cfg, store, notifier, unlock, err := prepare(c)
+				cfg, store, notifier, unlock, err := prepare(ctx, c)
 				if err != nil {
 					return err
 				}
 				defer unlock()
 
-				log.Printf("Starting MySQL backup (dump) workflow")
-				worker := NewWorker(cfg, store, notifier, c.Bool("only-dump"))
+				profile := c.String("profile")
+				if profile != "" && !slices.ContainsFunc(cfg.MySQL.Profiles, func(p config.DatabaseProfile) bool { return p.Match == profile }) {
+					return fmt.Errorf("no mysql.profiles entry matches %q", profile)
+				}
+
+				helper.Infof("Starting MySQL backup (dump) workflow")
+				worker := NewWorker(cfg, store, notifier, helper.OptionsFrom(ctx))
+				worker.SetProfile(profile)
 				return worker.Backup(ctx)
 			},
 		},
@@ -35,41 +49,64 @@ var Command = &cli.Command{
 			Usage: "Restore data from a backup path",
 			Flags: []cli.Flag{
 				&cli.StringFlag{
-					Name:     "input",
-					Aliases:  []string{"i"},
-					Usage:    "Path to the dump directory or zip file",
-					Required: true,
+					Name:    "input",
+					Aliases: []string{"i"},
+					Usage:   "Path to the dump directory or zip file",
+				},
+				&cli.StringFlag{
+					Name:  "key",
+					Usage: "Object key of a stored backup to restore instead of --input (served from the local cache when present)",
 				},
 			},
 			Action: func(ctx context.Context, c *cli.Command) error {
-				cfg, store, notifier, unlock, err := prepare(c)
+				inputPath, key := c.String("input"), c.String("key")
+				if (inputPath == "") == (key == "") {
+					return fmt.Errorf("exactly one of --input or --key is required")
+				}
+
+				cfg, store, notifier, unlock, err := prepare(ctx, c)
 				if err != nil {
 					return err
 				}
 				defer unlock()
 
-				inputPath := c.String("input")
-				log.Printf("Starting MySQL recovery from: %s", inputPath)
-				worker := NewWorker(cfg, store, notifier, c.Bool("only-dump"))
+				if key != "" {
+					workDir, err := os.MkdirTemp(cfg.Backup.TempDir, "recover_")
+					if err != nil {
+						return fmt.Errorf("failed to create work dir: %w", err)
+					}
+					defer os.RemoveAll(workDir)
+
+					inputPath = filepath.Join(workDir, filepath.Base(key))
+					if err := helper.FetchArtifact(ctx, store, helper.NewCache(cfg.Cache), key, inputPath); err != nil {
+						return err
+					}
+				}
+
+				helper.Infof("Starting MySQL recovery from: %s", inputPath)
+				worker := NewWorker(cfg, store, notifier, helper.OptionsFrom(ctx))
 				return worker.Recover(ctx, inputPath)
 			},
 		},
 	},
 }
 
-func prepare(c *cli.Command) (*config.Config, *helper.Storage, *helper.TelegramSender, func(), error) {
-	// 1. Check required tools
-	if err := helper.CheckTools("mysqlsh", "zip", "unzip"); err != nil {
-		return nil, nil, nil, nil, err
-	}
-
-	// 2. Load config
+func prepare(ctx context.Context, c *cli.Command) (*config.Config, helper.Storage, *helper.TelegramSender, func(), error) {
+	// 1. Load config
 	configPath := c.String("config")
 	cfg, err := config.LoadConfig(configPath)
 	if err != nil {
 		return nil, nil, nil, nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
+	// 2. Check required tools
+	if err := helper.CheckTools("zip", "unzip"); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if err := CheckShell(ctx, cfg); err != nil {
+		return nil, nil, nil, nil, err
+	}
+
 	// 2. File locking
 	unlock, err := helper.AcquireLock(cfg.LockFile)
 	if err != nil {
@@ -77,10 +114,10 @@ func prepare(c *cli.Command) (*config.Config, *helper.Storage, *helper.TelegramS
 	}
 
 	// 3. Initialize Telegram notifier
-	notifier := helper.NewTelegramSender(cfg.Telegram.BotToken, cfg.Telegram.ChatID)
+	notifier := helper.NewNotifier(cfg)
 
 	// 4. Initialize storage
-	store, err := helper.NewStorage(cfg.R2)
+	store, err := helper.NewStorage(cfg, helper.OptionsFrom(ctx))
 	if err != nil {
 		unlock()
 		return nil, nil, nil, nil, fmt.Errorf("failed to initialize storage: %w", err)
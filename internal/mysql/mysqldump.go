@@ -0,0 +1,225 @@
+package mysql
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// schemaMeta is the per-schema metadata of a dump, in the format of mysqlsh,
+// so mysqldump dumps describe their schemas and tables in manifests too.
+type schemaMeta struct {
+	Schema string   `json:"schema"`
+	Tables []string `json:"tables"`
+}
+
+// batchUnescaper undoes the escaping of special characters in the output of
+// the mysql client in batch mode.
+var batchUnescaper = strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n", `\0`, "\x00")
+
+// query runs a query with the mysql client and returns the fields of the rows
+// whose first column is tag, without it. Queries select a tag first, so rows
+// are told apart from warnings in the output.
+func (w *Worker) query(ctx context.Context, tag, query string) ([][]string, error) {
+	args, cleanup, err := w.connArgs()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	args = append(args, "--batch", "--skip-column-names", "-e", query)
+
+	output, err := helper.Run(ctx, helper.Command{Name: w.cfg.MySQL.ClientPath, Args: args})
+	if err != nil {
+		return nil, fmt.Errorf("mysql failed: %w", err)
+	}
+	var rows [][]string
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		if len(fields) < 2 || fields[0] != tag {
+			continue // Warnings and other noise
+		}
+		for i, field := range fields {
+			fields[i] = batchUnescaper.Replace(field)
+		}
+		rows = append(rows, fields[1:])
+	}
+	return rows, nil
+}
+
+// sqlString returns s as a MySQL string literal, independent of the
+// NO_BACKSLASH_ESCAPES SQL mode.
+func sqlString(s string) string {
+	return fmt.Sprintf("CONVERT(X'%s' USING utf8mb4)", hex.EncodeToString([]byte(s)))
+}
+
+// clientDatabases lists the databases with the mysql client.
+func (w *Worker) clientDatabases(ctx context.Context) ([]string, error) {
+	helper.Infof("Listing databases...")
+	rows, err := w.query(ctx, "schema", "SELECT 'schema', schema_name FROM information_schema.schemata")
+	if err != nil {
+		return nil, fmt.Errorf("mysql list databases failed: %w", err)
+	}
+	databases := make([]string, 0, len(rows))
+	for _, row := range rows {
+		databases = append(databases, row[0])
+	}
+	helper.Infof("Found databases: %v", databases)
+	return databases, nil
+}
+
+// sqlDump dumps a single database into outputPath with mysqldump, as a SQL
+// file next to its schema metadata and the SQLDumpMetadata marking the dump.
+// The table filters of the database's profile apply as with mysqlsh.
+func (w *Worker) sqlDump(ctx context.Context, dbName, outputPath string) error {
+	rows, err := w.query(ctx, "table", fmt.Sprintf(
+		"SELECT 'table', table_name FROM information_schema.tables WHERE table_schema = %s AND table_type = 'BASE TABLE'", sqlString(dbName)))
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	filters := w.cfg.MySQL.Profile(dbName).TableFilters
+	hasPrefix := func(table string, prefixes []string) bool {
+		return slices.ContainsFunc(prefixes, func(prefix string) bool { return strings.HasPrefix(table, prefix) })
+	}
+	included, excluded := slices.Clone(filters.Include), slices.Clone(filters.Exclude)
+	var tables []string
+	for _, row := range rows {
+		tables = append(tables, row[0])
+		if hasPrefix(row[0], filters.IncludePrefix) && !slices.Contains(included, row[0]) {
+			included = append(included, row[0])
+		}
+		if hasPrefix(row[0], filters.ExcludePrefix) && !slices.Contains(excluded, row[0]) {
+			excluded = append(excluded, row[0])
+		}
+	}
+	filtered := len(included) > 0
+	if filtered {
+		tables = slices.DeleteFunc(included, func(t string) bool { return !slices.Contains(tables, t) })
+	}
+	tables = slices.DeleteFunc(tables, func(t string) bool { return slices.Contains(excluded, t) })
+	slices.Sort(tables)
+	if filtered && len(tables) == 0 {
+		return fmt.Errorf("none of the tables included by the table filters of %s remain to dump", dbName)
+	}
+
+	// Option file arguments from connArgs come first
+	args, cleanup, err := w.connArgs()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	name := helper.EscapeName(dbName)
+	args = append(args,
+		"--single-transaction", "--routines", "--triggers", "--events", "--hex-blob",
+		"--result-file="+filepath.Join(outputPath, name+".sql"))
+	for _, t := range excluded {
+		args = append(args, "--ignore-table="+dbName+"."+t)
+	}
+	args = append(args, dbName)
+	if filtered {
+		args = append(args, tables...) // Only these; otherwise mysqldump dumps every table
+	}
+
+	dumpCtx, cancel := helper.DumpContext(ctx, w.faults)
+	defer cancel()
+	helper.Infof("Dumping database %s to %s with %s", dbName, outputPath, w.cfg.MySQL.DumpPath)
+	if _, err := helper.Run(dumpCtx, helper.Command{Name: w.cfg.MySQL.DumpPath, Args: args, Priority: w.cfg.MySQL.Priority}); err != nil {
+		return fmt.Errorf("mysqldump failed: %w", err)
+	}
+
+	if err := writeJSON(filepath.Join(outputPath, name+".json"), schemaMeta{Schema: dbName, Tables: tables}); err != nil {
+		return err
+	}
+	var dumper string
+	if output, err := helper.Run(ctx, helper.Command{Name: w.cfg.MySQL.DumpPath, Args: []string{"--version"}}); err == nil {
+		dumper, _, _ = strings.Cut(strings.TrimSpace(string(output)), "\n")
+	}
+	if err := writeJSON(filepath.Join(outputPath, helper.SQLDumpMetadata), map[string]string{"dumper": dumper}); err != nil {
+		return err
+	}
+	helper.Infof("Dump completed for %s", dbName)
+	return nil
+}
+
+// writeJSON writes the dump metadata v to path.
+func writeJSON(path string, v interface{}) error {
+	data, err := sonic.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write dump metadata: %w", err)
+	}
+	return nil
+}
+
+// isSQLDump reports whether dir holds a dump taken with mysqldump.
+func isSQLDump(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, helper.SQLDumpMetadata))
+	return err == nil
+}
+
+// loadSQLDump restores every schema of a mysqldump dump directory with the
+// mysql client, creating the schemas that don't exist.
+func (w *Worker) loadSQLDump(ctx context.Context, dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var restored []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") || strings.Contains(name, "@") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return "", err
+		}
+		var meta schemaMeta
+		if sonic.Unmarshal(data, &meta) != nil || meta.Schema == "" {
+			continue
+		}
+		if err := w.loadSchema(ctx, meta.Schema, filepath.Join(dir, strings.TrimSuffix(name, ".json")+".sql")); err != nil {
+			return "", fmt.Errorf("failed to restore %s: %w", meta.Schema, err)
+		}
+		restored = append(restored, meta.Schema)
+	}
+	if len(restored) == 0 {
+		return "", fmt.Errorf("no schema found in the mysqldump dump %s", dir)
+	}
+	return fmt.Sprintf("Restored %s from %s", strings.Join(restored, ", "), dir), nil
+}
+
+// loadSchema restores the SQL file of a schema with the mysql client.
+func (w *Worker) loadSchema(ctx context.Context, schema, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	args, cleanup, err := w.connArgs()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	create := append(slices.Clone(args), "-e", "CREATE DATABASE IF NOT EXISTS "+quoteIdent(schema))
+	if _, err := helper.Run(ctx, helper.Command{Name: w.cfg.MySQL.ClientPath, Args: create}); err != nil {
+		return fmt.Errorf("mysql failed: %w", err)
+	}
+
+	helper.Infof("Executing mysql restore of %s from %s", schema, path)
+	load := append(args, "--database="+schema)
+	if _, err := helper.Run(ctx, helper.Command{Name: w.cfg.MySQL.ClientPath, Args: load, Stdin: file}); err != nil {
+		return fmt.Errorf("mysql failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// replicaPollInterval is the delay between two lag checks of a lagging replica.
+const replicaPollInterval = 10 * time.Second
+
+// selectServer picks the server the dumps of this run are taken from. With
+// mysql.replica.host set, that is the replica once its lag is within
+// max_lag, waiting up to mysql.replica.wait for it to catch up. A replica
+// still lagging (or down) afterwards fails the run, or falls back to the
+// primary with mysql.replica.fallback. It returns the server chosen.
+func (w *Worker) selectServer(ctx context.Context) (string, error) {
+	replica := w.cfg.MySQL.Replica
+	primaryHost, primaryPort, err := w.address()
+	if err != nil {
+		return "", err
+	}
+	primary := net.JoinHostPort(primaryHost, strconv.Itoa(primaryPort))
+	if replica.Host == "" {
+		return primary, nil
+	}
+	server := net.JoinHostPort(replica.Host, strconv.Itoa(replica.Port))
+
+	deadline := time.Now().Add(replica.WaitDuration())
+	for {
+		lag, err := w.replicaLag(ctx, replica.Host, replica.Port)
+		if err == nil && lag <= replica.MaxLag {
+			helper.Infof("Dumping from replica %s (%ds behind its source)", server, lag)
+			w.dumpHost, w.dumpPort = replica.Host, replica.Port
+			return server, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("replica %s is %ds behind its source, more than mysql.replica.max_lag (%ds)", server, lag, replica.MaxLag)
+		} else {
+			err = fmt.Errorf("failed to check replica %s: %w", server, err)
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if time.Now().Add(replicaPollInterval).After(deadline) {
+			if !replica.Fallback {
+				return "", err
+			}
+			helper.Warnf("%v; dumping from the primary %s instead", err, primary)
+			return primary, nil
+		}
+		helper.Infof("%v; checking again in %s", err, replicaPollInterval)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(replicaPollInterval):
+		}
+	}
+}
+
+// replicaLag returns the Seconds_Behind_Source of a replica.
+func (w *Worker) replicaLag(ctx context.Context, host string, port int) (int, error) {
+	// SHOW REPLICA STATUS needs 8.0.22; older servers only know SHOW SLAVE STATUS
+	script := `
+var rs;
+try { rs = session.runSql('SHOW REPLICA STATUS'); } catch (e) { rs = session.runSql('SHOW SLAVE STATUS'); }
+var row = rs.fetchOneObject();
+if (!row) { println('lag\tnone'); } else {
+    var lag = row.Seconds_Behind_Source;
+    if (lag === undefined) { lag = row.Seconds_Behind_Master; }
+    println('lag\t' + (lag === null ? 'null' : lag));
+}
+`
+	args, cleanup, err := w.serverArgs(host, port)
+	if err != nil {
+		return 0, err
+	}
+	defer cleanup()
+	args = append(args, "--js", "-e", script)
+
+	output, err := helper.Run(ctx, helper.Command{Name: w.cfg.MySQL.ShellPath, Args: args})
+	if err != nil {
+		return 0, fmt.Errorf("mysqlsh failed: %w", err)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		value, ok := strings.CutPrefix(strings.TrimRight(line, "\r"), "lag\t")
+		if !ok {
+			continue // Warnings and other noise
+		}
+		switch value {
+		case "none":
+			return 0, fmt.Errorf("server is not a replica")
+		case "null":
+			return 0, fmt.Errorf("replication is not running")
+		}
+		return strconv.Atoi(value)
+	}
+	return 0, fmt.Errorf("unexpected mysqlsh output: %s", strings.TrimSpace(string(output)))
+}
@@ -0,0 +1,295 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/dumpfile"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// SandboxTable is a table restored into the sandbox.
+type SandboxTable struct {
+	Schema       string
+	Name         string
+	DumpRows     int64
+	RestoredRows int64
+	Checksum     string // CHECKSUM TABLE of the restored table
+}
+
+// Matched reports whether every dumped row was restored.
+func (t SandboxTable) Matched() bool {
+	return t.DumpRows == t.RestoredRows
+}
+
+// QueryResult is the outcome of a validation query on the restored data.
+type QueryResult struct {
+	Name   string
+	Value  string
+	Passed bool
+	Error  string
+}
+
+// SandboxResult is the outcome of restoring an artifact into the sandbox.
+type SandboxResult struct {
+	Schemas         []string
+	Tables          []SandboxTable
+	Queries         []QueryResult
+	RestoreDuration time.Duration
+}
+
+// Passed reports whether all rows were restored and all queries passed.
+func (r *SandboxResult) Passed() bool {
+	for _, t := range r.Tables {
+		if !t.Matched() {
+			return false
+		}
+	}
+	for _, q := range r.Queries {
+		if !q.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// NewSandboxWorker creates a worker restoring into compliance.sandbox
+// instead of mysql.host.
+func NewSandboxWorker(cfg *config.Config) (*Worker, error) {
+	sandbox := cfg.Compliance.Sandbox
+	if sandbox.Host == "" {
+		return nil, fmt.Errorf("compliance.sandbox.host is not set")
+	}
+	sandboxCfg := *cfg
+	sandboxCfg.MySQL.Host = sandbox.Host
+	sandboxCfg.MySQL.Port = sandbox.Port
+	sandboxCfg.MySQL.User = sandbox.User
+	sandboxCfg.MySQL.Password = sandbox.Password
+	sandboxCfg.MySQL.LoginPath = ""
+	sandboxCfg.MySQL.SRV = ""
+	sandboxCfg.MySQL.Replica = config.ReplicaConfig{}
+	return &Worker{cfg: &sandboxCfg}, nil
+}
+
+// SandboxRestore restores an artifact (or dump directory) into the sandbox,
+// replacing the schemas it holds, then compares the row counts of every
+// table with the dump and runs the validation queries.
+func (w *Worker) SandboxRestore(ctx context.Context, inputPath string, queries []config.ValidationQuery) (*SandboxResult, error) {
+	dumpDir, cleanup, err := w.extract(ctx, inputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	dirs, err := findDumpDirs(dumpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SandboxResult{}
+	for _, dir := range dirs {
+		dump, err := dumpfile.Open(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dump: %w", err)
+		}
+		tables, err := countDumpRows(dump)
+		if err != nil {
+			return nil, err
+		}
+		result.Schemas = append(result.Schemas, dump.Schemas...)
+		result.Tables = append(result.Tables, tables...)
+
+		if err := w.dropSchemas(ctx, dump.Schemas); err != nil {
+			return nil, fmt.Errorf("failed to clear sandbox: %w", err)
+		}
+		start := time.Now()
+		if _, err := w.loadDump(ctx, dir); err != nil {
+			return nil, err
+		}
+		result.RestoreDuration += time.Since(start)
+	}
+
+	if err := w.countRestoredRows(ctx, result.Tables); err != nil {
+		return nil, fmt.Errorf("failed to count restored rows: %w", err)
+	}
+	if result.Queries, err = w.runQueries(ctx, queries); err != nil {
+		return nil, fmt.Errorf("failed to run validation queries: %w", err)
+	}
+	return result, nil
+}
+
+// countDumpRows counts the rows of every table of a dump.
+func countDumpRows(dump *dumpfile.Dump) ([]SandboxTable, error) {
+	var tables []SandboxTable
+	for _, schema := range dump.Schemas {
+		objects, err := dump.Objects(schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dump metadata: %w", err)
+		}
+		for _, name := range objects["table"] {
+			t, err := dump.Table(schema, name)
+			if err != nil {
+				return nil, err
+			}
+			files, err := t.DataFiles()
+			if err != nil {
+				return nil, err
+			}
+			table := SandboxTable{Schema: schema, Name: name}
+			for _, path := range files {
+				n, err := countRows(t, path)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read %s.%s: %w", schema, name, err)
+				}
+				table.DumpRows += n
+			}
+			tables = append(tables, table)
+		}
+	}
+	return tables, nil
+}
+
+// countRows counts the rows of a data chunk.
+func countRows(t *dumpfile.Table, path string) (int64, error) {
+	in, err := t.OpenChunk(path)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	var n int64
+	reader := dumpfile.NewReader(in)
+	for {
+		if _, err := reader.Read(); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return 0, err
+		}
+		n++
+	}
+}
+
+// dropSchemas drops schemas from the sandbox, so the dump loads into empty ones.
+func (w *Worker) dropSchemas(ctx context.Context, schemas []string) error {
+	var script strings.Builder
+	for _, schema := range schemas {
+		fmt.Fprintf(&script, "DROP DATABASE IF EXISTS %s;\n", quoteIdent(schema))
+	}
+	return w.runSandbox(ctx, "--sql", script.String(), nil)
+}
+
+// countRestoredRows fills in the restored row count and checksum of tables.
+func (w *Worker) countRestoredRows(ctx context.Context, tables []SandboxTable) error {
+	if len(tables) == 0 {
+		return nil
+	}
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = quoteIdent(t.Schema) + "." + quoteIdent(t.Name)
+	}
+	list, err := sonic.MarshalString(names)
+	if err != nil {
+		return err
+	}
+	script := fmt.Sprintf(`
+%s.forEach(function(name, i) {
+    var count = session.runSql('SELECT COUNT(*) FROM ' + name).fetchOne()[0];
+    var checksum = session.runSql('CHECKSUM TABLE ' + name).fetchOne()[1];
+    println('table\t' + i + '\t' + count + '\t' + checksum);
+});
+`, list)
+
+	return w.runSandbox(ctx, "--js", script, func(fields []string) {
+		if len(fields) != 4 {
+			return
+		}
+		i, err := strconv.Atoi(fields[1])
+		if err != nil || i >= len(tables) {
+			return
+		}
+		tables[i].RestoredRows, _ = strconv.ParseInt(fields[2], 10, 64)
+		tables[i].Checksum = fields[3]
+	})
+}
+
+// runQueries runs the validation queries on the sandbox. A query passes when
+// the first column of its first row is neither NULL, empty nor zero.
+func (w *Worker) runQueries(ctx context.Context, queries []config.ValidationQuery) ([]QueryResult, error) {
+	if len(queries) == 0 {
+		return nil, nil
+	}
+	results := make([]QueryResult, len(queries))
+	statements := make([]string, len(queries))
+	for i, q := range queries {
+		results[i] = QueryResult{Name: q.Name, Error: "no result"}
+		statements[i] = q.SQL
+	}
+	list, err := sonic.MarshalString(statements)
+	if err != nil {
+		return nil, err
+	}
+	script := fmt.Sprintf(`
+%s.forEach(function(sql, i) {
+    try {
+        var row = session.runSql(sql).fetchOne();
+        println('query\t' + i + '\t' + (row && row[0] !== null ? row[0] : 'NULL'));
+    } catch (e) {
+        println('error\t' + i + '\t' + String(e.message).replace(/\s+/g, ' '));
+    }
+});
+`, list)
+
+	err = w.runSandbox(ctx, "--js", script, func(fields []string) {
+		if len(fields) != 3 {
+			return
+		}
+		i, err := strconv.Atoi(fields[1])
+		if err != nil || i >= len(results) {
+			return
+		}
+		switch fields[0] {
+		case "query":
+			value := fields[2]
+			results[i].Value = value
+			results[i].Error = ""
+			results[i].Passed = !slices.Contains([]string{"NULL", "", "0"}, value)
+		case "error":
+			results[i].Error = fields[2]
+		}
+	})
+	return results, err
+}
+
+// runSandbox runs a mysqlsh script, passing the tab-separated fields of
+// every "table", "query" or "error" line of its output to line.
+func (w *Worker) runSandbox(ctx context.Context, mode, script string, line func(fields []string)) error {
+	args, cleanup, err := w.connArgs()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	args = append(args, mode, "-e", script)
+
+	output, err := helper.Run(ctx, helper.Command{Name: w.cfg.MySQL.ShellPath, Args: args})
+	if err != nil {
+		return fmt.Errorf("mysqlsh failed: %w", err)
+	}
+	if line == nil {
+		return nil
+	}
+	for _, l := range strings.Split(string(output), "\n") {
+		fields := strings.Split(strings.TrimRight(l, "\r"), "\t")
+		switch fields[0] {
+		case "table", "query", "error":
+			line(fields)
+		}
+	}
+	return nil
+}
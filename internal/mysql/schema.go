@@ -0,0 +1,131 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/dumpfile"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// schemaObjectKinds are the object kinds compared by the schema check, with
+// the dump option that leaves them out of a dump.
+var schemaObjectKinds = []struct{ kind, option string }{
+	{"table", ""},
+	{"view", ""},
+	{"function", "routines"},
+	{"procedure", "routines"},
+	{"trigger", "triggers"},
+	{"event", "events"},
+}
+
+// schemaObject is an object of the live database. Table is the table of a
+// trigger, or the table itself.
+type schemaObject struct {
+	kind, name, table string
+}
+
+// checkSchema compares the objects of the live database with those in the
+// dump at dir and fails when the dump silently skipped any of them. Tables
+// left out by the table filters, and their triggers, are not expected.
+func (w *Worker) checkSchema(ctx context.Context, dbName, dir string) error {
+	profile := w.cfg.MySQL.Profile(dbName)
+	if enabled, _ := profile.DumpOptions["dataOnly"].(bool); enabled {
+		return nil // No DDL to compare
+	}
+
+	dump, err := dumpfile.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read dump: %w", err)
+	}
+	dumped, err := dump.Objects(dbName)
+	if err != nil {
+		return fmt.Errorf("failed to read dump metadata: %w", err)
+	}
+	live, err := w.liveObjects(ctx, dbName)
+	if err != nil {
+		return fmt.Errorf("failed to list schema objects: %w", err)
+	}
+
+	var missing, counts []string
+	for _, k := range schemaObjectKinds {
+		if enabled, ok := profile.DumpOptions[k.option].(bool); ok && !enabled {
+			continue
+		}
+		expected := 0
+		for _, object := range live {
+			if object.kind != k.kind || !w.dumpsTable(profile.TableFilters, object.table) {
+				continue
+			}
+			expected++
+			if !slices.Contains(dumped[k.kind], object.name) {
+				missing = append(missing, fmt.Sprintf("%s %s.%s", k.kind, dbName, object.name))
+			}
+		}
+		counts = append(counts, fmt.Sprintf("%d/%d %ss", len(dumped[k.kind]), expected, k.kind))
+	}
+	helper.Infof("Schema check of %s: %s", dbName, strings.Join(counts, ", "))
+	if len(missing) > 0 {
+		return fmt.Errorf("dump of %s is missing %d objects: %s", dbName, len(missing), strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// dumpsTable reports whether the table filters keep table in the dump. Views,
+// routines and events have no table and are always kept.
+func (w *Worker) dumpsTable(filters *config.TableFilter, table string) bool {
+	if table == "" || table == w.cfg.MySQL.Canary.Table {
+		return true
+	}
+	hasPrefix := func(prefixes []string) bool {
+		return slices.ContainsFunc(prefixes, func(p string) bool { return strings.HasPrefix(table, p) })
+	}
+	if slices.Contains(filters.Exclude, table) || hasPrefix(filters.ExcludePrefix) {
+		return false
+	}
+	if len(filters.Include) > 0 || len(filters.IncludePrefix) > 0 {
+		return slices.Contains(filters.Include, table) || hasPrefix(filters.IncludePrefix)
+	}
+	return true
+}
+
+// liveObjects lists the tables, views, routines, triggers and events of a
+// database.
+func (w *Worker) liveObjects(ctx context.Context, dbName string) ([]schemaObject, error) {
+	script := fmt.Sprintf(`
+var db = %s;
+var rs = session.runSql(
+    "SELECT 'table', table_name, table_name FROM information_schema.tables WHERE table_schema = ? AND table_type = 'BASE TABLE' " +
+    "UNION ALL SELECT 'view', table_name, '' FROM information_schema.views WHERE table_schema = ? " +
+    "UNION ALL SELECT LOWER(routine_type), routine_name, '' FROM information_schema.routines WHERE routine_schema = ? " +
+    "UNION ALL SELECT 'trigger', trigger_name, event_object_table FROM information_schema.triggers WHERE trigger_schema = ? " +
+    "UNION ALL SELECT 'event', event_name, '' FROM information_schema.events WHERE event_schema = ?",
+    [db, db, db, db, db]);
+rs.fetchAll().forEach(function(row) { println('object\t' + row[0] + '\t' + row[1] + '\t' + row[2]); });
+`, jsString(dbName))
+
+	args, cleanup, err := w.connArgs()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	args = append(args, "--js", "-e", script)
+
+	output, err := helper.Run(ctx, helper.Command{Name: w.cfg.MySQL.ShellPath, Args: args})
+	if err != nil {
+		return nil, fmt.Errorf("mysqlsh failed: %w", err)
+	}
+
+	var objects []schemaObject
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		if len(fields) != 4 || fields[0] != "object" {
+			continue // Warnings and other noise
+		}
+		objects = append(objects, schemaObject{kind: fields[1], name: fields[2], table: fields[3]})
+	}
+	return objects, nil
+}
@@ -0,0 +1,80 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// shellVersionPattern extracts the shell version from `mysqlsh --version`, e.g.
+// "mysqlsh   Ver 8.0.33 for Linux on x86_64 - for MySQL 8.0.33 (MySQL Community Server (GPL))".
+var shellVersionPattern = regexp.MustCompile(`Ver\s+(\d+(?:\.\d+)*)`)
+
+// CheckShell verifies that the configured mysqlsh is installed and new enough
+// for the dump options generated from cfg, or with mysql.engine: mysqldump
+// that mysqldump and the mysql client are.
+func CheckShell(ctx context.Context, cfg *config.Config) error {
+	if cfg.MySQL.Engine == "mysqldump" {
+		return helper.CheckTools(cfg.MySQL.DumpPath, cfg.MySQL.ClientPath)
+	}
+	if err := helper.CheckTools(cfg.MySQL.ShellPath); err != nil {
+		return err
+	}
+	return checkShellVersion(ctx, cfg.MySQL.ShellPath, requiredShellVersion(&cfg.MySQL))
+}
+
+// checkShellVersion verifies that the mysqlsh binary is at least minVersion.
+func checkShellVersion(ctx context.Context, shellPath, minVersion string) error {
+	output, err := helper.Run(ctx, helper.Command{Name: shellPath, Args: []string{"--version"}})
+	if err != nil {
+		return fmt.Errorf("failed to run %s --version: %w", shellPath, err)
+	}
+
+	m := shellVersionPattern.FindStringSubmatch(string(output))
+	if m == nil {
+		return fmt.Errorf("could not parse mysqlsh version from: %s", strings.TrimSpace(string(output)))
+	}
+	if compareVersions(m[1], minVersion) < 0 {
+		return fmt.Errorf("mysqlsh %s at %s is too old: version %s or newer is required for the generated dump options", m[1], shellPath, minVersion)
+	}
+	return nil
+}
+
+// sessionInitSQLVersion is the first mysqlsh release supporting the sessionInitSql dump option.
+const sessionInitSQLVersion = "8.0.30"
+
+// requiredShellVersion returns the configured minimum version, raised when the
+// generated dump options need a newer shell.
+func requiredShellVersion(cfg *config.MySQLConfig) string {
+	required := cfg.MinVersion
+	if len(cfg.SessionVariables) > 0 && compareVersions(required, sessionInitSQLVersion) < 0 {
+		required = sessionInitSQLVersion
+	}
+	return required
+}
+
+// compareVersions compares dotted version strings numerically.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -3,13 +3,15 @@ package mysql
 import (
 	"context"
 	"fmt"
-	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/bytedance/sonic"
+
 	"github.com/davexpro/backup/internal/config"
 	"github.com/davexpro/backup/internal/pkg/helper"
 )
@@ -17,23 +19,76 @@ import (
 // Worker handles MySQL backup and recovery operations.
 type Worker struct {
 	cfg      *config.Config
-	store    *helper.Storage
+	store    helper.Storage
 	notifier *helper.TelegramSender
+	pipeline *helper.Pipeline
+	progress helper.ProgressFunc
 	onlyDump bool
+	faults   helper.FaultConfig
+	profile  string // Match of the scheduled profile whose databases to dump; empty: all others
+
+	resolveOnce sync.Once // Resolves mysql.srv once, so every connection goes to the same server
+	host        string
+	port        int
+	resolveErr  error
+
+	// Server dumps are taken from when it is not the primary (mysql.replica)
+	dumpHost string
+	dumpPort int
 }
 
 // NewWorker creates a new MySQL worker.
-func NewWorker(cfg *config.Config, store *helper.Storage, notifier *helper.TelegramSender, onlyDump bool) *Worker {
+func NewWorker(cfg *config.Config, store helper.Storage, notifier *helper.TelegramSender, opts helper.Options) *Worker {
 	return &Worker{
 		cfg:      cfg,
 		store:    store,
 		notifier: notifier,
-		onlyDump: onlyDump,
+		pipeline: helper.NewPipeline(cfg, store, opts),
+		onlyDump: opts.OnlyDump,
+		faults:   opts.Faults,
+	}
+}
+
+// SetProgress sets the function receiving the progress of the backup: one
+// dump stage per database, then the stages of every shipped artifact.
+func (w *Worker) SetProgress(progress helper.ProgressFunc) {
+	w.progress = progress
+	w.pipeline.SetProgress(progress)
+}
+
+// SetProfile restricts the dump to the databases of the mysql profile with
+// the given match, as its scheduled job does. Without it, the databases of
+// profiles with a schedule are skipped.
+func (w *Worker) SetProfile(match string) {
+	w.profile = match
+}
+
+// reportDump reports the start of the dump of the i-th of total databases.
+func (w *Worker) reportDump(dbName string, i, total int) {
+	if w.progress != nil {
+		w.progress(helper.Progress{Stage: helper.StageDump, Item: dbName, Done: int64(i), Total: int64(total)})
 	}
 }
 
 // Backup executes the MySQL backup workflow.
 func (w *Worker) Backup(ctx context.Context) error {
+	if helper.CheckPaused(w.cfg, w.notifier, "mysql") {
+		return nil
+	}
+	stop := w.pipeline.Start()
+	defer stop()
+	// Verify storage before the long dump stage
+	if err := w.pipeline.SelfTest(ctx, w.notifier, "mysql"); err != nil {
+		return err
+	}
+	w.pipeline.FlushSpool(ctx)
+
+	server, err := w.selectServer(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to select the server to dump: %w", err)
+	}
+	w.pipeline.SetServer(server)
+
 	// List databases using mysqlsh
 	databases, err := w.listDatabases(ctx)
 	if err != nil {
@@ -42,39 +97,50 @@ func (w *Worker) Backup(ctx context.Context) error {
 
 	// Filter databases based on include list
 	databases = w.filterDatabases(databases)
-	log.Printf("Databases to backup: %v", databases)
-
-	var results []helper.BackupResult
-	var successCount, failCount int
+	helper.Infof("Databases to backup: %v", databases)
 
-	timeNow := time.Now()
+	var selected []string
 	for _, dbName := range databases {
 		if w.shouldExcludeDB(dbName) {
-			log.Printf("Skipping excluded database: %s", dbName)
+			helper.Infof("Skipping excluded database: %s", dbName)
+			continue
+		}
+		// Databases of a scheduled profile are dumped by the profile's own job
+		if profile := w.cfg.MySQL.Profile(dbName); w.profile != "" && profile.Match != w.profile || w.profile == "" && profile.Schedule != "" {
 			continue
 		}
+		selected = append(selected, dbName)
+	}
 
-		log.Printf("Backing up database: %s", dbName)
-		start := time.Now()
-		result := w.backupDatabase(ctx, dbName, timeNow)
-		result.Duration = time.Since(start)
+	var results []helper.BackupResult
+	timeNow := time.Now()
+	if w.cfg.Backup.SingleArchive {
+		results = w.backupRun(ctx, selected, timeNow)
+	} else {
+		for i, dbName := range selected {
+			helper.Infof("Backing up database: %s", dbName)
+			w.reportDump(dbName, i, len(selected))
+			results = append(results, w.backupDatabase(ctx, dbName, timeNow)...)
+		}
+	}
 
+	var successCount, failCount int
+	for _, result := range results {
 		if result.Success {
 			successCount++
-			log.Printf("Backup success: %s (Size: %d bytes, SHA256: %s)", dbName, result.Size, result.SHA256)
+			helper.Infof("Backup success: %s (Size: %d bytes, SHA256: %s)", result.Database, result.Size, result.SHA256)
 		} else {
 			failCount++
-			log.Printf("Backup failed: %s (%v)", dbName, result.Error)
+			helper.Errorf("backup of %s failed: %v", result.Database, result.Error)
 		}
-		results = append(results, result)
 	}
 
 	// Enforce retention
-	if err := w.store.EnforceRetention(ctx, w.cfg.Retention.Hours); err != nil {
-		log.Printf("Error enforcing retention policy: %v", err)
+	if err := w.pipeline.EnforceRetention(ctx, helper.ProfileRetention(w.cfg)); err != nil {
+		helper.Errorf("failed to enforce retention policy: %v", err)
 	}
 
-	helper.SendReport(w.notifier, results, successCount, failCount)
+	w.pipeline.Report(w.notifier, "mysql", results, successCount, failCount)
 
 	if failCount > 0 {
 		return fmt.Errorf("backup completed with %d failures", failCount)
@@ -84,122 +150,159 @@ func (w *Worker) Backup(ctx context.Context) error {
 
 // Recover restores data from a dump path (directory or zip).
 func (w *Worker) Recover(ctx context.Context, inputPath string) error {
-	log.Printf("Starting recovery from: %s", inputPath)
+	helper.Infof("Starting recovery from: %s", inputPath)
 
-	info, err := os.Stat(inputPath)
+	dumpDir, cleanup, err := w.extract(ctx, inputPath)
 	if err != nil {
-		return fmt.Errorf("failed to access input path: %w", err)
+		return err
 	}
+	defer cleanup()
 
-	dumpDir := inputPath
-	isZip := !info.IsDir() && strings.HasSuffix(strings.ToLower(inputPath), ".zip")
+	dumpDirs, err := findDumpDirs(dumpDir)
+	if err != nil {
+		return err
+	}
 
-	if isZip {
-		log.Printf("Detecting zip file, extracting to temporary directory...")
-		tempRestoreDir := filepath.Join(w.cfg.Backup.TempDir, fmt.Sprintf("restore_%d", time.Now().Unix()))
-		if err := os.MkdirAll(tempRestoreDir, 0755); err != nil {
-			return fmt.Errorf("failed to create temp restore dir: %w", err)
+	var outputs []string
+	for _, dir := range dumpDirs {
+		output, err := w.loadDump(ctx, dir)
+		if err != nil {
+			return err
 		}
-		defer os.RemoveAll(tempRestoreDir)
+		outputs = append(outputs, output)
+	}
 
-		// Unzip logic (using system unzip or our helper if we add it)
-		// For now using shell unzip as it's common and supports pwd
-		unzipArgs := []string{"-o", inputPath, "-d", tempRestoreDir}
-		if w.cfg.Encryption.Password != "" {
-			unzipArgs = append([]string{"-P", w.cfg.Encryption.Password}, unzipArgs...)
-		}
+	helper.Infof("Recovery completed successfully:\n%s", strings.Join(outputs, "\n"))
+	return nil
+}
 
-		log.Printf("Executing unzip %v", unzipArgs)
-		unzipCmd := exec.CommandContext(ctx, "unzip", unzipArgs...)
-		if output, err := unzipCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("unzip failed: %w, output: %s", err, string(output))
-		}
+// extract returns the directory holding the dumps of inputPath, a directory
+// or an artifact zip extracted into a temporary directory removed by cleanup.
+func (w *Worker) extract(ctx context.Context, inputPath string) (string, func(), error) {
+	noop := func() {}
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return "", noop, fmt.Errorf("failed to access input path: %w", err)
+	}
+	if info.IsDir() || !strings.HasSuffix(strings.ToLower(inputPath), ".zip") {
+		return inputPath, noop, nil
+	}
 
-		// The zip might contain a subfolder (like dbname_timestamp) or direct files
-		// mysqlsh util.loadDump needs the directory containing the @.json metadata
-		dumpDir = tempRestoreDir
-
-		// Look for subfolders if the root of unzip doesn't have @.json
-		if _, err := os.Stat(filepath.Join(dumpDir, "@.json")); os.IsNotExist(err) {
-			entries, _ := os.ReadDir(dumpDir)
-			for _, entry := range entries {
-				if entry.IsDir() {
-					subDir := filepath.Join(dumpDir, entry.Name())
-					if _, err := os.Stat(filepath.Join(subDir, "@.json")); err == nil {
-						dumpDir = subDir
-						break
-					}
-				}
+	helper.Infof("Detecting zip file, extracting to temporary directory...")
+	tempRestoreDir := filepath.Join(w.cfg.Backup.TempDir, fmt.Sprintf("restore_%d", time.Now().Unix()))
+	if err := os.MkdirAll(tempRestoreDir, 0755); err != nil {
+		return "", noop, fmt.Errorf("failed to create temp restore dir: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(tempRestoreDir) }
+
+	manifest, err := helper.ReadManifestFile(inputPath)
+	if err != nil {
+		cleanup()
+		return "", noop, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	password, err := helper.ArtifactPassword(ctx, w.cfg, manifest)
+	if err != nil {
+		cleanup()
+		return "", noop, err
+	}
+
+	// Using shell unzip as it's common and supports pwd
+	helper.Infof("Executing unzip %s -> %s", inputPath, tempRestoreDir)
+	if err := helper.Unzip(ctx, password, inputPath, tempRestoreDir); err != nil {
+		cleanup()
+		return "", noop, err
+	}
+
+	// The zip might contain a subfolder (like dbname_timestamp) or direct files
+	// mysqlsh util.loadDump needs the directory containing the @.json metadata
+	return tempRestoreDir, cleanup, nil
+}
+
+// findDumpDirs returns the dump directories (containing @.json, or the
+// SQLDumpMetadata of mysqldump) under root. A single-archive run holds one
+// dump directory per database.
+func findDumpDirs(root string) ([]string, error) {
+	if _, err := os.Stat(filepath.Join(root, "@.json")); err == nil || isSQLDump(root) {
+		return []string{root}, nil
+	}
+
+	var dirs []string
+	entries, _ := os.ReadDir(root)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			subDir := filepath.Join(root, entry.Name())
+			if _, err := os.Stat(filepath.Join(subDir, "@.json")); err == nil || isSQLDump(subDir) {
+				dirs = append(dirs, subDir)
 			}
 		}
 	}
-
-	if _, err := os.Stat(filepath.Join(dumpDir, "@.json")); os.IsNotExist(err) {
-		return fmt.Errorf("dump metadata (@.json) not found in %s", dumpDir)
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("dump metadata (@.json) not found in %s", root)
 	}
+	return dirs, nil
+}
 
-	log.Printf("Restoring from directory: %s", dumpDir)
+// loadDump restores a single dump directory with util.loadDump, or with the
+// mysql client when it was dumped with mysqldump.
+func (w *Worker) loadDump(ctx context.Context, dumpDir string) (string, error) {
+	helper.Infof("Restoring from directory: %s", dumpDir)
+	if isSQLDump(dumpDir) {
+		return w.loadSQLDump(ctx, dumpDir)
+	}
 
 	// util.loadDump(path, {threads: N, ignoreVersion: true, ...})
 	loadOpts := fmt.Sprintf("{threads: %d, ignoreVersion: true}", w.cfg.MySQL.Threads)
-	script := fmt.Sprintf("util.loadDump('%s', %s)", dumpDir, loadOpts)
+	script := fmt.Sprintf("util.loadDump(%s, %s)", jsString(dumpDir), loadOpts)
 
-	args := []string{
-		fmt.Sprintf("--user=%s", w.cfg.MySQL.User),
-		fmt.Sprintf("--password=%s", w.cfg.MySQL.Password),
-		fmt.Sprintf("--host=%s", w.cfg.MySQL.Host),
-		fmt.Sprintf("--port=%d", w.cfg.MySQL.Port),
-		"--js",
-		"-e",
-		script,
+	args, cleanup, err := w.connArgs()
+	if err != nil {
+		return "", err
 	}
+	defer cleanup()
+	args = append(args, "--js", "-e", script)
 
-	log.Printf("Executing mysqlsh recovery script...")
-	cmd := exec.CommandContext(ctx, "mysqlsh", args...)
-	output, err := cmd.CombinedOutput()
+	helper.Infof("Executing mysqlsh recovery script...")
+	output, err := helper.Run(ctx, helper.Command{Name: w.cfg.MySQL.ShellPath, Args: args})
 	if err != nil {
-		return fmt.Errorf("mysqlsh recovery failed: %w, output: %s", err, string(output))
+		return "", fmt.Errorf("mysqlsh recovery failed: %w", err)
 	}
-
-	log.Printf("Recovery completed successfully:\n%s", string(output))
-	return nil
+	return string(output), nil
 }
 
 func (w *Worker) listDatabases(ctx context.Context) ([]string, error) {
-	args := []string{
-		fmt.Sprintf("--user=%s", w.cfg.MySQL.User),
-		fmt.Sprintf("--password=%s", w.cfg.MySQL.Password),
-		fmt.Sprintf("--host=%s", w.cfg.MySQL.Host),
-		fmt.Sprintf("--port=%d", w.cfg.MySQL.Port),
-		"--sql",
-		"-e",
-		"SELECT schema_name FROM information_schema.schemata",
-	}
-
-	log.Printf("Listing databases...")
-	cmd := exec.CommandContext(ctx, "mysqlsh", args...)
-	output, err := cmd.CombinedOutput()
+	if w.cfg.MySQL.Engine == "mysqldump" {
+		return w.clientDatabases(ctx)
+	}
+	args, cleanup, err := w.connArgs()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	// Names are printed as JSON, so any character (spaces, tabs, CJK) survives
+	script := `
+var rs = session.runSql('SELECT schema_name FROM information_schema.schemata');
+println('databases\t' + JSON.stringify(rs.fetchAll().map(function(row) { return row[0]; })));
+`
+	args = append(args, "--js", "-e", script)
+
+	helper.Infof("Listing databases...")
+	output, err := helper.Run(ctx, helper.Command{Name: w.cfg.MySQL.ShellPath, Args: args})
 	if err != nil {
-		return nil, fmt.Errorf("mysqlsh list databases failed: %w, output: %s", err, string(output))
+		return nil, fmt.Errorf("mysqlsh list databases failed: %w", err)
 	}
 
 	var databases []string
-	// Parse output - filter out warnings, headers, and empty lines
 	for _, line := range strings.Split(string(output), "\n") {
-		line = strings.TrimSpace(line)
-		// Skip empty lines, warnings, headers, and separator lines
-		if line == "" ||
-			strings.HasPrefix(line, "WARNING:") ||
-			strings.HasPrefix(line, "SCHEMA_NAME") ||
-			strings.HasPrefix(line, "schema_name") ||
-			strings.HasPrefix(line, "+") ||
-			strings.HasPrefix(line, "|") {
-			continue
+		list, ok := strings.CutPrefix(strings.TrimRight(line, "\r"), "databases\t")
+		if !ok {
+			continue // Warnings and other noise
+		}
+		if err := sonic.UnmarshalString(list, &databases); err != nil {
+			return nil, fmt.Errorf("unexpected mysqlsh output: %w", err)
 		}
-		databases = append(databases, line)
 	}
 
-	log.Printf("Found databases: %v", databases)
+	helper.Infof("Found databases: %v", databases)
 	return databases, nil
 }
 
@@ -227,181 +330,256 @@ func (w *Worker) filterDatabases(databases []string) []string {
 	return filtered
 }
 
+// sessionInitSQL returns the SET statements for the configured session variables.
+func (w *Worker) sessionInitSQL() []string {
+	names := make([]string, 0, len(w.cfg.MySQL.SessionVariables))
+	for name := range w.cfg.MySQL.SessionVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var stmts []string
+	for _, name := range names {
+		stmts = append(stmts, fmt.Sprintf("SET SESSION %s = %s", name, w.cfg.MySQL.SessionVariables[name]))
+	}
+	return stmts
+}
+
 // shouldExcludeDB checks if a database should be excluded
 func (w *Worker) shouldExcludeDB(dbName string) bool {
-	systemDBs := []string{"information_schema", "performance_schema", "mysql", "sys"}
+	// information_schema and performance_schema are virtual and can never be dumped;
+	// mysql (grants, timezones) and sys may be opted in via include_system
+	systemDBs := []string{"information_schema", "performance_schema"}
+	if !w.cfg.MySQL.IncludeSystem {
+		systemDBs = append(systemDBs, "mysql", "sys")
+	}
 	for _, sys := range systemDBs {
 		if dbName == sys {
 			return true
 		}
 	}
+	// Never back up our own history logs
+	if dbName == w.cfg.History.Database {
+		return true
+	}
 	for _, excl := range w.cfg.MySQL.Exclude {
 		if dbName == excl {
 			return true
 		}
 	}
+	for _, prefix := range w.cfg.MySQL.ExcludePrefix {
+		if strings.HasPrefix(dbName, prefix) {
+			return true
+		}
+	}
 	return false
 }
 
-func (w *Worker) backupDatabase(ctx context.Context, dbName string, timeNow time.Time) helper.BackupResult {
+func (w *Worker) backupDatabase(ctx context.Context, dbName string, timeNow time.Time) []helper.BackupResult {
+	start := time.Now()
 	timestamp := timeNow.Format("20060102_150405")
-	dumpDir := filepath.Join(w.cfg.Backup.TempDir, fmt.Sprintf("%s_%s", dbName, timestamp))
-
-	zipFilename := fmt.Sprintf("%s_%s.zip", dbName, timestamp)
-	localZipPath := filepath.Join(w.cfg.Backup.TempDir, zipFilename)
+	dumpDir := filepath.Join(w.cfg.Backup.TempDir, fmt.Sprintf("%s_%s", helper.EscapeName(dbName), timestamp))
 
 	if err := w.dump(ctx, dbName, dumpDir); err != nil {
-		return helper.BackupResult{Database: dbName, Success: false, Error: err}
+		return []helper.BackupResult{{Database: dbName, Success: false, Error: err, Duration: time.Since(start)}}
 	}
 	// Cleanup dump directory based on config
 	if w.cfg.Backup.DeleteAfterUpload {
 		defer os.RemoveAll(dumpDir)
 	} else {
-		log.Printf("Keeping dump directory: %s", dumpDir)
+		helper.Infof("Keeping dump directory: %s", dumpDir)
+	}
+
+	result := w.pipeline.Ship(ctx, dbName, dumpDir, timeNow, true)
+	result.Duration = time.Since(start)
+	results := []helper.BackupResult{result}
+
+	if w.cfg.Anonymize.Enabled {
+		results = append(results, w.shipStaging(ctx, dbName, dumpDir, timeNow, true))
 	}
+	return results
+}
 
-	if err := helper.ZipEncryptFolder(ctx, w.cfg.Encryption.Password, dumpDir, localZipPath); err != nil {
-		return helper.BackupResult{Database: dbName, Success: false, Error: fmt.Errorf("zip encryption failed: %w", err)}
+// backupRun dumps every database into its own subdirectory of a single run
+// directory and ships the whole run as one archive.
+func (w *Worker) backupRun(ctx context.Context, databases []string, timeNow time.Time) []helper.BackupResult {
+	timestamp := timeNow.Format("20060102_150405")
+	runDir := filepath.Join(w.cfg.Backup.TempDir, fmt.Sprintf("mysql_%s", timestamp))
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		return []helper.BackupResult{{Database: "mysql", Success: false, Error: fmt.Errorf("failed to create run dir: %w", err)}}
 	}
-	// Cleanup zip file based on config
+	// Cleanup run directory based on config
 	if w.cfg.Backup.DeleteAfterUpload {
-		defer os.Remove(localZipPath)
+		defer os.RemoveAll(runDir)
 	} else {
-		log.Printf("Keeping zip file: %s", localZipPath)
+		helper.Infof("Keeping run directory: %s", runDir)
 	}
 
-	hash, size, err := helper.CalculateSHA256(localZipPath)
-	if err != nil {
-		return helper.BackupResult{Database: dbName, Success: false, Error: fmt.Errorf("hash calc failed: %w", err)}
+	var results []helper.BackupResult
+	var dumped []string
+	start := time.Now()
+	for i, dbName := range databases {
+		helper.Infof("Backing up database: %s", dbName)
+		w.reportDump(dbName, i, len(databases))
+		dbStart := time.Now()
+		if err := w.dump(ctx, dbName, filepath.Join(runDir, helper.EscapeName(dbName))); err != nil {
+			results = append(results, helper.BackupResult{Database: dbName, Success: false, Error: err, Duration: time.Since(dbStart)})
+			continue
+		}
+		dumped = append(dumped, dbName)
 	}
 
-	if w.onlyDump {
-		localDir := "local_backups"
-		if err := os.MkdirAll(localDir, 0755); err != nil {
-			return helper.BackupResult{Database: dbName, Success: false, Error: fmt.Errorf("failed to create local backup dir: %w", err)}
-		}
-		finalPath := filepath.Join(localDir, zipFilename)
-		if err := helper.CopyFile(localZipPath, finalPath); err != nil {
-			return helper.BackupResult{Database: dbName, Success: false, Error: fmt.Errorf("failed to save local backup: %w", err)}
-		}
-		log.Printf("Saved backup locally to %s", finalPath)
-	} else {
-		file, err := os.Open(localZipPath)
-		if err != nil {
-			return helper.BackupResult{Database: dbName, Success: false, Error: fmt.Errorf("open file failed: %w", err)}
-		}
-		defer file.Close()
+	if len(dumped) == 0 {
+		return results
+	}
 
-		if err := w.store.Upload(ctx, zipFilename, file); err != nil {
-			return helper.BackupResult{Database: dbName, Success: false, Error: fmt.Errorf("upload failed: %w", err)}
+	helper.Infof("Packing %d databases into a single archive: %v", len(dumped), dumped)
+	result := w.pipeline.Ship(ctx, "mysql", runDir, timeNow, false)
+	result.Duration = time.Since(start)
+	results = append(results, result)
+
+	if w.cfg.Anonymize.Enabled {
+		results = append(results, w.shipStaging(ctx, "mysql", runDir, timeNow, false))
+	}
+	return results
+}
+
+// dump dumps a database into outputPath and checks the result: with
+// mysql.canary it must contain the token written just before, and with
+// mysql.schema_check every object of the live database.
+func (w *Worker) dump(ctx context.Context, dbName, outputPath string) error {
+	var token string
+	if w.cfg.MySQL.Canary.Table != "" {
+		var err error
+		if token, err = w.startCanary(ctx, dbName); err != nil {
+			return err
 		}
 	}
 
-	return helper.BackupResult{
-		Database: dbName,
-		Success:  true,
-		Size:     size,
-		SHA256:   hash,
+	if err := w.Dump(ctx, dbName, outputPath); err != nil {
+		return err
+	}
+
+	if token != "" {
+		if err := verifyCanary(outputPath, dbName, w.cfg.MySQL.Canary.Table, token); err != nil {
+			return err
+		}
+	}
+	if w.cfg.MySQL.SchemaCheck {
+		return w.checkSchema(ctx, dbName, outputPath)
 	}
+	return nil
 }
 
-func (w *Worker) dump(ctx context.Context, dbName, outputPath string) error {
+// Dump dumps a single database into outputPath with util.dumpSchemas, or
+// with mysqldump under mysql.engine: mysqldump.
+func (w *Worker) Dump(ctx context.Context, dbName, outputPath string) error {
 	if err := os.MkdirAll(outputPath, 0755); err != nil {
 		return err
 	}
+	if w.cfg.MySQL.Engine == "mysqldump" {
+		return w.sqlDump(ctx, dbName, outputPath)
+	}
 
 	// Build dump options
-	dumpOpts := w.buildDumpOptions(dbName, outputPath)
+	dumpOpts, err := w.buildDumpOptions(dbName, outputPath)
+	if err != nil {
+		return err
+	}
 
 	// Use --js for JavaScript mode since util.dumpSchemas is a JS function
-	args := []string{
-		fmt.Sprintf("--user=%s", w.cfg.MySQL.User),
-		fmt.Sprintf("--password=%s", w.cfg.MySQL.Password),
-		fmt.Sprintf("--host=%s", w.cfg.MySQL.Host),
-		fmt.Sprintf("--port=%d", w.cfg.MySQL.Port),
-		"--js",
-		"-e",
-		dumpOpts,
-	}
-
-	log.Printf("Dumping database %s to %s", dbName, outputPath)
-	cmd := exec.CommandContext(ctx, "mysqlsh", args...)
-	output, err := cmd.CombinedOutput()
+	args, cleanup, err := w.connArgs()
 	if err != nil {
-		return fmt.Errorf("mysqlsh dump failed: %w, output: %s", err, string(output))
+		return err
+	}
+	defer cleanup()
+	args = append(args, "--js", "-e", dumpOpts)
+
+	ctx, cancel := helper.DumpContext(ctx, w.faults)
+	defer cancel()
+
+	helper.Infof("Dumping database %s to %s", dbName, outputPath)
+	if _, err := helper.Run(ctx, helper.Command{Name: w.cfg.MySQL.ShellPath, Args: args, Priority: w.cfg.MySQL.Priority}); err != nil {
+		return fmt.Errorf("mysqlsh dump failed: %w", err)
 	}
-	log.Printf("Dump completed for %s", dbName)
+	helper.Infof("Dump completed for %s", dbName)
 	return nil
 }
 
 // buildDumpOptions builds the util.dumpSchemas command with table filtering support using JS logic
-func (w *Worker) buildDumpOptions(dbName, outputPath string) string {
-	threads := w.cfg.MySQL.Threads
-	filters := w.cfg.MySQL.TableFilters
-
-	// Escape strings for JS
-	jsIncludeTables := "[]"
-	if len(filters.Include) > 0 {
-		var entries []string
-		for _, t := range filters.Include {
-			entries = append(entries, fmt.Sprintf("'%s.%s'", dbName, t))
+func (w *Worker) buildDumpOptions(dbName, outputPath string) (string, error) {
+	profile := w.cfg.MySQL.Profile(dbName)
+	threads := profile.Threads
+	filters := profile.TableFilters
+
+	// Names are passed as JSON literals and tables qualified with quoted
+	// identifiers, so names with quotes, dots, spaces or CJK characters survive
+	qualify := func(tables []string) []string {
+		qualified := make([]string, len(tables))
+		for i, t := range tables {
+			qualified[i] = quoteIdent(dbName) + "." + quoteIdent(t)
 		}
-		jsIncludeTables = "[" + strings.Join(entries, ", ") + "]"
+		return qualified
 	}
-
-	jsExcludeTables := "[]"
-	if len(filters.Exclude) > 0 {
-		var entries []string
-		for _, t := range filters.Exclude {
-			entries = append(entries, fmt.Sprintf("'%s.%s'", dbName, t))
-		}
-		jsExcludeTables = "[" + strings.Join(entries, ", ") + "]"
-	}
-
-	jsIncludePrefixes := "[]"
-	if len(filters.IncludePrefix) > 0 {
-		var entries []string
-		for _, p := range filters.IncludePrefix {
-			entries = append(entries, fmt.Sprintf("'%s'", p))
+	jsIncludeTables := jsList(qualify(filters.Include))
+	jsExcludeTables := jsList(qualify(filters.Exclude))
+	jsIncludePrefixes := jsList(filters.IncludePrefix)
+	jsExcludePrefixes := jsList(filters.ExcludePrefix)
+
+	// Free-form options are passed through as a JSON object literal
+	extraOptions := profile.DumpOptions
+	if initSQL := w.sessionInitSQL(); len(initSQL) > 0 {
+		if _, ok := extraOptions["sessionInitSql"]; !ok {
+			extraOptions = make(map[string]interface{}, len(profile.DumpOptions)+1)
+			for k, v := range profile.DumpOptions {
+				extraOptions[k] = v
+			}
+			extraOptions["sessionInitSql"] = initSQL
 		}
-		jsIncludePrefixes = "[" + strings.Join(entries, ", ") + "]"
 	}
-
-	jsExcludePrefixes := "[]"
-	if len(filters.ExcludePrefix) > 0 {
-		var entries []string
-		for _, p := range filters.ExcludePrefix {
-			entries = append(entries, fmt.Sprintf("'%s'", p))
-		}
-		jsExcludePrefixes = "[" + strings.Join(entries, ", ") + "]"
+	jsExtraOptions, err := sonic.MarshalString(extraOptions)
+	if err != nil {
+		return "", fmt.Errorf("invalid dump_options: %w", err)
 	}
 
 	// Dynamic script to calculate table lists based on prefixes
 	script := fmt.Sprintf(`
-var db = '%s';
+var db = %s;
 var includeTables = %s;
 var excludeTables = %s;
 var includePrefixes = %s;
 var excludePrefixes = %s;
+var canary = %s;
+
+function q(name) { return '\x60' + name.replace(/\x60/g, '\x60\x60') + '\x60'; } // Quotes an identifier
+function like(prefix) { return prefix.replace(/[\\%%_]/g, '\\$&') + '%%'; } // Matches names starting with prefix
 
 includePrefixes.forEach(function(p) {
-    var rs = session.runSql("SELECT table_name FROM information_schema.tables WHERE table_schema=? AND table_name LIKE ?", [db, p + "%%"]);
-    rs.fetchAll().forEach(function(row) { includeTables.push(db + "." + row[0]); });
+    var rs = session.runSql("SELECT table_name FROM information_schema.tables WHERE table_schema=? AND table_name LIKE ?", [db, like(p)]);
+    rs.fetchAll().forEach(function(row) { includeTables.push(q(db) + "." + q(row[0])); });
 });
 
 excludePrefixes.forEach(function(p) {
-    var rs = session.runSql("SELECT table_name FROM information_schema.tables WHERE table_schema=? AND table_name LIKE ?", [db, p + "%%"]);
-    rs.fetchAll().forEach(function(row) { excludeTables.push(db + "." + row[0]); });
+    var rs = session.runSql("SELECT table_name FROM information_schema.tables WHERE table_schema=? AND table_name LIKE ?", [db, like(p)]);
+    rs.fetchAll().forEach(function(row) { excludeTables.push(q(db) + "." + q(row[0])); });
 });
 
-var opts = {threads: %d, compression: 'zstd'};
+// The canary table is always dumped, whatever the table filters say
+if (canary) {
+    excludeTables = excludeTables.filter(function(t) { return t != q(db) + "." + q(canary); });
+    if (includeTables.length > 0 && includeTables.indexOf(q(db) + "." + q(canary)) < 0) includeTables.push(q(db) + "." + q(canary));
+}
+
+var opts = {threads: %d, compression: %s};
+Object.assign(opts, %s);
 if (includeTables.length > 0) opts.includeTables = includeTables;
 if (excludeTables.length > 0) opts.excludeTables = excludeTables;
 
-util.dumpSchemas([db], '%s', opts);
-`, dbName, jsIncludeTables, jsExcludeTables, jsIncludePrefixes, jsExcludePrefixes, threads, outputPath)
+util.dumpSchemas([db], %s, opts);
+`, jsString(dbName), jsIncludeTables, jsExcludeTables, jsIncludePrefixes, jsExcludePrefixes, jsString(w.cfg.MySQL.Canary.Table),
+		threads, jsString(profile.Compression), jsExtraOptions, jsString(outputPath))
 
 	// Clean up script for logging and execution (remove newlines for -e if necessary, but mysqlsh supports multidatabase scripts)
-	log.Printf("Generated mysqlsh JS script for %s", dbName)
-	return script
+	helper.Infof("Generated mysqlsh JS script for %s", dbName)
+	return script, nil
 }
@@ -0,0 +1,40 @@
+package notify
+
+import (
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// Channel is a configured notification destination.
+type Channel struct {
+	Name string
+	Send func(message string) error
+}
+
+// Channels returns every notification channel configured in cfg.
+func Channels(cfg *config.Config) []Channel {
+	var channels []Channel
+
+	telegram := helper.NewTelegramSender(cfg.Telegram)
+	if telegram.Enabled() {
+		channels = append(channels, Channel{Name: "telegram", Send: func(message string) error {
+			if err := telegram.Send(message); err != nil {
+				return err
+			}
+			return telegram.Flush() // Not batched: the channel is being tested
+		}})
+	}
+
+	// Each notifier plugin is its own channel, so they are tested separately
+	plugins, err := helper.FindPlugins(cfg.Plugins.Dir, helper.PluginNotify)
+	if err != nil {
+		helper.Warnf("notifier plugins disabled: %v", err)
+	}
+	for _, plugin := range plugins {
+		sender := helper.NewTelegramSender(config.TelegramConfig{})
+		sender.SetPlugins([]helper.Plugin{plugin})
+		channels = append(channels, Channel{Name: "plugin " + plugin.Name, Send: sender.Send})
+	}
+
+	return channels
+}
@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var Command = &cli.Command{
+	Name:  "notify",
+	Usage: "Notification channel operations",
+	Commands: []*cli.Command{
+		{
+			Name:   "test",
+			Usage:  "Send a sample message through every configured channel",
+			Action: runTest,
+		},
+	},
+}
+
+// channelResult is the outcome of a test message as printed with --output json.
+type channelResult struct {
+	Channel string `json:"channel"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+}
+
+func runTest(ctx context.Context, c *cli.Command) error {
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+	message := fmt.Sprintf("Backup notification test from %s [%s]", hostname, time.Now().Format(time.RFC3339))
+
+	channels := Channels(cfg)
+	if len(channels) == 0 {
+		return fmt.Errorf("no notification channels configured")
+	}
+
+	asJSON := helper.OptionsFrom(ctx).JSON
+	var results []channelResult
+	failed := 0
+	for _, ch := range channels {
+		if err := ch.Send(message); err != nil {
+			failed++
+			results = append(results, channelResult{Channel: ch.Name, Error: err.Error()})
+			if !asJSON {
+				fmt.Printf("FAIL  %-20s %v\n", ch.Name, err)
+			}
+			continue
+		}
+		results = append(results, channelResult{Channel: ch.Name, OK: true})
+		if !asJSON {
+			fmt.Printf("OK    %s\n", ch.Name)
+		}
+	}
+	if asJSON {
+		if err := helper.PrintJSON(results); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d notification channels failed", failed, len(channels))
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package pause
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var Command = &cli.Command{
+	Name:  "pause",
+	Usage: "Suspend scheduled backups (daemon and cron entries) until resume-schedule",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "reason",
+			Usage: "Why backups are paused, repeated in reminders",
+		},
+	},
+	Action: pause,
+}
+
+var ResumeCommand = &cli.Command{
+	Name:   "resume-schedule",
+	Usage:  "Resume backups suspended by pause",
+	Action: resume,
+}
+
+func pause(ctx context.Context, c *cli.Command) error {
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	state, err := helper.LoadPause(cfg.Schedule.PauseFile)
+	if err != nil {
+		return err
+	}
+	if state != nil {
+		helper.Infof("Backups are already paused since %s", state.PausedAt.Format(time.RFC3339))
+		return nil
+	}
+
+	state = &helper.PauseState{PausedAt: time.Now(), Reason: c.String("reason")}
+	if err := helper.SavePause(cfg.Schedule.PauseFile, state); err != nil {
+		return fmt.Errorf("failed to save pause file: %w", err)
+	}
+	helper.Infof("Backups paused; run `backup resume-schedule` to resume")
+
+	message := "⏸️ Backups paused"
+	if state.Reason != "" {
+		message += ": " + state.Reason
+	}
+	if err := helper.NewNotifier(cfg).SendJob("schedule", message); err != nil {
+		helper.Errorf("failed to send notification: %v", err)
+	}
+	return nil
+}
+
+func resume(ctx context.Context, c *cli.Command) error {
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	state, err := helper.LoadPause(cfg.Schedule.PauseFile)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		helper.Infof("Backups are not paused")
+		return nil
+	}
+	if err := os.Remove(cfg.Schedule.PauseFile); err != nil {
+		return fmt.Errorf("failed to remove pause file: %w", err)
+	}
+
+	paused := time.Since(state.PausedAt).Round(time.Minute)
+	helper.Infof("Backups resumed after %s", paused)
+	if err := helper.NewNotifier(cfg).SendJob("schedule", fmt.Sprintf("▶️ Backups resumed after %s", paused)); err != nil {
+		helper.Errorf("failed to send notification: %v", err)
+	}
+	return nil
+}
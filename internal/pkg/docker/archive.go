@@ -0,0 +1,45 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// CopyFileFrom copies a single file out of the container into dstDir,
+// streaming it without buffering the whole file.
+func (c *Client) CopyFileFrom(ctx context.Context, container, path, dstDir string) error {
+	archive, err := c.CopyFrom(ctx, container, path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("%s not found in archive from %s", path, container)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive from %s: %w", container, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		dst := filepath.Join(dstDir, filepath.Base(hdr.Name))
+		file, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode).Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(file, tr); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to copy %s: %w", path, err)
+		}
+		return file.Close()
+	}
+}
@@ -0,0 +1,268 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bytedance/sonic"
+)
+
+// DefaultHost is the Docker daemon socket used when no host is configured.
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// DetectHost returns the container engine to use: DOCKER_HOST or
+// CONTAINER_HOST when set, else the Docker socket, else a rootful or rootless
+// Podman socket (Podman serves a Docker-compatible API).
+func DetectHost() string {
+	for _, env := range []string{"DOCKER_HOST", "CONTAINER_HOST"} {
+		if host := os.Getenv(env); host != "" {
+			return host
+		}
+	}
+
+	candidates := []string{"/var/run/docker.sock", "/run/podman/podman.sock"}
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+	candidates = append(candidates, filepath.Join(runtimeDir, "podman", "podman.sock"))
+
+	for _, socket := range candidates {
+		if _, err := os.Stat(socket); err == nil {
+			return "unix://" + socket
+		}
+	}
+	return DefaultHost
+}
+
+// Client talks to the Docker Engine API (or Podman's compatible API) over a
+// unix socket or TCP (with optional TLS), without depending on a CLI.
+type Client struct {
+	http *http.Client
+	base string
+}
+
+// NewClient creates a client for host, falling back to DetectHost. TCP hosts
+// use TLS when DOCKER_TLS_VERIFY is set, with certificates from
+// DOCKER_CERT_PATH (default ~/.docker).
+func NewClient(host string) (*Client, error) {
+	if host == "" {
+		host = DetectHost()
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %q: %w", host, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &Client{http: &http.Client{Transport: transport}, base: "http://docker"}, nil
+	case "tcp":
+		if os.Getenv("DOCKER_TLS_VERIFY") == "" {
+			return &Client{http: &http.Client{}, base: "http://" + u.Host}, nil
+		}
+		tlsConfig, err := loadTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		transport := &http.Transport{TLSClientConfig: tlsConfig}
+		return &Client{http: &http.Client{Transport: transport}, base: "https://" + u.Host}, nil
+	default:
+		return nil, fmt.Errorf("unsupported docker host scheme %q: use unix:// or tcp://", u.Scheme)
+	}
+}
+
+func loadTLSConfig() (*tls.Config, error) {
+	certPath := os.Getenv("DOCKER_CERT_PATH")
+	if certPath == "" {
+		home, _ := os.UserHomeDir()
+		certPath = filepath.Join(home, ".docker")
+	}
+	cert, err := tls.LoadX509KeyPair(filepath.Join(certPath, "cert.pem"), filepath.Join(certPath, "key.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load docker client certificate: %w", err)
+	}
+	ca, err := os.ReadFile(filepath.Join(certPath, "ca.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read docker CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("invalid docker CA in %s", certPath)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: pool}, nil
+}
+
+// ErrNotFound is returned for requests on containers, images or volumes that
+// don't exist.
+var ErrNotFound = errors.New("not found")
+
+// Container is an entry of the container list.
+type Container struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// Name returns the container name without the leading slash.
+func (c Container) Name() string {
+	if len(c.Names) == 0 {
+		return c.ID
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// ListContainers returns the running containers carrying all given labels ("key=value").
+func (c *Client) ListContainers(ctx context.Context, labels ...string) ([]Container, error) {
+	filters, err := sonic.MarshalString(map[string][]string{"label": labels})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, http.MethodGet, "/containers/json?filters="+url.QueryEscape(filters), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var containers []Container
+	if err := decode(resp.Body, &containers); err != nil {
+		return nil, fmt.Errorf("failed to decode container list: %w", err)
+	}
+	return containers, nil
+}
+
+// Exec runs cmd inside the container and returns its combined stdout and
+// stderr. A non-zero exit code is reported as an error.
+func (c *Client) Exec(ctx context.Context, container string, cmd ...string) ([]byte, error) {
+	body, err := sonic.Marshal(map[string]interface{}{
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"Cmd":          cmd,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(container)+"/exec", body)
+	if err != nil {
+		return nil, err
+	}
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err = decode(resp.Body, &created)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode exec: %w", err)
+	}
+
+	resp, err = c.do(ctx, http.MethodPost, "/exec/"+created.ID+"/start", []byte(`{"Detach":false,"Tty":false}`))
+	if err != nil {
+		return nil, err
+	}
+	output, err := demux(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return output, fmt.Errorf("failed to read exec output: %w", err)
+	}
+
+	resp, err = c.do(ctx, http.MethodGet, "/exec/"+created.ID+"/json", nil)
+	if err != nil {
+		return output, err
+	}
+	defer resp.Body.Close()
+	var inspect struct {
+		ExitCode int `json:"ExitCode"`
+	}
+	if err := decode(resp.Body, &inspect); err != nil {
+		return output, fmt.Errorf("failed to decode exec result: %w", err)
+	}
+	if inspect.ExitCode != 0 {
+		return output, fmt.Errorf("%s exited with code %d", strings.Join(cmd, " "), inspect.ExitCode)
+	}
+	return output, nil
+}
+
+// CopyFrom streams path from the container as a tar archive.
+func (c *Client) CopyFrom(ctx context.Context, container, path string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(container)+"/archive?path="+url.QueryEscape(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// do sends an API request, turning error statuses into errors.
+func (c *Client) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker api %s %s failed: %w", method, path, err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := fmt.Errorf("docker api %s %s returned %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+		if resp.StatusCode == http.StatusNotFound {
+			err = fmt.Errorf("%w: %w", ErrNotFound, err)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+func decode(r io.Reader, v interface{}) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return sonic.Unmarshal(data, v)
+}
+
+// demux reads a multiplexed exec stream (8-byte frame headers: stream type and
+// big-endian payload size) and returns stdout and stderr interleaved.
+func demux(r io.Reader) ([]byte, error) {
+	var out bytes.Buffer
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return out.Bytes(), nil
+			}
+			return out.Bytes(), err
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(&out, r, size); err != nil {
+			return out.Bytes(), err
+		}
+	}
+}
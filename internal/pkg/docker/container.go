@@ -0,0 +1,125 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/bytedance/sonic"
+)
+
+// ContainerSpec describes a container to create.
+type ContainerSpec struct {
+	Image      string   `json:"Image"`
+	Entrypoint []string `json:"Entrypoint,omitempty"`
+	Cmd        []string `json:"Cmd,omitempty"`
+	HostConfig struct {
+		Binds []string `json:"Binds,omitempty"` // "<volume or host path>:<container path>[:ro]"
+	} `json:"HostConfig"`
+}
+
+// VolumeExists reports whether a named volume exists. Binding a missing
+// volume would silently create an empty one.
+func (c *Client) VolumeExists(ctx context.Context, name string) (bool, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/volumes/"+url.PathEscape(name), nil)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// EnsureImage pulls image unless it is present.
+func (c *Client) EnsureImage(ctx context.Context, image string) error {
+	resp, err := c.do(ctx, http.MethodGet, "/images/"+image+"/json", nil)
+	if err == nil {
+		resp.Body.Close()
+		return nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	resp, err = c.do(ctx, http.MethodPost, "/images/create?fromImage="+url.QueryEscape(image), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// The pull reports its progress, and its failure, as a stream of JSON lines
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var progress struct {
+			Error string `json:"error"`
+		}
+		if sonic.Unmarshal(scanner.Bytes(), &progress) == nil && progress.Error != "" {
+			return fmt.Errorf("failed to pull %s: %s", image, progress.Error)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to pull %s: %w", image, err)
+	}
+	return nil
+}
+
+// CreateContainer creates a container and returns its ID.
+func (c *Client) CreateContainer(ctx context.Context, spec ContainerSpec) (string, error) {
+	body, err := sonic.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/containers/create", body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := decode(resp.Body, &created); err != nil {
+		return "", fmt.Errorf("failed to decode created container: %w", err)
+	}
+	return created.ID, nil
+}
+
+// RunContainer starts a created container and waits for it to exit. A
+// non-zero exit code is reported as an error.
+func (c *Client) RunContainer(ctx context.Context, id string) error {
+	resp, err := c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/start", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	resp, err = c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/wait", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		StatusCode int `json:"StatusCode"`
+	}
+	if err := decode(resp.Body, &result); err != nil {
+		return fmt.Errorf("failed to decode container result: %w", err)
+	}
+	if result.StatusCode != 0 {
+		return fmt.Errorf("container exited with code %d", result.StatusCode)
+	}
+	return nil
+}
+
+// RemoveContainer removes a container, stopping it first when it runs. Its
+// named volumes are kept.
+func (c *Client) RemoveContainer(ctx context.Context, id string) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/containers/"+url.PathEscape(id)+"?force=1", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
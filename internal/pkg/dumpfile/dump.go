@@ -0,0 +1,309 @@
+package dumpfile
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bytedance/sonic"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Dump is a mysqlsh dump directory (the directory containing @.json).
+type Dump struct {
+	Dir         string
+	Compression string
+	Schemas     []string
+	basenames   map[string]string
+}
+
+// Table describes the data files of a single dumped table.
+type Table struct {
+	Schema      string
+	Name        string
+	Columns     []string
+	Compression string
+	Extension   string
+	basePath    string
+}
+
+// Open reads the dump metadata of a mysqlsh dump directory.
+func Open(dir string) (*Dump, error) {
+	var meta struct {
+		Compression string            `json:"compression"`
+		Schemas     []string          `json:"schemas"`
+		Basenames   map[string]string `json:"basenames"`
+	}
+	if err := readJSON(filepath.Join(dir, "@.json"), &meta); err != nil {
+		return nil, err
+	}
+	return &Dump{
+		Dir:         dir,
+		Compression: meta.Compression,
+		Schemas:     meta.Schemas,
+		basenames:   meta.Basenames,
+	}, nil
+}
+
+// FindDumps returns all mysqlsh dump directories below root.
+func FindDumps(root string) ([]*Dump, error) {
+	var dumps []*Dump
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != "@.json" {
+			return nil
+		}
+		dump, err := Open(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		dumps = append(dumps, dump)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dumps, nil
+}
+
+// HasSchema reports whether the dump contains the given schema.
+func (d *Dump) HasSchema(schema string) bool {
+	for _, s := range d.Schemas {
+		if s == schema {
+			return true
+		}
+	}
+	return false
+}
+
+// Table reads the metadata of a dumped table.
+func (d *Dump) Table(schema, table string) (*Table, error) {
+	schemaBase := d.schemaBasename(schema)
+
+	var schemaMeta struct {
+		Basenames map[string]string `json:"basenames"`
+	}
+	if err := readJSON(filepath.Join(d.Dir, schemaBase+".json"), &schemaMeta); err != nil {
+		return nil, err
+	}
+	tableBase := table
+	if b, ok := schemaMeta.Basenames[table]; ok {
+		tableBase = b
+	}
+
+	basePath := filepath.Join(d.Dir, schemaBase+"@"+tableBase)
+	var tableMeta struct {
+		Compression string `json:"compression"`
+		Extension   string `json:"extension"`
+		Options     struct {
+			Columns []string `json:"columns"`
+		} `json:"options"`
+	}
+	if err := readJSON(basePath+".json", &tableMeta); err != nil {
+		return nil, err
+	}
+
+	t := &Table{
+		Schema:      schema,
+		Name:        table,
+		Columns:     tableMeta.Options.Columns,
+		Compression: tableMeta.Compression,
+		Extension:   tableMeta.Extension,
+		basePath:    basePath,
+	}
+	if t.Compression == "" {
+		t.Compression = d.Compression
+	}
+	if t.Extension == "" {
+		t.Extension = "tsv"
+		if ext := compressionExtension(t.Compression); ext != "" {
+			t.Extension += "." + ext
+		}
+	}
+	return t, nil
+}
+
+func (d *Dump) schemaBasename(schema string) string {
+	if b, ok := d.basenames[schema]; ok {
+		return b
+	}
+	return schema
+}
+
+// DataFiles returns the table's data chunk files in load order.
+func (t *Table) DataFiles() ([]string, error) {
+	ext := "." + t.Extension
+	matches, err := filepath.Glob(globEscape(t.basePath) + "*" + globEscape(ext))
+	if err != nil {
+		return nil, err
+	}
+
+	type chunk struct {
+		path      string
+		partition string
+		index     int
+	}
+	base := filepath.Base(t.basePath)
+	var chunks []chunk
+	for _, path := range matches {
+		name := strings.TrimSuffix(filepath.Base(path), ext)
+		if name == base {
+			chunks = append(chunks, chunk{path: path})
+			continue
+		}
+		// Chunked files are named "<base>@[<partition>@]<n>" with "@@<n>" marking the last chunk
+		suffix, ok := strings.CutPrefix(name, base+"@")
+		if !ok {
+			continue
+		}
+		i := strings.LastIndex(suffix, "@")
+		index, err := strconv.Atoi(suffix[i+1:])
+		if err != nil {
+			continue
+		}
+		partition := ""
+		if i > 0 {
+			partition = strings.TrimSuffix(suffix[:i], "@")
+		}
+		chunks = append(chunks, chunk{path: path, partition: partition, index: index})
+	}
+
+	sort.Slice(chunks, func(i, j int) bool {
+		if chunks[i].partition != chunks[j].partition {
+			return chunks[i].partition < chunks[j].partition
+		}
+		return chunks[i].index < chunks[j].index
+	})
+
+	files := make([]string, len(chunks))
+	for i, c := range chunks {
+		files[i] = c.path
+	}
+	return files, nil
+}
+
+// OpenChunk opens a data chunk file and returns a reader of its decompressed content.
+func (t *Table) OpenChunk(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.Compression {
+	case "", "none":
+		return file, nil
+	case "zstd":
+		decoder, err := zstd.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &chunkReader{Reader: decoder, close: func() error {
+			decoder.Close()
+			return file.Close()
+		}}, nil
+	case "gzip":
+		decoder, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &chunkReader{Reader: decoder, close: func() error {
+			decoder.Close()
+			return file.Close()
+		}}, nil
+	default:
+		file.Close()
+		return nil, fmt.Errorf("unsupported dump compression %q", t.Compression)
+	}
+}
+
+// CreateChunk creates a data chunk file and returns a writer compressing into it.
+func (t *Table) CreateChunk(path string) (io.WriteCloser, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.Compression {
+	case "", "none":
+		return file, nil
+	case "zstd":
+		encoder, err := zstd.NewWriter(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &chunkWriter{Writer: encoder, close: func() error {
+			if err := encoder.Close(); err != nil {
+				file.Close()
+				return err
+			}
+			return file.Close()
+		}}, nil
+	case "gzip":
+		encoder := gzip.NewWriter(file)
+		return &chunkWriter{Writer: encoder, close: func() error {
+			if err := encoder.Close(); err != nil {
+				file.Close()
+				return err
+			}
+			return file.Close()
+		}}, nil
+	default:
+		file.Close()
+		return nil, fmt.Errorf("unsupported dump compression %q", t.Compression)
+	}
+}
+
+type chunkReader struct {
+	io.Reader
+	close func() error
+}
+
+func (r *chunkReader) Close() error { return r.close() }
+
+type chunkWriter struct {
+	io.Writer
+	close func() error
+}
+
+func (w *chunkWriter) Close() error { return w.close() }
+
+func compressionExtension(compression string) string {
+	switch compression {
+	case "zstd":
+		return "zst"
+	case "gzip":
+		return "gz"
+	}
+	return ""
+}
+
+func globEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`)
+	return r.Replace(s)
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := sonic.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// BasePath returns the path prefix shared by the table's metadata and data files.
+func (t *Table) BasePath() string {
+	return t.basePath
+}
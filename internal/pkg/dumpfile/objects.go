@@ -0,0 +1,49 @@
+package dumpfile
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Objects returns the names of the objects of a dumped schema by kind: table,
+// view, function, procedure, event and trigger. Routines, events and triggers
+// are only listed when the dump includes them.
+func (d *Dump) Objects(schema string) (map[string][]string, error) {
+	schemaBase := d.schemaBasename(schema)
+
+	var meta struct {
+		Tables     []string          `json:"tables"`
+		Views      []string          `json:"views"`
+		Functions  []string          `json:"functions"`
+		Procedures []string          `json:"procedures"`
+		Events     []string          `json:"events"`
+		Basenames  map[string]string `json:"basenames"`
+	}
+	if err := readJSON(filepath.Join(d.Dir, schemaBase+".json"), &meta); err != nil {
+		return nil, err
+	}
+	objects := map[string][]string{
+		"table":     meta.Tables,
+		"view":      meta.Views,
+		"function":  meta.Functions,
+		"procedure": meta.Procedures,
+		"event":     meta.Events,
+	}
+
+	// Triggers are listed in the metadata of their table
+	for _, table := range meta.Tables {
+		tableBase := table
+		if b, ok := meta.Basenames[table]; ok {
+			tableBase = b
+		}
+		var tableMeta struct {
+			Triggers []string `json:"triggers"`
+		}
+		err := readJSON(filepath.Join(d.Dir, schemaBase+"@"+tableBase+".json"), &tableMeta)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		objects["trigger"] = append(objects["trigger"], tableMeta.Triggers...)
+	}
+	return objects, nil
+}
@@ -0,0 +1,161 @@
+package dumpfile
+
+import (
+	"bufio"
+	"database/sql"
+	"io"
+)
+
+// Row is a decoded data row; invalid entries are SQL NULLs.
+type Row []sql.NullString
+
+// Reader decodes rows from mysqlsh data chunks written with the default
+// dialect (tab separated fields, newline terminated lines, backslash escapes).
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader creates a row reader over decompressed chunk data.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// Read returns the next row, or io.EOF when the data is exhausted.
+func (r *Reader) Read() (Row, error) {
+	var (
+		row     Row
+		field   []byte
+		escaped bool // Field so far consists of exactly "\N"
+		started bool
+	)
+
+	finishField := func() {
+		if escaped && string(field) == "N" {
+			row = append(row, sql.NullString{})
+		} else {
+			row = append(row, sql.NullString{String: string(field), Valid: true})
+		}
+		field = field[:0]
+		escaped = false
+	}
+
+	for {
+		b, err := r.r.ReadByte()
+		if err == io.EOF {
+			if !started {
+				return nil, io.EOF
+			}
+			finishField()
+			return row, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		started = true
+
+		switch b {
+		case '\\':
+			next, err := r.r.ReadByte()
+			if err != nil {
+				return nil, io.ErrUnexpectedEOF
+			}
+			if next == 'N' && len(field) == 0 {
+				escaped = true
+				field = append(field, 'N')
+				continue
+			}
+			escaped = false
+			field = append(field, unescape(next))
+		case '\t':
+			finishField()
+		case '\n':
+			finishField()
+			return row, nil
+		default:
+			escaped = false
+			field = append(field, b)
+		}
+	}
+}
+
+func unescape(b byte) byte {
+	switch b {
+	case '0':
+		return 0
+	case 'b':
+		return '\b'
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'Z':
+		return 0x1a
+	}
+	return b
+}
+
+// Writer encodes rows in the dialect understood by Reader and util.loadDump.
+type Writer struct {
+	w *bufio.Writer
+	n int64
+}
+
+// NewWriter creates a row writer producing uncompressed chunk data.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriterSize(w, 64*1024)}
+}
+
+// Write encodes a single row.
+func (w *Writer) Write(row Row) error {
+	for i, v := range row {
+		if i > 0 {
+			w.writeByte('\t')
+		}
+		if !v.Valid {
+			w.writeString(`\N`)
+			continue
+		}
+		for j := 0; j < len(v.String); j++ {
+			switch b := v.String[j]; b {
+			case '\\':
+				w.writeString(`\\`)
+			case '\t':
+				w.writeString(`\t`)
+			case '\n':
+				w.writeString(`\n`)
+			case '\r':
+				w.writeString(`\r`)
+			case 0:
+				w.writeString(`\0`)
+			case 0x1a:
+				w.writeString(`\Z`)
+			default:
+				w.writeByte(b)
+			}
+		}
+	}
+	w.writeByte('\n')
+	return nil
+}
+
+// Flush writes buffered data to the underlying writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Written returns the number of uncompressed bytes written so far.
+func (w *Writer) Written() int64 {
+	return w.n
+}
+
+func (w *Writer) writeByte(b byte) {
+	w.w.WriteByte(b)
+	w.n++
+}
+
+func (w *Writer) writeString(s string) {
+	w.w.WriteString(s)
+	w.n += int64(len(s))
+}
@@ -0,0 +1,176 @@
+package helper
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// ErrApprovalRequired is returned while a destructive operation waits for a
+// second operator.
+var ErrApprovalRequired = errors.New("approval required")
+
+// Approval is a destructive operation waiting for, or granted by, a second
+// operator. Only a hash of its token is stored; the token itself is sent
+// through the notifier.
+type Approval struct {
+	ID          string    `json:"id"`
+	Action      string    `json:"action"`
+	Summary     string    `json:"summary"`
+	TokenHash   string    `json:"token_hash"`
+	RequestedBy string    `json:"requested_by"`
+	RequestedAt time.Time `json:"requested_at"`
+	ApprovedBy  string    `json:"approved_by,omitempty"`
+	ApprovedAt  time.Time `json:"approved_at,omitempty"`
+}
+
+// Operator identifies the person running the tool as user@host. The user
+// behind sudo counts, as both operators often end up as root.
+func Operator() string {
+	name := os.Getenv("SUDO_USER")
+	if name == "" {
+		if u, err := user.Current(); err == nil {
+			name = u.Username
+		}
+	}
+	hostname, _ := os.Hostname()
+	return name + "@" + hostname
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func loadApproval(path string) (*Approval, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var approval Approval
+	if err := sonic.Unmarshal(data, &approval); err != nil {
+		return nil, fmt.Errorf("failed to parse approval %s: %w", path, err)
+	}
+	return &approval, nil
+}
+
+func saveApproval(path string, approval *Approval) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create approval dir: %w", err)
+	}
+	data, err := sonic.Marshal(approval)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// RequireApproval enforces the two-person rule on an action affecting count
+// backups. scope identifies the operation (e.g. the keys involved), so an
+// approval only unlocks the operation it was requested for, once. The first
+// call sends an approval token through the notifier; until a second operator
+// runs `backup approve <token>`, calls fail with ErrApprovalRequired.
+func RequireApproval(cfg *config.Config, action, scope string, count int, summary string) error {
+	if cfg.Approval.Threshold <= 0 || count <= cfg.Approval.Threshold {
+		return nil
+	}
+	ttl := cfg.Approval.TTLDuration()
+	sum := sha256.Sum256([]byte(action + "\n" + scope))
+	id := hex.EncodeToString(sum[:8])
+	path := filepath.Join(cfg.Approval.Dir, id+".json")
+
+	approval, err := loadApproval(path)
+	if err != nil {
+		return err
+	}
+	if approval != nil && !approval.ApprovedAt.IsZero() && time.Since(approval.ApprovedAt) < ttl {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to consume approval: %w", err)
+		}
+		Infof("%s approved by %s", summary, approval.ApprovedBy)
+		return nil
+	}
+	if approval != nil && approval.ApprovedAt.IsZero() && time.Since(approval.RequestedAt) < ttl {
+		return fmt.Errorf("%w: %s is waiting for a second operator since %s", ErrApprovalRequired, summary, approval.RequestedAt.Format(time.RFC3339))
+	}
+
+	notifier := NewNotifier(cfg)
+	if !notifier.Enabled() && len(notifier.plugins) == 0 {
+		return fmt.Errorf("%w: %s, but no notifier is configured to deliver the approval token", ErrApprovalRequired, summary)
+	}
+	token := NewRunID() + NewRunID()
+	approval = &Approval{
+		ID:          id,
+		Action:      action,
+		Summary:     summary,
+		TokenHash:   hashToken(token),
+		RequestedBy: Operator(),
+		RequestedAt: time.Now(),
+	}
+	if err := saveApproval(path, approval); err != nil {
+		return fmt.Errorf("failed to save approval request: %w", err)
+	}
+	message := fmt.Sprintf("🔐 Approval needed: %s\nRequested by %s\nAnother operator can approve it within %s by running:\nbackup approve %s", summary, approval.RequestedBy, ttl, token)
+	if err := notifier.Notify(action, SeverityAlert, message); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to send approval token: %w", err)
+	}
+	return fmt.Errorf("%w: %s needs a second operator; a token was sent through the notifier, run again once it is approved with `backup approve <token>`", ErrApprovalRequired, summary)
+}
+
+// Approve grants the pending approval matching token. The approver must be
+// a different operator than the requester.
+func Approve(cfg *config.Config, token string) (*Approval, error) {
+	entries, err := os.ReadDir(cfg.Approval.Dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read approval dir: %w", err)
+	}
+
+	hash := hashToken(strings.TrimSpace(token))
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(cfg.Approval.Dir, entry.Name())
+		approval, err := loadApproval(path)
+		if err != nil {
+			Warnf("%v", err)
+			continue
+		}
+		if approval == nil || subtle.ConstantTimeCompare([]byte(approval.TokenHash), []byte(hash)) != 1 {
+			continue
+		}
+
+		if !approval.ApprovedAt.IsZero() {
+			return nil, fmt.Errorf("%s was already approved by %s", approval.Summary, approval.ApprovedBy)
+		}
+		if time.Since(approval.RequestedAt) >= cfg.Approval.TTLDuration() {
+			return nil, fmt.Errorf("the token for %s has expired; run the operation again for a new one", approval.Summary)
+		}
+		approver := Operator()
+		if approver == approval.RequestedBy {
+			return nil, fmt.Errorf("%s was requested by %s and must be approved by another operator", approval.Summary, approver)
+		}
+		approval.ApprovedBy = approver
+		approval.ApprovedAt = time.Now()
+		if err := saveApproval(path, approval); err != nil {
+			return nil, fmt.Errorf("failed to save approval: %w", err)
+		}
+		return approval, nil
+	}
+	return nil, fmt.Errorf("no pending approval matches this token")
+}
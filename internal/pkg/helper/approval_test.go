@@ -0,0 +1,183 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// testApprovals enables the two-person rule above threshold backups. Tokens
+// are delivered through a notifier plugin keeping the last message, from
+// which the returned function reads the token.
+func testApprovals(t *testing.T, threshold int) (*config.Config, func() string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the notifier plugin is a shell script")
+	}
+	cfg := testConfig(t)
+	cfg.Approval.Threshold = threshold
+	cfg.Approval.Dir = t.TempDir()
+	cfg.Approval.TTL = "1h"
+	cfg.Plugins.Dir = t.TempDir()
+	message := filepath.Join(t.TempDir(), "message")
+	script := "#!/bin/sh\ncat > '" + message + "'\n"
+	if err := os.WriteFile(filepath.Join(cfg.Plugins.Dir, "backup-notify-record"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return cfg, func() string {
+		t.Helper()
+		data, err := os.ReadFile(message)
+		if err != nil {
+			t.Fatalf("no approval token sent: %v", err)
+		}
+		_, token, ok := strings.Cut(string(data), "backup approve ")
+		if !ok {
+			t.Fatalf("message lacks the token:\n%s", data)
+		}
+		return strings.TrimSpace(token)
+	}
+}
+
+// asOperator makes Operator name the given user.
+func asOperator(t *testing.T, name string) {
+	t.Setenv("SUDO_USER", name)
+}
+
+func TestApprovalApprove(t *testing.T) {
+	cfg, token := testApprovals(t, 1)
+	request := func() error { return RequireApproval(cfg, "rekey", "a\nb", 2, "rekey of 2 backups") }
+
+	asOperator(t, "alice")
+	if err := RequireApproval(cfg, "rekey", "a", 1, "rekey of 1 backup"); err != nil {
+		t.Fatalf("operation within the threshold: %v", err)
+	}
+	if err := request(); !errors.Is(err, ErrApprovalRequired) {
+		t.Fatalf("first request = %v, want ErrApprovalRequired", err)
+	}
+	sent := token()
+	if err := request(); !errors.Is(err, ErrApprovalRequired) || !strings.Contains(err.Error(), "waiting for a second operator") {
+		t.Fatalf("pending request = %v, want it waiting", err)
+	}
+
+	asOperator(t, "bob")
+	approval, err := Approve(cfg, sent)
+	if err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+	if !strings.HasPrefix(approval.ApprovedBy, "bob@") || !strings.HasPrefix(approval.RequestedBy, "alice@") {
+		t.Errorf("approval by %s of a request by %s", approval.ApprovedBy, approval.RequestedBy)
+	}
+
+	asOperator(t, "alice")
+	if err := request(); err != nil {
+		t.Fatalf("approved request = %v", err)
+	}
+	// An approval is consumed by the operation it was granted for
+	if err := request(); !errors.Is(err, ErrApprovalRequired) {
+		t.Fatalf("request after the approval was used = %v, want ErrApprovalRequired", err)
+	}
+}
+
+func TestApprovalRejects(t *testing.T) {
+	cfg, token := testApprovals(t, 1)
+	asOperator(t, "alice")
+	if err := RequireApproval(cfg, "rekey", "a\nb", 2, "rekey of 2 backups"); !errors.Is(err, ErrApprovalRequired) {
+		t.Fatalf("request = %v, want ErrApprovalRequired", err)
+	}
+	sent := token()
+
+	asOperator(t, "bob")
+	if _, err := Approve(cfg, "not-the-token"); err == nil || !strings.Contains(err.Error(), "no pending approval") {
+		t.Errorf("Approve with a wrong token = %v", err)
+	}
+	if _, err := Approve(cfg, sent); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Approve(cfg, sent); err == nil || !strings.Contains(err.Error(), "already approved") {
+		t.Errorf("second Approve = %v", err)
+	}
+
+	// The approval unlocks its own scope only
+	asOperator(t, "alice")
+	if err := RequireApproval(cfg, "rekey", "a\nc", 2, "rekey of 2 backups"); !errors.Is(err, ErrApprovalRequired) {
+		t.Errorf("request of other keys = %v, want ErrApprovalRequired", err)
+	}
+
+	// Tokens expire after approval.ttl
+	expiring := token()
+	cfg.Approval.TTL = "1ns"
+	asOperator(t, "bob")
+	if _, err := Approve(cfg, expiring); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("Approve of an expired token = %v", err)
+	}
+}
+
+func TestApprovalSameOperator(t *testing.T) {
+	cfg, token := testApprovals(t, 1)
+	asOperator(t, "alice")
+	if err := RequireApproval(cfg, "rekey", "a\nb", 2, "rekey of 2 backups"); !errors.Is(err, ErrApprovalRequired) {
+		t.Fatalf("request = %v, want ErrApprovalRequired", err)
+	}
+	if _, err := Approve(cfg, token()); err == nil || !strings.Contains(err.Error(), "another operator") {
+		t.Fatalf("self-approval = %v, want it refused", err)
+	}
+	if err := RequireApproval(cfg, "rekey", "a\nb", 2, "rekey of 2 backups"); !errors.Is(err, ErrApprovalRequired) {
+		t.Errorf("request after a refused self-approval = %v, want it still waiting", err)
+	}
+}
+
+func TestRetentionApprovalCoversDeletionSet(t *testing.T) {
+	cfg, token := testApprovals(t, 1)
+	cfg.Retention.Hours = 24
+	store := NewMemoryStorage("")
+	old := time.Now().Add(-48 * time.Hour)
+	expire := func(name string) {
+		key := ArtifactFilename(name, old, NewRunID(), "")
+		if err := store.Upload(context.Background(), key, strings.NewReader("x")); err != nil {
+			t.Fatal(err)
+		}
+		store.SetModified(key, old)
+	}
+	expire("shop")
+	expire("blog")
+	p := NewPipeline(cfg, store, Options{})
+	retention := FixedRetention(cfg.Retention.Hours)
+
+	asOperator(t, "alice")
+	if err := p.EnforceRetention(context.Background(), retention); !errors.Is(err, ErrApprovalRequired) {
+		t.Fatalf("retention = %v, want ErrApprovalRequired", err)
+	}
+	asOperator(t, "bob")
+	if _, err := Approve(cfg, token()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another backup expiring makes it a different deletion, needing its own approval
+	expire("wiki")
+	asOperator(t, "alice")
+	if err := p.EnforceRetention(context.Background(), retention); !errors.Is(err, ErrApprovalRequired) {
+		t.Fatalf("retention of more backups = %v, want ErrApprovalRequired", err)
+	}
+	if keys := artifactKeys(t, store); len(keys) != 3 {
+		t.Fatalf("stored artifacts = %v, want all 3 kept", keys)
+	}
+
+	asOperator(t, "bob")
+	if _, err := Approve(cfg, token()); err != nil {
+		t.Fatal(err)
+	}
+	asOperator(t, "alice")
+	if err := p.EnforceRetention(context.Background(), retention); err != nil {
+		t.Fatalf("approved retention = %v", err)
+	}
+	if keys := artifactKeys(t, store); len(keys) != 0 {
+		t.Errorf("stored artifacts = %v, want all deleted", keys)
+	}
+}
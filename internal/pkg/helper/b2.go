@@ -0,0 +1,225 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Backblaze/blazer/b2"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// unfinishedUploadAge is the age after which unfinished large file uploads
+// are cancelled by retention; B2 keeps (and bills) their parts otherwise.
+const unfinishedUploadAge = 24 * time.Hour
+
+// B2Storage stores artifacts in a Backblaze B2 bucket through the native B2
+// API. Large artifacts use the large file API with parts buffered on disk,
+// and deletions remove every version of a file, as B2 keeps versions even
+// when the bucket has no lifecycle rules.
+type B2Storage struct {
+	bucket     *b2.Bucket
+	pathPrefix string
+	layout     string
+
+	chunkSize         int
+	concurrentUploads int
+	bufferDir         string
+}
+
+// NewB2Storage authorizes with B2 and opens the configured bucket. Upload
+// parts are buffered in bufferDir.
+func NewB2Storage(cfg config.B2Config, bufferDir string) (*B2Storage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	client, err := b2.NewClient(ctx, cfg.KeyID, cfg.ApplicationKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authorize with b2: %w", err)
+	}
+	bucket, err := client.Bucket(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open b2 bucket %s: %w", cfg.Bucket, err)
+	}
+	return &B2Storage{
+		bucket:            bucket,
+		pathPrefix:        cfg.PathPrefix,
+		layout:            cfg.Layout,
+		chunkSize:         cfg.ChunkSizeMB << 20,
+		concurrentUploads: cfg.ConcurrentUploads,
+		bufferDir:         bufferDir,
+	}, nil
+}
+
+func (s *B2Storage) ObjectKey(source string, ts time.Time, filename string) string {
+	return objectKey(s.pathPrefix, s.layout, source, ts, filename)
+}
+
+// Upload uploads content unless the key exists. B2 has no conditional
+// uploads, so the check is not atomic; a concurrent upload would become a
+// newer version of the file.
+func (s *B2Storage) Upload(ctx context.Context, key string, content io.Reader) error {
+	exists, err := s.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%w: %s", ErrObjectExists, key)
+	}
+	return s.put(ctx, key, content)
+}
+
+// Replace uploads a new version of the file, then deletes the older ones.
+func (s *B2Storage) Replace(ctx context.Context, key string, content io.Reader) error {
+	versions, err := s.versions(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := s.put(ctx, key, content); err != nil {
+		return err
+	}
+	for _, version := range versions {
+		if err := version.Delete(ctx); err != nil {
+			Warnf("failed to delete old version of %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+func (s *B2Storage) put(ctx context.Context, key string, content io.Reader) error {
+	w := s.bucket.Object(key).NewWriter(ctx)
+	w.ChunkSize = s.chunkSize
+	w.ConcurrentUploads = s.concurrentUploads
+	w.UseFileBuffer = true
+	w.FileBufferDir = s.bufferDir
+
+	size, err := io.Copy(w, &contextReader{ctx: ctx, r: content})
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload object %s: %w", key, err)
+	}
+	Infof("Uploaded %s to %s (Size: %d)", key, s.bucket.Name(), size)
+	return nil
+}
+
+func (s *B2Storage) Exists(ctx context.Context, key string) (bool, error) {
+	attrs, err := s.bucket.Object(key).Attrs(ctx)
+	if b2.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to stat object %s: %w", key, err)
+	}
+	return attrs.Status == b2.Uploaded, nil
+}
+
+func (s *B2Storage) Download(ctx context.Context, key string, w io.Writer) error {
+	r := s.bucket.Object(key).NewReader(ctx)
+	defer r.Close()
+
+	if _, err := io.Copy(w, r); err != nil {
+		return fmt.Errorf("failed to download object %s: %w", key, err)
+	}
+	return nil
+}
+
+// List returns the current files under the path prefix.
+func (s *B2Storage) List(ctx context.Context) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	iter := s.bucket.List(ctx, b2.ListPrefix(s.pathPrefix))
+	for iter.Next() {
+		attrs, err := iter.Object().Attrs(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		if attrs.Status != b2.Uploaded {
+			continue
+		}
+		objects = append(objects, ObjectInfo{Key: attrs.Name, Size: attrs.Size, LastModified: attrs.UploadTimestamp})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	return objects, nil
+}
+
+// versions returns every version and hide marker of a file.
+func (s *B2Storage) versions(ctx context.Context, key string) ([]*b2.Object, error) {
+	var versions []*b2.Object
+	iter := s.bucket.List(ctx, b2.ListPrefix(key), b2.ListHidden())
+	for iter.Next() {
+		if object := iter.Object(); object.Name() == key {
+			versions = append(versions, object)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list versions of %s: %w", key, err)
+	}
+	return versions, nil
+}
+
+// Delete deletes every version of a file, so no hidden copies are left behind.
+func (s *B2Storage) Delete(ctx context.Context, key string) error {
+	versions, err := s.versions(ctx, key)
+	if err != nil {
+		return err
+	}
+	for _, version := range versions {
+		if err := version.Delete(ctx); err != nil {
+			return fmt.Errorf("failed to delete object %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// EnforceRetention deletes expired artifacts with all their versions, then
+// cancels large file uploads left unfinished by interrupted runs.
+func (s *B2Storage) EnforceRetention(ctx context.Context, retention RetentionFunc, limits RetentionLimits) (RetentionStats, error) {
+	stats, err := enforceRetention(ctx, s, retention, limits)
+	if err != nil {
+		return stats, err
+	}
+
+	cancelled := 0
+	iter := s.bucket.List(ctx, b2.ListPrefix(s.pathPrefix), b2.ListUnfinished())
+	for iter.Next() {
+		if ctx.Err() != nil {
+			break
+		}
+		object := iter.Object()
+		attrs, err := object.Attrs(ctx)
+		if err != nil || attrs.Status != b2.Started || time.Since(attrs.UploadTimestamp) < unfinishedUploadAge {
+			continue
+		}
+		if err := object.Cancel(ctx); err != nil {
+			Errorf("failed to cancel unfinished upload %s: %v", object.Name(), err)
+			continue
+		}
+		cancelled++
+	}
+	if cancelled > 0 {
+		Infof("Retention: cancelled %d unfinished large file uploads", cancelled)
+	}
+	if err := ctx.Err(); err != nil {
+		return stats, err
+	}
+	return stats, iter.Err()
+}
+
+func (s *B2Storage) SelfTest(ctx context.Context) error {
+	return canaryTest(ctx, s, s.Delete)
+}
+
+// PresignedURL returns a download URL carrying a download authorization
+// limited to the object.
+func (s *B2Storage) PresignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	u, err := s.bucket.Object(key).AuthURL(ctx, expires, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to authorize download of %s: %w", key, err)
+	}
+	return u.String(), nil
+}
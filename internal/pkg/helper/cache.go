@@ -0,0 +1,145 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// Cache keeps copies of the most recently uploaded artifacts on local disk, so
+// restoring a recent backup doesn't require downloading it again.
+type Cache struct {
+	dir      string
+	maxItems int
+	maxBytes int64
+}
+
+// NewCache creates the local artifact cache. It returns nil when caching is disabled.
+func NewCache(cfg config.CacheConfig) *Cache {
+	if cfg.Dir == "" {
+		return nil
+	}
+	return &Cache{
+		dir:      cfg.Dir,
+		maxItems: cfg.MaxItems,
+		maxBytes: int64(cfg.MaxSizeMB) << 20,
+	}
+}
+
+// Put copies an uploaded artifact and its manifest into the cache, then evicts
+// the oldest artifacts beyond the configured limits.
+func (c *Cache) Put(key, artifactPath string, manifest *Manifest) error {
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create cache dir: %w", err)
+	}
+	dst := filepath.Join(c.dir, path.Base(key))
+	if err := CopyFile(artifactPath, dst); err != nil {
+		return fmt.Errorf("failed to cache artifact: %w", err)
+	}
+	if manifest != nil {
+		data, err := manifest.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(ManifestKey(dst), data, 0600); err != nil {
+			return fmt.Errorf("failed to cache manifest: %w", err)
+		}
+	}
+	return c.evict()
+}
+
+// Lookup returns the cached copy of the artifact stored under key.
+func (c *Cache) Lookup(key string) (string, bool) {
+	cached := filepath.Join(c.dir, path.Base(key))
+	if _, err := os.Stat(cached); err != nil {
+		return "", false
+	}
+	return cached, true
+}
+
+// Artifacts returns the paths of the cached artifacts.
+func (c *Cache) Artifacts() ([]string, error) {
+	entries, err := os.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && !strings.HasSuffix(entry.Name(), ManifestSuffix) {
+			paths = append(paths, filepath.Join(c.dir, entry.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// evict removes the oldest cached artifacts until the cache fits its limits.
+func (c *Cache) evict() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	var artifacts []os.FileInfo
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ManifestSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		artifacts = append(artifacts, info)
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].ModTime().After(artifacts[j].ModTime())
+	})
+
+	var total int64
+	for i, info := range artifacts {
+		total += info.Size()
+		if (c.maxItems > 0 && i >= c.maxItems) || (c.maxBytes > 0 && total > c.maxBytes) {
+			cached := filepath.Join(c.dir, info.Name())
+			os.Remove(cached)
+			os.Remove(ManifestKey(cached))
+			Infof("Evicted %s from the local cache", info.Name())
+		}
+	}
+	return nil
+}
+
+// FetchArtifact places the artifact stored under key, with its manifest if it
+// has one, at dst. Artifacts in the local cache are copied instead of
+// downloaded; cache may be nil.
+func FetchArtifact(ctx context.Context, store Storage, cache *Cache, key, dst string) error {
+	if cache != nil {
+		if cached, ok := cache.Lookup(key); ok {
+			Debugf("Using cached copy of %s", key)
+			if err := CopyFile(cached, dst); err != nil {
+				return err
+			}
+			if err := CopyFile(ManifestKey(cached), ManifestKey(dst)); err != nil {
+				os.Remove(ManifestKey(dst))
+			}
+			return nil
+		}
+	}
+
+	Infof("Downloading %s...", key)
+	if err := DownloadFile(ctx, store, key, dst); err != nil {
+		return err
+	}
+	// The manifest carries the wrapped data key of envelope-encrypted backups
+	if err := DownloadFile(ctx, store, ManifestKey(key), ManifestKey(dst)); err != nil {
+		os.Remove(ManifestKey(dst))
+	}
+	return nil
+}
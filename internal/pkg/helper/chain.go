@@ -0,0 +1,123 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+)
+
+// Chain kinds of an artifact. A full artifact restores on its own; the others
+// are applied on top of their parent, forming a chain that starts with a full
+// artifact.
+const (
+	ChainFull        = "full"
+	ChainIncremental = "incremental"
+	ChainBinlog      = "binlog"
+)
+
+// maxChainLength bounds chain walks, guarding against parent cycles.
+const maxChainLength = 10000
+
+// ChainLink is an artifact of a chain. Manifest is nil for artifacts stored
+// without a manifest, which are full artifacts.
+type ChainLink struct {
+	Key      string    `json:"key"`
+	Manifest *Manifest `json:"manifest"`
+}
+
+// Kind returns the chain kind of the artifact.
+func (l ChainLink) Kind() string {
+	if l.Manifest == nil || l.Manifest.Kind == "" {
+		return ChainFull
+	}
+	return l.Manifest.Kind
+}
+
+// LoadManifest downloads and parses the manifest of an artifact.
+func LoadManifest(ctx context.Context, store Storage, artifactKey string) (*Manifest, error) {
+	var buf bytes.Buffer
+	if err := store.Download(ctx, ManifestKey(artifactKey), &buf); err != nil {
+		return nil, err
+	}
+	return ParseManifest(buf.Bytes())
+}
+
+// ResolveChain returns the artifacts needed to restore key, from its full
+// artifact to key itself. It fails when an artifact of the chain is missing.
+func ResolveChain(ctx context.Context, store Storage, key string) ([]ChainLink, error) {
+	var chain []ChainLink
+	for len(chain) < maxChainLength {
+		exists, err := store.Exists(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("chain is broken: artifact %s is missing", key)
+		}
+		link := ChainLink{Key: key}
+		if manifest, err := LoadManifest(ctx, store, key); err == nil {
+			link.Manifest = manifest
+		}
+		chain = append([]ChainLink{link}, chain...)
+		if link.Kind() == ChainFull {
+			return chain, nil
+		}
+		if link.Manifest.Parent == "" {
+			return nil, fmt.Errorf("chain is broken: %s artifact %s has no parent", link.Kind(), key)
+		}
+		key = link.Manifest.Parent
+	}
+	return nil, fmt.Errorf("chain of %s is longer than %d artifacts", key, maxChainLength)
+}
+
+// ProtectChains wraps retention so that expired artifacts still needed by an
+// unexpired artifact of their chain are kept. It reads the manifest of every
+// unexpired artifact, so it is enabled with retention.protect_chains.
+func ProtectChains(ctx context.Context, store Storage, retention RetentionFunc) (RetentionFunc, error) {
+	objects, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	protected := make(map[string]bool)
+	for _, object := range objects {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !IsArtifactKey(object.Key) || isExpired(object, retention, now) {
+			continue
+		}
+		manifest, err := LoadManifest(ctx, store, object.Key)
+		if err != nil {
+			continue // No manifest: a full artifact
+		}
+		for parent, n := manifest.Parent, 0; parent != "" && !protected[parent] && n < maxChainLength; n++ {
+			protected[parent] = true
+			parentManifest, err := LoadManifest(ctx, store, parent)
+			if err != nil {
+				break
+			}
+			parent = parentManifest.Parent
+		}
+	}
+
+	kept := 0
+	for _, object := range objects {
+		if protected[object.Key] && isExpired(object, retention, now) {
+			kept++
+		}
+	}
+	if kept > 0 {
+		Infof("Retention: keeping %d expired backups still needed by unexpired chains", kept)
+	}
+
+	return func(key string) int {
+		if protected[key] {
+			return 0
+		}
+		return retention(key)
+	}, nil
+}
@@ -1,9 +1,18 @@
 package helper
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os/exec"
+	"runtime"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
 )
 
 // CheckTools verifies that the required command-line tools are available in the system PATH.
@@ -20,3 +29,155 @@ func CheckTools(tools ...string) error {
 	}
 	return nil
 }
+
+// maxCommandOutput bounds the output of a command kept in memory, e.g. the
+// output of a multi-GB loadDump; the command log keeps all of it.
+const maxCommandOutput = 16 << 20
+
+// commandErrorOutput is how much of the end of the output goes into errors.
+const commandErrorOutput = 4 << 10
+
+// Command is an external program run by Run. Arguments are passed as an
+// array, never through a shell, so they need no quoting.
+type Command struct {
+	Name     string
+	Args     []string
+	Dir      string
+	Env      []string              // Added to the scrubbed environment
+	Stdin    io.Reader             // Default: no input
+	Stdout   io.Writer             // Default: kept with stderr in the output returned
+	Timeout  time.Duration         // Default: bounded by the context only
+	Priority config.PriorityConfig // CPU/IO priority of the process
+}
+
+// Run runs a command and returns its combined stdout and stderr, of which
+// only the last 16MB are kept; with a command log the full output is also
+// streamed to the log file of the run. The command inherits the environment
+// minus the tool's own BACKUP_* variables, in the C locale so its messages
+// and number formats can be parsed. On failure the error ends with the last
+// lines of output. With Stdout set, stdout is streamed there instead and only
+// stderr is returned and logged, so binary or secret output stays out of the
+// command log.
+func Run(ctx context.Context, c Command) ([]byte, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	argv := priorityArgv(c.Priority, append([]string{c.Name}, c.Args...))
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = c.Dir
+	cmd.Env = append(config.CommandEnv(), c.Env...)
+	cmd.Stdin = c.Stdin
+	// Don't hang on children that keep the output open after a kill
+	cmd.WaitDelay = 10 * time.Second
+
+	output := &outputRing{max: maxCommandOutput}
+	var w io.Writer = output
+	section := startCommandLog(c.Name)
+	if section != nil {
+		w = io.MultiWriter(output, section)
+	}
+	cmd.Stdout = w
+	if c.Stdout != nil {
+		cmd.Stdout = c.Stdout
+	}
+	cmd.Stderr = w
+	Debugf("Running %s", c.Name)
+	start := time.Now()
+	err := cmd.Run()
+	Debugf("%s exited after %s", c.Name, time.Since(start).Round(time.Millisecond))
+	if err != nil && c.Timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", c.Timeout)
+	}
+	if section != nil {
+		section.finish(err)
+	}
+	if err != nil {
+		summary := output.summary()
+		if section != nil {
+			summary += fmt.Sprintf(" (full output in %s)", section.path)
+		}
+		return output.bytes(), fmt.Errorf("%w, output: %s", err, summary)
+	}
+	return output.bytes(), nil
+}
+
+// outputRing keeps the last max bytes of the output of a command.
+type outputRing struct {
+	buf     []byte
+	max     int
+	dropped int64
+}
+
+func (r *outputRing) Write(p []byte) (int, error) {
+	r.buf = append(r.buf, p...)
+	// Compact only once twice the cap is buffered, so writes stay cheap
+	if len(r.buf) > 2*r.max {
+		r.trim()
+	}
+	return len(p), nil
+}
+
+func (r *outputRing) trim() {
+	if excess := len(r.buf) - r.max; excess > 0 {
+		r.dropped += int64(excess)
+		r.buf = append(r.buf[:0], r.buf[excess:]...)
+	}
+}
+
+// bytes returns the kept output.
+func (r *outputRing) bytes() []byte {
+	r.trim()
+	return r.buf
+}
+
+// summary returns the end of the output for an error message.
+func (r *outputRing) summary() string {
+	out := bytes.TrimRight(r.bytes(), "\r\n")
+	if r.dropped == 0 && len(out) <= commandErrorOutput {
+		return string(out)
+	}
+	omitted := r.dropped + int64(len(out)-min(len(out), commandErrorOutput))
+	return fmt.Sprintf("...(%d bytes omitted)...%s", omitted, out[len(out)-min(len(out), commandErrorOutput):])
+}
+
+// priorityArgv wraps argv to run at the configured CPU (nice) and IO (ionice)
+// priority, optionally pinned to a subset of CPUs (taskset). Wrappers whose
+// tools are unavailable, such as ionice outside Linux, are skipped.
+func priorityArgv(p config.PriorityConfig, argv []string) []string {
+	if p.CPUs > 0 && p.CPUs < runtime.NumCPU() {
+		if _, err := exec.LookPath("taskset"); err == nil {
+			argv = append([]string{"taskset", "-c", fmt.Sprintf("0-%d", p.CPUs-1)}, argv...)
+		}
+	}
+
+	if p.IOClass != "" {
+		if _, err := exec.LookPath("ionice"); err == nil {
+			wrap := []string{"ionice", "-c", ioniceClass(p.IOClass)}
+			if p.IOLevel > 0 && p.IOClass != "idle" {
+				wrap = append(wrap, "-n", strconv.Itoa(p.IOLevel))
+			}
+			argv = append(wrap, argv...)
+		}
+	}
+	if p.Nice != 0 {
+		if _, err := exec.LookPath("nice"); err == nil {
+			argv = append([]string{"nice", "-n", strconv.Itoa(p.Nice)}, argv...)
+		}
+	}
+	return argv
+}
+
+// ioniceClass maps a scheduling class name to its ionice number.
+func ioniceClass(class string) string {
+	switch class {
+	case "realtime":
+		return "1"
+	case "best-effort":
+		return "2"
+	default:
+		return "3" // idle
+	}
+}
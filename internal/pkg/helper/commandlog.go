@@ -0,0 +1,85 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// commandLog keeps the full output of the commands run by Run in one file
+// per run, as Run only keeps the end of it in memory.
+var commandLog struct {
+	mu   sync.Mutex
+	dir  string
+	file *os.File
+	seq  int
+}
+
+// SetCommandLogDir enables the command log. The first command of the run
+// creates commands_<timestamp>_<pid>.log in dir; the file is only readable
+// by its owner, as the output of commands may hold sensitive data.
+func SetCommandLogDir(dir string) {
+	commandLog.mu.Lock()
+	defer commandLog.mu.Unlock()
+	commandLog.dir = dir
+}
+
+// commandLogSection is the output of one command in the command log. The
+// output of commands running at the same time may interleave, so the header
+// and footer of a section carry the command's sequence number.
+type commandLogSection struct {
+	seq  int
+	name string
+	path string
+}
+
+// startCommandLog writes the header of a command's section, or returns nil
+// when the command log is disabled or cannot be written.
+func startCommandLog(name string) *commandLogSection {
+	commandLog.mu.Lock()
+	defer commandLog.mu.Unlock()
+	if commandLog.dir == "" {
+		return nil
+	}
+	if commandLog.file == nil {
+		if err := os.MkdirAll(commandLog.dir, 0700); err != nil {
+			Warnf("command log disabled: %v", err)
+			commandLog.dir = ""
+			return nil
+		}
+		filename := fmt.Sprintf("commands_%s_%d.log", time.Now().Format(TimestampLayout), os.Getpid())
+		file, err := os.OpenFile(filepath.Join(commandLog.dir, filename), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			Warnf("command log disabled: %v", err)
+			commandLog.dir = ""
+			return nil
+		}
+		commandLog.file = file
+	}
+	commandLog.seq++
+	section := &commandLogSection{seq: commandLog.seq, name: name, path: commandLog.file.Name()}
+	fmt.Fprintf(commandLog.file, "=== #%d %s started %s\n", section.seq, name, time.Now().Format(time.RFC3339))
+	return section
+}
+
+// Write appends output to the command log. Write errors are ignored, so a
+// full disk never fails the command itself.
+func (s *commandLogSection) Write(p []byte) (int, error) {
+	commandLog.mu.Lock()
+	defer commandLog.mu.Unlock()
+	commandLog.file.Write(p)
+	return len(p), nil
+}
+
+// finish writes the footer of the section with the outcome of the command.
+func (s *commandLogSection) finish(err error) {
+	commandLog.mu.Lock()
+	defer commandLog.mu.Unlock()
+	status := "ok"
+	if err != nil {
+		status = err.Error()
+	}
+	fmt.Fprintf(commandLog.file, "\n=== #%d %s finished %s: %s\n", s.seq, s.name, time.Now().Format(time.RFC3339), status)
+}
@@ -0,0 +1,129 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// FaultConfig describes faults injected on purpose by the hidden
+// --fault-inject flag (Options.Faults), so failure handling (retries,
+// spooling, verification, reporting) can be exercised. Never enable it in
+// production.
+type FaultConfig struct {
+	UploadEvery   int           // Fail every Nth upload
+	Corrupt       bool          // Flip a byte of every artifact after zipping, before it is hashed
+	KillDumpAfter time.Duration // Kill database dumps after this long
+}
+
+// ParseFaults parses a comma-separated fault spec such as
+// "upload-every=3,corrupt,kill-dump=30s".
+func ParseFaults(spec string) (FaultConfig, error) {
+	var f FaultConfig
+	for _, item := range strings.Split(spec, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(item), "=")
+		var err error
+		switch name {
+		case "":
+		case "upload-every":
+			f.UploadEvery, err = strconv.Atoi(value)
+			if err == nil && f.UploadEvery <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "corrupt":
+			f.Corrupt = true
+		case "kill-dump":
+			f.KillDumpAfter, err = time.ParseDuration(value)
+		default:
+			return f, fmt.Errorf("unknown fault %q", name)
+		}
+		if err != nil {
+			return f, fmt.Errorf("invalid fault %q: %w", item, err)
+		}
+	}
+	return f, nil
+}
+
+// DumpContext returns the context for a database dump, cancelled after the
+// injected kill-dump delay when one is set.
+func DumpContext(ctx context.Context, f FaultConfig) (context.Context, context.CancelFunc) {
+	if f.KillDumpAfter > 0 {
+		return context.WithTimeout(ctx, f.KillDumpAfter)
+	}
+	return context.WithCancel(ctx)
+}
+
+// corruptArtifact flips a byte in the middle of the file when corruption is injected.
+func corruptArtifact(path string, f FaultConfig) error {
+	if !f.Corrupt {
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+
+	b := make([]byte, 1)
+	offset := info.Size() / 2
+	if _, err := file.ReadAt(b, offset); err != nil {
+		return err
+	}
+	b[0] ^= 0xff
+	if _, err := file.WriteAt(b, offset); err != nil {
+		return err
+	}
+	Infof("Fault injection: corrupted byte %d of %s", offset, path)
+	return nil
+}
+
+// WithFaults wraps a storage so that every Nth upload fails.
+func WithFaults(store Storage, f FaultConfig) Storage {
+	if f.UploadEvery <= 0 {
+		return store
+	}
+	return &faultStorage{Storage: store, every: int64(f.UploadEvery)}
+}
+
+// faultStorage fails every Nth upload.
+type faultStorage struct {
+	Storage
+	every int64
+	count atomic.Int64
+}
+
+func (s *faultStorage) fail(key string, content io.Reader) error {
+	if n := s.count.Add(1); n%s.every == 0 {
+		io.Copy(io.Discard, content) // Behave like a connection dropped at the end
+		return fmt.Errorf("failed to upload object %s: injected fault (upload %d)", key, n)
+	}
+	return nil
+}
+
+func (s *faultStorage) Upload(ctx context.Context, key string, content io.Reader) error {
+	if err := s.fail(key, content); err != nil {
+		return err
+	}
+	return s.Storage.Upload(ctx, key, content)
+}
+
+func (s *faultStorage) Replace(ctx context.Context, key string, content io.Reader) error {
+	if err := s.fail(key, content); err != nil {
+		return err
+	}
+	return s.Storage.Replace(ctx, key, content)
+}
+
+// SelfTest uses the wrapped uploads so the canary can be failed as well.
+func (s *faultStorage) SelfTest(ctx context.Context) error {
+	return canaryTest(ctx, s, s.Delete)
+}
@@ -3,6 +3,7 @@ package helper
 import (
 	"io"
 	"os"
+	"path/filepath"
 )
 
 // CopyFile copies a file from src to dst.
@@ -26,3 +27,53 @@ func CopyFile(src, dst string) error {
 
 	return destFile.Sync()
 }
+
+// CopyDir recursively copies the directory tree src to dst.
+func CopyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return CopyFile(path, target)
+	})
+}
+
+// CopyTree copies the directory tree src to dst like CopyDir, skipping paths
+// matching the exclude patterns (relative to src) and anything but regular
+// files and directories.
+func CopyTree(src, dst string, exclude []string) error {
+	return filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		for _, pattern := range exclude {
+			if ok, _ := filepath.Match(pattern, filepath.ToSlash(rel)); ok {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return CopyFile(path, target)
+	})
+}
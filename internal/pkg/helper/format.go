@@ -1,6 +1,10 @@
 package helper
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/bytedance/sonic"
+)
 
 // HumanizeSize formats byte size to human-readable string.
 func HumanizeSize(bytes int64) string {
@@ -15,3 +19,14 @@ func HumanizeSize(bytes int64) string {
 	}
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
+
+// PrintJSON prints the result of a command as a single line of JSON on
+// stdout, for --output json. Logs stay on stderr.
+func PrintJSON(v interface{}) error {
+	data, err := sonic.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
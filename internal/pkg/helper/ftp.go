@@ -0,0 +1,609 @@
+package helper
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// ftpTimeout bounds connecting and every command on the control connection.
+const ftpTimeout = 60 * time.Second
+
+// ftpNotFound is the reply code of commands on missing files.
+const ftpNotFound = 550
+
+var (
+	epsvPattern = regexp.MustCompile(`\(\|\|\|(\d+)\|\)`)
+	pasvPattern = regexp.MustCompile(`(\d+),(\d+),(\d+),(\d+),(\d+),(\d+)`)
+)
+
+// FTPStorage stores artifacts on an FTP server below a base path, with
+// explicit (AUTH TLS) or implicit TLS protecting both the control and data
+// connections when configured. Data connections are always passive. Uploads
+// go to a partial file that is renamed into place; as FTP renames overwrite,
+// the target is checked just before.
+type FTPStorage struct {
+	addr     string
+	user     string
+	password string
+	mode     string      // "", "explicit" or "implicit"
+	tls      *tls.Config // Nil for plain FTP
+	basePath string
+	layout   string
+
+	mu   sync.Mutex // Serializes the commands of the control connection
+	conn *ftpConn   // Nil until connected, or after a failure
+}
+
+// ftpConn is a logged-in control connection.
+type ftpConn struct {
+	raw  net.Conn
+	text *textproto.Conn
+	tls  *tls.Config // Protects data connections when set
+}
+
+// NewFTPStorage connects to the configured FTP server.
+func NewFTPStorage(cfg config.FTPConfig) (*FTPStorage, error) {
+	s := &FTPStorage{
+		addr:     net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		user:     cfg.User,
+		password: cfg.Password,
+		mode:     cfg.TLS,
+		basePath: cfg.BasePath,
+		layout:   cfg.Layout,
+	}
+	if cfg.TLS != "" {
+		if cfg.InsecureSkipVerify {
+			Warnf("ftp certificate verification disabled")
+		}
+		s.tls = &tls.Config{
+			ServerName:         cfg.Host,
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+			// Servers commonly require data connections to resume the control session
+			ClientSessionCache: tls.NewLRUClientSessionCache(4),
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	// Paths are made absolute, as creating directories changes the working directory
+	if !path.IsAbs(s.basePath) {
+		_, msg, err := c.cmd(2, "PWD")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get login directory on %s: %w", s.addr, err)
+		}
+		s.basePath = path.Join(parsePWD(msg), s.basePath)
+	}
+	return s, nil
+}
+
+// parsePWD returns the directory of a PWD reply, quoted with doubled quotes
+// (257 "/home/user" is the current directory).
+func parsePWD(msg string) string {
+	start, end := strings.Index(msg, `"`), strings.LastIndex(msg, `"`)
+	if start < 0 || end <= start {
+		return "/"
+	}
+	return strings.ReplaceAll(msg[start+1:end], `""`, `"`)
+}
+
+// connect returns the control connection, logging in again when the server
+// dropped it, e.g. after idling through a long dump.
+func (s *FTPStorage) connect(ctx context.Context) (*ftpConn, error) {
+	if s.conn != nil {
+		if _, _, err := s.conn.cmd(2, "NOOP"); err == nil {
+			return s.conn, nil
+		}
+		s.conn.close()
+		s.conn = nil
+	}
+
+	dialer := &net.Dialer{Timeout: ftpTimeout}
+	var raw net.Conn
+	var err error
+	if s.mode == "implicit" {
+		raw, err = (&tls.Dialer{NetDialer: dialer, Config: s.tls}).DialContext(ctx, "tcp", s.addr)
+	} else {
+		raw, err = dialer.DialContext(ctx, "tcp", s.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", s.addr, err)
+	}
+	c := &ftpConn{raw: raw, text: textproto.NewConn(raw)}
+	if err := s.login(c); err != nil {
+		c.close()
+		return nil, fmt.Errorf("failed to log in to %s: %w", s.addr, err)
+	}
+	s.conn = c
+	return c, nil
+}
+
+// login greets the server, negotiates TLS and logs in.
+func (s *FTPStorage) login(c *ftpConn) error {
+	c.raw.SetDeadline(time.Now().Add(ftpTimeout))
+	if _, _, err := c.text.ReadResponse(2); err != nil {
+		return err
+	}
+	if s.mode == "explicit" {
+		if _, _, err := c.cmd(2, "AUTH TLS"); err != nil {
+			return err
+		}
+		c.raw = tls.Client(c.raw, s.tls)
+		c.text = textproto.NewConn(c.raw)
+	}
+	code, _, err := c.cmd(2, "USER %s", s.user)
+	if code == 331 {
+		_, _, err = c.cmd(2, "PASS %s", s.password)
+	}
+	if err != nil {
+		return err
+	}
+	if s.tls != nil {
+		if _, _, err := c.cmd(2, "PBSZ 0"); err != nil {
+			return err
+		}
+		if _, _, err := c.cmd(2, "PROT P"); err != nil {
+			return err
+		}
+		c.tls = s.tls
+	}
+	_, _, err = c.cmd(2, "TYPE I")
+	return err
+}
+
+// cmd sends a command and reads its reply, which must start with the digit
+// expect. The reply code is returned on mismatch too.
+func (c *ftpConn) cmd(expect int, format string, args ...interface{}) (int, string, error) {
+	c.raw.SetDeadline(time.Now().Add(ftpTimeout))
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return 0, "", err
+	}
+	return c.text.ReadResponse(expect)
+}
+
+func (c *ftpConn) close() {
+	c.text.Close()
+}
+
+// ftpCode returns the reply code of a failed command, or 0.
+func ftpCode(err error) int {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code
+	}
+	return 0
+}
+
+// session locks the control connection for an operation. Cancelling ctx
+// interrupts the connection, which is then dropped.
+func (s *FTPStorage) session(ctx context.Context) (*ftpConn, func(), error) {
+	s.mu.Lock()
+	c, err := s.connect(ctx)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { c.raw.SetDeadline(time.Now()) })
+	release := func() {
+		if !stop() || ctx.Err() != nil {
+			c.close()
+			s.conn = nil
+		}
+		s.mu.Unlock()
+	}
+	return c, release, nil
+}
+
+// transfer opens a passive data connection and sends a transfer command on
+// it, returning the connection once the server accepted the command. The
+// caller closes it and reads the final reply with finish.
+func (c *ftpConn) transfer(ctx context.Context, format string, args ...interface{}) (net.Conn, error) {
+	host, _, _ := net.SplitHostPort(c.raw.RemoteAddr().String())
+	var port string
+	_, msg, err := c.cmd(2, "EPSV")
+	if m := epsvPattern.FindStringSubmatch(msg); err == nil && m != nil {
+		port = m[1]
+	} else {
+		// Only the port of the PASV reply is used: servers behind NAT
+		// commonly advertise their private address
+		if _, msg, err = c.cmd(2, "PASV"); err != nil {
+			return nil, err
+		}
+		m := pasvPattern.FindStringSubmatch(msg)
+		if m == nil {
+			return nil, fmt.Errorf("invalid PASV reply %q", msg)
+		}
+		hi, _ := strconv.Atoi(m[5])
+		lo, _ := strconv.Atoi(m[6])
+		port = strconv.Itoa(hi<<8 | lo)
+	}
+
+	data, err := (&net.Dialer{Timeout: ftpTimeout}).DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open data connection: %w", err)
+	}
+	if _, _, err := c.cmd(1, format, args...); err != nil {
+		data.Close()
+		return nil, err
+	}
+	if c.tls != nil {
+		tlsData := tls.Client(data, c.tls)
+		if err := tlsData.HandshakeContext(ctx); err != nil {
+			data.Close()
+			return nil, fmt.Errorf("data connection TLS handshake failed: %w", err)
+		}
+		data = tlsData
+	}
+	stop := context.AfterFunc(ctx, func() { data.Close() })
+	return &ftpData{Conn: data, stop: stop}, nil
+}
+
+// ftpData is a data connection closed on cancellation.
+type ftpData struct {
+	net.Conn
+	stop func() bool
+}
+
+func (d *ftpData) Close() error {
+	d.stop()
+	return d.Conn.Close()
+}
+
+// finish reads the final reply of a transfer after its data connection was
+// closed. Transfers may take longer than a command, so the deadline is
+// renewed first.
+func (c *ftpConn) finish() error {
+	c.raw.SetDeadline(time.Now().Add(ftpTimeout))
+	_, _, err := c.text.ReadResponse(2)
+	return err
+}
+
+// remotePath maps a key to its path on the server.
+func (s *FTPStorage) remotePath(key string) string {
+	return path.Join(s.basePath, key)
+}
+
+// key maps a path on the server back to its key.
+func (s *FTPStorage) key(remotePath string) string {
+	return strings.TrimPrefix(remotePath, strings.TrimSuffix(s.basePath, "/")+"/")
+}
+
+func (s *FTPStorage) ObjectKey(source string, ts time.Time, filename string) string {
+	return objectKey("", s.layout, source, ts, filename)
+}
+
+// Upload writes a partial file and renames it into place, unless the target
+// exists.
+func (s *FTPStorage) Upload(ctx context.Context, key string, content io.Reader) error {
+	c, release, err := s.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	exists, err := s.exists(c, key)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%w: %s", ErrObjectExists, key)
+	}
+	partial, err := s.write(ctx, c, key, content)
+	if err != nil {
+		return err
+	}
+	// A rename would silently replace an object uploaded in the meantime
+	if exists, err := s.exists(c, key); err != nil || exists {
+		c.cmd(2, "DELE %s", partial)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s", ErrObjectExists, key)
+	}
+	if err := ftpRename(c, partial, s.remotePath(key)); err != nil {
+		c.cmd(2, "DELE %s", partial)
+		return fmt.Errorf("failed to upload object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *FTPStorage) Replace(ctx context.Context, key string, content io.Reader) error {
+	c, release, err := s.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	partial, err := s.write(ctx, c, key, content)
+	if err != nil {
+		return err
+	}
+	target := s.remotePath(key)
+	err = ftpRename(c, partial, target)
+	if err != nil && ftpCode(err) >= 500 {
+		// Servers refusing to rename over a file need it deleted first
+		c.cmd(2, "DELE %s", target)
+		err = ftpRename(c, partial, target)
+	}
+	if err != nil {
+		c.cmd(2, "DELE %s", partial)
+		return fmt.Errorf("failed to upload object %s: %w", key, err)
+	}
+	return nil
+}
+
+// ftpRename renames a file on the server.
+func ftpRename(c *ftpConn, from, to string) error {
+	if _, _, err := c.cmd(3, "RNFR %s", from); err != nil {
+		return err
+	}
+	_, _, err := c.cmd(2, "RNTO %s", to)
+	return err
+}
+
+// write uploads content to the partial file of key and returns its path.
+func (s *FTPStorage) write(ctx context.Context, c *ftpConn, key string, content io.Reader) (string, error) {
+	target := s.remotePath(key)
+	if err := ftpMkdirAll(c, path.Dir(target)); err != nil {
+		return "", fmt.Errorf("failed to create directory for %s: %w", key, err)
+	}
+
+	partial := target + partialSuffix
+	data, err := c.transfer(ctx, "STOR %s", partial)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload object %s: %w", key, err)
+	}
+	size, err := io.Copy(data, content)
+	if closeErr := data.Close(); err == nil {
+		err = closeErr
+	}
+	if finishErr := c.finish(); err == nil {
+		err = finishErr
+	}
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			c.cmd(2, "DELE %s", partial)
+		}
+		return "", fmt.Errorf("failed to upload object %s: %w", key, err)
+	}
+
+	Infof("Uploaded %s to %s (Size: %d)", key, s.addr, size)
+	return partial, nil
+}
+
+// ftpMkdirAll creates a directory and its parents. MKD fails on existing
+// directories, so errors only count when the directory can't be entered.
+func ftpMkdirAll(c *ftpConn, dir string) error {
+	if dir == "." || dir == "/" {
+		return nil
+	}
+	if _, _, err := c.cmd(2, "CWD %s", dir); err == nil {
+		return nil
+	}
+	if err := ftpMkdirAll(c, path.Dir(dir)); err != nil {
+		return err
+	}
+	if _, _, err := c.cmd(2, "MKD %s", dir); err != nil {
+		if _, _, cwdErr := c.cmd(2, "CWD %s", dir); cwdErr != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FTPStorage) Exists(ctx context.Context, key string) (bool, error) {
+	c, release, err := s.session(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	return s.exists(c, key)
+}
+
+// exists checks a file with SIZE, which answers 550 for missing files.
+func (s *FTPStorage) exists(c *ftpConn, key string) (bool, error) {
+	_, _, err := c.cmd(2, "SIZE %s", s.remotePath(key))
+	if err == nil {
+		return true, nil
+	}
+	if ftpCode(err) == ftpNotFound {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to stat object %s: %w", key, err)
+}
+
+func (s *FTPStorage) Download(ctx context.Context, key string, w io.Writer) error {
+	c, release, err := s.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	data, err := c.transfer(ctx, "RETR %s", s.remotePath(key))
+	if err != nil {
+		return fmt.Errorf("failed to get object %s: %w", key, err)
+	}
+	_, err = io.Copy(w, data)
+	data.Close()
+	if finishErr := c.finish(); err == nil {
+		err = finishErr
+	}
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download object %s: %w", key, err)
+	}
+	return nil
+}
+
+// List walks the base path with MLSD, or with NLST, SIZE and MDTM on
+// servers without MLSD. Partial uploads are left out.
+func (s *FTPStorage) List(ctx context.Context) ([]ObjectInfo, error) {
+	c, release, err := s.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	root := s.remotePath("")
+	if _, _, err := c.cmd(2, "CWD %s", root); ftpCode(err) == ftpNotFound {
+		return nil, nil // Nothing uploaded yet
+	}
+	var objects []ObjectInfo
+	if err := s.list(ctx, c, root, &objects); err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	return objects, nil
+}
+
+func (s *FTPStorage) list(ctx context.Context, c *ftpConn, dir string, objects *[]ObjectInfo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	entries, err := readListing(ctx, c, "MLSD %s", dir)
+	if code := ftpCode(err); code >= 500 && code != ftpNotFound {
+		return s.listNames(ctx, c, dir, objects)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		facts, name, ok := strings.Cut(entry, " ")
+		if !ok {
+			continue
+		}
+		var kind string
+		var size int64
+		var modified time.Time
+		for _, fact := range strings.Split(facts, ";") {
+			k, v, _ := strings.Cut(fact, "=")
+			switch strings.ToLower(k) {
+			case "type":
+				kind = strings.ToLower(v)
+			case "size":
+				size, _ = strconv.ParseInt(v, 10, 64)
+			case "modify":
+				modified, _ = parseFTPTime(v)
+			}
+		}
+		remote := path.Join(dir, name)
+		switch {
+		case kind == "dir":
+			if err := s.list(ctx, c, remote, objects); err != nil {
+				return err
+			}
+		case kind == "file" && !strings.HasSuffix(name, partialSuffix):
+			*objects = append(*objects, ObjectInfo{Key: s.key(remote), Size: size, LastModified: modified})
+		}
+	}
+	return nil
+}
+
+// listNames lists a directory with NLST, telling files from directories by
+// SIZE, which fails on directories.
+func (s *FTPStorage) listNames(ctx context.Context, c *ftpConn, dir string, objects *[]ObjectInfo) error {
+	names, err := readListing(ctx, c, "NLST %s", dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		remote := path.Join(dir, path.Base(name))
+		if base := path.Base(name); base == "." || base == ".." {
+			continue
+		}
+		_, msg, err := c.cmd(2, "SIZE %s", remote)
+		if err != nil {
+			if err := s.listNames(ctx, c, remote, objects); err != nil {
+				return err
+			}
+			continue
+		}
+		if strings.HasSuffix(remote, partialSuffix) {
+			continue
+		}
+		size, _ := strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+		var modified time.Time
+		if _, msg, err := c.cmd(2, "MDTM %s", remote); err == nil {
+			modified, _ = parseFTPTime(strings.TrimSpace(msg))
+		}
+		*objects = append(*objects, ObjectInfo{Key: s.key(remote), Size: size, LastModified: modified})
+	}
+	return nil
+}
+
+// readListing reads the lines of a listing command.
+func readListing(ctx context.Context, c *ftpConn, format string, args ...interface{}) ([]string, error) {
+	data, err := c.transfer(ctx, format, args...)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := io.ReadAll(data)
+	data.Close()
+	if finishErr := c.finish(); err == nil {
+		err = finishErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []string
+	for _, line := range strings.Split(string(lines), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			entries = append(entries, line)
+		}
+	}
+	return entries, nil
+}
+
+// parseFTPTime parses the UTC timestamps of MLSD and MDTM, which may carry
+// fractional seconds.
+func parseFTPTime(v string) (time.Time, error) {
+	v, _, _ = strings.Cut(v, ".")
+	return time.ParseInLocation("20060102150405", v, time.UTC)
+}
+
+func (s *FTPStorage) Delete(ctx context.Context, key string) error {
+	c, release, err := s.session(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if _, _, err := c.cmd(2, "DELE %s", s.remotePath(key)); err != nil {
+		return fmt.Errorf("failed to delete object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *FTPStorage) EnforceRetention(ctx context.Context, retention RetentionFunc, limits RetentionLimits) (RetentionStats, error) {
+	return enforceRetention(ctx, s, retention, limits)
+}
+
+func (s *FTPStorage) SelfTest(ctx context.Context) error {
+	return canaryTest(ctx, s, s.Delete)
+}
+
+func (s *FTPStorage) PresignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return "", ErrNotSupported
+}
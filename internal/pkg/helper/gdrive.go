@@ -0,0 +1,512 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+const (
+	gdriveFilesURL  = "https://www.googleapis.com/drive/v3/files"
+	gdriveUploadURL = "https://www.googleapis.com/upload/drive/v3/files"
+	gdriveTokenURL  = "https://oauth2.googleapis.com/token"
+	gdriveScope     = "https://www.googleapis.com/auth/drive"
+)
+
+// gdriveResumeIncomplete is the status of a resumable upload chunk accepted
+// before the last one.
+const gdriveResumeIncomplete = 308
+
+// GDriveStorage stores artifacts in a Google Drive folder, authenticating
+// with a service account key or an OAuth refresh token. Drive has no paths:
+// every object is a file of the folder named by its full key. Uploads use
+// resumable sessions, so a file only appears once it is complete.
+type GDriveStorage struct {
+	client     *http.Client
+	folderID   string
+	pathPrefix string
+	layout     string
+	chunkSize  int
+
+	// Service account
+	email   string
+	subject string
+	key     *rsa.PrivateKey
+	// OAuth client
+	clientID     string
+	clientSecret string
+	refreshToken string
+
+	mu          sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+// NewGDriveStorage creates a storage for the configured Google Drive folder.
+func NewGDriveStorage(cfg config.GDriveConfig) (*GDriveStorage, error) {
+	s := &GDriveStorage{
+		client:       &http.Client{},
+		folderID:     cfg.FolderID,
+		pathPrefix:   cfg.PathPrefix,
+		layout:       cfg.Layout,
+		chunkSize:    cfg.ChunkSizeMB << 20,
+		subject:      cfg.Subject,
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		refreshToken: cfg.RefreshToken,
+	}
+	if cfg.CredentialsFile != "" {
+		if err := s.loadServiceAccount(cfg.CredentialsFile); err != nil {
+			return nil, fmt.Errorf("invalid gdrive.credentials_file: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// loadServiceAccount reads the email and private key of a service account
+// JSON key.
+func (s *GDriveStorage) loadServiceAccount(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var account struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+	}
+	if err := sonic.Unmarshal(data, &account); err != nil {
+		return err
+	}
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if account.ClientEmail == "" || block == nil {
+		return fmt.Errorf("not a service account key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return fmt.Errorf("private key is not an RSA key")
+	}
+	s.email, s.key = account.ClientEmail, rsaKey
+	return nil
+}
+
+// token returns a valid access token, requesting a new one shortly before
+// the current one expires.
+func (s *GDriveStorage) token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.accessToken != "" && time.Now().Before(s.expiry) {
+		return s.accessToken, nil
+	}
+
+	form := url.Values{}
+	if s.key != nil {
+		assertion, err := s.assertion()
+		if err != nil {
+			return "", err
+		}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+	} else {
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", s.clientID)
+		form.Set("client_secret", s.clientSecret)
+		form.Set("refresh_token", s.refreshToken)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, gdriveTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get google access token: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get google access token: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := sonic.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("invalid google token response: %w", err)
+	}
+	s.accessToken = token.AccessToken
+	s.expiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return s.accessToken, nil
+}
+
+// assertion returns the signed JWT a service account exchanges for an
+// access token.
+func (s *GDriveStorage) assertion() (string, error) {
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":   s.email,
+		"scope": gdriveScope,
+		"aud":   gdriveTokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	if s.subject != "" {
+		claims["sub"] = s.subject
+	}
+	payload, err := sonic.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encode := base64.RawURLEncoding.EncodeToString
+	unsigned := encode([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + encode(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + encode(signature), nil
+}
+
+// gdriveStatusError is a request answered with an unexpected status.
+type gdriveStatusError struct {
+	code    int
+	status  string
+	message string
+}
+
+func (e *gdriveStatusError) Error() string {
+	if e.message != "" {
+		return e.status + ": " + e.message
+	}
+	return e.status
+}
+
+// gdriveStatus returns the status code of a failed request, or 0.
+func gdriveStatus(err error) int {
+	var statusErr *gdriveStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code
+	}
+	return 0
+}
+
+// do sends an authorized request. Statuses other than 2xx and the 308 of
+// resumable uploads are returned as errors. A negative size streams the body
+// with unknown length.
+func (s *GDriveStorage) do(ctx context.Context, method, target string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	token, err := s.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if (resp.StatusCode < 200 || resp.StatusCode > 299) && resp.StatusCode != gdriveResumeIncomplete {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		sonic.Unmarshal(data, &apiErr)
+		return nil, &gdriveStatusError{code: resp.StatusCode, status: method + " " + resp.Status, message: apiErr.Error.Message}
+	}
+	return resp, nil
+}
+
+// call sends a request and decodes its JSON response into out, when set.
+func (s *GDriveStorage) call(ctx context.Context, method, target string, out interface{}) error {
+	resp, err := s.do(ctx, method, target, nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil || out == nil {
+		return err
+	}
+	return sonic.Unmarshal(data, out)
+}
+
+// gdriveFile is the part of a Drive file resource the storage reads.
+type gdriveFile struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Size         string    `json:"size"`
+	ModifiedTime time.Time `json:"modifiedTime"`
+}
+
+// files lists the files of the folder matching a Drive query, oldest first.
+func (s *GDriveStorage) files(ctx context.Context, query string) ([]gdriveFile, error) {
+	q := fmt.Sprintf("'%s' in parents and trashed = false", gdriveQuote(s.folderID))
+	if query != "" {
+		q += " and " + query
+	}
+	params := url.Values{
+		"q":                         {q},
+		"fields":                    {"nextPageToken,files(id,name,size,modifiedTime)"},
+		"pageSize":                  {"1000"},
+		"orderBy":                   {"createdTime"},
+		"supportsAllDrives":         {"true"},
+		"includeItemsFromAllDrives": {"true"},
+	}
+	var files []gdriveFile
+	for {
+		var page struct {
+			NextPageToken string       `json:"nextPageToken"`
+			Files         []gdriveFile `json:"files"`
+		}
+		if err := s.call(ctx, http.MethodGet, gdriveFilesURL+"?"+params.Encode(), &page); err != nil {
+			return nil, err
+		}
+		files = append(files, page.Files...)
+		if page.NextPageToken == "" {
+			return files, nil
+		}
+		params.Set("pageToken", page.NextPageToken)
+	}
+}
+
+// gdriveQuote escapes a string for a Drive query literal.
+func gdriveQuote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
+
+// find returns the IDs of the files named key, oldest first. Drive allows
+// several files of the same name.
+func (s *GDriveStorage) find(ctx context.Context, key string) ([]string, error) {
+	files, err := s.files(ctx, fmt.Sprintf("name = '%s'", gdriveQuote(key)))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(files))
+	for i, f := range files {
+		ids[i] = f.ID
+	}
+	return ids, nil
+}
+
+func (s *GDriveStorage) ObjectKey(source string, ts time.Time, filename string) string {
+	return objectKey(s.pathPrefix, s.layout, source, ts, filename)
+}
+
+// Upload creates a file named key without overwriting. As Drive does not
+// refuse duplicate names, a file of the same name created concurrently is
+// detected afterwards and the upload removed again.
+func (s *GDriveStorage) Upload(ctx context.Context, key string, content io.Reader) error {
+	exists, err := s.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%w: %s", ErrObjectExists, key)
+	}
+
+	metadata := map[string]interface{}{"name": key, "parents": []string{s.folderID}}
+	id, err := s.upload(ctx, http.MethodPost, gdriveUploadURL, metadata, key, content)
+	if err != nil {
+		return err
+	}
+	ids, err := s.find(ctx, key)
+	if err == nil && len(ids) > 1 && ids[0] != id {
+		s.delete(ctx, id)
+		return fmt.Errorf("%w: %s", ErrObjectExists, key)
+	}
+	return nil
+}
+
+func (s *GDriveStorage) Replace(ctx context.Context, key string, content io.Reader) error {
+	ids, err := s.find(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to stat object %s: %w", key, err)
+	}
+	if len(ids) == 0 {
+		metadata := map[string]interface{}{"name": key, "parents": []string{s.folderID}}
+		_, err = s.upload(ctx, http.MethodPost, gdriveUploadURL, metadata, key, content)
+	} else {
+		_, err = s.upload(ctx, http.MethodPatch, gdriveUploadURL+"/"+url.PathEscape(ids[0]), map[string]interface{}{}, key, content)
+	}
+	return err
+}
+
+// upload sends content through a resumable upload session, in chunks of
+// unknown total length until the last one, and returns the file ID.
+func (s *GDriveStorage) upload(ctx context.Context, method, target string, metadata map[string]interface{}, key string, content io.Reader) (string, error) {
+	body, err := sonic.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+	header := http.Header{
+		"Content-Type":          {"application/json; charset=UTF-8"},
+		"X-Upload-Content-Type": {"application/octet-stream"},
+	}
+	resp, err := s.do(ctx, method, target+"?uploadType=resumable&supportsAllDrives=true", bytes.NewReader(body), int64(len(body)), header)
+	if err != nil {
+		return "", fmt.Errorf("failed to start upload of %s: %w", key, err)
+	}
+	resp.Body.Close()
+	session := resp.Header.Get("Location")
+	if session == "" {
+		return "", fmt.Errorf("failed to start upload of %s: no upload session", key)
+	}
+
+	buf := make([]byte, s.chunkSize)
+	var offset int64
+	for {
+		n, err := io.ReadFull(content, buf)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return "", fmt.Errorf("failed to upload object %s: %w", key, err)
+		}
+		total := "*"
+		if last {
+			total = strconv.FormatInt(offset+int64(n), 10)
+		}
+		contentRange := fmt.Sprintf("bytes */%s", total)
+		if n > 0 {
+			contentRange = fmt.Sprintf("bytes %d-%d/%s", offset, offset+int64(n)-1, total)
+		}
+		resp, err := s.do(ctx, http.MethodPut, session, bytes.NewReader(buf[:n]), int64(n), http.Header{"Content-Range": {contentRange}})
+		if err != nil {
+			return "", fmt.Errorf("failed to upload object %s: %w", key, err)
+		}
+		offset += int64(n)
+		if !last {
+			resp.Body.Close()
+			// Chunks are sent whole; a session that kept less lost data
+			if resp.StatusCode != gdriveResumeIncomplete || resp.Header.Get("Range") != fmt.Sprintf("bytes=0-%d", offset-1) {
+				return "", fmt.Errorf("failed to upload object %s: chunk not stored (%s)", key, resp.Status)
+			}
+			continue
+		}
+
+		var file gdriveFile
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err == nil {
+			err = sonic.Unmarshal(data, &file)
+		}
+		if err != nil || resp.StatusCode == gdriveResumeIncomplete {
+			return "", fmt.Errorf("failed to upload object %s: upload not completed (%s)", key, resp.Status)
+		}
+		Infof("Uploaded %s to Google Drive (Size: %d)", key, offset)
+		return file.ID, nil
+	}
+}
+
+func (s *GDriveStorage) Exists(ctx context.Context, key string) (bool, error) {
+	ids, err := s.find(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat object %s: %w", key, err)
+	}
+	return len(ids) > 0, nil
+}
+
+func (s *GDriveStorage) Download(ctx context.Context, key string, w io.Writer) error {
+	ids, err := s.find(ctx, key)
+	if err == nil && len(ids) == 0 {
+		err = fmt.Errorf("not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get object %s: %w", key, err)
+	}
+	resp, err := s.do(ctx, http.MethodGet, gdriveFilesURL+"/"+url.PathEscape(ids[0])+"?alt=media&supportsAllDrives=true", nil, 0, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get object %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to download object %s: %w", key, err)
+	}
+	return nil
+}
+
+// List lists the files of the folder named below the path prefix.
+func (s *GDriveStorage) List(ctx context.Context) ([]ObjectInfo, error) {
+	files, err := s.files(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	prefix := KeyPrefix(s)
+	var objects []ObjectInfo
+	for _, f := range files {
+		if !strings.HasPrefix(f.Name, prefix) {
+			continue
+		}
+		size, _ := strconv.ParseInt(f.Size, 10, 64)
+		objects = append(objects, ObjectInfo{Key: f.Name, Size: size, LastModified: f.ModifiedTime})
+	}
+	return objects, nil
+}
+
+// Delete deletes every file named key permanently, bypassing the trash.
+func (s *GDriveStorage) Delete(ctx context.Context, key string) error {
+	ids, err := s.find(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to delete object %s: %w", key, err)
+	}
+	for _, id := range ids {
+		if err := s.delete(ctx, id); err != nil {
+			return fmt.Errorf("failed to delete object %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// delete deletes a file by ID; files already gone are not an error.
+func (s *GDriveStorage) delete(ctx context.Context, id string) error {
+	err := s.call(ctx, http.MethodDelete, gdriveFilesURL+"/"+url.PathEscape(id)+"?supportsAllDrives=true", nil)
+	if gdriveStatus(err) == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func (s *GDriveStorage) EnforceRetention(ctx context.Context, retention RetentionFunc, limits RetentionLimits) (RetentionStats, error) {
+	return enforceRetention(ctx, s, retention, limits)
+}
+
+func (s *GDriveStorage) SelfTest(ctx context.Context) error {
+	return canaryTest(ctx, s, s.Delete)
+}
+
+func (s *GDriveStorage) PresignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return "", ErrNotSupported
+}
@@ -1,25 +1,53 @@
 package helper
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 )
 
-// CalculateSHA256 calculates the SHA256 hash of a file.
-func CalculateSHA256(path string) (string, int64, error) {
+// CalculateSHA256 calculates the SHA256 hash of a file, reading at most
+// bytesPerSec (unlimited when non-positive).
+func CalculateSHA256(ctx context.Context, path string, bytesPerSec int64) (string, int64, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return "", 0, err
 	}
 	defer file.Close()
 
-	hash := sha256.New()
-	size, err := io.Copy(hash, file)
+	h := sha256.New()
+	size, err := io.Copy(h, Throttle(ctx, file, bytesPerSec))
 	if err != nil {
 		return "", 0, err
 	}
 
-	return fmt.Sprintf("%x", hash.Sum(nil)), size, nil
+	return fmt.Sprintf("%x", h.Sum(nil)), size, nil
+}
+
+// HashingReader computes the SHA256 and size of everything read through it,
+// so content can be hashed while it is streamed elsewhere.
+type HashingReader struct {
+	r    io.Reader
+	hash hash.Hash
+	size int64
+}
+
+// NewHashingReader wraps r.
+func NewHashingReader(r io.Reader) *HashingReader {
+	h := sha256.New()
+	return &HashingReader{r: io.TeeReader(r, h), hash: h}
+}
+
+func (h *HashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.size += int64(n)
+	return n, err
+}
+
+// Sum returns the hex SHA256 and size of the content read so far.
+func (h *HashingReader) Sum() (string, int64) {
+	return fmt.Sprintf("%x", h.hash.Sum(nil)), h.size
 }
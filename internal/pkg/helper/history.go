@@ -0,0 +1,353 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// historyTimeout bounds recording the history of a run.
+const historyTimeout = 30 * time.Second
+
+// HistoryEntry is one artifact of a run in the backup history.
+type HistoryEntry struct {
+	ID         int64         `json:"id"` // Row ID; zero for entries not recorded yet
+	Job        string        `json:"job"`
+	Name       string        `json:"name"`
+	Host       string        `json:"host"`
+	RunID      string        `json:"run_id"`
+	Artifact   string        `json:"artifact"`
+	Success    bool          `json:"success"`
+	Size       int64         `json:"size"`
+	SHA256     string        `json:"sha256"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration_ns"`
+	FinishedAt time.Time     `json:"finished_at"`
+}
+
+// HistoryRecorder appends entries to the backup history (table backup_logs).
+type HistoryRecorder interface {
+	Record(ctx context.Context, entries []HistoryEntry) error
+	// Entries returns every entry of the history naming an artifact.
+	Entries(ctx context.Context) ([]HistoryEntry, error)
+	// MarkMissing marks the entries with the given IDs as failed with reason,
+	// for artifacts that turned out to be missing from storage.
+	MarkMissing(ctx context.Context, ids []int64, reason string) error
+}
+
+// NewHistoryRecorder returns the recorder configured in history.backend, or
+// nil when history is disabled.
+func NewHistoryRecorder(cfg *config.Config) HistoryRecorder {
+	switch cfg.History.Backend {
+	case "mysql":
+		return &mysqlHistory{my: cfg.MySQL, database: cfg.History.Database}
+	case "sqlite":
+		return &sqliteHistory{path: cfg.History.SQLitePath}
+	default:
+		return nil
+	}
+}
+
+// historyEntries converts the results of a run into history entries.
+func historyEntries(job, runID string, results []BackupResult) []HistoryEntry {
+	hostname, _ := os.Hostname()
+	now := time.Now()
+	entries := make([]HistoryEntry, 0, len(results))
+	for _, res := range results {
+		entry := HistoryEntry{
+			Job:        job,
+			Name:       res.Database,
+			Host:       hostname,
+			RunID:      runID,
+			Success:    res.Success,
+			Size:       res.Size,
+			SHA256:     res.SHA256,
+			Duration:   res.Duration,
+			FinishedAt: now,
+		}
+		if res.Manifest != nil {
+			entry.Artifact = res.Manifest.Artifact
+		}
+		if res.Error != nil {
+			entry.Error = res.Error.Error()
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// mysqlHistory records the history in a MySQL database, using the
+// credentials of the mysql section.
+type mysqlHistory struct {
+	my       config.MySQLConfig
+	database string
+}
+
+// open connects to the server and creates the history table when missing.
+// It returns the quoted database name.
+func (h *mysqlHistory) open(ctx context.Context) (*sql.DB, string, error) {
+	dsn := mysql.NewConfig()
+	dsn.User = h.my.User
+	dsn.Passwd = h.my.Password
+	dsn.Net = "tcp"
+	host, port := h.my.Host, h.my.Port
+	if h.my.SRV != "" {
+		var err error
+		if host, port, err = ResolveSRV(ctx, h.my.SRV); err != nil {
+			return nil, "", err
+		}
+	}
+	dsn.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+	db, err := sql.Open("mysql", dsn.FormatDSN())
+	if err != nil {
+		return nil, "", err
+	}
+
+	database := "`" + strings.ReplaceAll(h.database, "`", "``") + "`"
+	schema := []string{
+		"CREATE DATABASE IF NOT EXISTS " + database,
+		`CREATE TABLE IF NOT EXISTS ` + database + `.backup_logs (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			job VARCHAR(64) NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			host VARCHAR(255) NOT NULL,
+			run_id VARCHAR(16) NOT NULL,
+			artifact VARCHAR(512) NOT NULL,
+			success TINYINT(1) NOT NULL,
+			size BIGINT NOT NULL,
+			sha256 CHAR(64) NOT NULL,
+			error TEXT NOT NULL,
+			duration_ms BIGINT NOT NULL,
+			finished_at DATETIME NOT NULL,
+			KEY idx_name_finished (name, finished_at)
+		)`,
+	}
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			db.Close()
+			return nil, "", fmt.Errorf("failed to create history table: %w", err)
+		}
+	}
+	return db, database, nil
+}
+
+func (h *mysqlHistory) Record(ctx context.Context, entries []HistoryEntry) error {
+	db, database, err := h.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	insert := `INSERT INTO ` + database + `.backup_logs
+		(job, name, host, run_id, artifact, success, size, sha256, error, duration_ms, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	for _, e := range entries {
+		_, err := tx.ExecContext(ctx, insert, e.Job, e.Name, e.Host, e.RunID, e.Artifact, e.Success,
+			e.Size, e.SHA256, e.Error, e.Duration.Milliseconds(), e.FinishedAt.UTC())
+		if err != nil {
+			return fmt.Errorf("failed to insert history: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (h *mysqlHistory) Entries(ctx context.Context) ([]HistoryEntry, error) {
+	db, database, err := h.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `SELECT id, job, name, host, run_id, artifact, success, size, sha256, error, duration_ms, finished_at
+		FROM `+database+`.backup_logs WHERE artifact <> '' ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []HistoryEntry
+	for rows.Next() {
+		var e HistoryEntry
+		var durationMS int64
+		var finishedAt string
+		if err := rows.Scan(&e.ID, &e.Job, &e.Name, &e.Host, &e.RunID, &e.Artifact, &e.Success,
+			&e.Size, &e.SHA256, &e.Error, &durationMS, &finishedAt); err != nil {
+			return nil, fmt.Errorf("failed to read history: %w", err)
+		}
+		e.Duration = time.Duration(durationMS) * time.Millisecond
+		e.FinishedAt, _ = time.ParseInLocation(time.DateTime, finishedAt, time.UTC)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (h *mysqlHistory) MarkMissing(ctx context.Context, ids []int64, reason string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	db, database, err := h.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	update := `UPDATE ` + database + `.backup_logs SET success = 0, error = ? WHERE id = ?`
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx, update, reason, id); err != nil {
+			return fmt.Errorf("failed to update history: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// sqliteHistory records the history in a SQLite file through the sqlite3
+// shell, which the app command requires anyway.
+type sqliteHistory struct {
+	path string
+}
+
+// sqliteSchema creates the history table when missing.
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS backup_logs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	job TEXT NOT NULL,
+	name TEXT NOT NULL,
+	host TEXT NOT NULL,
+	run_id TEXT NOT NULL,
+	artifact TEXT NOT NULL,
+	success INTEGER NOT NULL,
+	size INTEGER NOT NULL,
+	sha256 TEXT NOT NULL,
+	error TEXT NOT NULL,
+	duration_ms INTEGER NOT NULL,
+	finished_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_name_finished ON backup_logs (name, finished_at);
+`
+
+func (h *sqliteHistory) Record(ctx context.Context, entries []HistoryEntry) error {
+	var script strings.Builder
+	script.WriteString(sqliteSchema)
+	script.WriteString("BEGIN;\n")
+	for _, e := range entries {
+		success := 0
+		if e.Success {
+			success = 1
+		}
+		fmt.Fprintf(&script, "INSERT INTO backup_logs (job, name, host, run_id, artifact, success, size, sha256, error, duration_ms, finished_at) VALUES (%s, %s, %s, %s, %s, %d, %d, %s, %s, %d, %s);\n",
+			sqliteString(e.Job), sqliteString(e.Name), sqliteString(e.Host), sqliteString(e.RunID), sqliteString(e.Artifact),
+			success, e.Size, sqliteString(e.SHA256), sqliteString(e.Error), e.Duration.Milliseconds(),
+			sqliteString(e.FinishedAt.UTC().Format(time.RFC3339)))
+	}
+	script.WriteString("COMMIT;\n")
+	_, err := h.run(ctx, script.String())
+	return err
+}
+
+func (h *sqliteHistory) Entries(ctx context.Context) ([]HistoryEntry, error) {
+	output, err := h.run(ctx, sqliteSchema+`SELECT id, job, name, host, run_id, artifact, success, size, sha256, error, duration_ms, finished_at
+		FROM backup_logs WHERE artifact <> '' ORDER BY id;`, "-json")
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(output)) == 0 {
+		return nil, nil // No rows
+	}
+	var rows []struct {
+		ID         int64  `json:"id"`
+		Job        string `json:"job"`
+		Name       string `json:"name"`
+		Host       string `json:"host"`
+		RunID      string `json:"run_id"`
+		Artifact   string `json:"artifact"`
+		Success    int    `json:"success"`
+		Size       int64  `json:"size"`
+		SHA256     string `json:"sha256"`
+		Error      string `json:"error"`
+		DurationMS int64  `json:"duration_ms"`
+		FinishedAt string `json:"finished_at"`
+	}
+	if err := sonic.Unmarshal(output, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse history: %w", err)
+	}
+	entries := make([]HistoryEntry, len(rows))
+	for i, r := range rows {
+		finishedAt, _ := time.Parse(time.RFC3339, r.FinishedAt)
+		entries[i] = HistoryEntry{
+			ID: r.ID, Job: r.Job, Name: r.Name, Host: r.Host, RunID: r.RunID, Artifact: r.Artifact,
+			Success: r.Success != 0, Size: r.Size, SHA256: r.SHA256, Error: r.Error,
+			Duration: time.Duration(r.DurationMS) * time.Millisecond, FinishedAt: finishedAt,
+		}
+	}
+	return entries, nil
+}
+
+func (h *sqliteHistory) MarkMissing(ctx context.Context, ids []int64, reason string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	list := make([]string, len(ids))
+	for i, id := range ids {
+		list[i] = strconv.FormatInt(id, 10)
+	}
+	_, err := h.run(ctx, fmt.Sprintf("UPDATE backup_logs SET success = 0, error = %s WHERE id IN (%s);\n",
+		sqliteString(reason), strings.Join(list, ", ")))
+	return err
+}
+
+// run runs a script on the history file through the sqlite3 shell.
+func (h *sqliteHistory) run(ctx context.Context, script string, options ...string) ([]byte, error) {
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history dir: %w", err)
+	}
+	args := append([]string{"-bail", "-cmd", ".timeout 60000"}, options...)
+	output, err := Run(ctx, Command{
+		Name:  "sqlite3",
+		Args:  append(args, h.path),
+		Stdin: strings.NewReader(script),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3 failed: %w", err)
+	}
+	return output, nil
+}
+
+// sqliteString quotes a value as a SQLite string literal.
+func sqliteString(v string) string {
+	return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+}
+
+// recordHistory records the results of a run when history is enabled.
+// Failures are logged and never fail the run.
+func recordHistory(cfg *config.Config, job, runID string, results []BackupResult) {
+	recorder := NewHistoryRecorder(cfg)
+	if recorder == nil || len(results) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), historyTimeout)
+	defer cancel()
+	if err := recorder.Record(ctx, historyEntries(job, runID, results)); err != nil {
+		Warnf("failed to record backup history: %v", err)
+	}
+}
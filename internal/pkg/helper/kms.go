@@ -0,0 +1,211 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// KeyWrapper wraps and unwraps per-artifact data keys with an external key
+// management service (envelope encryption).
+type KeyWrapper interface {
+	Wrap(ctx context.Context, key []byte) (string, error)
+	Unwrap(ctx context.Context, wrapped string) ([]byte, error)
+}
+
+// NewKeyWrapper creates the KeyWrapper configured in cfg. It returns nil when
+// envelope encryption is disabled.
+func NewKeyWrapper(cfg config.KMSConfig) (KeyWrapper, error) {
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case "aws":
+		return &awsKMS{keyID: cfg.KeyID}, nil
+	case "gcp":
+		return &gcpKMS{keyID: cfg.KeyID}, nil
+	case "vault":
+		addr := cfg.VaultAddr
+		if addr == "" {
+			addr = os.Getenv("VAULT_ADDR")
+		}
+		token := cfg.VaultToken
+		if token == "" {
+			token = os.Getenv("VAULT_TOKEN")
+		}
+		if addr == "" || token == "" {
+			return nil, fmt.Errorf("vault transit requires an address and a token")
+		}
+		return &vaultTransit{
+			addr:   strings.TrimSuffix(addr, "/"),
+			token:  token,
+			mount:  cfg.VaultMount,
+			keyID:  cfg.KeyID,
+			client: &http.Client{Timeout: 30 * time.Second},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported kms provider %q", cfg.Provider)
+	}
+}
+
+// NewDataKey generates a random data key and returns it together with the zip
+// password derived from it.
+func NewDataKey() ([]byte, string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	return key, hex.EncodeToString(key), nil
+}
+
+// ArtifactPassword returns the zip password of an artifact: the unwrapped data
+// key when its manifest carries one, the configured password otherwise.
+func ArtifactPassword(ctx context.Context, cfg *config.Config, manifest *Manifest) (string, error) {
+	if manifest == nil || manifest.Encryption == nil {
+		return cfg.Encryption.Password, nil
+	}
+
+	kmsCfg := cfg.Encryption.KMS
+	kmsCfg.Provider = manifest.Encryption.Provider
+	kmsCfg.KeyID = manifest.Encryption.KeyID
+	wrapper, err := NewKeyWrapper(kmsCfg)
+	if err != nil {
+		return "", err
+	}
+	key, err := wrapper.Unwrap(ctx, manifest.Encryption.WrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return hex.EncodeToString(key), nil
+}
+
+type awsKMS struct {
+	keyID string
+}
+
+func (k *awsKMS) Wrap(ctx context.Context, key []byte) (string, error) {
+	output, err := runKMS(ctx, key, "aws", "kms", "encrypt", "--key-id", k.keyID,
+		"--plaintext", "fileb:///dev/stdin", "--output", "text", "--query", "CiphertextBlob")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func (k *awsKMS) Unwrap(ctx context.Context, wrapped string) ([]byte, error) {
+	blob, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped key: %w", err)
+	}
+	output, err := runKMS(ctx, blob, "aws", "kms", "decrypt", "--key-id", k.keyID,
+		"--ciphertext-blob", "fileb:///dev/stdin", "--output", "text", "--query", "Plaintext")
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(output)))
+}
+
+type gcpKMS struct {
+	keyID string
+}
+
+func (k *gcpKMS) Wrap(ctx context.Context, key []byte) (string, error) {
+	output, err := runKMS(ctx, key, "gcloud", "kms", "encrypt", "--key", k.keyID,
+		"--plaintext-file", "-", "--ciphertext-file", "-")
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(output), nil
+}
+
+func (k *gcpKMS) Unwrap(ctx context.Context, wrapped string) ([]byte, error) {
+	blob, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped key: %w", err)
+	}
+	return runKMS(ctx, blob, "gcloud", "kms", "decrypt", "--key", k.keyID,
+		"--ciphertext-file", "-", "--plaintext-file", "-")
+}
+
+// runKMS runs a KMS CLI with input on stdin and returns its stdout, which
+// holds key material and so is kept out of the command log.
+func runKMS(ctx context.Context, input []byte, name string, args ...string) ([]byte, error) {
+	var output bytes.Buffer
+	if _, err := Run(ctx, Command{Name: name, Args: args, Stdin: bytes.NewReader(input), Stdout: &output}); err != nil {
+		return nil, fmt.Errorf("%s kms failed: %w", name, err)
+	}
+	return output.Bytes(), nil
+}
+
+type vaultTransit struct {
+	addr   string
+	token  string
+	mount  string
+	keyID  string
+	client *http.Client
+}
+
+func (v *vaultTransit) Wrap(ctx context.Context, key []byte) (string, error) {
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	payload := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(key)}
+	if err := v.call(ctx, "encrypt", payload, &resp); err != nil {
+		return "", err
+	}
+	return resp.Data.Ciphertext, nil
+}
+
+func (v *vaultTransit) Unwrap(ctx context.Context, wrapped string) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	payload := map[string]string{"ciphertext": wrapped}
+	if err := v.call(ctx, "decrypt", payload, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+}
+
+func (v *vaultTransit) call(ctx context.Context, op string, payload map[string]string, out interface{}) error {
+	body, err := sonic.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/v1/%s/%s/%s", v.addr, v.mount, op, v.keyID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault transit %s failed: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault transit %s returned non-200 status: %d", op, resp.StatusCode)
+	}
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		return err
+	}
+	return sonic.Unmarshal(buf.Bytes(), out)
+}
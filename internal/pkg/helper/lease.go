@@ -0,0 +1,103 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// ErrLeaseHeld is returned by AcquireLease while another holder's lease is valid.
+var ErrLeaseHeld = errors.New("lease held by another host")
+
+// leaseSettle is how long a taken-over lease is left to settle before
+// checking that no other host took it over at the same time.
+var leaseSettle = 2 * time.Second
+
+// leaseReleaseTimeout bounds releasing a lease, which also happens after
+// the run was cancelled.
+const leaseReleaseTimeout = 30 * time.Second
+
+// leaseName is the name of the retention lease object, next to the backups.
+const leaseName = ".backup_retention_lease"
+
+// lease is the content of a lease object.
+type lease struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// leaseKey returns the key of the retention lease of a storage.
+func leaseKey(store Storage) string {
+	return KeyPrefix(store) + leaseName
+}
+
+// AcquireLease takes the retention lease of a storage for ttl, so hosts
+// sharing a bucket prefix don't list and delete the same objects at once.
+// The lease is created with Upload, which fails when it exists; an expired
+// lease is taken over with Replace and read back after a moment, as two hosts
+// may take it over together. It returns ErrLeaseHeld while another holder's
+// lease is valid, and a function releasing the lease.
+//
+// The lease is advisory. It excludes other hosts only where Upload is an
+// atomic conditional write (local storage, S3, SFTP); on backends checking
+// for the object before writing it, like B2, FTP, WebDAV and Google Drive,
+// two hosts starting at the same moment may both hold it.
+func AcquireLease(ctx context.Context, store Storage, ttl time.Duration, holder string) (func(), error) {
+	key := leaseKey(store)
+	data, err := sonic.Marshal(lease{Holder: holder, ExpiresAt: time.Now().Add(ttl).UTC()})
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.Upload(ctx, key, bytes.NewReader(data))
+	if errors.Is(err, ErrObjectExists) {
+		current, readErr := readLease(ctx, store, key)
+		if readErr == nil && current.Holder != holder && current.ExpiresAt.After(time.Now()) {
+			return nil, fmt.Errorf("%w: %s until %s", ErrLeaseHeld, current.Holder, current.ExpiresAt.Local().Format(time.RFC3339))
+		}
+		// Expired, unreadable or our own: take it over
+		if err = store.Replace(ctx, key, bytes.NewReader(data)); err == nil {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(leaseSettle):
+			}
+			current, err = readLease(ctx, store, key)
+			if err == nil && current.Holder != holder {
+				return nil, fmt.Errorf("%w: %s took it over at the same time", ErrLeaseHeld, current.Holder)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	release := func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), leaseReleaseTimeout)
+		defer cancel()
+		if current, err := readLease(ctx, store, key); err != nil || current.Holder != holder {
+			return // Expired and taken over by another host
+		}
+		if err := store.Delete(ctx, key); err != nil {
+			Warnf("failed to release retention lease %s: %v", key, err)
+		}
+	}
+	return release, nil
+}
+
+// readLease reads a lease object.
+func readLease(ctx context.Context, store Storage, key string) (*lease, error) {
+	var buf bytes.Buffer
+	if err := store.Download(ctx, key, &buf); err != nil {
+		return nil, err
+	}
+	var l lease
+	if err := sonic.Unmarshal(buf.Bytes(), &l); err != nil {
+		return nil, fmt.Errorf("invalid lease %s: %w", key, err)
+	}
+	return &l, nil
+}
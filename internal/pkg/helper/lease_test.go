@@ -0,0 +1,137 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testLeaseStorage returns local storage for lease tests, taking expired
+// leases over without the settle delay.
+func testLeaseStorage(t *testing.T) *LocalStorage {
+	t.Helper()
+	settle := leaseSettle
+	leaseSettle = time.Millisecond
+	t.Cleanup(func() { leaseSettle = settle })
+	return NewLocalStorage(testConfig(t).Local)
+}
+
+// leaseHolder returns the holder of the stored lease, or "" without one.
+func leaseHolder(t *testing.T, store Storage) string {
+	t.Helper()
+	exists, err := store.Exists(context.Background(), leaseKey(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		return ""
+	}
+	current, err := readLease(context.Background(), store, leaseKey(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return current.Holder
+}
+
+func TestLeaseConcurrentAcquire(t *testing.T) {
+	store := testLeaseStorage(t)
+
+	const hosts = 8
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		holders  []string
+		releases []func()
+	)
+	for i := 0; i < hosts; i++ {
+		wg.Add(1)
+		go func(holder string) {
+			defer wg.Done()
+			release, err := AcquireLease(context.Background(), store, time.Hour, holder)
+			if err != nil {
+				if !errors.Is(err, ErrLeaseHeld) {
+					t.Errorf("%s: AcquireLease = %v, want ErrLeaseHeld", holder, err)
+				}
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			holders = append(holders, holder)
+			releases = append(releases, release)
+		}(fmt.Sprintf("host-%d", i))
+	}
+	wg.Wait()
+
+	if len(holders) != 1 {
+		t.Fatalf("lease acquired by %v, want exactly one host", holders)
+	}
+	if got := leaseHolder(t, store); got != holders[0] {
+		t.Errorf("stored lease held by %q, want %q", got, holders[0])
+	}
+	releases[0]()
+	if got := leaseHolder(t, store); got != "" {
+		t.Errorf("lease of %q left after release", got)
+	}
+}
+
+func TestLeaseExpiryTakeover(t *testing.T) {
+	store := testLeaseStorage(t)
+	ctx := context.Background()
+
+	releaseA, err := AcquireLease(ctx, store, time.Millisecond, "host-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// The expired lease is taken over
+	releaseB, err := AcquireLease(ctx, store, time.Hour, "host-b")
+	if err != nil {
+		t.Fatalf("takeover of an expired lease = %v", err)
+	}
+	if got := leaseHolder(t, store); got != "host-b" {
+		t.Fatalf("stored lease held by %q, want host-b", got)
+	}
+
+	// The former holder neither takes it back nor releases it
+	if _, err := AcquireLease(ctx, store, time.Hour, "host-a"); !errors.Is(err, ErrLeaseHeld) {
+		t.Errorf("AcquireLease of a valid lease = %v, want ErrLeaseHeld", err)
+	}
+	releaseA()
+	if got := leaseHolder(t, store); got != "host-b" {
+		t.Errorf("stored lease held by %q after the former holder released, want host-b", got)
+	}
+
+	releaseB()
+	if got := leaseHolder(t, store); got != "" {
+		t.Errorf("lease of %q left after release", got)
+	}
+}
+
+func TestLeaseRelease(t *testing.T) {
+	store := testLeaseStorage(t)
+	ctx := context.Background()
+
+	release, err := AcquireLease(ctx, store, time.Hour, "host-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AcquireLease(ctx, store, time.Hour, "host-b"); !errors.Is(err, ErrLeaseHeld) {
+		t.Fatalf("AcquireLease of a held lease = %v, want ErrLeaseHeld", err)
+	}
+
+	// A host renews its own lease
+	renewed, err := AcquireLease(ctx, store, time.Hour, "host-a")
+	if err != nil {
+		t.Fatalf("renewal of an own lease = %v", err)
+	}
+	renewed()
+	release() // Already released: a no-op
+
+	if _, err := AcquireLease(ctx, store, time.Hour, "host-b"); err != nil {
+		t.Errorf("AcquireLease after release = %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// LocalStorage stores artifacts in a directory on the local filesystem.
+type LocalStorage struct {
+	dir    string
+	layout string
+}
+
+// NewLocalStorage creates a storage rooted at the configured directory, which
+// is created on the first upload.
+func NewLocalStorage(cfg config.LocalConfig) *LocalStorage {
+	return &LocalStorage{dir: cfg.Dir, layout: cfg.Layout}
+}
+
+// Path returns the file path of a key.
+func (s *LocalStorage) Path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
+
+func (s *LocalStorage) ObjectKey(source string, ts time.Time, filename string) string {
+	return objectKey("", s.layout, source, ts, filename)
+}
+
+// Upload writes a partial file and hard-links it into place. Linking fails
+// when the target exists, which keeps stored artifacts immutable.
+func (s *LocalStorage) Upload(ctx context.Context, key string, content io.Reader) error {
+	partial, err := s.write(ctx, key, content)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(partial)
+
+	if err := os.Link(partial, s.Path(key)); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("%w: %s", ErrObjectExists, key)
+		}
+		return fmt.Errorf("failed to save object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) Replace(ctx context.Context, key string, content io.Reader) error {
+	partial, err := s.write(ctx, key, content)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(partial, s.Path(key)); err != nil {
+		os.Remove(partial)
+		return fmt.Errorf("failed to save object %s: %w", key, err)
+	}
+	return nil
+}
+
+// write copies content to the partial file of key and returns its path.
+func (s *LocalStorage) write(ctx context.Context, key string, content io.Reader) (string, error) {
+	target := s.Path(key)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory for %s: %w", key, err)
+	}
+
+	// Unique per write, so concurrent uploads of a key don't share it
+	file, err := os.CreateTemp(filepath.Dir(target), filepath.Base(target)+".*"+partialSuffix)
+	if err != nil {
+		return "", fmt.Errorf("failed to save object %s: %w", key, err)
+	}
+	partial := file.Name()
+	size, err := io.Copy(file, &contextReader{ctx: ctx, r: content})
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partial)
+		return "", fmt.Errorf("failed to save object %s: %w", key, err)
+	}
+
+	Infof("Saved %s to %s (Size: %d)", key, s.dir, size)
+	return partial, nil
+}
+
+func (s *LocalStorage) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := os.Stat(s.Path(key))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to stat object %s: %w", key, err)
+}
+
+func (s *LocalStorage) Download(ctx context.Context, key string, w io.Writer) error {
+	file, err := os.Open(s.Path(key))
+	if err != nil {
+		return fmt.Errorf("failed to get object %s: %w", key, err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(w, &contextReader{ctx: ctx, r: file}); err != nil {
+		return fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+	return nil
+}
+
+// List walks the directory. Partial files are left out.
+func (s *LocalStorage) List(ctx context.Context) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if path == s.dir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipAll // Nothing saved yet
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, partialSuffix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{Key: filepath.ToSlash(rel), Size: info.Size(), LastModified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	return objects, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(s.Path(key)); err != nil {
+		return fmt.Errorf("failed to delete object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) EnforceRetention(ctx context.Context, retention RetentionFunc, limits RetentionLimits) (RetentionStats, error) {
+	return enforceRetention(ctx, s, retention, limits)
+}
+
+func (s *LocalStorage) SelfTest(ctx context.Context) error {
+	return canaryTest(ctx, s, s.Delete)
+}
+
+func (s *LocalStorage) PresignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return "", ErrNotSupported
+}
@@ -0,0 +1,83 @@
+package helper
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestShipOnlyDumpKeepsArtifactLocally(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Backup.SpoolDir = t.TempDir()
+	cfg.R2.SHA256Metadata = true
+	remote := NewMemoryStorage("")
+	p := NewPipeline(cfg, remote, Options{OnlyDump: true})
+
+	res := p.Ship(context.Background(), "shop", testDump(t), time.Now(), false)
+	if !res.Success {
+		t.Fatalf("Ship failed: %v", res.Error)
+	}
+	local := NewLocalStorage(cfg.Local)
+	keys := artifactKeys(t, local)
+	if len(keys) != 1 {
+		t.Fatalf("local artifacts = %v, want 1", keys)
+	}
+	hash, size, err := CalculateSHA256(context.Background(), local.Path(keys[0]), 0)
+	if err != nil || hash != res.SHA256 || size != res.Size {
+		t.Errorf("local copy has %s/%d (%v), result %s/%d", hash, size, err, res.SHA256, res.Size)
+	}
+	if manifest, err := LoadManifest(context.Background(), local, keys[0]); err != nil || manifest == nil {
+		t.Errorf("LoadManifest = %v, %v", manifest, err)
+	}
+	if objects, _ := remote.List(context.Background()); len(objects) != 0 {
+		t.Errorf("remote storage got %v in only-dump mode", objects)
+	}
+	if entries, _ := NewSpool(cfg.Backup.SpoolDir, 0).Entries(); len(entries) != 0 {
+		t.Errorf("spool got %v in only-dump mode", entries)
+	}
+}
+
+// backdate sets the modification time of a local artifact and its manifest.
+func backdate(t *testing.T, store *LocalStorage, key string, modified time.Time) {
+	t.Helper()
+	for _, k := range []string{key, ManifestKey(key)} {
+		if err := os.Chtimes(store.Path(k), modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPruneLocal(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Retention.Hours = 24
+	local := NewLocalStorage(cfg.Local)
+	p := NewPipeline(cfg, local, Options{OnlyDump: true})
+
+	now := time.Now()
+	for _, created := range []time.Time{now.Add(-48 * time.Hour), now} {
+		if res := p.Ship(context.Background(), "shop", testDump(t), created, false); !res.Success {
+			t.Fatalf("Ship failed: %v", res.Error)
+		}
+	}
+	keys := artifactKeys(t, local)
+	if len(keys) != 2 {
+		t.Fatalf("local artifacts = %v, want 2", keys)
+	}
+	backdate(t, local, keys[0], now.Add(-48*time.Hour))
+
+	// Runs uploading to remote storage leave local.dir alone
+	NewPipeline(cfg, local, Options{}).PruneLocal(context.Background())
+	if got := artifactKeys(t, local); len(got) != 2 {
+		t.Fatalf("local artifacts after remote run = %v, want 2", got)
+	}
+
+	p.PruneLocal(context.Background())
+	got := artifactKeys(t, local)
+	if len(got) != 1 || got[0] != keys[1] {
+		t.Fatalf("local artifacts after pruning = %v, want %s", got, keys[1])
+	}
+	if exists, _ := local.Exists(context.Background(), ManifestKey(keys[0])); exists {
+		t.Errorf("manifest of pruned %s kept", keys[0])
+	}
+}
@@ -0,0 +1,113 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// Log levels, from the most to the least verbose.
+var logLevels = map[string]int{"debug": 0, "info": 1, "warn": 2, "error": 3}
+
+// logWriter filters and formats the lines of the standard logger. Lines
+// logged through Debugf, Infof, Warnf and Errorf carry their level; any other
+// line, e.g. from log.Printf, is informational.
+type logWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	level  int
+	asJSON bool
+}
+
+// SetupLogging configures the standard logger with a minimum level (debug,
+// info, warn or error) and an output format (text or json).
+func SetupLogging(level, format string) error {
+	minLevel, ok := logLevels[level]
+	if !ok {
+		return fmt.Errorf("invalid log level %q: must be debug, info, warn or error", level)
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("invalid output format %q: must be text or json", format)
+	}
+	log.SetFlags(0)
+	log.SetOutput(&logWriter{out: os.Stderr, level: minLevel, asJSON: format == "json"})
+	return nil
+}
+
+// levelLabels prefix the messages of levels other than info in text output.
+var levelLabels = map[string]string{"debug": "Debug: ", "warn": "Warning: ", "error": "Error: "}
+
+// Debugf logs details that are only shown at the debug level.
+func Debugf(format string, args ...any) {
+	logf("debug", format, args...)
+}
+
+// Infof logs the progress of a run.
+func Infof(format string, args ...any) {
+	logf("info", format, args...)
+}
+
+// Warnf logs a problem the run continues despite, as "Warning: ..." in text
+// output.
+func Warnf(format string, args ...any) {
+	logf("warn", format, args...)
+}
+
+// Errorf logs a failure, as "Error: ..." in text output.
+func Errorf(format string, args ...any) {
+	logf("error", format, args...)
+}
+
+func logf(level, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	w, ok := log.Writer().(*logWriter)
+	if !ok {
+		// Logging was not set up, e.g. in library use: info and above
+		if level != "debug" {
+			log.Print(levelLabels[level] + msg)
+		}
+		return
+	}
+	w.write(level, msg)
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	if err := w.write("info", strings.TrimSuffix(string(p), "\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// write writes a message of the given level, unless it is below the minimum.
+func (w *logWriter) write(level, msg string) error {
+	if logLevels[level] < w.level {
+		return nil
+	}
+
+	now := time.Now()
+	var line []byte
+	if w.asJSON {
+		data, err := sonic.Marshal(struct {
+			Time  string `json:"time"`
+			Level string `json:"level"`
+			Msg   string `json:"msg"`
+		}{now.Format(time.RFC3339), level, msg})
+		if err != nil {
+			return err
+		}
+		line = append(data, '\n')
+	} else {
+		line = []byte(now.Format("2006/01/02 15:04:05 ") + levelLabels[level] + msg + "\n")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.out.Write(line)
+	return err
+}
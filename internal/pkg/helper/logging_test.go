@@ -0,0 +1,62 @@
+package helper
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureLog routes the standard logger to a buffer at the given level.
+func captureLog(t *testing.T, level string, asJSON bool) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	flags := log.Flags()
+	log.SetFlags(0)
+	log.SetOutput(&logWriter{out: &buf, level: logLevels[level], asJSON: asJSON})
+	t.Cleanup(func() {
+		log.SetFlags(flags)
+		log.SetOutput(os.Stderr)
+	})
+	return &buf
+}
+
+func TestLogLevels(t *testing.T) {
+	buf := captureLog(t, "info", false)
+	Debugf("hidden %d", 1)
+	Infof("shown %d", 2)
+	Warnf("disk at %d%%", 90)
+	Errorf("upload failed")
+	log.Printf("plain")
+
+	out := buf.String()
+	if strings.Contains(out, "hidden") {
+		t.Errorf("debug message logged at info level:\n%s", out)
+	}
+	for _, want := range []string{"shown 2\n", "Warning: disk at 90%\n", "Error: upload failed\n", "plain\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestLogDebugLevel(t *testing.T) {
+	buf := captureLog(t, "debug", false)
+	Debugf("details")
+	if !strings.Contains(buf.String(), "Debug: details\n") {
+		t.Errorf("debug message missing:\n%s", buf)
+	}
+}
+
+func TestLogJSON(t *testing.T) {
+	buf := captureLog(t, "warn", true)
+	Infof("progress")
+	log.Printf("Upload of x failed") // Untagged lines are informational
+	Warnf("slow")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"level":"warn","msg":"slow"`) {
+		t.Errorf("lines = %q, want the warning only", lines)
+	}
+}
@@ -0,0 +1,179 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// ManifestSuffix is appended to an artifact key to form its manifest key.
+const ManifestSuffix = ".manifest.json"
+
+// Manifest describes the content of an artifact. It is stored next to the
+// artifact so backups can be searched without downloading them.
+type Manifest struct {
+	Artifact  string              `json:"artifact"`
+	Source    string              `json:"source"`
+	CreatedAt time.Time           `json:"created_at"`
+	Size      int64               `json:"size"`
+	SHA256    string              `json:"sha256"`
+	Schemas   map[string][]string `json:"schemas,omitempty"` // Schema name -> table names
+	Kind      string              `json:"kind,omitempty"`    // Chain kind: full (default), incremental or binlog
+	Parent    string              `json:"parent,omitempty"`  // Key of the artifact this one applies on top of
+
+	Engine        string `json:"engine,omitempty"`         // Tool that produced the dump, e.g. mysqlsh
+	EngineVersion string `json:"engine_version,omitempty"` // Version of that tool
+	Server        string `json:"server,omitempty"`         // host:port the dump was taken from, e.g. a replica
+
+	Encryption *EncryptionInfo `json:"encryption,omitempty"` // Set when the artifact is protected by a wrapped data key
+}
+
+// EncryptionInfo records the wrapped data key protecting an artifact.
+type EncryptionInfo struct {
+	Provider   string `json:"provider"`
+	KeyID      string `json:"key_id"`
+	WrappedKey string `json:"wrapped_key"`
+}
+
+// ManifestKey returns the manifest key (or path) for an artifact key (or path).
+func ManifestKey(artifactKey string) string {
+	return artifactKey + ManifestSuffix
+}
+
+// HasTable reports whether the manifest lists the given table. The table may be
+// qualified with its schema ("db.table"). Schema and table names may contain
+// dots themselves, so a qualified name is matched against the schemas listed
+// rather than split at a dot.
+func (m *Manifest) HasTable(table string) bool {
+	for s, tables := range m.Schemas {
+		for _, t := range tables {
+			if t == table || s+"."+t == table {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasSchema reports whether the manifest lists the given schema.
+func (m *Manifest) HasSchema(schema string) bool {
+	_, ok := m.Schemas[schema]
+	return ok
+}
+
+// Marshal encodes the manifest as indented JSON.
+func (m *Manifest) Marshal() ([]byte, error) {
+	return sonic.MarshalIndent(m, "", "  ")
+}
+
+// ParseManifest decodes a manifest from JSON.
+func ParseManifest(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := sonic.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// SQLDumpMetadata is the file marking a mysqldump dump directory, holding the
+// "dumper" like the @.json of mysqlsh dumps. Its schemas are described by
+// per-schema metadata files in the mysqlsh format.
+const SQLDumpMetadata = "@.sqldump.json"
+
+// ReadDumpSchemas collects the schemas and tables of the mysqlsh (or
+// mysqldump) dumps found under dir from their per-schema metadata files.
+// Directories without dumps yield an empty result.
+func ReadDumpSchemas(dir string) (map[string][]string, error) {
+	schemas := make(map[string][]string)
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		// Schema metadata lives in "<schema>.json"; table metadata in "<schema>@<table>.json"
+		if d.IsDir() || !strings.HasSuffix(name, ".json") || strings.Contains(name, "@") {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var meta struct {
+			Schema string   `json:"schema"`
+			Tables []string `json:"tables"`
+		}
+		if err := sonic.Unmarshal(data, &meta); err != nil || meta.Schema == "" {
+			return nil // Not a mysqlsh schema metadata file
+		}
+		tables := append(schemas[meta.Schema], meta.Tables...)
+		sort.Strings(tables)
+		schemas[meta.Schema] = tables
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dump metadata: %w", err)
+	}
+	return schemas, nil
+}
+
+// ReadDumpEngine returns the tool and version that produced the mysqlsh dump
+// below dir, read from the "dumper" field of its @.json, e.g. "mysqlsh Ver
+// 8.0.36 for Linux on x86_64", or of the SQLDumpMetadata of a mysqldump dump,
+// e.g. "mariadb-dump from 11.4.2-MariaDB, client 10.19 for Linux". Both are
+// empty when dir holds no dump.
+func ReadDumpEngine(dir string) (engine, version string) {
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() != "@.json" && d.Name() != SQLDumpMetadata {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		var meta struct {
+			Dumper string `json:"dumper"`
+		}
+		if sonic.Unmarshal(data, &meta) != nil {
+			return nil
+		}
+		fields := strings.Fields(meta.Dumper)
+		if len(fields) == 0 {
+			return nil
+		}
+		engine = fields[0]
+		if len(fields) > 2 && (fields[1] == "Ver" || fields[1] == "from") {
+			version = strings.TrimSuffix(fields[2], ",")
+		}
+		return filepath.SkipAll
+	})
+	return engine, version
+}
+
+// ReadManifestFile reads the manifest stored next to a local artifact. It
+// returns nil when the artifact has no manifest.
+func ReadManifestFile(artifactPath string) (*Manifest, error) {
+	data, err := os.ReadFile(ManifestKey(artifactPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifest(data)
+}
+
+// writeManifestFile writes the manifest of an artifact file next to it, where
+// ReadManifestFile finds it.
+func writeManifestFile(artifactPath string, manifest *Manifest) error {
+	data, err := manifest.Marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ManifestKey(artifactPath), data, 0600)
+}
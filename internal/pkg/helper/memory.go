@@ -0,0 +1,182 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// MemoryStorage keeps objects in memory. It backs integration tests of the
+// pipeline, spool, cache and retention without a bucket.
+type MemoryStorage struct {
+	mu      sync.Mutex
+	objects map[string]memoryObject
+	layout  string
+}
+
+type memoryObject struct {
+	data     []byte
+	modified time.Time
+}
+
+// NewMemoryStorage creates an empty in-memory storage using the given key layout.
+func NewMemoryStorage(layout string) *MemoryStorage {
+	return &MemoryStorage{objects: make(map[string]memoryObject), layout: layout}
+}
+
+func (s *MemoryStorage) ObjectKey(source string, ts time.Time, filename string) string {
+	return objectKey("", s.layout, source, ts, filename)
+}
+
+func (s *MemoryStorage) Upload(ctx context.Context, key string, content io.Reader) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return fmt.Errorf("failed to upload object %s: %w", key, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.objects[key]; ok {
+		return fmt.Errorf("%w: %s", ErrObjectExists, key)
+	}
+	s.objects[key] = memoryObject{data: data, modified: time.Now()}
+	return nil
+}
+
+func (s *MemoryStorage) Replace(ctx context.Context, key string, content io.Reader) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return fmt.Errorf("failed to upload object %s: %w", key, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = memoryObject{data: data, modified: time.Now()}
+	return nil
+}
+
+func (s *MemoryStorage) Exists(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.objects[key]
+	return ok, nil
+}
+
+func (s *MemoryStorage) Download(ctx context.Context, key string, w io.Writer) error {
+	s.mu.Lock()
+	object, ok := s.objects[key]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("failed to get object %s: not found", key)
+	}
+	_, err := w.Write(object.data)
+	return err
+}
+
+func (s *MemoryStorage) List(ctx context.Context) ([]ObjectInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects := make([]ObjectInfo, 0, len(s.objects))
+	for key, object := range s.objects {
+		objects = append(objects, ObjectInfo{Key: key, Size: int64(len(object.data)), LastModified: object.modified})
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (s *MemoryStorage) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *MemoryStorage) EnforceRetention(ctx context.Context, retention RetentionFunc, limits RetentionLimits) (RetentionStats, error) {
+	return enforceRetention(ctx, s, retention, limits)
+}
+
+func (s *MemoryStorage) SelfTest(ctx context.Context) error {
+	return canaryTest(ctx, s, s.Delete)
+}
+
+func (s *MemoryStorage) PresignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return "", ErrNotSupported
+}
+
+// SetModified backdates an object, e.g. to make it expire under retention.
+func (s *MemoryStorage) SetModified(key string, modified time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if object, ok := s.objects[key]; ok {
+		object.modified = modified
+		s.objects[key] = object
+	}
+}
+
+// MemoryNotifier records the messages of a TelegramSender instead of
+// delivering them.
+type MemoryNotifier struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+// NewMemoryNotifier returns a sender whose messages are recorded by the
+// returned MemoryNotifier.
+func NewMemoryNotifier() (*TelegramSender, *MemoryNotifier) {
+	recorder := &MemoryNotifier{}
+	sender := NewTelegramSender(config.TelegramConfig{BotToken: "memory", ChatID: "memory"})
+	sender.Client = &http.Client{Transport: recorder}
+	return sender, recorder
+}
+
+// Messages returns the texts sent so far; documents are recorded as
+// "document: <caption>".
+func (n *MemoryNotifier) Messages() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.messages...)
+}
+
+// RoundTrip records a Telegram API call and answers it successfully.
+func (n *MemoryNotifier) RoundTrip(req *http.Request) (*http.Response, error) {
+	var message string
+	if strings.HasSuffix(req.URL.Path, "/sendDocument") {
+		if err := req.ParseMultipartForm(32 << 20); err != nil {
+			return nil, err
+		}
+		message = "document: " + req.FormValue("caption")
+	} else {
+		var payload struct {
+			Text string `json:"text"`
+		}
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		if err := sonic.Unmarshal(data, &payload); err != nil {
+			return nil, err
+		}
+		message = payload.Text
+	}
+
+	n.mu.Lock()
+	n.messages = append(n.messages, message)
+	id := len(n.messages)
+	n.mu.Unlock()
+
+	body := fmt.Sprintf(`{"ok":true,"result":{"message_id":%d}}`, id)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewBufferString(body)),
+		Request:    req,
+	}, nil
+}
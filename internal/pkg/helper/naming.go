@@ -0,0 +1,181 @@
+package helper
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TimestampLayout is the timestamp format embedded in artifact names.
+const TimestampLayout = "20060102_150405"
+
+// artifactNamePattern matches artifact file names produced by ArtifactFilename
+// and their manifests. Names from before run IDs were introduced have no
+// run ID suffix; the info suffix is optional (backup.name_suffix).
+var artifactNamePattern = regexp.MustCompile(`^(.+)_(\d{8}_\d{6})(?:_([0-9a-f]{8})(?:_([0-9A-Za-z.-]+))?)?\.zip(\.manifest\.json)?$`)
+
+// ArtifactInfo summarizes the content of an artifact for its file name and
+// object metadata, so listings are self-explanatory without the manifest.
+type ArtifactInfo struct {
+	Schemas       int
+	Tables        int
+	Engine        string
+	EngineVersion string
+}
+
+// NewArtifactInfo summarizes the schemas and dump engine of a manifest.
+func NewArtifactInfo(m *Manifest) ArtifactInfo {
+	info := ArtifactInfo{Schemas: len(m.Schemas), Engine: m.Engine, EngineVersion: m.EngineVersion}
+	for _, tables := range m.Schemas {
+		info.Tables += len(tables)
+	}
+	return info
+}
+
+// Suffix returns the info suffix made of fields, e.g.
+// "2schemas-40tables-mysqlsh-8.0.36". Counts are left out for artifacts
+// without dump schemas, and unknown engines and versions are left out too.
+func (i ArtifactInfo) Suffix(fields []string) string {
+	var parts []string
+	for _, field := range fields {
+		switch field {
+		case "schemas":
+			if i.Schemas > 0 {
+				parts = append(parts, fmt.Sprintf("%dschemas", i.Schemas))
+			}
+		case "tables":
+			if i.Schemas > 0 {
+				parts = append(parts, fmt.Sprintf("%dtables", i.Tables))
+			}
+		case "engine":
+			parts = append(parts, nameSafe(i.Engine))
+		case "version":
+			parts = append(parts, nameSafe(i.EngineVersion))
+		}
+	}
+	parts = slices.DeleteFunc(parts, func(p string) bool { return p == "" })
+	return strings.Join(parts, "-")
+}
+
+// Metadata returns the info as object metadata.
+func (i ArtifactInfo) Metadata() map[string]string {
+	metadata := make(map[string]string)
+	if i.Schemas > 0 {
+		metadata["schemas"] = strconv.Itoa(i.Schemas)
+		metadata["tables"] = strconv.Itoa(i.Tables)
+	}
+	if i.Engine != "" {
+		metadata["engine"] = i.Engine
+	}
+	if i.EngineVersion != "" {
+		metadata["engine-version"] = i.EngineVersion
+	}
+	return metadata
+}
+
+// nameSafe drops the characters not allowed in the info suffix.
+func nameSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// NewRunID returns a random identifier distinguishing the artifacts of runs
+// started within the same second.
+func NewRunID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate run id: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// EscapeName escapes a source name, such as a database name, for file names
+// and object keys. Letters of any script, digits, '-', '_' and '.' (except
+// leading) are kept; anything else, e.g. spaces, slashes or quotes, is
+// percent-encoded, so the name stays a single, portable path element.
+func EscapeName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' && i > 0 {
+			b.WriteRune(r)
+			continue
+		}
+		var buf [utf8.UTFMax]byte
+		for _, c := range buf[:utf8.EncodeRune(buf[:], r)] {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// UnescapeName reverses EscapeName. Names that are not escaped, e.g. of
+// artifacts from before names were escaped, are returned unchanged.
+func UnescapeName(name string) string {
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
+
+// ArtifactFilename returns the file name of an artifact:
+// "<name>_<timestamp>_<run id>.zip", or "<name>_<timestamp>_<run id>_<info>.zip"
+// with an info suffix. The name is escaped with EscapeName.
+func ArtifactFilename(name string, ts time.Time, runID, info string) string {
+	name = EscapeName(name)
+	if info != "" {
+		return fmt.Sprintf("%s_%s_%s_%s.zip", name, ts.Format(TimestampLayout), runID, info)
+	}
+	return fmt.Sprintf("%s_%s_%s.zip", name, ts.Format(TimestampLayout), runID)
+}
+
+// IsArtifactKey reports whether an object key names an artifact (or an artifact
+// manifest) created by this tool.
+func IsArtifactKey(key string) bool {
+	return artifactNamePattern.MatchString(path.Base(key))
+}
+
+// ArtifactTime returns the creation time embedded in an artifact key.
+func ArtifactTime(key string) (time.Time, bool) {
+	m := artifactNamePattern.FindStringSubmatch(path.Base(key))
+	if m == nil {
+		return time.Time{}, false
+	}
+	ts, err := time.ParseInLocation(TimestampLayout, m[2], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return ts, true
+}
+
+// ArtifactRunID returns the run ID embedded in an artifact key, or "" for
+// keys from before run IDs were introduced.
+func ArtifactRunID(key string) string {
+	m := artifactNamePattern.FindStringSubmatch(path.Base(key))
+	if m == nil {
+		return ""
+	}
+	return m[3]
+}
+
+// ArtifactName returns the name an artifact key was created with (the part
+// before the timestamp, unescaped), or "" if the key is not an artifact.
+func ArtifactName(key string) string {
+	m := artifactNamePattern.FindStringSubmatch(path.Base(key))
+	if m == nil {
+		return ""
+	}
+	return UnescapeName(m[1])
+}
@@ -0,0 +1,83 @@
+package helper
+
+import (
+	"testing"
+	"time"
+)
+
+// unusualNames are source names that need care in file names and object keys.
+var unusualNames = []string{
+	"shop",
+	"shop.eu",
+	".hidden",
+	"my db",
+	"a/b",
+	"50%_off",
+	"it's",
+	"данные",
+	"shop_20240101_120000",
+}
+
+func TestEscapeNameRoundTrip(t *testing.T) {
+	for _, name := range unusualNames {
+		escaped := EscapeName(name)
+		if got := UnescapeName(escaped); got != name {
+			t.Errorf("UnescapeName(EscapeName(%q)) = %q", name, got)
+		}
+		for _, r := range escaped {
+			if r == '/' || r == ' ' || r == '\'' {
+				t.Errorf("EscapeName(%q) = %q keeps %q", name, escaped, r)
+			}
+		}
+		if escaped[0] == '.' {
+			t.Errorf("EscapeName(%q) = %q starts with a dot", name, escaped)
+		}
+	}
+}
+
+func TestArtifactNameRoundTrip(t *testing.T) {
+	ts := time.Date(2025, 3, 4, 5, 6, 7, 0, time.Local)
+	for _, name := range unusualNames {
+		for _, info := range []string{"", "2schemas-40tables-mysqlsh-8.0.36"} {
+			key := "mysql/" + ArtifactFilename(name, ts, "0a1b2c3d", info)
+			if !IsArtifactKey(key) || !IsArtifactKey(ManifestKey(key)) {
+				t.Fatalf("IsArtifactKey(%q) = false", key)
+			}
+			if got := ArtifactName(key); got != name {
+				t.Errorf("ArtifactName(%q) = %q, want %q", key, got, name)
+			}
+			if got := ArtifactName(ManifestKey(key)); got != name {
+				t.Errorf("ArtifactName(%q) = %q, want %q", ManifestKey(key), got, name)
+			}
+			if got, ok := ArtifactTime(key); !ok || !got.Equal(ts) {
+				t.Errorf("ArtifactTime(%q) = %v, %v; want %v", key, got, ok, ts)
+			}
+			if got := ArtifactRunID(key); got != "0a1b2c3d" {
+				t.Errorf("ArtifactRunID(%q) = %q", key, got)
+			}
+		}
+	}
+}
+
+func TestHasTable(t *testing.T) {
+	m := &Manifest{Schemas: map[string][]string{
+		"shop":    {"orders"},
+		"shop.eu": {"orders", "v1.items"},
+	}}
+	for table, want := range map[string]bool{
+		"orders":             true,
+		"shop.orders":        true,
+		"shop.eu.orders":     true,
+		"v1.items":           true,
+		"shop.eu.v1.items":   true,
+		"eu.orders":          false,
+		"shop.items":         false,
+		"shop.v1.items":      false,
+		"shop.eu":            false,
+		"shop.eu.v1.missing": false,
+	} {
+		if got := m.HasTable(table); got != want {
+			t.Errorf("HasTable(%q) = %v, want %v", table, got, want)
+		}
+	}
+}
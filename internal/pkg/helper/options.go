@@ -0,0 +1,27 @@
+package helper
+
+import "context"
+
+// Options are the settings of a run given as global flags rather than in the
+// config file. The CLI puts them in the context of every command, which
+// passes them on to the storage, pipeline and workers it creates.
+type Options struct {
+	OnlyDump            bool        // --only-dump: keep backups in local.dir whatever storage.backend says
+	ConfirmLargeDeletes bool        // --confirm-large-delete: lift retention.confirm_threshold
+	Faults              FaultConfig // --fault-inject: never set in production
+	JSON                bool        // --output json: print command results as JSON on stdout
+}
+
+// optionsKey is the context key of the run options.
+type optionsKey struct{}
+
+// WithOptions returns a context carrying the options of the run.
+func WithOptions(ctx context.Context, opts Options) context.Context {
+	return context.WithValue(ctx, optionsKey{}, opts)
+}
+
+// OptionsFrom returns the options set by WithOptions, or the zero options.
+func OptionsFrom(ctx context.Context) Options {
+	opts, _ := ctx.Value(optionsKey{}).(Options)
+	return opts
+}
@@ -0,0 +1,80 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// PauseState is persisted by `backup pause` and removed by `backup resume-schedule`.
+type PauseState struct {
+	PausedAt   time.Time `json:"paused_at"`
+	Reason     string    `json:"reason,omitempty"`
+	RemindedAt time.Time `json:"reminded_at,omitempty"`
+}
+
+// LoadPause reads the pause file. It returns nil when backups are not paused.
+func LoadPause(path string) (*PauseState, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state PauseState
+	if err := sonic.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse pause file %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// SavePause writes the pause file.
+func SavePause(path string, state *PauseState) error {
+	data, err := sonic.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// CheckPaused reports whether backups are paused, in which case job must not
+// run. While paused, a reminder is sent every schedule.pause_reminder hours.
+// An unreadable pause file counts as paused, so a broken flag never lets
+// backups run during a migration.
+func CheckPaused(cfg *config.Config, notifier *TelegramSender, job string) bool {
+	path := cfg.Schedule.PauseFile
+	state, err := LoadPause(path)
+	if err != nil {
+		Infof("Skipping %s: pause file is unreadable: %v", job, err)
+		return true
+	}
+	if state == nil {
+		return false
+	}
+
+	paused := time.Since(state.PausedAt).Round(time.Minute)
+	reason := ""
+	if state.Reason != "" {
+		reason = fmt.Sprintf(" (%s)", state.Reason)
+	}
+	Infof("Skipping %s: backups paused for %s%s; run `backup resume-schedule` to resume", job, paused, reason)
+
+	interval := time.Duration(cfg.Schedule.PauseReminder) * time.Hour
+	if interval > 0 && paused >= interval && time.Since(state.RemindedAt) >= interval {
+		message := fmt.Sprintf("⏸️ Backups have been paused for %s%s; run `backup resume-schedule` to resume", paused, reason)
+		if err := notifier.Notify(job, SeverityAlert, message); err != nil {
+			Errorf("failed to send notification: %v", err)
+			return true
+		}
+		state.RemindedAt = time.Now()
+		if err := SavePause(path, state); err != nil {
+			Warnf("failed to save pause file: %v", err)
+		}
+	}
+	return true
+}
@@ -0,0 +1,777 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// Pipeline packages dump directories into encrypted artifacts and ships them
+// to storage, or to local storage in only-dump mode.
+type Pipeline struct {
+	cfg      *config.Config
+	store    Storage
+	mirrors  []mirror // storage.mirrors; empty in only-dump mode
+	wrapper  KeyWrapper
+	spool    *Spool // Nil when spooling is disabled
+	cache    *Cache // Nil when caching is disabled
+	runID    string // Shared by all artifacts shipped by this pipeline
+	usage    *UsageMonitor
+	quotas   map[string]*quotaState // Usage of the destinations with a storage.quota, by backend
+	pruned   []RetentionResult      // Outcomes of the retention runs, reported with the run
+	progress ProgressFunc           // Nil when nobody follows the progress
+	server   string                 // Server the dumps come from, when the source knows it
+	opts     Options
+}
+
+// NewPipeline creates a new artifact pipeline.
+func NewPipeline(cfg *config.Config, store Storage, opts Options) *Pipeline {
+	wrapper, err := NewKeyWrapper(cfg.Encryption.KMS)
+	if err != nil {
+		Warnf("envelope encryption disabled: %v", err)
+	}
+	if opts.OnlyDump {
+		store = WithFaults(NewLocalStorage(cfg.Local), opts.Faults)
+	}
+	var spool *Spool
+	if cfg.Backup.SpoolDir != "" && !opts.OnlyDump {
+		spool = NewSpool(cfg.Backup.SpoolDir, cfg.Backup.UploadChunkBytes())
+	}
+	var mirrors []mirror
+	if !opts.OnlyDump {
+		for _, backend := range cfg.Storage.Mirrors {
+			store, err := NewBackend(cfg, backend, opts)
+			if err != nil {
+				Warnf("failed to initialize mirror %s: %v", backend, err)
+			}
+			mirrors = append(mirrors, mirror{backend: backend, store: store, err: err})
+		}
+	}
+	return &Pipeline{
+		cfg:     cfg,
+		spool:   spool,
+		cache:   NewCache(cfg.Cache),
+		store:   store,
+		mirrors: mirrors,
+		wrapper: wrapper,
+		runID:   NewRunID(),
+		quotas:  make(map[string]*quotaState),
+		opts:    opts,
+	}
+}
+
+// Start starts measuring the resource usage of a run, reported by Report.
+// The returned function stops the measurement; defer it, so runs that end
+// before their report don't leave the sampler running.
+func (p *Pipeline) Start() (stop func()) {
+	usage := StartUsageMonitor(p.cfg.Backup.TempDir)
+	p.usage = usage
+	return func() { usage.Stop() }
+}
+
+// SetProgress sets the function receiving the zip, upload and done stages of
+// the artifacts shipped by the pipeline.
+func (p *Pipeline) SetProgress(progress ProgressFunc) {
+	p.progress = progress
+}
+
+// SetServer records the server (host:port) the dumps shipped next were taken
+// from in their manifests and object metadata.
+func (p *Pipeline) SetServer(server string) {
+	p.server = server
+}
+
+// SelfTest runs the storage self-test before a job's long dump stage, when
+// enabled. Failures are reported through the notifier.
+func (p *Pipeline) SelfTest(ctx context.Context, notifier *TelegramSender, job string) error {
+	if p.opts.OnlyDump || !p.cfg.R2.SelfTest {
+		return nil
+	}
+	if err := p.store.SelfTest(ctx); err != nil {
+		err = fmt.Errorf("storage self-test failed: %w", err)
+		if notifyErr := notifier.Notify(job, SeverityAlert, fmt.Sprintf("❌ %s backup aborted: %v", job, err)); notifyErr != nil {
+			Errorf("failed to send notification: %v", notifyErr)
+		}
+		return err
+	}
+	Infof("Storage self-test passed")
+	return nil
+}
+
+// Ship zips srcDir into an artifact named by ArtifactFilename, hashes it and uploads it.
+// When flatten is set, directory structure inside srcDir is discarded.
+func (p *Pipeline) Ship(ctx context.Context, name, srcDir string, timeNow time.Time, flatten bool) BackupResult {
+	schemas, err := ReadDumpSchemas(srcDir)
+	if err != nil {
+		Warnf("failed to collect schemas for manifest of %s: %v", name, err)
+	}
+	engine, engineVersion := ReadDumpEngine(srcDir)
+	info := NewArtifactInfo(&Manifest{Schemas: schemas, Engine: engine, EngineVersion: engineVersion})
+	metadata := info.Metadata()
+	metadata["source"] = name
+	metadata["created"] = timeNow.UTC().Format(time.RFC3339)
+	if version := ToolVersion(); version != "" {
+		metadata["tool-version"] = version
+	}
+	if p.server != "" {
+		metadata["server"] = p.server
+	}
+
+	zipFilename := ArtifactFilename(name, timeNow, p.runID, info.Suffix(p.cfg.Backup.NameSuffix))
+	localZipPath := filepath.Join(p.cfg.Backup.TempDir, zipFilename)
+
+	password, encryption, err := p.password(ctx)
+	if err != nil {
+		return BackupResult{Database: name, Success: false, Error: err}
+	}
+
+	zip := ZipEncryptTree
+	if flatten {
+		zip = ZipEncryptFolder
+	}
+	p.progress.report(StageZip, zipFilename, 0, -1)
+	if err := zip(ctx, p.cfg.Backup.Priority, password, srcDir, localZipPath); err != nil {
+		return BackupResult{Database: name, Success: false, Error: fmt.Errorf("zip encryption failed: %w", err)}
+	}
+	if err := corruptArtifact(localZipPath, p.opts.Faults); err != nil {
+		return BackupResult{Database: name, Success: false, Error: err}
+	}
+	size := int64(-1)
+	if info, err := os.Stat(localZipPath); err == nil {
+		size = info.Size()
+	}
+	if err := checkArtifactSize(zipFilename, size, p.cfg.Backup.MinArtifactBytes); err != nil {
+		os.Remove(localZipPath)
+		return BackupResult{Database: name, Success: false, Error: err}
+	}
+	if p.cfg.R2.SHA256Metadata && !p.opts.OnlyDump {
+		hash, _, err := CalculateSHA256(ctx, localZipPath, p.cfg.Backup.IOLimitBytes())
+		if err != nil {
+			return BackupResult{Database: name, Success: false, Error: fmt.Errorf("failed to hash artifact: %w", err)}
+		}
+		metadata["sha256"] = hash
+	}
+	ctx = WithObjectMetadata(ctx, metadata)
+	// Cleanup zip file based on config, unless its upload is resumed later
+	resume := false
+	defer func() {
+		if resume {
+			return
+		}
+		os.Remove(ManifestKey(localZipPath))
+		if p.cfg.Backup.DeleteAfterUpload {
+			os.Remove(localZipPath)
+		}
+	}()
+	if !p.cfg.Backup.DeleteAfterUpload {
+		Debugf("Keeping zip file: %s", localZipPath)
+	}
+
+	newManifest := func(hash string, size int64) *Manifest {
+		return &Manifest{
+			Artifact:   zipFilename,
+			Source:     name,
+			CreatedAt:  timeNow,
+			Size:       size,
+			SHA256:     hash,
+			Schemas:    schemas,
+			Kind:       ChainFull,
+			Encryption: encryption,
+
+			Engine:        engine,
+			EngineVersion: engineVersion,
+			Server:        p.server,
+		}
+	}
+
+	// A chunked upload cut short by the process stopping is resumed by the
+	// next run, which needs the manifest to finish it
+	resumable := !p.opts.OnlyDump && p.cfg.Backup.UploadChunkBytes() > 0
+	if resumable {
+		if err := writeManifestFile(localZipPath, newManifest("", 0)); err != nil {
+			Warnf("failed to save manifest for resuming %s: %v", zipFilename, err)
+			resumable = false
+		}
+	}
+
+	// The hash is computed while streaming, saving a full read of the artifact
+	key := p.store.ObjectKey(name, timeNow, zipFilename)
+	uploaded, err := p.uploadWithinWindow(ctx, p.backend(), p.store, key, localZipPath)
+	mirrors := p.shipMirrors(ctx, name, timeNow, zipFilename, localZipPath, newManifest)
+	if err != nil {
+		if resumable && ctx.Err() != nil && !errors.Is(err, ErrObjectExists) {
+			resume = true
+			Infof("Upload of %s interrupted, the next run resumes it from %s", key, localZipPath)
+			return BackupResult{Database: name, Success: false, Error: fmt.Errorf("upload interrupted, resumed by the next run: %w", err), Mirrors: mirrors}
+		}
+		if p.spool == nil || errors.Is(err, ErrObjectExists) || errors.Is(err, ErrQuotaExceeded) {
+			discardChunked(ctx, p.store, localZipPath)
+			return BackupResult{Database: name, Success: false, Error: fmt.Errorf("upload failed: %w", err), Mirrors: mirrors}
+		}
+		res := p.enqueue(ctx, name, key, localZipPath, newManifest, err)
+		res.Mirrors = mirrors
+		return res
+	}
+	hash, size := uploaded.SHA256, uploaded.Size
+	if !p.opts.OnlyDump {
+		p.usage.AddUploaded(size)
+	}
+	if size == 0 || hash == "" {
+		return BackupResult{Database: name, Success: false, Error: fmt.Errorf("upload failed: %w", &ArtifactSizeError{Artifact: key}), Mirrors: mirrors}
+	}
+	verified, err := p.verifyUpload(ctx, key, hash)
+	if err != nil {
+		return BackupResult{Database: name, Success: false, Size: size, SHA256: hash, Error: fmt.Errorf("uploaded artifact failed verification: %w", err), Mirrors: mirrors}
+	}
+
+	manifest := newManifest(hash, size)
+	if err := saveManifest(ctx, p.store, key, manifest); err != nil {
+		if encryption != nil {
+			return BackupResult{Database: name, Success: false, Error: fmt.Errorf("failed to save manifest holding the wrapped key: %w", err)}
+		}
+		Warnf("failed to save manifest for %s: %v", key, err)
+	}
+	if p.cache != nil && !p.opts.OnlyDump {
+		if err := p.cache.Put(key, localZipPath, manifest); err != nil {
+			Warnf("failed to cache %s: %v", key, err)
+		}
+	}
+
+	p.progress.report(StageDone, key, size, size)
+	return BackupResult{
+		Database: name,
+		Success:  true,
+		Size:     size,
+		SHA256:   hash,
+		Verified: verified,
+		Manifest: manifest,
+		Mirrors:  mirrors,
+	}
+}
+
+// verifyUpload checks an artifact uploaded with the given SHA256 as
+// backup.verify_upload asks: that storage holds it, or that downloading it
+// again yields the same checksum. It returns the check made, if any, or
+// Unverified when write-only credentials may not check for the artifact.
+func (p *Pipeline) verifyUpload(ctx context.Context, key, hash string) (string, error) {
+	switch method := p.cfg.Backup.VerifyUpload; method {
+	case "exists":
+		exists, err := p.store.Exists(ctx, key)
+		if errors.Is(err, ErrExistsUnknown) {
+			Warnf("upload of %s left unverified: %v", key, err)
+			return Unverified, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return "", fmt.Errorf("%s is missing from storage", key)
+		}
+		return method, nil
+	case "checksum":
+		h := sha256.New()
+		if err := p.store.Download(ctx, key, h); err != nil {
+			return "", fmt.Errorf("failed to download %s: %w", key, err)
+		}
+		if stored := fmt.Sprintf("%x", h.Sum(nil)); stored != hash {
+			return "", fmt.Errorf("stored %s has SHA256 %s, expected %s", key, stored, hash)
+		}
+		return method, nil
+	}
+	return "", nil
+}
+
+// mirror is a further destination of every artifact (storage.mirrors). store
+// is nil when the backend failed to initialize.
+type mirror struct {
+	backend string
+	store   Storage
+	err     error
+}
+
+// shipMirrors uploads an artifact and its manifest to every mirror, whatever
+// the outcome of the primary upload.
+func (p *Pipeline) shipMirrors(ctx context.Context, name string, timeNow time.Time, zipFilename, localZipPath string, newManifest func(string, int64) *Manifest) []MirrorResult {
+	var results []MirrorResult
+	for _, m := range p.mirrors {
+		result := MirrorResult{Backend: m.backend, Error: m.err}
+		if m.store != nil {
+			result.Key = m.store.ObjectKey(name, timeNow, zipFilename)
+			uploaded, err := p.uploadWithinWindow(ctx, m.backend, m.store, result.Key, localZipPath)
+			if err == nil {
+				err = saveManifest(ctx, m.store, result.Key, newManifest(uploaded.SHA256, uploaded.Size))
+			}
+			if err == nil {
+				p.usage.AddUploaded(uploaded.Size)
+			}
+			result.Error = err
+		}
+		if result.Error != nil {
+			Warnf("failed to upload %s to mirror %s: %v", zipFilename, m.backend, result.Error)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// RetentionResult is the outcome of a retention run on one storage.
+type RetentionResult struct {
+	Backend string
+	RetentionStats
+	Error error
+}
+
+// EnforceRetention enforces retention on the storage the pipeline ships to
+// and on its mirrors, within the limits and window of the retention section.
+// With retention.protect_chains, artifacts needed by unexpired chains are kept.
+// The outcomes are included in the run's report.
+func (p *Pipeline) EnforceRetention(ctx context.Context, retention RetentionFunc) error {
+	if !p.cfg.Retention.InWindow(time.Now()) {
+		Infof("Retention: outside the deletion window %s, skipped", p.cfg.Retention.Window)
+		return nil
+	}
+	limits := p.retentionLimits()
+	var err error
+	for i, target := range p.retentionTargets() {
+		stats, targetErr := p.enforceRetention(ctx, target.backend, target.store, retention, limits)
+		p.pruned = append(p.pruned, RetentionResult{Backend: target.backend, RetentionStats: stats, Error: targetErr})
+		if targetErr != nil && i > 0 {
+			targetErr = fmt.Errorf("mirror %s: %w", target.backend, targetErr)
+		}
+		err = errors.Join(err, targetErr)
+	}
+	return err
+}
+
+// retentionLimits returns the limits of a retention run.
+func (p *Pipeline) retentionLimits() RetentionLimits {
+	return RetentionLimits{
+		MaxDeletions: p.cfg.Retention.MaxDeletions,
+		MaxBytes:     int64(p.cfg.Retention.MaxDeletedMB) << 20,
+	}
+}
+
+// backend returns the name of the backend the pipeline ships to.
+func (p *Pipeline) backend() string {
+	if p.opts.OnlyDump {
+		return "local"
+	}
+	return p.cfg.Storage.Backend
+}
+
+// retentionTargets returns the storage retention applies to, followed by the
+// mirrors that were initialized.
+func (p *Pipeline) retentionTargets() []mirror {
+	targets := []mirror{{backend: p.backend(), store: p.store}}
+	for _, m := range p.mirrors {
+		if m.store != nil {
+			targets = append(targets, m)
+		}
+	}
+	return targets
+}
+
+// RetentionPreview lists the artifacts retention would delete from a storage.
+type RetentionPreview struct {
+	Backend string       `json:"backend"`
+	Expired []ObjectInfo `json:"expired"`
+	Capped  bool         `json:"capped"` // More artifacts are expired than the limits of a run allow
+}
+
+// PreviewRetention returns the artifacts EnforceRetention would delete from
+// the storage and each mirror, without deleting anything. With
+// retention.protect_chains, artifacts needed by unexpired chains are left out.
+func (p *Pipeline) PreviewRetention(ctx context.Context, retention RetentionFunc) ([]RetentionPreview, error) {
+	limits := p.retentionLimits()
+	var previews []RetentionPreview
+	for _, target := range p.retentionTargets() {
+		preview, err := p.previewRetention(ctx, target.store, retention, limits)
+		if err != nil {
+			return previews, fmt.Errorf("%s: %w", target.backend, err)
+		}
+		preview.Backend = target.backend
+		previews = append(previews, preview)
+	}
+	return previews, nil
+}
+
+func (p *Pipeline) previewRetention(ctx context.Context, store Storage, retention RetentionFunc, limits RetentionLimits) (RetentionPreview, error) {
+	var preview RetentionPreview
+	if p.cfg.Retention.ProtectChains {
+		protected, err := ProtectChains(ctx, store, retention)
+		if err != nil {
+			return preview, fmt.Errorf("failed to resolve backup chains: %w", err)
+		}
+		retention = protected
+	}
+	objects, err := store.List(ctx)
+	if err != nil {
+		return preview, err
+	}
+	now := time.Now()
+	var expiredBytes int64
+	for _, object := range objects {
+		if !IsArtifactKey(object.Key) || !isExpired(object, retention, now) {
+			continue
+		}
+		if limits.reached(len(preview.Expired), expiredBytes, object.Size) {
+			preview.Capped = true
+			break
+		}
+		expiredBytes += object.Size
+		preview.Expired = append(preview.Expired, object)
+	}
+	return preview, nil
+}
+
+func (p *Pipeline) enforceRetention(ctx context.Context, backend string, store Storage, retention RetentionFunc, limits RetentionLimits) (RetentionStats, error) {
+	if ttl := p.cfg.Retention.LeaseDuration(); ttl > 0 {
+		hostname, _ := os.Hostname()
+		release, err := AcquireLease(ctx, store, ttl, hostname+"/"+p.runID)
+		if errors.Is(err, ErrLeaseHeld) {
+			Infof("Retention of %s skipped: %v", backend, err)
+			return RetentionStats{}, nil
+		}
+		if err != nil {
+			return RetentionStats{}, fmt.Errorf("failed to acquire retention lease: %w", err)
+		}
+		defer release()
+	}
+	if p.cfg.Retention.ProtectChains {
+		protected, err := ProtectChains(ctx, store, retention)
+		if err != nil {
+			return RetentionStats{}, fmt.Errorf("failed to resolve backup chains: %w", err)
+		}
+		retention = protected
+	}
+	confirm, approve := p.cfg.Retention.ConfirmThreshold, p.cfg.Approval.Threshold
+	if (confirm > 0 && !p.opts.ConfirmLargeDeletes) || approve > 0 {
+		keys, err := expiredKeys(ctx, store, retention, limits)
+		if err != nil {
+			return RetentionStats{}, err
+		}
+		count := len(keys)
+		if confirm > 0 && !p.opts.ConfirmLargeDeletes && count > confirm {
+			return RetentionStats{}, fmt.Errorf("retention would delete %d backups, more than retention.confirm_threshold (%d); run with --confirm-large-delete if this is intended", count, confirm)
+		}
+		// The approval covers exactly these keys; a run deleting others needs its own
+		summary := fmt.Sprintf("retention deleting %d backups from %s", count, backend)
+		if err := RequireApproval(p.cfg, "retention", backend+"\n"+strings.Join(keys, "\n"), count, summary); err != nil {
+			return RetentionStats{}, err
+		}
+		retention = onlyKeys(retention, keys)
+	}
+	return store.EnforceRetention(ctx, retention, limits)
+}
+
+// expiredKeys returns the sorted keys of the artifacts a retention run would
+// delete from a storage, within the limits of a run.
+func expiredKeys(ctx context.Context, store Storage, retention RetentionFunc, limits RetentionLimits) ([]string, error) {
+	objects, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var keys []string
+	var expiredBytes int64
+	for _, object := range objects {
+		if !IsArtifactKey(object.Key) || !isExpired(object, retention, now) {
+			continue
+		}
+		if limits.reached(len(keys), expiredBytes, object.Size) {
+			break
+		}
+		expiredBytes += object.Size
+		keys = append(keys, object.Key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// onlyKeys keeps every artifact but the given ones, so a retention run deletes
+// no more than was counted, confirmed and approved, should others expire
+// meanwhile.
+func onlyKeys(retention RetentionFunc, keys []string) RetentionFunc {
+	allowed := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		allowed[key] = true
+	}
+	return func(key string) int {
+		if !allowed[key] {
+			return 0
+		}
+		return retention(key)
+	}
+}
+
+// PruneLocal enforces retention.hours on local storage in only-dump mode, so
+// local-only hosts don't fill up. Remote storage is pruned by the mysql job.
+func (p *Pipeline) PruneLocal(ctx context.Context) {
+	if !p.opts.OnlyDump {
+		return
+	}
+	if err := p.EnforceRetention(ctx, FixedRetention(p.cfg.Retention.Hours)); err != nil {
+		Errorf("failed to enforce retention policy: %v", err)
+	}
+}
+
+// Report sends the report of a job's run together with the outcomes of its
+// retention runs and its resource usage since Start, which is also appended
+// to backup.metrics_file. The results are recorded in the backup history when
+// enabled, with successes lacking a size or checksum turned into failures.
+// Destinations whose uploads were stopped by their quota are alerted
+// separately.
+func (p *Pipeline) Report(notifier *TelegramSender, job string, results []BackupResult, success, fail int) {
+	// A success without content would read as a backup that restores
+	for i, res := range results {
+		if res.Success && (res.Size <= 0 || res.SHA256 == "") {
+			results[i].Success = false
+			results[i].Error = &ArtifactSizeError{Artifact: res.Database, Size: res.Size}
+			success, fail = success-1, fail+1
+		}
+	}
+	usage := p.usage.Stop()
+	logUsage(p.cfg.Backup.MetricsFile, job, success, fail, usage)
+	recordHistory(p.cfg, job, p.runID, results)
+	SendReport(notifier, job, results, p.pruned, success, fail, &usage)
+	if alert := p.quotaAlert(job); alert != "" {
+		Warnf("%s", alert)
+		if err := notifier.Notify(job, SeverityAlert, alert); err != nil {
+			Errorf("failed to send notification: %v", err)
+		}
+	}
+}
+
+// uploadWithinWindow uploads an artifact file within backup.upload_window
+// and the quota of its destination. An upload still running when the window
+// closes is cut off; queued, it resumes from its last chunk in a later run.
+func (p *Pipeline) uploadWithinWindow(ctx context.Context, backend string, store Storage, key, path string) (UploadResult, error) {
+	if p.opts.OnlyDump {
+		return p.uploadWithinQuota(ctx, backend, store, key, path)
+	}
+	uploadCtx, cancel, err := UploadWindowContext(ctx, p.cfg.Backup)
+	defer cancel()
+	if err != nil {
+		return UploadResult{}, err
+	}
+	uploaded, err := p.uploadWithinQuota(uploadCtx, backend, store, key, path)
+	if err != nil && windowClosed(ctx, uploadCtx) {
+		err = fmt.Errorf("%w: it closed during the upload", ErrUploadWindowClosed)
+	}
+	return uploaded, err
+}
+
+// uploadBackoff is the wait before the first upload retry; later retries
+// wait quadratically longer.
+var uploadBackoff = 10 * time.Second
+
+// upload uploads an artifact file, retrying transient failures with backoff.
+func (p *Pipeline) upload(ctx context.Context, store Storage, key, path string) (UploadResult, error) {
+	var lastErr error
+	for attempt := 0; attempt <= p.cfg.Backup.UploadRetries; attempt++ {
+		if attempt > 0 {
+			wait := time.Duration(attempt*attempt) * uploadBackoff
+			Warnf("upload of %s failed (%v), retrying in %s", key, lastErr, wait)
+			select {
+			case <-ctx.Done():
+				return UploadResult{}, ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return UploadResult{}, fmt.Errorf("open file failed: %w", err)
+		}
+		var content io.Reader = Throttle(ctx, file, p.cfg.Backup.IOLimitBytes())
+		if p.progress != nil {
+			total := int64(-1)
+			if info, err := file.Stat(); err == nil {
+				total = info.Size()
+			}
+			content = &progressReader{r: content, progress: p.progress, stage: StageUpload, item: key, total: total}
+		}
+		// Only artifacts for the primary storage are queued, so only they resume in a later run
+		var chunkSize int64
+		if store == p.store {
+			chunkSize = p.cfg.Backup.UploadChunkBytes()
+		}
+		uploaded, err := uploadArtifact(ctx, store, key, path, content, chunkSize)
+		file.Close()
+		if err == nil || errors.Is(err, ErrObjectExists) {
+			return uploaded, err
+		}
+		if ctx.Err() != nil {
+			return UploadResult{}, ctx.Err() // Interrupted: no point in retrying
+		}
+		lastErr = err
+	}
+	return UploadResult{}, lastErr
+}
+
+// enqueue moves an artifact that failed to upload into the spool, so it is
+// uploaded by a later run instead of being lost.
+func (p *Pipeline) enqueue(ctx context.Context, name, key, localZipPath string, newManifest func(string, int64) *Manifest, uploadErr error) BackupResult {
+	hash, size, err := CalculateSHA256(ctx, localZipPath, p.cfg.Backup.IOLimitBytes())
+	if err != nil {
+		return BackupResult{Database: name, Success: false, Error: fmt.Errorf("upload failed: %w (spooling failed: %v)", uploadErr, err)}
+	}
+	manifest := newManifest(hash, size)
+	data, err := manifest.Marshal()
+	if err == nil {
+		err = p.spool.Enqueue(SpoolEntry{
+			Key:      key,
+			Source:   name,
+			QueuedAt: time.Now(),
+			Error:    uploadErr.Error(),
+		}, localZipPath, data)
+	}
+	if err != nil {
+		return BackupResult{Database: name, Success: false, Error: fmt.Errorf("upload failed: %w (spooling failed: %v)", uploadErr, err)}
+	}
+
+	Infof("Queued %s in %s for upload on the next run", key, p.cfg.Backup.SpoolDir)
+	return BackupResult{
+		Database: name,
+		Success:  false,
+		Size:     size,
+		SHA256:   hash,
+		Error:    fmt.Errorf("upload failed, queued for retry: %w", uploadErr),
+		Manifest: manifest,
+	}
+}
+
+// FlushSpool resumes the uploads interrupted by earlier runs and uploads the
+// artifacts they queued, within the upload window. Failures are logged and
+// the artifacts stay queued.
+func (p *Pipeline) FlushSpool(ctx context.Context) {
+	if p.opts.OnlyDump || (p.spool == nil && p.cfg.Backup.UploadChunkBytes() == 0) {
+		return
+	}
+	uploadCtx, cancel, err := UploadWindowContext(ctx, p.cfg.Backup)
+	defer cancel()
+	if err != nil {
+		Infof("Upload queue: %v, flushed later", err)
+		return
+	}
+	p.resumeUploads(uploadCtx)
+	if p.spool == nil {
+		return
+	}
+	uploaded, err := p.spool.Flush(uploadCtx, p.store)
+	if uploaded > 0 {
+		Infof("Uploaded %d queued backups", uploaded)
+	}
+	if windowClosed(ctx, uploadCtx) {
+		Infof("Upload queue: the upload window closed, the remaining backups are flushed in the next one")
+	} else if err != nil {
+		Warnf("failed to flush upload queue: %v", err)
+	}
+}
+
+// resumeUploads finishes the chunked uploads of artifacts left in
+// backup.temp_dir by runs that stopped during the upload, from their last
+// stored chunk. Runs hold the lock file, so none of these uploads is still
+// going on. Uploads failing again are queued in backup.spool_dir when it is
+// set, and retried by the next run otherwise.
+func (p *Pipeline) resumeUploads(ctx context.Context) {
+	statePaths, err := filepath.Glob(filepath.Join(p.cfg.Backup.TempDir, "*"+chunkStateSuffix))
+	if err != nil {
+		Warnf("failed to look for interrupted uploads: %v", err)
+		return
+	}
+	for _, statePath := range statePaths {
+		if ctx.Err() != nil {
+			return
+		}
+		path := strings.TrimSuffix(statePath, chunkStateSuffix)
+		manifest, err := ReadManifestFile(path)
+		if err != nil || manifest == nil {
+			// The manifest may hold the only copy of the wrapped data key
+			Warnf("discarding interrupted upload of %s without its manifest", path)
+			discardChunked(ctx, p.store, path)
+			continue
+		}
+		key := p.store.ObjectKey(manifest.Source, manifest.CreatedAt, manifest.Artifact)
+		Infof("Resuming interrupted upload of %s", key)
+
+		uploaded, err := p.uploadWithinQuota(ctx, p.backend(), p.store, key, path)
+		if errors.Is(err, ErrObjectExists) {
+			// Completed before the run stopped, but maybe without its manifest
+			uploaded.SHA256, uploaded.Size, err = CalculateSHA256(ctx, path, p.cfg.Backup.IOLimitBytes())
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if p.spool == nil {
+				Warnf("resumed upload of %s failed, retried by the next run: %v", key, err)
+				continue
+			}
+			res := p.enqueue(ctx, manifest.Source, key, path, func(hash string, size int64) *Manifest {
+				manifest.SHA256, manifest.Size = hash, size
+				return manifest
+			}, err)
+			os.Remove(ManifestKey(path)) // The spool keeps its own copy
+			Warnf("resumed upload of %s: %v", key, res.Error)
+			continue
+		}
+
+		p.usage.AddUploaded(uploaded.Size)
+		manifest.SHA256, manifest.Size = uploaded.SHA256, uploaded.Size
+		if err := saveManifest(ctx, p.store, key, manifest); err != nil && !errors.Is(err, ErrObjectExists) {
+			Warnf("failed to save manifest for %s: %v", key, err)
+			continue // Retried with the upload, which is found complete
+		}
+		os.Remove(ManifestKey(path))
+		if p.cfg.Backup.DeleteAfterUpload {
+			os.Remove(path)
+		}
+		Infof("Completed interrupted upload of %s", key)
+	}
+}
+
+// saveManifest stores the manifest next to the artifact.
+func saveManifest(ctx context.Context, store Storage, key string, manifest *Manifest) error {
+	data, err := manifest.Marshal()
+	if err != nil {
+		return fmt.Errorf("manifest encoding failed: %w", err)
+	}
+	return store.Upload(ctx, ManifestKey(key), bytes.NewReader(data))
+}
+
+// password returns the zip password for a new artifact. With envelope
+// encryption every artifact gets its own data key, wrapped by the KMS and
+// recorded in the manifest.
+func (p *Pipeline) password(ctx context.Context) (string, *EncryptionInfo, error) {
+	if p.cfg.Encryption.KMS.Provider == "" {
+		return p.cfg.Encryption.Password, nil, nil
+	}
+	if p.wrapper == nil {
+		return "", nil, fmt.Errorf("kms provider %q is not available", p.cfg.Encryption.KMS.Provider)
+	}
+
+	key, password, err := NewDataKey()
+	if err != nil {
+		return "", nil, err
+	}
+	wrapped, err := p.wrapper.Wrap(ctx, key)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	return password, &EncryptionInfo{
+		Provider:   p.cfg.Encryption.KMS.Provider,
+		KeyID:      p.cfg.Encryption.KMS.KeyID,
+		WrappedKey: wrapped,
+	}, nil
+}
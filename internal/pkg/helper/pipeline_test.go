@@ -0,0 +1,227 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// testConfig returns a config shipping from temporary directories without
+// retries, encryption or verification.
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Backup.TempDir = t.TempDir()
+	cfg.Backup.DeleteAfterUpload = true
+	cfg.Local.Dir = t.TempDir()
+	return cfg
+}
+
+// testDump creates a dump directory holding a single file.
+func testDump(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "shop.sql"), []byte(strings.Repeat("INSERT INTO t VALUES (1);\n", 100)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// artifactKeys returns the keys of the artifacts held by a storage.
+func artifactKeys(t *testing.T, store Storage) []string {
+	t.Helper()
+	objects, err := store.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, object := range objects {
+		if IsArtifactKey(object.Key) && !strings.HasSuffix(object.Key, ManifestSuffix) {
+			keys = append(keys, object.Key)
+		}
+	}
+	return keys
+}
+
+func TestShipUploadsArtifactAndManifest(t *testing.T) {
+	cfg := testConfig(t)
+	store := NewMemoryStorage("")
+	p := NewPipeline(cfg, store, Options{})
+
+	res := p.Ship(context.Background(), "shop", testDump(t), time.Now(), false)
+	if !res.Success {
+		t.Fatalf("Ship failed: %v", res.Error)
+	}
+	keys := artifactKeys(t, store)
+	if len(keys) != 1 {
+		t.Fatalf("stored artifacts = %v, want 1", keys)
+	}
+	manifest, err := LoadManifest(context.Background(), store, keys[0])
+	if err != nil || manifest == nil {
+		t.Fatalf("LoadManifest = %v, %v", manifest, err)
+	}
+	if manifest.SHA256 != res.SHA256 || manifest.Size != res.Size {
+		t.Errorf("manifest has %s/%d, result %s/%d", manifest.SHA256, manifest.Size, res.SHA256, res.Size)
+	}
+}
+
+func TestShipRetriesFailedUpload(t *testing.T) {
+	defer func(wait time.Duration) { uploadBackoff = wait }(uploadBackoff)
+	uploadBackoff = time.Millisecond
+
+	cfg := testConfig(t)
+	cfg.Backup.UploadRetries = 1
+	mem := NewMemoryStorage("")
+	store := WithFaults(mem, FaultConfig{UploadEvery: 2})
+	// Make the artifact upload the second one, failing once
+	if err := store.Upload(context.Background(), "warmup", strings.NewReader("x")); err != nil {
+		t.Fatal(err)
+	}
+	p := NewPipeline(cfg, store, Options{})
+
+	res := p.Ship(context.Background(), "shop", testDump(t), time.Now(), false)
+	if !res.Success {
+		t.Fatalf("Ship failed despite a retry: %v", res.Error)
+	}
+	if keys := artifactKeys(t, mem); len(keys) != 1 {
+		t.Fatalf("stored artifacts = %v, want 1", keys)
+	}
+}
+
+func TestShipFailsWithoutRetries(t *testing.T) {
+	cfg := testConfig(t)
+	store := WithFaults(NewMemoryStorage(""), FaultConfig{UploadEvery: 1})
+	p := NewPipeline(cfg, store, Options{})
+
+	res := p.Ship(context.Background(), "shop", testDump(t), time.Now(), false)
+	if res.Success {
+		t.Fatal("Ship succeeded although every upload fails")
+	}
+	if !strings.Contains(res.Error.Error(), "injected fault") {
+		t.Errorf("error = %v, want the injected fault", res.Error)
+	}
+}
+
+func TestShipSpoolsFailedUpload(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Backup.SpoolDir = t.TempDir()
+	mem := NewMemoryStorage("")
+	p := NewPipeline(cfg, WithFaults(mem, FaultConfig{UploadEvery: 1}), Options{})
+
+	res := p.Ship(context.Background(), "shop", testDump(t), time.Now(), false)
+	if res.Success || !strings.Contains(res.Error.Error(), "queued for retry") {
+		t.Fatalf("Ship = %v, %v; want queued", res.Success, res.Error)
+	}
+	spool := NewSpool(cfg.Backup.SpoolDir, 0)
+	entries, err := spool.Entries()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("spool entries = %v, %v; want 1", entries, err)
+	}
+
+	// Once storage is reachable again, the next run uploads the queue
+	NewPipeline(cfg, mem, Options{}).FlushSpool(context.Background())
+	if keys := artifactKeys(t, mem); len(keys) != 1 || keys[0] != entries[0].Key {
+		t.Fatalf("stored artifacts = %v, want %s", keys, entries[0].Key)
+	}
+	if entries, _ := spool.Entries(); len(entries) != 0 {
+		t.Errorf("spool still holds %v", entries)
+	}
+}
+
+// droppingStorage acknowledges artifact uploads without storing them, as a
+// storage losing writes would.
+type droppingStorage struct {
+	*MemoryStorage
+}
+
+func (s droppingStorage) Upload(ctx context.Context, key string, content io.Reader) error {
+	if IsArtifactKey(key) && !strings.HasSuffix(key, ManifestSuffix) {
+		_, err := io.Copy(io.Discard, content)
+		return err
+	}
+	return s.MemoryStorage.Upload(ctx, key, content)
+}
+
+func TestShipFailsVerification(t *testing.T) {
+	for _, method := range []string{"exists", "checksum"} {
+		t.Run(method, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Backup.VerifyUpload = method
+			p := NewPipeline(cfg, droppingStorage{NewMemoryStorage("")}, Options{})
+
+			res := p.Ship(context.Background(), "shop", testDump(t), time.Now(), false)
+			if res.Success || !strings.Contains(res.Error.Error(), "failed verification") {
+				t.Fatalf("Ship = %v, %v; want a verification failure", res.Success, res.Error)
+			}
+		})
+	}
+}
+
+func TestShipVerifiesUpload(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Backup.VerifyUpload = "checksum"
+	p := NewPipeline(cfg, NewMemoryStorage(""), Options{})
+
+	res := p.Ship(context.Background(), "shop", testDump(t), time.Now(), false)
+	if !res.Success || res.Verified != "checksum" {
+		t.Fatalf("Ship = %v, %q, %v; want verified by checksum", res.Success, res.Verified, res.Error)
+	}
+}
+
+// forbiddenStorage may not check for objects, as with write-only credentials.
+type forbiddenStorage struct {
+	*MemoryStorage
+}
+
+func (s forbiddenStorage) Exists(ctx context.Context, key string) (bool, error) {
+	return false, fmt.Errorf("%w: %s: Access Denied", ErrExistsUnknown, key)
+}
+
+func TestShipLeavesUploadUnverified(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Backup.VerifyUpload = "exists"
+	mem := NewMemoryStorage("")
+	p := NewPipeline(cfg, forbiddenStorage{mem}, Options{})
+
+	res := p.Ship(context.Background(), "shop", testDump(t), time.Now(), false)
+	if !res.Success || res.Verified != Unverified {
+		t.Fatalf("Ship = %v, %q, %v; want an unverified success", res.Success, res.Verified, res.Error)
+	}
+	if keys := artifactKeys(t, mem); len(keys) != 1 {
+		t.Fatalf("stored artifacts = %v, want 1", keys)
+	}
+}
+
+func TestReportOutcome(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Backup.SpoolDir = t.TempDir()
+	mem := NewMemoryStorage("")
+	p := NewPipeline(cfg, WithFaults(mem, FaultConfig{UploadEvery: 1}), Options{})
+	stop := p.Start()
+	defer stop()
+
+	results := []BackupResult{
+		p.Ship(context.Background(), "shop", testDump(t), time.Now(), false),
+		{Database: "empty", Success: true}, // Lacks a size and checksum
+	}
+	notifier, recorder := NewMemoryNotifier()
+	p.Report(notifier, "mysql", results, 1, 1)
+
+	messages := recorder.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("messages = %q, want 1 report", messages)
+	}
+	report := messages[0]
+	for _, want := range []string{"Total: 2, Success: 0, Fail: 2", "❌ shop: Error: upload failed, queued for retry", "❌ empty: Error:", "📊 peak RSS"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report lacks %q:\n%s", want, report)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Plugin kinds. Plugins are executables named backup-<kind>-<name> in the
+// plugins directory and talk to the tool through arguments, environment,
+// stdin/stdout and exit codes, so they can be written in any language.
+const (
+	PluginSource  = "source"  // Invoked with an output directory to fill; shipped as an artifact
+	PluginStorage = "storage" // Invoked as "<op> [key]", see PluginStore
+	PluginNotify  = "notify"  // Invoked with the message on stdin
+)
+
+// Exit codes of plugins besides success (0) and failure (anything else).
+const (
+	pluginExitNotFound     = 2 // exists/get: no such object; put: the object already exists
+	pluginExitNotSupported = 3 // The operation is not implemented
+)
+
+// pluginTimeout bounds notifier plugins, which run inline with reports.
+const pluginTimeout = 30 * time.Second
+
+// Plugin is an external executable discovered in the plugins directory.
+type Plugin struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// FindPlugins lists the plugins of a kind in dir, sorted by name. A missing
+// directory holds no plugins.
+func FindPlugins(dir, kind string) ([]Plugin, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugins dir: %w", err)
+	}
+
+	prefix := "backup-" + kind + "-"
+	var plugins []Plugin
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".exe")
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || name == prefix {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || (runtime.GOOS != "windows" && info.Mode()&0111 == 0) {
+			continue // Not executable
+		}
+		plugins = append(plugins, Plugin{
+			Kind: kind,
+			Name: strings.TrimPrefix(name, prefix),
+			Path: filepath.Join(dir, entry.Name()),
+		})
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins, nil
+}
+
+// FindPlugin returns the plugin of a kind with the given name.
+func FindPlugin(dir, kind, name string) (Plugin, error) {
+	plugins, err := FindPlugins(dir, kind)
+	if err != nil {
+		return Plugin{}, err
+	}
+	for _, plugin := range plugins {
+		if plugin.Name == name {
+			return plugin, nil
+		}
+	}
+	return Plugin{}, fmt.Errorf("%s plugin %q not found in %s (expected an executable named backup-%s-%s)", kind, name, dir, kind, name)
+}
+
+// pluginExitError describes a plugin exiting with a non-zero code.
+type pluginExitError struct {
+	code   int
+	stderr string
+}
+
+func (e *pluginExitError) Error() string {
+	if e.stderr == "" {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return fmt.Sprintf("exit status %d: %s", e.code, e.stderr)
+}
+
+// pluginExitCode returns the exit code of a failed plugin run, or -1 when it
+// did not exit normally.
+func pluginExitCode(err error) int {
+	var exitErr *pluginExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return -1
+}
+
+// Run executes the plugin with args, wiring stdin and stdout. The plugin
+// gets the environment of other commands, without the tool's own BACKUP_*
+// secrets, plus the plugin kind and name and the extra env. Stderr is
+// included in the error of a failed run.
+func (p Plugin) Run(ctx context.Context, stdin io.Reader, stdout io.Writer, env []string, args ...string) error {
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	env = append([]string{"BACKUP_PLUGIN_KIND=" + p.Kind, "BACKUP_PLUGIN_NAME=" + p.Name}, env...)
+	stderr, err := Run(ctx, Command{Name: p.Path, Args: args, Env: env, Stdin: stdin, Stdout: stdout})
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+		return &pluginExitError{code: exitErr.ExitCode(), stderr: strings.TrimSpace(string(stderr))}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run plugin %s: %w", p.Path, err)
+	}
+	return nil
+}
+
+// notify runs a notifier plugin with the message on stdin.
+func (p Plugin) notify(hostname, job string, severity Severity, message string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), pluginTimeout)
+	defer cancel()
+	env := []string{"BACKUP_HOSTNAME=" + hostname, "BACKUP_JOB=" + job, "BACKUP_SEVERITY=" + string(severity)}
+	if err := p.Run(ctx, strings.NewReader(message), nil, env); err != nil {
+		return fmt.Errorf("notify plugin %s failed: %w", p.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// PluginStore delegates storage to a storage plugin, invoked once per
+// operation as "backup-storage-<name> <op> [key]":
+//
+//	put <key>        store stdin; exit 2 if the object already exists
+//	replace <key>    store stdin, overwriting
+//	get <key>        write the object to stdout; exit 2 if missing
+//	exists <key>     exit 0 if the object exists, 2 if not
+//	list             print one JSON object per line: {"key", "size", "modified" (RFC 3339)}
+//	delete <key>     remove the object
+//	url <key> <sec>  print a temporary download URL; exit 3 if unsupported
+type PluginStore struct {
+	plugin Plugin
+}
+
+// NewPluginStore finds the storage plugin selected by storage.plugin.
+func NewPluginStore(cfg *config.Config) (*PluginStore, error) {
+	plugin, err := FindPlugin(cfg.Plugins.Dir, PluginStorage, cfg.Storage.Plugin)
+	if err != nil {
+		return nil, err
+	}
+	return &PluginStore{plugin: plugin}, nil
+}
+
+// run executes an operation of the plugin.
+func (s *PluginStore) run(ctx context.Context, stdin io.Reader, stdout io.Writer, args ...string) error {
+	return s.plugin.Run(ctx, stdin, stdout, nil, args...)
+}
+
+func (s *PluginStore) ObjectKey(source string, ts time.Time, filename string) string {
+	return objectKey("", "flat", source, ts, filename)
+}
+
+func (s *PluginStore) Upload(ctx context.Context, key string, content io.Reader) error {
+	err := s.run(ctx, content, nil, "put", key)
+	if pluginExitCode(err) == pluginExitNotFound {
+		return fmt.Errorf("%w: %s", ErrObjectExists, key)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload object %s: %w", key, err)
+	}
+	Infof("Uploaded %s via storage plugin %s", key, s.plugin.Name)
+	return nil
+}
+
+func (s *PluginStore) Replace(ctx context.Context, key string, content io.Reader) error {
+	if err := s.run(ctx, content, nil, "replace", key); err != nil {
+		return fmt.Errorf("failed to upload object %s: %w", key, err)
+	}
+	Infof("Uploaded %s via storage plugin %s", key, s.plugin.Name)
+	return nil
+}
+
+func (s *PluginStore) Exists(ctx context.Context, key string) (bool, error) {
+	err := s.run(ctx, nil, nil, "exists", key)
+	if err == nil {
+		return true, nil
+	}
+	if pluginExitCode(err) == pluginExitNotFound {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to stat object %s: %w", key, err)
+}
+
+func (s *PluginStore) Download(ctx context.Context, key string, w io.Writer) error {
+	if err := s.run(ctx, nil, w, "get", key); err != nil {
+		return fmt.Errorf("failed to get object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *PluginStore) List(ctx context.Context) ([]ObjectInfo, error) {
+	var out bytes.Buffer
+	if err := s.run(ctx, nil, &out, "list"); err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	var objects []ObjectInfo
+	scanner := bufio.NewScanner(&out)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry struct {
+			Key      string    `json:"key"`
+			Size     int64     `json:"size"`
+			Modified time.Time `json:"modified"`
+		}
+		if err := sonic.UnmarshalString(line, &entry); err != nil {
+			return nil, fmt.Errorf("invalid list entry from storage plugin: %w", err)
+		}
+		objects = append(objects, ObjectInfo{Key: entry.Key, Size: entry.Size, LastModified: entry.Modified})
+	}
+	return objects, scanner.Err()
+}
+
+func (s *PluginStore) Delete(ctx context.Context, key string) error {
+	if err := s.run(ctx, nil, nil, "delete", key); err != nil {
+		return fmt.Errorf("failed to delete object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *PluginStore) EnforceRetention(ctx context.Context, retention RetentionFunc, limits RetentionLimits) (RetentionStats, error) {
+	return enforceRetention(ctx, s, retention, limits)
+}
+
+func (s *PluginStore) SelfTest(ctx context.Context) error {
+	return canaryTest(ctx, s, s.Delete)
+}
+
+func (s *PluginStore) PresignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	var out bytes.Buffer
+	err := s.run(ctx, nil, &out, "url", key, strconv.Itoa(int(expires.Seconds())))
+	if pluginExitCode(err) == pluginExitNotSupported {
+		return "", ErrNotSupported
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to presign object %s: %w", key, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
@@ -0,0 +1,112 @@
+package helper
+
+import (
+	"context"
+	"io"
+)
+
+// Stages reported through ProgressFunc.
+const (
+	StageDump     = "dump"     // Dumping a source; Done/Total count its items (e.g. databases)
+	StageZip      = "zip"      // Compressing and encrypting an artifact
+	StageUpload   = "upload"   // Uploading an artifact; Done/Total count bytes
+	StageDownload = "download" // Downloading an object; Done counts bytes
+	StageDone     = "done"     // An artifact was shipped
+)
+
+// progressStep is the number of bytes between two byte progress reports.
+const progressStep = 1 << 20
+
+// Progress is a snapshot of a running backup. Total is -1 when unknown.
+type Progress struct {
+	Stage string
+	Item  string // Database, artifact or object key the stage works on
+	Done  int64
+	Total int64
+}
+
+// ProgressFunc receives progress reports. It is called from the goroutine
+// doing the work, so it must return quickly.
+type ProgressFunc func(Progress)
+
+// report calls f when set.
+func (f ProgressFunc) report(stage, item string, done, total int64) {
+	if f != nil {
+		f(Progress{Stage: stage, Item: item, Done: done, Total: total})
+	}
+}
+
+// progressReader reports the bytes read from r every progressStep bytes and
+// at EOF.
+type progressReader struct {
+	r        io.Reader
+	progress ProgressFunc
+	stage    string
+	item     string
+	total    int64
+
+	done, reported int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	if p.done-p.reported >= progressStep || err == io.EOF && p.done > p.reported {
+		p.reported = p.done
+		p.progress.report(p.stage, p.item, p.done, p.total)
+	}
+	return n, err
+}
+
+// progressWriter reports the bytes written to w every progressStep bytes.
+// The final count is reported by its user once the copy is over.
+type progressWriter struct {
+	w        io.Writer
+	progress ProgressFunc
+	item     string
+
+	done, reported int64
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.done += int64(n)
+	if p.done-p.reported >= progressStep {
+		p.reported = p.done
+		p.progress.report(StageDownload, p.item, p.done, -1)
+	}
+	return n, err
+}
+
+// WithProgress wraps a storage so that the bytes of every upload and
+// download are reported to progress. Object sizes are not known up front, so
+// Total is -1.
+func WithProgress(store Storage, progress ProgressFunc) Storage {
+	if progress == nil {
+		return store
+	}
+	return &progressStorage{Storage: store, progress: progress}
+}
+
+// progressStorage reports the transfers of a storage.
+type progressStorage struct {
+	Storage
+	progress ProgressFunc
+}
+
+func (s *progressStorage) Upload(ctx context.Context, key string, content io.Reader) error {
+	return s.Storage.Upload(ctx, key, &progressReader{r: content, progress: s.progress, stage: StageUpload, item: key, total: -1})
+}
+
+func (s *progressStorage) Replace(ctx context.Context, key string, content io.Reader) error {
+	return s.Storage.Replace(ctx, key, &progressReader{r: content, progress: s.progress, stage: StageUpload, item: key, total: -1})
+}
+
+func (s *progressStorage) Download(ctx context.Context, key string, w io.Writer) error {
+	pw := &progressWriter{w: w, progress: s.progress, item: key}
+	err := s.Storage.Download(ctx, key, pw)
+	if err == nil {
+		s.progress.report(StageDownload, key, pw.done, pw.done)
+	}
+	return err
+}
@@ -0,0 +1,183 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrQuotaExceeded is returned for uploads that would take a destination
+// over its storage.quota.
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// quotaState is the usage of a destination during a run.
+type quotaState struct {
+	used    int64
+	stopped bool // Uploads stopped by storage.quota.action "stop"
+}
+
+// uploadWithinQuota uploads an artifact file after making room for it in the
+// quota of the destination backend.
+func (p *Pipeline) uploadWithinQuota(ctx context.Context, backend string, store Storage, key, path string) (UploadResult, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if err := p.checkQuota(ctx, backend, store, info.Size()); err != nil {
+		return UploadResult{}, err
+	}
+	uploaded, err := p.upload(ctx, store, key, path)
+	if err == nil {
+		if state := p.quotas[backend]; state != nil {
+			state.used += uploaded.Size
+		}
+	}
+	return uploaded, err
+}
+
+// checkQuota checks that an artifact of size fits in the quota of a
+// destination, following storage.quota.action when it does not: "fail"
+// fails the upload, "prune" deletes the oldest backups to make room, within
+// the safeguards of retention, and "stop" fails every further upload of the
+// run. The usage of a destination is listed once per run, then counted along
+// with the uploads.
+func (p *Pipeline) checkQuota(ctx context.Context, backend string, store Storage, size int64) error {
+	quota := p.cfg.Storage.Quota
+	limit := quota.Limit(backend)
+	if limit <= 0 || p.opts.OnlyDump {
+		return nil
+	}
+	state := p.quotas[backend]
+	if state == nil {
+		used, err := storedBytes(ctx, store)
+		if err != nil {
+			return fmt.Errorf("failed to measure usage of %s for its quota: %w", backend, err)
+		}
+		state = &quotaState{used: used}
+		p.quotas[backend] = state
+	}
+	if state.stopped {
+		return fmt.Errorf("%w: uploads to %s stopped for this run", ErrQuotaExceeded, backend)
+	}
+	if state.used+size <= limit {
+		return nil
+	}
+
+	switch quota.Action {
+	case "prune":
+		freed, err := p.pruneForQuota(ctx, backend, store, state.used+size-limit)
+		state.used -= freed
+		if err != nil {
+			return fmt.Errorf("%w: failed to make room on %s: %v", ErrQuotaExceeded, backend, err)
+		}
+		if state.used+size <= limit {
+			return nil
+		}
+	case "stop":
+		state.stopped = true
+		Infof("Quota of %s reached, stopping uploads to it for this run", backend)
+	}
+	return fmt.Errorf("%w: %s would hold %s, over its quota of %s", ErrQuotaExceeded, backend, HumanizeSize(state.used+size), HumanizeSize(limit))
+}
+
+// storedBytes returns the size of the objects of a storage.
+func storedBytes(ctx context.Context, store Storage) (int64, error) {
+	objects, err := store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, object := range objects {
+		total += object.Size
+	}
+	return total, nil
+}
+
+// pruneForQuota deletes the oldest artifacts of a storage, with their
+// manifests, until at least need bytes are freed. Only artifacts with a
+// retention period and older than an hour are candidates, and they are
+// deleted by a retention run keeping its safeguards: the window, the lease,
+// protected chains, confirmation, approvals, the limits of a run and Object
+// Lock. It returns the bytes freed.
+func (p *Pipeline) pruneForQuota(ctx context.Context, backend string, store Storage, need int64) (int64, error) {
+	if !p.cfg.Retention.InWindow(time.Now()) {
+		return 0, fmt.Errorf("outside the deletion window %s", p.cfg.Retention.Window)
+	}
+	objects, err := store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	retention := ProfileRetention(p.cfg)
+	cutoff := time.Now().Add(-time.Hour)
+	var artifacts []ObjectInfo
+	manifests := make(map[string]int64)
+	for _, object := range objects {
+		switch {
+		case strings.HasSuffix(object.Key, ManifestSuffix):
+			manifests[object.Key] = object.Size
+		case IsArtifactKey(object.Key) && retention(object.Key) > 0 && object.LastModified.Before(cutoff):
+			artifacts = append(artifacts, object)
+		}
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].LastModified.Before(artifacts[j].LastModified)
+	})
+
+	chosen := make(map[string]bool)
+	var chosenBytes int64
+	for _, object := range artifacts {
+		if chosenBytes >= need {
+			break
+		}
+		chosen[object.Key] = true
+		chosenBytes += object.Size
+	}
+	if len(chosen) == 0 {
+		return 0, errors.New("no backups to delete")
+	}
+
+	// Chosen artifacts expire after an hour, which they are older than
+	stats, err := p.enforceRetention(ctx, backend, store, func(key string) int {
+		if chosen[key] {
+			return 1
+		}
+		return 0
+	}, p.retentionLimits())
+	freed := stats.Bytes
+	if stats.Deleted > 0 {
+		Infof("Quota: deleted %d backups (%s) from %s", stats.Deleted, HumanizeSize(stats.Bytes), backend)
+	}
+	for key := range chosen {
+		size, ok := manifests[ManifestKey(key)]
+		if !ok {
+			continue
+		}
+		if exists, existsErr := store.Exists(ctx, key); existsErr != nil || exists {
+			continue // Kept by a safeguard
+		}
+		if store.Delete(ctx, ManifestKey(key)) == nil {
+			freed += size
+		}
+	}
+	return freed, err
+}
+
+// quotaAlert describes the destinations whose uploads were stopped by their
+// quota, empty when there are none.
+func (p *Pipeline) quotaAlert(job string) string {
+	var stopped []string
+	for backend, state := range p.quotas {
+		if state.stopped {
+			stopped = append(stopped, backend)
+		}
+	}
+	if len(stopped) == 0 {
+		return ""
+	}
+	sort.Strings(stopped)
+	return fmt.Sprintf("🛑 %s: storage quota reached on %s, uploads stopped; free space or raise storage.quota", job, strings.Join(stopped, ", "))
+}
@@ -0,0 +1,136 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// testQuota stores a chain of three 100-byte artifacts, uploaded 72, 48 and
+// 24 hours ago, on a destination whose quota prunes. It returns the keys,
+// oldest first.
+func testQuota(t *testing.T) (*config.Config, *MemoryStorage, []string) {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.Retention.Hours = 24 * 30
+	cfg.Storage.Quota = config.QuotaConfig{MaxGB: 1, Action: "prune"}
+	store := NewMemoryStorage("")
+	var keys []string
+	for i, age := range []time.Duration{72, 48, 24} {
+		modified := time.Now().Add(-age * time.Hour)
+		key := ArtifactFilename("shop", modified, NewRunID(), "")
+		if err := store.Upload(context.Background(), key, strings.NewReader(strings.Repeat("x", 100))); err != nil {
+			t.Fatal(err)
+		}
+		store.SetModified(key, modified)
+		manifest := &Manifest{Artifact: key, Kind: "full"}
+		if i > 0 {
+			manifest.Kind, manifest.Parent = "incremental", keys[i-1]
+		}
+		if err := saveManifest(context.Background(), store, key, manifest); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	return cfg, store, keys
+}
+
+// overQuota returns the size of an upload exceeding the quota of cfg by
+// excess bytes on store.
+func overQuota(t *testing.T, cfg *config.Config, store Storage, excess int64) int64 {
+	t.Helper()
+	used, err := storedBytes(context.Background(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg.Storage.Quota.Limit("memory") - used + excess
+}
+
+func TestQuotaPruneDeletesOldest(t *testing.T) {
+	cfg, store, keys := testQuota(t)
+	p := NewPipeline(cfg, store, Options{})
+
+	if err := p.checkQuota(context.Background(), "memory", store, overQuota(t, cfg, store, 150)); err != nil {
+		t.Fatalf("checkQuota = %v, want room made", err)
+	}
+	if got := artifactKeys(t, store); !slices.Equal(got, keys[2:]) {
+		t.Errorf("stored artifacts = %v, want only the newest %v", got, keys[2:])
+	}
+	for _, key := range keys[:2] {
+		if exists, _ := store.Exists(context.Background(), ManifestKey(key)); exists {
+			t.Errorf("manifest of deleted %s kept", key)
+		}
+	}
+	if exists, _ := store.Exists(context.Background(), ManifestKey(keys[2])); !exists {
+		t.Errorf("manifest of kept %s deleted", keys[2])
+	}
+}
+
+func TestQuotaPruneKeepsSafeguards(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, cfg *config.Config, store *MemoryStorage)
+	}{
+		{"keep forever", func(t *testing.T, cfg *config.Config, store *MemoryStorage) {
+			cfg.Retention.Hours = 0
+		}},
+		{"outside the deletion window", func(t *testing.T, cfg *config.Config, store *MemoryStorage) {
+			now := time.Now()
+			cfg.Retention.Window = now.Add(2*time.Hour).Format("15:04") + "-" + now.Add(3*time.Hour).Format("15:04")
+		}},
+		{"protected chains", func(t *testing.T, cfg *config.Config, store *MemoryStorage) {
+			cfg.Retention.ProtectChains = true
+		}},
+		{"confirmation", func(t *testing.T, cfg *config.Config, store *MemoryStorage) {
+			cfg.Retention.ConfirmThreshold = 1
+		}},
+		{"approval", func(t *testing.T, cfg *config.Config, store *MemoryStorage) {
+			cfg.Approval.Threshold = 1
+			cfg.Approval.Dir = t.TempDir()
+		}},
+		{"lease held by another host", func(t *testing.T, cfg *config.Config, store *MemoryStorage) {
+			cfg.Retention.LeaseTTL = "1h"
+			if _, err := AcquireLease(context.Background(), store, time.Hour, "other-host"); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"recent backups", func(t *testing.T, cfg *config.Config, store *MemoryStorage) {
+			for _, key := range artifactKeys(t, store) {
+				store.SetModified(key, time.Now().Add(-time.Minute))
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, store, keys := testQuota(t)
+			tt.setup(t, cfg, store)
+			p := NewPipeline(cfg, store, Options{})
+
+			err := p.checkQuota(context.Background(), "memory", store, overQuota(t, cfg, store, 150))
+			if !errors.Is(err, ErrQuotaExceeded) {
+				t.Errorf("checkQuota = %v, want ErrQuotaExceeded", err)
+			}
+			if got := artifactKeys(t, store); !slices.Equal(got, keys) {
+				t.Errorf("stored artifacts = %v, want all kept", got)
+			}
+		})
+	}
+}
+
+func TestQuotaPruneConfirmedLargeDelete(t *testing.T) {
+	cfg, store, keys := testQuota(t)
+	cfg.Retention.ConfirmThreshold = 1
+	p := NewPipeline(cfg, store, Options{ConfirmLargeDeletes: true})
+
+	if err := p.checkQuota(context.Background(), "memory", store, overQuota(t, cfg, store, 150)); err != nil {
+		t.Fatalf("checkQuota = %v, want room made", err)
+	}
+	if got := artifactKeys(t, store); !slices.Equal(got, keys[2:]) {
+		t.Errorf("stored artifacts = %v, want only the newest %v", got, keys[2:])
+	}
+}
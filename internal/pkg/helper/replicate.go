@@ -0,0 +1,100 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// ReplicationResult summarizes a replication run.
+type ReplicationResult struct {
+	Copied  int   // Objects missing from the destination
+	Updated int   // Objects changed since they were copied, e.g. rekeyed manifests
+	Skipped int   // Objects already up to date
+	Failed  int   // Objects that could not be copied
+	Bytes   int64 // Bytes copied
+}
+
+// Replicate copies the objects of src that are missing from dst, or changed
+// since they were copied, to dst. Keys keep their path below the prefix of
+// each storage, so the prefixes may differ. Nothing is deleted from dst: its
+// own retention prunes it. With dryRun, the objects are only logged.
+func Replicate(ctx context.Context, src, dst Storage, dryRun bool) (ReplicationResult, error) {
+	var result ReplicationResult
+	srcObjects, err := src.List(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to list source: %w", err)
+	}
+	dstObjects, err := dst.List(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to list destination: %w", err)
+	}
+
+	srcPrefix, dstPrefix := KeyPrefix(src), KeyPrefix(dst)
+	existing := make(map[string]ObjectInfo, len(dstObjects))
+	for _, object := range dstObjects {
+		existing[strings.TrimPrefix(object.Key, dstPrefix)] = object
+	}
+
+	for _, object := range srcObjects {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		rel := strings.TrimPrefix(object.Key, srcPrefix)
+		if path.Base(rel) == leaseName {
+			continue
+		}
+		copied, exists := existing[rel]
+		changed := exists && (copied.Size != object.Size || object.LastModified.After(copied.LastModified))
+		if exists && !changed {
+			result.Skipped++
+			continue
+		}
+
+		if dryRun {
+			action := "copy"
+			if changed {
+				action = "update"
+			}
+			Infof("Would %s %s (%s)", action, object.Key, HumanizeSize(object.Size))
+		} else if err := copyObject(ctx, src, dst, object.Key, dstPrefix+rel, changed); err != nil {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			Errorf("failed to replicate %s: %v", object.Key, err)
+			result.Failed++
+			continue
+		}
+		if changed {
+			result.Updated++
+		} else {
+			result.Copied++
+		}
+		result.Bytes += object.Size
+	}
+
+	if result.Failed > 0 {
+		return result, fmt.Errorf("failed to replicate %d objects", result.Failed)
+	}
+	return result, nil
+}
+
+// copyObject streams an object from src to dst, replacing the copy in dst
+// when replace is set.
+func copyObject(ctx context.Context, src, dst Storage, srcKey, dstKey string, replace bool) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(src.Download(ctx, srcKey, pw))
+	}()
+
+	var err error
+	if replace {
+		err = dst.Replace(ctx, dstKey, pr)
+	} else {
+		err = dst.Upload(ctx, dstKey, pr)
+	}
+	pr.CloseWithError(err) // Stops the download when the upload failed
+	return err
+}
@@ -1,37 +1,166 @@
 package helper
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/bytedance/sonic"
 )
 
+// Unverified is the BackupResult.Verified of an artifact whose upload could
+// not be checked, e.g. because the credentials may not look objects up.
+const Unverified = "unverified"
+
 // BackupResult holds the result of a single backup operation.
 type BackupResult struct {
 	Database string
 	Success  bool
 	Size     int64
 	SHA256   string
+	Verified string // Check of the uploaded artifact, as backup.verify_upload: "exists" or "checksum", or Unverified; empty when not checked
 	Error    error
 	Duration time.Duration
+	Manifest *Manifest
+	Mirrors  []MirrorResult // Copies on storage.mirrors, whatever the outcome of the primary upload
+}
+
+// ArtifactSizeError reports an artifact that is missing, empty or smaller
+// than backup.min_artifact_bytes, which points at a failed dump or archive
+// rather than at a backup worth keeping.
+type ArtifactSizeError struct {
+	Artifact string
+	Size     int64 // -1 when the artifact is missing
+	Min      int64 // backup.min_artifact_bytes
+}
+
+func (e *ArtifactSizeError) Error() string {
+	switch {
+	case e.Size < 0:
+		return fmt.Sprintf("artifact %s is missing", e.Artifact)
+	case e.Size == 0:
+		return fmt.Sprintf("artifact %s is empty", e.Artifact)
+	}
+	return fmt.Sprintf("artifact %s is %s, smaller than backup.min_artifact_bytes (%s)", e.Artifact, HumanizeSize(e.Size), HumanizeSize(e.Min))
+}
+
+// checkArtifactSize returns an ArtifactSizeError when an artifact of size is
+// empty or smaller than min.
+func checkArtifactSize(artifact string, size, min int64) error {
+	if size <= 0 || size < min {
+		return &ArtifactSizeError{Artifact: artifact, Size: size, Min: min}
+	}
+	return nil
 }
 
-// SendReport sends a backup report via Telegram.
-func SendReport(notifier *TelegramSender, results []BackupResult, success, fail int) {
+// shortHash abbreviates a SHA256 for reports.
+func shortHash(hash string) string {
+	if len(hash) <= 8 {
+		return hash
+	}
+	return hash[:8] + "..."
+}
+
+// MirrorResult is the outcome of uploading an artifact to a mirror.
+type MirrorResult struct {
+	Backend string
+	Key     string
+	Error   error
+}
+
+// telegramMessageLimit is the maximum length of a Telegram text message.
+const telegramMessageLimit = 4096
+
+// SendReport sends the backup report of a job via Telegram, with the
+// verification of every artifact and the outcomes of the run's retention, as
+// a success when nothing failed and as an alert when a backup or a retention
+// run did. usage may be nil.
+func SendReport(notifier *TelegramSender, job string, results []BackupResult, retention []RetentionResult, success, fail int, usage *Usage) {
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("Backup Report [%s]\n", time.Now().Format(time.RFC3339)))
 	sb.WriteString(fmt.Sprintf("Total: %d, Success: %d, Fail: %d\n\n", len(results), success, fail))
 
 	for _, res := range results {
 		if res.Success {
-			sb.WriteString(fmt.Sprintf("✅ %s: %s (SHA256: %s...)\n", res.Database, HumanizeSize(res.Size), res.SHA256[:8]))
+			verified := ""
+			if res.Verified == Unverified {
+				verified = ", " + Unverified
+			} else if res.Verified != "" {
+				verified = ", verified: " + res.Verified
+			}
+			sb.WriteString(fmt.Sprintf("✅ %s: %s (SHA256: %s%s)\n", res.Database, HumanizeSize(res.Size), shortHash(res.SHA256), verified))
 		} else {
 			sb.WriteString(fmt.Sprintf("❌ %s: Error: %v\n", res.Database, res.Error))
 		}
+		for _, m := range res.Mirrors {
+			if m.Error != nil {
+				sb.WriteString(fmt.Sprintf("   ⚠️ %s: Error: %v\n", m.Backend, m.Error))
+			} else {
+				sb.WriteString(fmt.Sprintf("   ↪ %s: ok\n", m.Backend))
+			}
+		}
+	}
+	if len(retention) > 0 {
+		sb.WriteString("\n")
+	}
+	for _, r := range retention {
+		if r.Error != nil {
+			sb.WriteString(fmt.Sprintf("⚠️ Retention %s: deleted %d backups (%s freed), Error: %v\n", r.Backend, r.Deleted, HumanizeSize(r.Bytes), r.Error))
+		} else {
+			sb.WriteString(fmt.Sprintf("🧹 Retention %s: deleted %d backups (%s freed)\n", r.Backend, r.Deleted, HumanizeSize(r.Bytes)))
+		}
+	}
+	if usage != nil {
+		sb.WriteString(fmt.Sprintf("\n📊 %s\n", usage))
 	}
 
-	if err := notifier.Send(sb.String()); err != nil {
-		log.Printf("Failed to send telegram notification: %v", err)
+	// Reports exceeding the message limit are sent to Telegram as a document
+	// instead of being truncated; notifier plugins receive them whole
+	report := sb.String()
+	severity := SeveritySuccess
+	if fail > 0 {
+		severity = SeverityAlert
+	}
+	for _, res := range results {
+		if !res.Success {
+			severity = SeverityAlert
+		}
+	}
+	for _, r := range retention {
+		if r.Error != nil {
+			severity = SeverityAlert
+		}
+	}
+	var err error
+	if utf8.RuneCountInString(report) > telegramMessageLimit {
+		caption := fmt.Sprintf("Backup Report: Total: %d, Success: %d, Fail: %d", len(results), success, fail)
+		errs := notifier.notifyPlugins(job, severity, report)
+		err = errors.Join(append(errs, notifier.SendDocument(job, severity, "report.txt", []byte(report), caption))...)
+	} else {
+		err = notifier.Notify(job, severity, report)
+	}
+	if err != nil {
+		Errorf("failed to send telegram notification: %v", err)
+	}
+
+	if notifier.AttachManifest {
+		var manifests []*Manifest
+		for _, res := range results {
+			if res.Manifest != nil {
+				manifests = append(manifests, res.Manifest)
+			}
+		}
+		if len(manifests) == 0 {
+			return
+		}
+		data, err := sonic.MarshalIndent(manifests, "", "  ")
+		if err == nil {
+			err = notifier.SendDocument(job, severity, "manifest.json", data, "")
+		}
+		if err != nil {
+			Errorf("failed to send telegram manifest: %v", err)
+		}
 	}
 }
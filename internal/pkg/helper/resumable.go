@@ -0,0 +1,246 @@
+package helper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// ErrUploadWindowClosed is returned for uploads attempted outside
+// backup.upload_window, or cut off when it closed.
+var ErrUploadWindowClosed = errors.New("outside the upload window")
+
+// ChunkedStorage is implemented by storages that can assemble an object from
+// separately uploaded chunks, so an interrupted upload resumes from the last
+// stored chunk instead of restarting from zero.
+type ChunkedStorage interface {
+	Storage
+	// StartChunked starts a chunked upload to key and returns its ID.
+	StartChunked(ctx context.Context, key string) (string, error)
+	// PutChunk stores chunk n (counted from 1), verified by storage against
+	// its checksums, and returns the tag identifying the stored chunk.
+	PutChunk(ctx context.Context, key, uploadID string, n int, chunk []byte) (string, error)
+	// StoredChunks returns the tags of the chunks stored so far by number. It
+	// fails when the upload no longer exists, e.g. it completed or expired.
+	StoredChunks(ctx context.Context, key, uploadID string) (map[int]string, error)
+	// CompleteChunked assembles the chunks, given by their tags in order,
+	// into the object. It fails with ErrObjectExists when key is taken.
+	CompleteChunked(ctx context.Context, key, uploadID string, tags []string) error
+	// AbortChunked discards an upload and its chunks.
+	AbortChunked(ctx context.Context, key, uploadID string) error
+}
+
+// chunkState is the progress of a chunked upload, saved next to the artifact
+// after every chunk, so a retry or a later run resumes it.
+type chunkState struct {
+	Key       string       `json:"key"`
+	UploadID  string       `json:"upload_id"`
+	ChunkSize int64        `json:"chunk_size"`
+	Chunks    []chunkEntry `json:"chunks"`
+}
+
+// chunkEntry is a stored chunk with the checksum of its local content.
+type chunkEntry struct {
+	SHA256 string `json:"sha256"`
+	Tag    string `json:"tag"`
+}
+
+// chunkStateSuffix is appended to the path of an artifact file to name the
+// resume state of its upload.
+const chunkStateSuffix = ".upload.json"
+
+// chunkStatePath returns the path of the resume state of an artifact file.
+func chunkStatePath(artifactPath string) string {
+	return artifactPath + chunkStateSuffix
+}
+
+// uploadArtifact uploads content, read from the artifact file at path, in
+// chunks of chunkSize when it is set and store supports chunked uploads, and
+// in one go otherwise.
+func uploadArtifact(ctx context.Context, store Storage, key, path string, content io.Reader, chunkSize int64) (UploadResult, error) {
+	if chunked, ok := store.(ChunkedStorage); ok && chunkSize > 0 {
+		return UploadChunked(ctx, chunked, key, path, content, chunkSize)
+	}
+	if info, err := os.Stat(path); err == nil {
+		ctx = withUploadSize(ctx, info.Size())
+	}
+	return UploadHashed(ctx, store, key, content)
+}
+
+// UploadChunked uploads content, read from the artifact file at path, in
+// chunks of chunkSize while computing its SHA256. Every chunk is verified by
+// storage and recorded in a resume state next to the file, together with the
+// checksum of its local content. An upload of the same key and chunk size
+// found in that state resumes after its last chunk still held by storage:
+// the chunks before it are only read locally and compared.
+func UploadChunked(ctx context.Context, store ChunkedStorage, key, path string, content io.Reader, chunkSize int64) (UploadResult, error) {
+	statePath := chunkStatePath(path)
+	state := loadChunkState(statePath, key, chunkSize)
+	if state != nil {
+		stored, err := store.StoredChunks(ctx, key, state.UploadID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return UploadResult{}, ctx.Err()
+			}
+			Infof("Restarting upload of %s: %v", key, err)
+			state = nil
+		} else {
+			n := 0
+			for n < len(state.Chunks) && stored[n+1] == state.Chunks[n].Tag {
+				n++
+			}
+			state.Chunks = state.Chunks[:n]
+			Debugf("Resuming upload of %s after chunk %d", key, n)
+		}
+	}
+	if state == nil {
+		// The completion is conditional, so an unknown answer is no obstacle
+		exists, err := store.Exists(ctx, key)
+		if err != nil && !errors.Is(err, ErrExistsUnknown) {
+			return UploadResult{}, err
+		}
+		if exists {
+			os.Remove(statePath) // Left behind by an upload that completed
+			return UploadResult{}, fmt.Errorf("%w: %s", ErrObjectExists, key)
+		}
+		id, err := store.StartChunked(ctx, key)
+		if err != nil {
+			return UploadResult{}, fmt.Errorf("failed to start upload of %s: %w", key, err)
+		}
+		state = &chunkState{Key: key, UploadID: id, ChunkSize: chunkSize}
+		if err := saveChunkState(statePath, state); err != nil {
+			return UploadResult{}, err
+		}
+	}
+
+	hr := NewHashingReader(content)
+	buf := make([]byte, chunkSize)
+	chunks := 0
+	for {
+		size, err := io.ReadFull(hr, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return UploadResult{}, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if size == 0 && chunks > 0 {
+			break
+		}
+		chunks++
+		sum := sha256.Sum256(buf[:size])
+		entry := chunkEntry{SHA256: hex.EncodeToString(sum[:])}
+		if chunks <= len(state.Chunks) && state.Chunks[chunks-1].SHA256 == entry.SHA256 {
+			entry.Tag = state.Chunks[chunks-1].Tag
+		} else {
+			// Chunks after one that changed locally are uploaded again
+			if chunks <= len(state.Chunks) {
+				state.Chunks = state.Chunks[:chunks-1]
+			}
+			if entry.Tag, err = store.PutChunk(ctx, key, state.UploadID, chunks, buf[:size]); err != nil {
+				return UploadResult{}, fmt.Errorf("failed to upload chunk %d of %s: %w", chunks, key, err)
+			}
+			state.Chunks = append(state.Chunks, entry)
+			if err := saveChunkState(statePath, state); err != nil {
+				return UploadResult{}, err
+			}
+		}
+		if size < len(buf) {
+			break
+		}
+	}
+
+	tags := make([]string, chunks)
+	for i := range tags {
+		tags[i] = state.Chunks[i].Tag
+	}
+	if err := store.CompleteChunked(ctx, key, state.UploadID, tags); err != nil {
+		if errors.Is(err, ErrObjectExists) {
+			store.AbortChunked(context.WithoutCancel(ctx), key, state.UploadID)
+			os.Remove(statePath)
+		}
+		return UploadResult{}, err
+	}
+	os.Remove(statePath)
+	hash, size := hr.Sum()
+	return UploadResult{Key: key, Size: size, SHA256: hash}, nil
+}
+
+// discardChunked aborts the unfinished chunked upload of an artifact file
+// that will not be resumed, and removes its resume state.
+func discardChunked(ctx context.Context, store Storage, path string) {
+	chunked, ok := store.(ChunkedStorage)
+	if !ok {
+		return
+	}
+	statePath := chunkStatePath(path)
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return
+	}
+	var state chunkState
+	if sonic.Unmarshal(data, &state) == nil {
+		if err := chunked.AbortChunked(context.WithoutCancel(ctx), state.Key, state.UploadID); err != nil {
+			Warnf("failed to abort upload of %s: %v", state.Key, err)
+		}
+	}
+	os.Remove(statePath)
+}
+
+// loadChunkState returns the saved state of an upload of key in chunks of
+// chunkSize, or nil when there is none.
+func loadChunkState(path, key string, chunkSize int64) *chunkState {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var state chunkState
+	if err := sonic.Unmarshal(data, &state); err != nil {
+		Warnf("ignoring unreadable upload state %s: %v", path, err)
+		return nil
+	}
+	if state.Key != key || state.ChunkSize != chunkSize || state.UploadID == "" {
+		return nil
+	}
+	return &state
+}
+
+func saveChunkState(path string, state *chunkState) error {
+	data, err := sonic.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write upload state: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// UploadWindowContext returns a context for uploads that is cancelled when
+// backup.upload_window closes. Outside the window it fails with
+// ErrUploadWindowClosed.
+func UploadWindowContext(ctx context.Context, cfg config.BackupConfig) (context.Context, context.CancelFunc, error) {
+	end, open := cfg.UploadWindowEnd(time.Now())
+	if !open {
+		return ctx, func() {}, fmt.Errorf("%w %s", ErrUploadWindowClosed, cfg.UploadWindow)
+	}
+	if end.IsZero() {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithDeadline(ctx, end)
+	return ctx, cancel, nil
+}
+
+// windowClosed reports whether uploadCtx, returned by UploadWindowContext
+// for ctx, was cancelled by the upload window closing.
+func windowClosed(ctx, uploadCtx context.Context) bool {
+	return ctx.Err() == nil && errors.Is(uploadCtx.Err(), context.DeadlineExceeded)
+}
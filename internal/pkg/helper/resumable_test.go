@@ -0,0 +1,253 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeChunked is a ChunkedStorage keeping chunked uploads in memory and
+// completing them into a MemoryStorage.
+type fakeChunked struct {
+	*MemoryStorage
+	uploads map[string]map[int]fakeChunk // Upload ID -> chunk number -> chunk
+	puts    []int                        // Numbers of the chunks stored, in order
+	failAt  int                          // Chunk whose next PutChunk fails, e.g. a dropped connection
+	aborted []string
+	seq     int
+}
+
+type fakeChunk struct {
+	tag  string
+	data []byte
+}
+
+func newFakeChunked() *fakeChunked {
+	return &fakeChunked{MemoryStorage: NewMemoryStorage(""), uploads: make(map[string]map[int]fakeChunk)}
+}
+
+func (f *fakeChunked) StartChunked(ctx context.Context, key string) (string, error) {
+	f.seq++
+	id := fmt.Sprintf("upload-%d", f.seq)
+	f.uploads[id] = make(map[int]fakeChunk)
+	return id, nil
+}
+
+func (f *fakeChunked) PutChunk(ctx context.Context, key, uploadID string, n int, chunk []byte) (string, error) {
+	if n == f.failAt {
+		f.failAt = 0
+		return "", errors.New("connection reset by peer")
+	}
+	chunks, ok := f.uploads[uploadID]
+	if !ok {
+		return "", fmt.Errorf("no upload %s", uploadID)
+	}
+	f.seq++
+	tag := fmt.Sprintf("tag-%d", f.seq)
+	chunks[n] = fakeChunk{tag: tag, data: bytes.Clone(chunk)}
+	f.puts = append(f.puts, n)
+	return tag, nil
+}
+
+func (f *fakeChunked) StoredChunks(ctx context.Context, key, uploadID string) (map[int]string, error) {
+	chunks, ok := f.uploads[uploadID]
+	if !ok {
+		return nil, fmt.Errorf("no upload %s", uploadID)
+	}
+	tags := make(map[int]string)
+	for n, chunk := range chunks {
+		tags[n] = chunk.tag
+	}
+	return tags, nil
+}
+
+func (f *fakeChunked) CompleteChunked(ctx context.Context, key, uploadID string, tags []string) error {
+	chunks, ok := f.uploads[uploadID]
+	if !ok {
+		return fmt.Errorf("no upload %s", uploadID)
+	}
+	var content bytes.Buffer
+	for i, tag := range tags {
+		if chunks[i+1].tag != tag {
+			return fmt.Errorf("chunk %d: tag %s is not stored", i+1, tag)
+		}
+		content.Write(chunks[i+1].data)
+	}
+	if err := f.Upload(ctx, key, &content); err != nil {
+		return err
+	}
+	delete(f.uploads, uploadID)
+	return nil
+}
+
+func (f *fakeChunked) AbortChunked(ctx context.Context, key, uploadID string) error {
+	delete(f.uploads, uploadID)
+	f.aborted = append(f.aborted, uploadID)
+	return nil
+}
+
+// onlyUpload returns the ID of the single unfinished upload.
+func (f *fakeChunked) onlyUpload(t *testing.T) string {
+	t.Helper()
+	if len(f.uploads) != 1 {
+		t.Fatalf("%d unfinished uploads, want 1", len(f.uploads))
+	}
+	for id := range f.uploads {
+		return id
+	}
+	return ""
+}
+
+func TestUploadChunked(t *testing.T) {
+	const key = "shop/shop_20240101_000000.zip"
+	content := []byte("aaaabbbbccccdd")
+
+	tests := []struct {
+		name      string
+		content   []byte
+		chunkSize int64
+		// failAt interrupts a first upload at this chunk, after which
+		// between changes the storage or returns the local content to resume
+		failAt   int
+		between  func(t *testing.T, f *fakeChunked, content []byte) []byte
+		wantPuts []int // Chunks stored by the last upload
+		wantErr  error
+	}{
+		{
+			name:      "uneven chunks",
+			content:   content,
+			chunkSize: 4,
+			wantPuts:  []int{1, 2, 3, 4},
+		},
+		{
+			name:      "exact multiple of the chunk size",
+			content:   content[:12],
+			chunkSize: 4,
+			wantPuts:  []int{1, 2, 3},
+		},
+		{
+			name:      "empty artifact",
+			content:   []byte{},
+			chunkSize: 4,
+			wantPuts:  []int{1},
+		},
+		{
+			name:      "interrupted upload resumes after the stored chunks",
+			content:   content,
+			chunkSize: 4,
+			failAt:    3,
+			wantPuts:  []int{3, 4},
+		},
+		{
+			name:      "chunk no longer held by storage",
+			content:   content,
+			chunkSize: 4,
+			failAt:    4,
+			between: func(t *testing.T, f *fakeChunked, content []byte) []byte {
+				// Chunk 2 was replaced, so its tag differs from the saved one
+				chunks := f.uploads[f.onlyUpload(t)]
+				chunks[2] = fakeChunk{tag: "replaced", data: chunks[2].data}
+				return content
+			},
+			wantPuts: []int{2, 3, 4},
+		},
+		{
+			name:      "locally changed chunk uploads the later chunks again",
+			content:   content,
+			chunkSize: 4,
+			failAt:    4,
+			between: func(t *testing.T, f *fakeChunked, content []byte) []byte {
+				changed := bytes.Clone(content)
+				changed[5] = 'X'
+				return changed
+			},
+			wantPuts: []int{2, 3, 4},
+		},
+		{
+			name:      "upload no longer held by storage restarts",
+			content:   content,
+			chunkSize: 4,
+			failAt:    3,
+			between: func(t *testing.T, f *fakeChunked, content []byte) []byte {
+				delete(f.uploads, f.onlyUpload(t))
+				return content
+			},
+			wantPuts: []int{1, 2, 3, 4},
+		},
+		{
+			name:      "object created meanwhile",
+			content:   content,
+			chunkSize: 4,
+			failAt:    3,
+			between: func(t *testing.T, f *fakeChunked, content []byte) []byte {
+				if err := f.Upload(context.Background(), key, strings.NewReader("other")); err != nil {
+					t.Fatal(err)
+				}
+				return content
+			},
+			wantPuts: []int{3, 4},
+			wantErr:  ErrObjectExists,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeChunked()
+			path := filepath.Join(t.TempDir(), "shop.zip")
+			local := tt.content
+
+			if tt.failAt > 0 {
+				f.failAt = tt.failAt
+				if _, err := UploadChunked(context.Background(), f, key, path, bytes.NewReader(local), tt.chunkSize); err == nil {
+					t.Fatal("interrupted upload succeeded")
+				}
+				if _, err := os.Stat(chunkStatePath(path)); err != nil {
+					t.Fatalf("no resume state after the interruption: %v", err)
+				}
+				if tt.between != nil {
+					local = tt.between(t, f, local)
+				}
+				f.puts = nil
+			}
+
+			result, err := UploadChunked(context.Background(), f, key, path, bytes.NewReader(local), tt.chunkSize)
+			if !slices.Equal(f.puts, tt.wantPuts) {
+				t.Errorf("stored chunks %v, want %v", f.puts, tt.wantPuts)
+			}
+			if _, statErr := os.Stat(chunkStatePath(path)); !os.IsNotExist(statErr) {
+				t.Errorf("resume state left behind: %v", statErr)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("UploadChunked = %v, want %v", err, tt.wantErr)
+				}
+				if len(f.uploads) != 0 || len(f.aborted) != 1 {
+					t.Errorf("upload not aborted: %d unfinished, %v aborted", len(f.uploads), f.aborted)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UploadChunked = %v", err)
+			}
+
+			var stored bytes.Buffer
+			if err := f.Download(context.Background(), key, &stored); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(stored.Bytes(), local) {
+				t.Errorf("stored %q, want %q", stored.Bytes(), local)
+			}
+			sum := sha256.Sum256(local)
+			if result.Size != int64(len(local)) || result.SHA256 != hex.EncodeToString(sum[:]) {
+				t.Errorf("result %+v, want size %d and sha256 %x", result, len(local), sum)
+			}
+		})
+	}
+}
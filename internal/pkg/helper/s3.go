@@ -0,0 +1,581 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// S3Storage stores artifacts in an S3-compatible bucket (Cloudflare R2, MinIO, AWS S3).
+type S3Storage struct {
+	client      *minio.Client
+	pruneClient *minio.Client // Client used for retention; may hold delete-capable credentials
+	bucket      string
+	pathPrefix  string
+	layout      string
+
+	contentTypes map[string]string
+	cacheControl string
+	storageClass string // Applied to artifacts only, so manifests stay readable
+	sse          encrypt.ServerSide
+	tags         map[string]string // Object tags of artifacts; values may hold {metadata} placeholders
+
+	lockMode minio.RetentionMode // Object Lock mode of artifacts and manifests; empty when disabled
+	lockDays int
+
+	multipartThreshold int64
+	partSize           uint64
+	concurrentParts    uint
+}
+
+// defaultContentTypes maps artifact file extensions to their content type.
+var defaultContentTypes = map[string]string{
+	".zip":  "application/zip",
+	".json": "application/json",
+	".zst":  "application/zstd",
+	".gz":   "application/gzip",
+	".tar":  "application/x-tar",
+}
+
+// NewS3Storage creates an S3 storage using minio-go/v7.
+func NewS3Storage(cfg config.R2Config) (*S3Storage, error) {
+	// Remove scheme if present, minio-go expects host:port
+	endpoint := cfg.Endpoint
+	secure := true
+	if strings.HasPrefix(endpoint, "https://") {
+		endpoint = strings.TrimPrefix(endpoint, "https://")
+	} else if strings.HasPrefix(endpoint, "http://") {
+		endpoint = strings.TrimPrefix(endpoint, "http://")
+		secure = false
+	}
+	// A bare IPv6 address must be bracketed to be told apart from a port
+	if ip := net.ParseIP(endpoint); ip != nil && ip.To4() == nil {
+		endpoint = "[" + endpoint + "]"
+	}
+
+	creds := staticCredentials(cfg, cfg.AccessKey, cfg.SecretKey)
+	if cfg.Credentials == "chain" {
+		creds = chainCredentials(cfg)
+	}
+	client, err := newMinioClient(cfg, endpoint, secure, creds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize minio client: %w", err)
+	}
+
+	// Separate prune credentials let the upload credentials stay write-only
+	pruneClient := client
+	if cfg.PruneAccessKey != "" {
+		pruneClient, err = newMinioClient(cfg, endpoint, secure, staticCredentials(cfg, cfg.PruneAccessKey, cfg.PruneSecretKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize minio prune client: %w", err)
+		}
+	}
+
+	if cfg.AutoCreateBucket {
+		if err := ensureBucket(client, cfg.Bucket, cfg.Region, cfg.ObjectLockMode != ""); err != nil {
+			return nil, err
+		}
+	}
+
+	var sse encrypt.ServerSide
+	switch cfg.SSE {
+	case "s3":
+		sse = encrypt.NewSSE()
+	case "kms":
+		if sse, err = encrypt.NewSSEKMS(cfg.SSEKMSKeyID, nil); err != nil {
+			return nil, fmt.Errorf("invalid SSE-KMS settings: %w", err)
+		}
+	}
+
+	return &S3Storage{
+		client:      client,
+		pruneClient: pruneClient,
+		bucket:      cfg.Bucket,
+		pathPrefix:  cfg.PathPrefix,
+		layout:      cfg.Layout,
+
+		contentTypes: cfg.ContentTypes,
+		cacheControl: cfg.CacheControl,
+		storageClass: cfg.StorageClass,
+		sse:          sse,
+		tags:         cfg.Tags,
+
+		lockMode: minio.RetentionMode(strings.ToUpper(cfg.ObjectLockMode)),
+		lockDays: cfg.ObjectLockDays,
+
+		multipartThreshold: int64(cfg.MultipartThresholdMB) << 20,
+		partSize:           uint64(cfg.PartSizeMB) << 20,
+		concurrentParts:    uint(cfg.ConcurrentParts),
+	}, nil
+}
+
+// ensureBucket creates bucket in region when it does not exist, with Object
+// Lock enabled when objectLocking is set. Prefixes need no creation: they
+// exist as soon as an object is stored under them.
+func ensureBucket(client *minio.Client, bucket, region string, objectLocking bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return fmt.Errorf("failed to check bucket %s: %w", bucket, err)
+	}
+	if exists {
+		return nil
+	}
+	err = client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: region, ObjectLocking: objectLocking})
+	if err != nil {
+		// Another agent may have created it in the meantime
+		if code := minio.ToErrorResponse(err).Code; code != "BucketAlreadyOwnedByYou" && code != "BucketAlreadyExists" {
+			return fmt.Errorf("failed to create bucket %s: %w", bucket, err)
+		}
+		return nil
+	}
+	Infof("Created bucket %s", bucket)
+	return nil
+}
+
+// staticCredentials returns fixed access keys signed with the configured signature version.
+func staticCredentials(cfg config.R2Config, accessKey, secretKey string) *credentials.Credentials {
+	if cfg.SignatureVersion == "v2" {
+		return credentials.NewStaticV2(accessKey, secretKey, "")
+	}
+	return credentials.NewStaticV4(accessKey, secretKey, "")
+}
+
+// chainCredentials resolves credentials from the environment, the shared AWS
+// credentials file and finally the EC2/ECS instance role or web identity, so
+// cloud-hosted agents don't need long-lived keys in the config.
+func chainCredentials(cfg config.R2Config) *credentials.Credentials {
+	return credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.FileAWSCredentials{Profile: cfg.Profile},
+		&credentials.IAM{},
+	})
+}
+
+// newMinioClient creates a client with the configured addressing style and region.
+func newMinioClient(cfg config.R2Config, endpoint string, secure bool, creds *credentials.Credentials) (*minio.Client, error) {
+	lookup := minio.BucketLookupAuto
+	switch cfg.Addressing {
+	case "path":
+		lookup = minio.BucketLookupPath
+	case "virtual":
+		lookup = minio.BucketLookupDNS
+	}
+
+	return minio.New(endpoint, &minio.Options{
+		Creds:        creds,
+		Secure:       secure,
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+	})
+}
+
+// ObjectKey builds the object key for an artifact of the given source.
+func (s *S3Storage) ObjectKey(source string, ts time.Time, filename string) string {
+	return objectKey(s.pathPrefix, s.layout, source, ts, filename)
+}
+
+// Upload uploads a file to storage under the given object key. Stored objects
+// are immutable: the upload fails with ErrObjectExists instead of replacing an
+// object with the same key, e.g. when several hosts share a misconfigured prefix.
+func (s *S3Storage) Upload(ctx context.Context, key string, content io.Reader) error {
+	// No HEAD first: write-only credentials may not check for the object
+	opts := s.putOptions(key)
+	opts.SetMatchETagExcept("*") // If-None-Match: *
+	return s.put(ctx, key, content, opts)
+}
+
+// Replace uploads a file to storage, deliberately overwriting any object
+// stored under the same key.
+func (s *S3Storage) Replace(ctx context.Context, key string, content io.Reader) error {
+	return s.put(ctx, key, content, s.putOptions(key))
+}
+
+// putOptions returns the content type and headers of an upload, derived from
+// the key's file extension. Artifacts get the configured storage class;
+// manifests and canaries keep the default one, as archive tiers can't be read
+// without restoring the object first. Server-side encryption applies to all.
+func (s *S3Storage) putOptions(key string) minio.PutObjectOptions {
+	ext := strings.ToLower(path.Ext(key))
+	contentType, ok := s.contentTypes[ext]
+	if !ok {
+		contentType, ok = defaultContentTypes[ext]
+	}
+	if !ok {
+		contentType = "application/octet-stream"
+	}
+	opts := minio.PutObjectOptions{
+		ContentType:          contentType,
+		ContentDisposition:   fmt.Sprintf("attachment; filename=%q", path.Base(key)),
+		CacheControl:         s.cacheControl,
+		ServerSideEncryption: s.sse,
+	}
+	if IsArtifactKey(key) {
+		opts.StorageClass = s.storageClass
+	}
+	// Manifests are locked too: they may hold the wrapped key of their artifact
+	if s.lockMode != "" && artifactNamePattern.MatchString(path.Base(key)) {
+		opts.Mode = s.lockMode
+		opts.RetainUntilDate = time.Now().AddDate(0, 0, s.lockDays).UTC()
+	}
+	return opts
+}
+
+// put uploads content in a single request when it is smaller than the
+// multipart threshold. Larger content is sent as a multipart upload whose
+// parts are read in turn and uploaded concurrently. Artifact files come with
+// their size and are streamed either way; content of unknown size is
+// buffered up to the threshold to tell.
+func (s *S3Storage) put(ctx context.Context, key string, content io.Reader, opts minio.PutObjectOptions) error {
+	if IsArtifactKey(key) {
+		opts.UserMetadata = objectMetadata(ctx)
+		opts.UserTags = s.objectTags(opts.UserMetadata)
+	}
+	body, size := content, uploadSize(ctx)
+	if size < 0 {
+		head, err := io.ReadAll(io.LimitReader(content, s.multipartThreshold))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		body = io.MultiReader(bytes.NewReader(head), content)
+		if int64(len(head)) < s.multipartThreshold {
+			body, size = bytes.NewReader(head), int64(len(head))
+		}
+	}
+	if size >= 0 && size < s.multipartThreshold {
+		opts.DisableMultipart = true
+	} else {
+		opts.PartSize = s.partSize
+		opts.NumThreads = s.concurrentParts
+		opts.ConcurrentStreamParts = true
+	}
+
+	info, err := s.client.PutObject(ctx, s.bucket, key, body, size, opts)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "PreconditionFailed" {
+			return fmt.Errorf("%w: %s", ErrObjectExists, key)
+		}
+		return fmt.Errorf("failed to upload object %s: %w", key, err)
+	}
+
+	Infof("Uploaded %s to %s (Size: %d)", key, s.bucket, info.Size)
+	return nil
+}
+
+// objectTags returns the configured tags, with {name} placeholders replaced by
+// the metadata of the artifact. Tags left empty are dropped.
+func (s *S3Storage) objectTags(metadata map[string]string) map[string]string {
+	if len(s.tags) == 0 {
+		return nil
+	}
+	var pairs []string
+	for name, value := range metadata {
+		pairs = append(pairs, "{"+name+"}", value)
+	}
+	replacer := strings.NewReplacer(pairs...)
+	tags := make(map[string]string, len(s.tags))
+	for name, value := range s.tags {
+		if value = replacer.Replace(value); value != "" {
+			tags[name] = value
+		}
+	}
+	return tags
+}
+
+// StartChunked starts a multipart upload to key with the options of a
+// regular upload, for UploadChunked.
+func (s *S3Storage) StartChunked(ctx context.Context, key string) (string, error) {
+	opts := s.putOptions(key)
+	if IsArtifactKey(key) {
+		opts.UserMetadata = objectMetadata(ctx)
+		opts.UserTags = s.objectTags(opts.UserMetadata)
+	}
+	return minio.Core{Client: s.client}.NewMultipartUpload(ctx, s.bucket, key, opts)
+}
+
+// PutChunk uploads a part with its MD5 and SHA256, which the provider checks
+// before storing it, and returns the part's ETag.
+func (s *S3Storage) PutChunk(ctx context.Context, key, uploadID string, n int, chunk []byte) (string, error) {
+	md5sum, sha256sum := md5.Sum(chunk), sha256.Sum256(chunk)
+	part, err := minio.Core{Client: s.client}.PutObjectPart(ctx, s.bucket, key, uploadID, n, bytes.NewReader(chunk), int64(len(chunk)), minio.PutObjectPartOptions{
+		Md5Base64: base64.StdEncoding.EncodeToString(md5sum[:]),
+		Sha256Hex: hex.EncodeToString(sha256sum[:]),
+		// Sign the SHA256 instead of streaming signatures over plain HTTP
+		DisableContentSha256: true,
+	})
+	return part.ETag, err
+}
+
+// StoredChunks returns the ETags of the parts uploaded so far.
+func (s *S3Storage) StoredChunks(ctx context.Context, key, uploadID string) (map[int]string, error) {
+	core := minio.Core{Client: s.client}
+	tags := make(map[int]string)
+	marker := 0
+	for {
+		result, err := core.ListObjectParts(ctx, s.bucket, key, uploadID, marker, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range result.ObjectParts {
+			tags[part.PartNumber] = strings.Trim(part.ETag, `"`) // Quoted, unlike those of PutObjectPart
+		}
+		if !result.IsTruncated {
+			return tags, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+// CompleteChunked assembles the parts into the object, unless another object
+// was stored under key in the meantime.
+func (s *S3Storage) CompleteChunked(ctx context.Context, key, uploadID string, tags []string) error {
+	parts := make([]minio.CompletePart, len(tags))
+	for i, tag := range tags {
+		parts[i] = minio.CompletePart{PartNumber: i + 1, ETag: tag}
+	}
+	var opts minio.PutObjectOptions
+	opts.SetMatchETagExcept("*") // If-None-Match: *
+	_, err := minio.Core{Client: s.client}.CompleteMultipartUpload(ctx, s.bucket, key, uploadID, parts, opts)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "PreconditionFailed" {
+			return fmt.Errorf("%w: %s", ErrObjectExists, key)
+		}
+		return fmt.Errorf("failed to complete upload of %s: %w", key, err)
+	}
+	Infof("Uploaded %s to %s in %d chunks", key, s.bucket, len(parts))
+	return nil
+}
+
+// AbortChunked aborts a multipart upload, deleting its parts.
+func (s *S3Storage) AbortChunked(ctx context.Context, key, uploadID string) error {
+	return minio.Core{Client: s.client}.AbortMultipartUpload(ctx, s.bucket, key, uploadID)
+}
+
+// Exists reports whether an object is stored under key.
+func (s *S3Storage) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err == nil {
+		return true, nil
+	}
+	resp := minio.ToErrorResponse(err)
+	if resp.Code == "NoSuchKey" {
+		return false, nil
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		return false, fmt.Errorf("%w: %s: %v", ErrExistsUnknown, key, err)
+	}
+	return false, fmt.Errorf("failed to stat object %s: %w", key, err)
+}
+
+// Delete removes an object from storage.
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete object %s: %w", key, err)
+	}
+	return nil
+}
+
+// SelfTest writes, reads back and deletes a canary object. The canary is
+// deleted with the prune credentials, which may be the only delete-capable ones.
+func (s *S3Storage) SelfTest(ctx context.Context) error {
+	return canaryTest(ctx, s, func(ctx context.Context, key string) error {
+		return s.pruneClient.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+	})
+}
+
+// PresignedURL returns a URL granting GET access to the object for the given
+// duration (at most 7 days), without sharing credentials.
+func (s *S3Storage) PresignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, expires, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign %s: %w", key, err)
+	}
+	return u.String(), nil
+}
+
+// List returns the objects stored under the configured path prefix.
+func (s *S3Storage) List(ctx context.Context) ([]ObjectInfo, error) {
+	opts := minio.ListObjectsOptions{
+		Prefix:    s.pathPrefix,
+		Recursive: true,
+	}
+
+	var objects []ObjectInfo
+	for object := range s.client.ListObjects(ctx, s.bucket, opts) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		objects = append(objects, ObjectInfo{
+			Key:          object.Key,
+			Size:         object.Size,
+			LastModified: object.LastModified,
+		})
+	}
+	return objects, nil
+}
+
+// Download writes the content of an object to w.
+func (s *S3Storage) Download(ctx context.Context, key string, w io.Writer) error {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get object %s: %w", key, err)
+	}
+	defer object.Close()
+
+	if _, err := io.Copy(w, object); err != nil {
+		return fmt.Errorf("failed to download object %s: %w", key, err)
+	}
+	return nil
+}
+
+// locked reports whether an object version is under an Object Lock retention
+// that has not expired yet. Deleting it would fail.
+func (s *S3Storage) locked(ctx context.Context, object minio.ObjectInfo, now time.Time) bool {
+	_, until, err := s.pruneClient.GetObjectRetention(ctx, s.bucket, object.Key, object.VersionID)
+	if err != nil {
+		return false // No retention set on the object
+	}
+	return until != nil && until.After(now)
+}
+
+// EnforceRetention deletes artifacts older than their retention period.
+// Expired objects are deleted in batches (DeleteObjects) while listing
+// continues, so large buckets are pruned in a single pass. Deletions stop at
+// the limits of a run, guarding against a misconfigured retention wiping the
+// bucket. Objects still under Object Lock are kept until their lock
+// expires.
+func (s *S3Storage) EnforceRetention(ctx context.Context, retention RetentionFunc, limits RetentionLimits) (RetentionStats, error) {
+	now := time.Now()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// List objects, queueing expired ones for deletion
+	opts := minio.ListObjectsOptions{
+		Prefix:    s.pathPrefix,
+		Recursive: true,
+		// Locked buckets are versioned: a plain delete only adds a delete
+		// marker, so expired versions are deleted by version ID
+		WithVersions: s.lockMode != "",
+	}
+	expired := make(chan minio.ObjectInfo, 1000)
+	listDone := make(chan struct{})
+	listedCount, skippedCount, expiredCount, lockedCount, capped := 0, 0, 0, 0, false
+	var expiredBytes int64
+	var listErr error // Stops the listing; the deletions queued so far still go ahead
+	// Sizes of the queued objects by name and version, as deletion results carry neither
+	var sizesMu sync.Mutex
+	sizes := make(map[string]int64)
+	go func() {
+		defer close(listDone)
+		defer close(expired)
+		for object := range s.pruneClient.ListObjects(ctx, s.bucket, opts) {
+			if object.Err != nil {
+				if ctx.Err() == nil {
+					listErr = object.Err
+				}
+				return
+			}
+			if object.IsDeleteMarker {
+				continue
+			}
+			listedCount++
+			if listedCount%retentionProgressInterval == 0 {
+				Debugf("Retention: scanned %d objects, %d expired so far", listedCount, expiredCount)
+			}
+
+			if !IsArtifactKey(object.Key) {
+				skippedCount++
+				continue
+			}
+
+			if !isExpired(ObjectInfo{Key: object.Key, Size: object.Size, LastModified: object.LastModified}, retention, now) {
+				continue
+			}
+			if s.lockMode != "" && s.locked(ctx, object, now) {
+				lockedCount++
+				continue
+			}
+
+			if limits.reached(expiredCount, expiredBytes, object.Size) {
+				capped = true
+				return
+			}
+			expiredCount++
+			expiredBytes += object.Size
+			sizesMu.Lock()
+			sizes[object.Key+"\x00"+object.VersionID] = object.Size
+			sizesMu.Unlock()
+			select {
+			case expired <- object:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var stats RetentionStats
+	deletedCount, failedCount := 0, 0
+	for result := range s.pruneClient.RemoveObjectsWithResult(ctx, s.bucket, expired, minio.RemoveObjectsOptions{}) {
+		if result.Err != nil {
+			if ctx.Err() != nil {
+				continue // Interrupted, not failed
+			}
+			failedCount++
+			Errorf("failed to delete expired object %s: %v", result.ObjectName, result.Err)
+			continue
+		}
+		deletedCount++
+		sizesMu.Lock()
+		stats.Bytes += sizes[result.ObjectName+"\x00"+result.ObjectVersionID]
+		sizesMu.Unlock()
+		if deletedCount%retentionProgressInterval == 0 {
+			Debugf("Retention: deleted %d expired backups so far", deletedCount)
+		}
+	}
+	<-listDone
+	stats.Deleted = deletedCount
+
+	if deletedCount > 0 {
+		Infof("Retention policy enforced: deleted %d expired backups.", deletedCount)
+	}
+	if lockedCount > 0 {
+		Infof("Retention policy kept %d expired backups still under object lock.", lockedCount)
+	}
+	if skippedCount > 0 {
+		Infof("Retention policy ignored %d objects not created by this tool.", skippedCount)
+	}
+	if capped {
+		Warnf("retention stopped at the limit of %s per run; remaining expired backups will be deleted by later runs", limits)
+	}
+	if err := ctx.Err(); err != nil {
+		return stats, retentionInterrupted(deletedCount, err)
+	}
+	if listErr != nil {
+		return stats, fmt.Errorf("failed to list objects after %d: %w", listedCount, listErr)
+	}
+	if failedCount > 0 {
+		return stats, fmt.Errorf("failed to delete %d expired backups", failedCount)
+	}
+
+	return stats, nil
+}
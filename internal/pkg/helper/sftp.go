@@ -0,0 +1,267 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// partialSuffix marks files still being uploaded; they are renamed into place
+// once complete, so readers and retention never see partial artifacts.
+const partialSuffix = ".partial"
+
+// SFTPStorage stores artifacts on an SFTP server below a base path.
+type SFTPStorage struct {
+	client   *sftp.Client
+	host     string
+	basePath string
+	layout   string
+}
+
+// NewSFTPStorage connects to the configured SFTP server.
+func NewSFTPStorage(cfg config.SFTPConfig) (*SFTPStorage, error) {
+	var auth []ssh.AuthMethod
+	if cfg.KeyFile != "" {
+		key, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sftp key: %w", err)
+		}
+		var signer ssh.Signer
+		if cfg.KeyPass != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(cfg.KeyPass))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sftp key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+
+	hostKeyCallback, err := sftpHostKeyCallback(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	conn, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	client, err := sftp.NewClient(conn, sftp.UseConcurrentWrites(true))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start sftp session on %s: %w", addr, err)
+	}
+
+	return &SFTPStorage{
+		client:   client,
+		host:     cfg.Host,
+		basePath: cfg.BasePath,
+		layout:   cfg.Layout,
+	}, nil
+}
+
+// sftpHostKeyCallback verifies the server against known_hosts.
+func sftpHostKeyCallback(cfg config.SFTPConfig) (ssh.HostKeyCallback, error) {
+	if cfg.InsecureIgnoreHostKey {
+		Warnf("sftp host key verification disabled")
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	knownHosts := cfg.KnownHosts
+	if knownHosts == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate known_hosts: %w", err)
+		}
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known_hosts %s: %w", knownHosts, err)
+	}
+	return callback, nil
+}
+
+// remotePath maps a key to its path on the server. An empty base path is
+// the login directory.
+func (s *SFTPStorage) remotePath(key string) string {
+	return path.Join(s.basePath, key)
+}
+
+// key maps a path on the server back to its key.
+func (s *SFTPStorage) key(remotePath string) string {
+	if s.basePath == "" {
+		return remotePath
+	}
+	return strings.TrimPrefix(remotePath, path.Clean(s.basePath)+"/")
+}
+
+func (s *SFTPStorage) ObjectKey(source string, ts time.Time, filename string) string {
+	return objectKey("", s.layout, source, ts, filename)
+}
+
+// Upload writes a partial file and renames it into place. SFTP renames fail
+// when the target exists, which keeps stored artifacts immutable.
+func (s *SFTPStorage) Upload(ctx context.Context, key string, content io.Reader) error {
+	exists, err := s.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%w: %s", ErrObjectExists, key)
+	}
+
+	partial, err := s.write(ctx, key, content)
+	if err != nil {
+		return err
+	}
+	if err := s.client.Rename(partial, s.remotePath(key)); err != nil {
+		s.client.Remove(partial)
+		if exists, _ := s.Exists(ctx, key); exists {
+			return fmt.Errorf("%w: %s", ErrObjectExists, key)
+		}
+		return fmt.Errorf("failed to upload object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *SFTPStorage) Replace(ctx context.Context, key string, content io.Reader) error {
+	partial, err := s.write(ctx, key, content)
+	if err != nil {
+		return err
+	}
+	if err := s.client.PosixRename(partial, s.remotePath(key)); err != nil {
+		s.client.Remove(partial)
+		return fmt.Errorf("failed to upload object %s: %w", key, err)
+	}
+	return nil
+}
+
+// write uploads content to the partial file of key and returns its path.
+func (s *SFTPStorage) write(ctx context.Context, key string, content io.Reader) (string, error) {
+	target := s.remotePath(key)
+	if err := s.client.MkdirAll(path.Dir(target)); err != nil {
+		return "", fmt.Errorf("failed to create directory for %s: %w", key, err)
+	}
+
+	partial := target + partialSuffix
+	file, err := s.client.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload object %s: %w", key, err)
+	}
+	// Closing the file aborts the concurrent writes of ReadFrom on cancellation
+	stop := context.AfterFunc(ctx, func() { file.Close() })
+	size, err := file.ReadFrom(content)
+	stop()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		s.client.Remove(partial)
+		return "", fmt.Errorf("failed to upload object %s: %w", key, err)
+	}
+
+	Infof("Uploaded %s to %s (Size: %d)", key, s.host, size)
+	return partial, nil
+}
+
+func (s *SFTPStorage) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.client.Stat(s.remotePath(key))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to stat object %s: %w", key, err)
+}
+
+func (s *SFTPStorage) Download(ctx context.Context, key string, w io.Writer) error {
+	file, err := s.client.Open(s.remotePath(key))
+	if err != nil {
+		return fmt.Errorf("failed to get object %s: %w", key, err)
+	}
+	defer file.Close()
+
+	stop := context.AfterFunc(ctx, func() { file.Close() })
+	defer stop()
+	if _, err := file.WriteTo(w); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return fmt.Errorf("failed to download object %s: %w", key, err)
+	}
+	return nil
+}
+
+// List walks the base path. Partial uploads are left out.
+func (s *SFTPStorage) List(ctx context.Context) ([]ObjectInfo, error) {
+	root := s.remotePath("")
+	if root == "" {
+		root = "."
+	}
+	var objects []ObjectInfo
+	walker := s.client.Walk(root)
+	for walker.Step() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := walker.Err(); err != nil {
+			if walker.Path() == root && errors.Is(err, os.ErrNotExist) {
+				return nil, nil // Nothing uploaded yet
+			}
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		info := walker.Stat()
+		if info.IsDir() || strings.HasSuffix(walker.Path(), partialSuffix) {
+			continue
+		}
+		objects = append(objects, ObjectInfo{Key: s.key(walker.Path()), Size: info.Size(), LastModified: info.ModTime()})
+	}
+	return objects, nil
+}
+
+func (s *SFTPStorage) Delete(ctx context.Context, key string) error {
+	if err := s.client.Remove(s.remotePath(key)); err != nil {
+		return fmt.Errorf("failed to delete object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *SFTPStorage) EnforceRetention(ctx context.Context, retention RetentionFunc, limits RetentionLimits) (RetentionStats, error) {
+	return enforceRetention(ctx, s, retention, limits)
+}
+
+func (s *SFTPStorage) SelfTest(ctx context.Context) error {
+	return canaryTest(ctx, s, s.Delete)
+}
+
+func (s *SFTPStorage) PresignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return "", ErrNotSupported
+}
@@ -0,0 +1,160 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// spoolIndex is the name of the queue index inside the spool directory.
+const spoolIndex = "queue.json"
+
+// SpoolEntry is an artifact waiting in the spool for upload.
+type SpoolEntry struct {
+	Key      string    `json:"key"`  // Object key the artifact is uploaded to
+	File     string    `json:"file"` // Artifact file name inside the spool directory
+	Source   string    `json:"source"`
+	QueuedAt time.Time `json:"queued_at"`
+	Error    string    `json:"error"` // Upload error that caused the artifact to be queued
+}
+
+// Spool keeps artifacts that could not be uploaded, together with their
+// manifests, until storage is reachable again.
+type Spool struct {
+	dir       string
+	chunkSize int64 // Chunk size of resumable uploads; zero when disabled
+}
+
+// NewSpool creates a spool in dir. With a chunkSize, artifacts are uploaded in
+// chunks, resuming the uploads interrupted before they were queued.
+func NewSpool(dir string, chunkSize int64) *Spool {
+	return &Spool{dir: dir, chunkSize: chunkSize}
+}
+
+// Entries returns the queued artifacts, oldest first.
+func (s *Spool) Entries() ([]SpoolEntry, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, spoolIndex))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool index: %w", err)
+	}
+	var entries []SpoolEntry
+	if err := sonic.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse spool index: %w", err)
+	}
+	return entries, nil
+}
+
+// Path returns the path of a queued artifact; its manifest is stored next to it.
+func (s *Spool) Path(entry SpoolEntry) string {
+	return filepath.Join(s.dir, entry.File)
+}
+
+// Enqueue moves an artifact into the spool and stores its manifest next to it.
+func (s *Spool) Enqueue(entry SpoolEntry, artifactPath string, manifest []byte) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create spool dir: %w", err)
+	}
+	entries, err := s.Entries()
+	if err != nil {
+		return err
+	}
+
+	entry.File = filepath.Base(artifactPath)
+	dst := filepath.Join(s.dir, entry.File)
+	if err := os.Rename(artifactPath, dst); err != nil {
+		// The temp dir may be on another filesystem
+		if err := CopyFile(artifactPath, dst); err != nil {
+			return fmt.Errorf("failed to spool artifact: %w", err)
+		}
+	}
+	if err := os.WriteFile(ManifestKey(dst), manifest, 0600); err != nil {
+		return fmt.Errorf("failed to spool manifest: %w", err)
+	}
+	// The upload resumes from the chunks already stored
+	if err := os.Rename(chunkStatePath(artifactPath), chunkStatePath(dst)); err != nil && !os.IsNotExist(err) {
+		if err := CopyFile(chunkStatePath(artifactPath), chunkStatePath(dst)); err == nil {
+			os.Remove(chunkStatePath(artifactPath))
+		}
+	}
+
+	return s.save(append(entries, entry))
+}
+
+// Flush uploads the queued artifacts and their manifests, removing them from
+// the spool. Artifacts that still fail to upload stay queued. It returns the
+// number of uploaded artifacts.
+func (s *Spool) Flush(ctx context.Context, store Storage) (int, error) {
+	entries, err := s.Entries()
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+
+	var remaining []SpoolEntry
+	var errs []error
+	for i, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			remaining = append(remaining, entries[i:]...) // Left for the next flush
+			errs = append(errs, err)
+			break
+		}
+		if err := s.upload(ctx, store, entry); err != nil {
+			entry.Error = err.Error()
+			remaining = append(remaining, entry)
+			errs = append(errs, fmt.Errorf("%s: %w", entry.Key, err))
+			continue
+		}
+		Infof("Uploaded queued backup %s (queued at %s)", entry.Key, entry.QueuedAt.Format(time.RFC3339))
+	}
+
+	if err := s.save(remaining); err != nil {
+		return len(entries) - len(remaining), err
+	}
+	return len(entries) - len(remaining), errors.Join(errs...)
+}
+
+func (s *Spool) upload(ctx context.Context, store Storage, entry SpoolEntry) error {
+	path := s.Path(entry)
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// An artifact that already exists was uploaded by an earlier, interrupted flush
+	if _, err := uploadArtifact(ctx, store, entry.Key, path, file, s.chunkSize); err != nil && !errors.Is(err, ErrObjectExists) {
+		return err
+	}
+	if manifest, err := os.ReadFile(ManifestKey(path)); err == nil {
+		if err := store.Upload(ctx, ManifestKey(entry.Key), bytes.NewReader(manifest)); err != nil && !errors.Is(err, ErrObjectExists) {
+			return fmt.Errorf("manifest upload failed: %w", err)
+		}
+	}
+
+	os.Remove(path)
+	os.Remove(ManifestKey(path))
+	return nil
+}
+
+func (s *Spool) save(entries []SpoolEntry) error {
+	if entries == nil {
+		entries = []SpoolEntry{}
+	}
+	data, err := sonic.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.dir, spoolIndex+".tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write spool index: %w", err)
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, spoolIndex))
+}
@@ -0,0 +1,32 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// srvTimeout bounds SRV lookups.
+const srvTimeout = 30 * time.Second
+
+// ResolveSRV looks up a DNS SRV record such as _mysql._tcp.db.example.com and
+// returns the target to connect to: the first of the lowest priority, picked
+// by weight among those.
+func ResolveSRV(ctx context.Context, name string) (string, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, srvTimeout)
+	defer cancel()
+
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to resolve SRV record %s: %w", name, err)
+	}
+	for _, record := range records {
+		// A single "." target means the service is decidedly not available
+		if target := strings.TrimSuffix(record.Target, "."); target != "" {
+			return target, int(record.Port), nil
+		}
+	}
+	return "", 0, fmt.Errorf("SRV record %s has no usable target", name)
+}
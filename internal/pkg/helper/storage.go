@@ -1,106 +1,341 @@
 package helper
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"os"
 	"strings"
 	"time"
 
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
-
 	"github.com/davexpro/backup/internal/config"
 )
 
-type Storage struct {
-	client     *minio.Client
-	bucket     string
-	pathPrefix string
+// Storage is a destination for artifacts and their manifests. Keys are
+// slash-separated paths built by ObjectKey.
+type Storage interface {
+	// ObjectKey builds the key for an artifact of the given source.
+	ObjectKey(source string, ts time.Time, filename string) string
+	// Upload stores content under key. Stored objects are immutable: the
+	// upload fails with ErrObjectExists instead of replacing an existing object.
+	Upload(ctx context.Context, key string, content io.Reader) error
+	// Replace stores content under key, deliberately overwriting any existing object.
+	Replace(ctx context.Context, key string, content io.Reader) error
+	// Exists reports whether an object is stored under key.
+	Exists(ctx context.Context, key string) (bool, error)
+	// Download writes the content of an object to w.
+	Download(ctx context.Context, key string, w io.Writer) error
+	// List returns the objects stored under the configured prefix.
+	List(ctx context.Context) ([]ObjectInfo, error)
+	// Delete removes an object.
+	Delete(ctx context.Context, key string) error
+	// EnforceRetention deletes artifacts older than their retention period,
+	// stopping at the limits of a run, and returns what it deleted, also
+	// when it fails partway.
+	EnforceRetention(ctx context.Context, retention RetentionFunc, limits RetentionLimits) (RetentionStats, error)
+	// SelfTest verifies that storage is usable before a long backup.
+	SelfTest(ctx context.Context) error
+	// PresignedURL returns a URL granting GET access to the object for the
+	// given duration, or ErrNotSupported.
+	PresignedURL(ctx context.Context, key string, expires time.Duration) (string, error)
 }
 
-// NewStorage creates a new Storage instance using minio-go/v7.
-func NewStorage(cfg config.R2Config) (*Storage, error) {
-	// Remove scheme if present, minio-go expects host:port
-	endpoint := cfg.Endpoint
-	secure := true
-	if strings.HasPrefix(endpoint, "https://") {
-		endpoint = strings.TrimPrefix(endpoint, "https://")
-	} else if strings.HasPrefix(endpoint, "http://") {
-		endpoint = strings.TrimPrefix(endpoint, "http://")
-		secure = false
+// NewStorage creates the storage backend configured in cfg, or the local
+// storage in only-dump mode so such runs need no remote credentials.
+func NewStorage(cfg *config.Config, opts Options) (Storage, error) {
+	backend := cfg.Storage.Backend
+	if opts.OnlyDump {
+		backend = "local"
 	}
+	return NewBackend(cfg, backend, opts)
+}
 
-	client, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
-		Secure: secure,
-	})
+// NewBackend creates a storage backend by name ("s3", "b2", "sftp", "ftp",
+// "webdav", "gdrive", "local" or "plugin"), configured by its section of cfg.
+func NewBackend(cfg *config.Config, backend string, opts Options) (Storage, error) {
+	var (
+		store Storage
+		err   error
+	)
+	switch backend {
+	case "b2":
+		store, err = NewB2Storage(cfg.B2, cfg.Backup.TempDir)
+	case "sftp":
+		store, err = NewSFTPStorage(cfg.SFTP)
+	case "ftp":
+		store, err = NewFTPStorage(cfg.FTP)
+	case "webdav":
+		store, err = NewWebDAVStorage(cfg.WebDAV)
+	case "gdrive":
+		store, err = NewGDriveStorage(cfg.GDrive)
+	case "local":
+		store = NewLocalStorage(cfg.Local)
+	case "plugin":
+		store, err = NewPluginStore(cfg)
+	default:
+		store, err = NewS3Storage(cfg.R2)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize minio client: %w", err)
+		return nil, err
 	}
+	return WithFaults(store, opts.Faults), nil
+}
 
-	return &Storage{
-		client:     client,
-		bucket:     cfg.Bucket,
-		pathPrefix: cfg.PathPrefix,
-	}, nil
+var (
+	// ErrObjectExists is returned when an upload would overwrite an existing object.
+	ErrObjectExists = errors.New("object already exists")
+	// ErrNotSupported is returned by operations a storage backend cannot provide.
+	ErrNotSupported = errors.New("not supported by this storage")
+	// ErrExistsUnknown is returned by Exists when the credentials may not
+	// check for objects, as with write-only keys. Uploads go ahead regardless.
+	ErrExistsUnknown = errors.New("cannot check whether the object exists")
+)
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
 }
 
-// Upload uploads a file to storage.
-func (s *Storage) Upload(ctx context.Context, filename string, content io.Reader) error {
-	key := fmt.Sprintf("%s/%s", s.pathPrefix, filename)
-	if s.pathPrefix == "" {
-		key = filename
+// objectKey joins an artifact key. With the structured layout, keys are
+// grouped as <prefix>/<source>/<yyyy>/<mm>/<filename> so large buckets stay
+// listable and lifecycle rules can target a single source.
+func objectKey(prefix, layout, source string, ts time.Time, filename string) string {
+	var parts []string
+	if prefix != "" {
+		parts = append(parts, strings.TrimSuffix(prefix, "/"))
+	}
+	if layout == "structured" {
+		parts = append(parts, EscapeName(source), ts.Format("2006"), ts.Format("01"))
 	}
+	parts = append(parts, filename)
+	return strings.Join(parts, "/")
+}
 
-	info, err := s.client.PutObject(ctx, s.bucket, key, content, -1, minio.PutObjectOptions{
-		ContentType: "application/gzip",
-	})
+// KeyPrefix returns the prefix all keys of a storage start with ("" or ending
+// in a slash), whatever its layout.
+func KeyPrefix(store Storage) string {
+	key := strings.TrimSuffix(store.ObjectKey("source", time.Time{}, "file"), "file")
+	return strings.TrimSuffix(key, "source/0001/01/")
+}
+
+// UploadResult describes an uploaded object.
+type UploadResult struct {
+	Key    string
+	Size   int64
+	SHA256 string
+}
+
+// UploadHashed uploads content like Upload while computing its SHA256, so the
+// artifact doesn't need a separate read pass for hashing.
+func UploadHashed(ctx context.Context, store Storage, key string, content io.Reader) (UploadResult, error) {
+	hr := NewHashingReader(content)
+	if err := store.Upload(ctx, key, hr); err != nil {
+		return UploadResult{}, err
+	}
+	hash, size := hr.Sum()
+	return UploadResult{Key: key, Size: size, SHA256: hash}, nil
+}
+
+// DownloadFile downloads an object into a local file.
+func DownloadFile(ctx context.Context, store Storage, key, path string) error {
+	file, err := os.Create(path)
 	if err != nil {
-		return fmt.Errorf("failed to upload object %s: %w", key, err)
+		return fmt.Errorf("failed to create %s: %w", path, err)
 	}
+	defer file.Close()
 
-	log.Printf("Uploaded %s to %s (Size: %d)", key, s.bucket, info.Size)
+	if err := store.Download(ctx, key, file); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// canaryTest verifies that storage is usable by writing, reading back and
+// deleting a tiny canary object with remove.
+func canaryTest(ctx context.Context, store Storage, remove func(ctx context.Context, key string) error) error {
+	key := store.ObjectKey("canary", time.Now(), fmt.Sprintf(".backup_canary_%s", NewRunID()))
+	payload := []byte("backup storage self-test " + time.Now().Format(time.RFC3339))
+
+	if err := store.Upload(ctx, key, bytes.NewReader(payload)); err != nil {
+		return fmt.Errorf("canary put failed: %w", err)
+	}
+	var got bytes.Buffer
+	if err := store.Download(ctx, key, &got); err != nil {
+		return fmt.Errorf("canary get failed: %w", err)
+	}
+	if !bytes.Equal(got.Bytes(), payload) {
+		return fmt.Errorf("canary get returned %d bytes, expected %d", got.Len(), len(payload))
+	}
+	if err := remove(ctx, key); err != nil {
+		return fmt.Errorf("canary delete failed: %w", err)
+	}
 	return nil
 }
 
-// EnforceRetention deletes objects older than the specified retention period.
-func (s *Storage) EnforceRetention(ctx context.Context, retentionHours int) error {
-	if retentionHours <= 0 {
-		return nil
+// RetentionFunc returns the retention period in hours for an artifact key.
+// Zero or negative keeps the artifact forever.
+type RetentionFunc func(key string) int
+
+// FixedRetention applies the same retention period to every artifact.
+func FixedRetention(hours int) RetentionFunc {
+	return func(string) int { return hours }
+}
+
+// ProfileRetention applies the retention period of the mysql database profile
+// an artifact belongs to, or retention.hours.
+func ProfileRetention(cfg *config.Config) RetentionFunc {
+	return func(key string) int {
+		dbName := strings.TrimSuffix(ArtifactName(key), "_staging")
+		if hours := cfg.MySQL.Profile(dbName).RetentionHours; hours > 0 {
+			return hours
+		}
+		return cfg.Retention.Hours
+	}
+}
+
+// isExpired reports whether an object is past its retention period at now.
+func isExpired(object ObjectInfo, retention RetentionFunc, now time.Time) bool {
+	hours := retention(object.Key)
+	return hours > 0 && object.LastModified.Before(now.Add(-time.Duration(hours)*time.Hour))
+}
+
+// RetentionLimits caps the deletions of a retention run, guarding against a
+// misconfigured retention wiping the storage. Zero values are unlimited.
+type RetentionLimits struct {
+	MaxDeletions int   // Objects deleted per run
+	MaxBytes     int64 // Bytes deleted per run; the first deletion of a run is always allowed
+}
+
+// RetentionStats counts the artifacts deleted by a retention run.
+type RetentionStats struct {
+	Deleted int
+	Bytes   int64 // Total size of the deleted artifacts
+}
+
+// reached reports whether deleting another object of size, after count
+// objects totalling bytes, would exceed the limits.
+func (l RetentionLimits) reached(count int, bytes, size int64) bool {
+	if l.MaxDeletions > 0 && count >= l.MaxDeletions {
+		return true
 	}
+	return l.MaxBytes > 0 && count > 0 && bytes+size > l.MaxBytes
+}
 
-	retentionDuration := time.Duration(retentionHours) * time.Hour
-	deadline := time.Now().Add(-retentionDuration)
+func (l RetentionLimits) String() string {
+	var limits []string
+	if l.MaxDeletions > 0 {
+		limits = append(limits, fmt.Sprintf("%d deletions", l.MaxDeletions))
+	}
+	if l.MaxBytes > 0 {
+		limits = append(limits, HumanizeSize(l.MaxBytes))
+	}
+	return strings.Join(limits, " or ")
+}
 
-	// List objects
-	opts := minio.ListObjectsOptions{
-		Prefix:    s.pathPrefix,
-		Recursive: true,
+// retentionProgressInterval is the number of objects between retention progress logs.
+const retentionProgressInterval = 10000
+
+// enforceRetention implements EnforceRetention with List and Delete, for
+// backends without batch deletion.
+func enforceRetention(ctx context.Context, store Storage, retention RetentionFunc, limits RetentionLimits) (RetentionStats, error) {
+	var stats RetentionStats
+	objects, err := store.List(ctx)
+	if err != nil {
+		return stats, err
 	}
 
-	deletedCount := 0
-	for object := range s.client.ListObjects(ctx, s.bucket, opts) {
-		if object.Err != nil {
-			log.Printf("Error listing object: %v", object.Err)
+	now := time.Now()
+	deletedCount, failedCount, skippedCount, capped := 0, 0, 0, false
+	var attemptedBytes int64
+	for _, object := range objects {
+		if ctx.Err() != nil {
+			break
+		}
+		if !IsArtifactKey(object.Key) {
+			skippedCount++
 			continue
 		}
-
-		if object.LastModified.Before(deadline) {
-			err := s.client.RemoveObject(ctx, s.bucket, object.Key, minio.RemoveObjectOptions{})
-			if err != nil {
-				log.Printf("Failed to delete expired object %s: %v", object.Key, err)
-				continue
+		if !isExpired(object, retention, now) {
+			continue
+		}
+		if limits.reached(deletedCount+failedCount, attemptedBytes, object.Size) {
+			capped = true
+			break
+		}
+		attemptedBytes += object.Size
+		if err := store.Delete(ctx, object.Key); err != nil {
+			if ctx.Err() != nil {
+				break
 			}
-			deletedCount++
-			log.Printf("Deleted expired backup: %s (Time: %s)", object.Key, object.LastModified.Format(time.RFC3339))
+			failedCount++
+			Errorf("failed to delete expired object %s: %v", object.Key, err)
+			continue
+		}
+		deletedCount++
+		stats.Deleted++
+		stats.Bytes += object.Size
+		if deletedCount%retentionProgressInterval == 0 {
+			Debugf("Retention: deleted %d expired backups so far", deletedCount)
 		}
 	}
 
 	if deletedCount > 0 {
-		log.Printf("Retention policy enforced: deleted %d expired backups.", deletedCount)
+		Infof("Retention policy enforced: deleted %d expired backups.", deletedCount)
+	}
+	if skippedCount > 0 {
+		Infof("Retention policy ignored %d objects not created by this tool.", skippedCount)
 	}
+	if capped {
+		Warnf("retention stopped at the limit of %s per run; remaining expired backups will be deleted by later runs", limits)
+	}
+	if err := ctx.Err(); err != nil {
+		return stats, retentionInterrupted(deletedCount, err)
+	}
+	if failedCount > 0 {
+		return stats, fmt.Errorf("failed to delete %d expired backups", failedCount)
+	}
+	return stats, nil
+}
 
-	return nil
+// retentionInterrupted reports a retention run stopped by cancellation after
+// deleting deleted backups. The remaining ones are deleted by later runs.
+func retentionInterrupted(deleted int, err error) error {
+	Infof("Retention interrupted after deleting %d expired backups; the rest will be deleted by later runs", deleted)
+	return fmt.Errorf("retention interrupted: %w", err)
+}
+
+// objectMetadataKey is the context key of the metadata stored with artifacts.
+type objectMetadataKey struct{}
+
+// WithObjectMetadata returns a context under which artifacts are uploaded
+// with metadata, on the backends that store object metadata.
+func WithObjectMetadata(ctx context.Context, metadata map[string]string) context.Context {
+	return context.WithValue(ctx, objectMetadataKey{}, metadata)
+}
+
+// objectMetadata returns the metadata set by WithObjectMetadata.
+func objectMetadata(ctx context.Context) map[string]string {
+	metadata, _ := ctx.Value(objectMetadataKey{}).(map[string]string)
+	return metadata
+}
+
+// uploadSizeKey is the context key of the size of the content uploaded.
+type uploadSizeKey struct{}
+
+// withUploadSize returns a context under which the content uploaded is known
+// to be size bytes long, so backends can stream it without buffering.
+func withUploadSize(ctx context.Context, size int64) context.Context {
+	return context.WithValue(ctx, uploadSizeKey{}, size)
+}
+
+// uploadSize returns the size set by withUploadSize, or -1 when unknown.
+func uploadSize(ctx context.Context) int64 {
+	if size, ok := ctx.Value(uploadSizeKey{}).(int64); ok {
+		return size
+	}
+	return -1
 }
@@ -2,53 +2,498 @@ package helper
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/bytedance/sonic"
+
+	"github.com/davexpro/backup/internal/config"
 )
 
 type TelegramSender struct {
 	BotToken string
 	ChatID   string
 	Client   *http.Client
+
+	threadID      int
+	topics        map[string]int
+	chats         []telegramChat // telegram.chats, receiving the messages of their severities
+	silentSuccess bool
+	replyChain    bool
+	stateFile     string
+	hostname      string
+
+	// AttachManifest makes reports include the run's manifests as a JSON document.
+	AttachManifest bool
+
+	plugins []Plugin // Notifier plugins receiving every message
+
+	batchWindow time.Duration // Zero when every message is sent at once
+	mu          sync.Mutex
+	pending     map[string]*batch // Batched messages by severity and job
+	batches     sync.WaitGroup    // Pending batches, done once sent
+	sending     sync.Mutex        // Serializes API calls, so batches queue up behind a flood wait
 }
 
-func NewTelegramSender(botToken, chatID string) *TelegramSender {
-	return &TelegramSender{
-		BotToken: botToken,
-		ChatID:   chatID,
-		Client:   &http.Client{Timeout: 10 * time.Second},
+// Severity routes a message to the chats of telegram.chats listing it.
+type Severity string
+
+const (
+	SeveritySuccess Severity = "success" // Successful runs; silent with telegram.silent_success
+	SeverityInfo    Severity = "info"    // Everything else worth knowing
+	SeverityAlert   Severity = "alert"   // Failures and anything waiting for an operator
+)
+
+// telegramChat is a chat messages are delivered to: chat_id, receiving every
+// message in the topic of its job, or an entry of telegram.chats.
+type telegramChat struct {
+	id         string
+	threadID   int
+	severities []string // Empty: all
+	main       bool     // chat_id
+}
+
+// batch is the messages of a job waiting to be merged into one.
+type batch struct {
+	job      string
+	severity Severity
+	messages []string
+	timer    *time.Timer
+}
+
+const (
+	// floodRetries and maxFloodWait bound the waits for Telegram's flood
+	// control (429 Too Many Requests with retry_after).
+	floodRetries = 3
+	maxFloodWait = time.Minute
+)
+
+// batchingSenders are the senders with a batch window, flushed by FlushNotifications.
+var batchingSenders struct {
+	sync.Mutex
+	senders []*TelegramSender
+}
+
+func NewTelegramSender(cfg config.TelegramConfig) *TelegramSender {
+	hostname, _ := os.Hostname()
+	batchWindow, _ := time.ParseDuration(cfg.BatchWindow) // Validated by LoadConfig
+	sender := &TelegramSender{
+		BotToken:      cfg.BotToken,
+		ChatID:        cfg.ChatID,
+		Client:        newTelegramClient(cfg),
+		threadID:      cfg.ThreadID,
+		topics:        cfg.Topics,
+		silentSuccess: cfg.SilentSuccess,
+		replyChain:    cfg.ReplyChain,
+		stateFile:     cfg.StateFile,
+		hostname:      hostname,
+
+		AttachManifest: cfg.AttachManifest,
+
+		batchWindow: batchWindow,
+		pending:     make(map[string]*batch),
+	}
+	for _, chat := range cfg.Chats {
+		sender.chats = append(sender.chats, telegramChat{id: chat.ID, threadID: chat.ThreadID, severities: chat.Severities})
+	}
+	if batchWindow > 0 {
+		batchingSenders.Lock()
+		batchingSenders.senders = append(batchingSenders.senders, sender)
+		batchingSenders.Unlock()
+	}
+	return sender
+}
+
+// newTelegramClient returns the HTTP client of the Bot API, going through
+// telegram.proxy when set and the environment's proxy otherwise.
+func newTelegramClient(cfg config.TelegramConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Proxy != "" {
+		if proxy, err := url.Parse(cfg.Proxy); err == nil { // Validated by LoadConfig
+			transport.Proxy = http.ProxyURL(proxy)
+		}
+	}
+	timeout, _ := time.ParseDuration(cfg.Timeout)
+	if timeout <= 0 {
+		timeout = 10 * time.Second
 	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// FlushNotifications sends the messages still batched by every sender, e.g.
+// before the process exits.
+func FlushNotifications() {
+	batchingSenders.Lock()
+	senders := batchingSenders.senders
+	batchingSenders.Unlock()
+	for _, sender := range senders {
+		if err := sender.Flush(); err != nil {
+			Errorf("failed to send notification: %v", err)
+		}
+	}
+}
+
+// NewNotifier creates the sender for cfg, delivering messages to Telegram and
+// to the notifier plugins found in plugins.dir.
+func NewNotifier(cfg *config.Config) *TelegramSender {
+	sender := NewTelegramSender(cfg.Telegram)
+	plugins, err := FindPlugins(cfg.Plugins.Dir, PluginNotify)
+	if err != nil {
+		Warnf("notifier plugins disabled: %v", err)
+	}
+	sender.SetPlugins(plugins)
+	return sender
+}
+
+// SetPlugins sets the notifier plugins receiving every message of the sender.
+func (s *TelegramSender) SetPlugins(plugins []Plugin) {
+	s.plugins = plugins
+}
+
+// Enabled reports whether the sender is configured to deliver messages.
+func (s *TelegramSender) Enabled() bool {
+	return s.BotToken != "" && (s.ChatID != "" || len(s.chats) > 0)
 }
 
 func (s *TelegramSender) Send(message string) error {
-	if s.BotToken == "" || s.ChatID == "" {
-		return nil // Notification disabled
+	return s.SendJob("", message)
+}
+
+// SendJob sends an informational message on behalf of a job.
+func (s *TelegramSender) SendJob(job, message string) error {
+	return s.Notify(job, SeverityInfo, message)
+}
+
+// Notify sends a message of the given severity on behalf of a job, to chat_id
+// and the telegram.chats listing the severity. In chat_id the message is
+// posted into the forum topic configured for "<hostname>/<job>", "<job>" or
+// "<hostname>" (in that order). With reply chaining, it replies to the job's
+// previous message in each chat.
+func (s *TelegramSender) Notify(job string, severity Severity, message string) error {
+	pluginErrs := s.notifyPlugins(job, severity, message)
+	if !s.Enabled() {
+		return errors.Join(pluginErrs...) // Telegram disabled
+	}
+
+	if s.batchWindow > 0 {
+		s.enqueue(job, severity, message)
+		return errors.Join(pluginErrs...)
+	}
+	err := s.sendMessage(job, severity, message)
+	return errors.Join(append(pluginErrs, err)...)
+}
+
+// notifyPlugins delivers a message to the notifier plugins and returns their errors.
+func (s *TelegramSender) notifyPlugins(job string, severity Severity, message string) []error {
+	var errs []error
+	for _, plugin := range s.plugins {
+		if err := plugin.notify(s.hostname, job, severity, message); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	return errs
+}
 
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", s.BotToken)
+// sendMessage posts a text message on behalf of a job to the chats of its severity.
+func (s *TelegramSender) sendMessage(job string, severity Severity, message string) error {
+	var errs []error
+	for _, chat := range s.chatsFor(severity) {
+		payload := s.params(job, chat, severity)
+		payload["text"] = message
 
-	payload := map[string]string{
-		"chat_id": s.ChatID,
-		"text":    message,
+		jsonData, err := sonic.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal notification payload: %w", err)
+		}
+		errs = append(errs, s.post(s.chainKey(job, chat), "sendMessage", "application/json", jsonData))
 	}
+	return errors.Join(errs...)
+}
 
-	jsonData, err := sonic.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal notification payload: %w", err)
+// enqueue adds a message to the batch of its job and severity, which is sent
+// once the batch window has passed since its first message.
+func (s *TelegramSender) enqueue(job string, severity Severity, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := string(severity) + "/" + job
+	b := s.pending[key]
+	if b == nil {
+		b = &batch{job: job, severity: severity}
+		s.pending[key] = b
+		s.batches.Add(1)
+		b.timer = time.AfterFunc(s.batchWindow, func() {
+			if err := s.flushBatch(key); err != nil {
+				Errorf("failed to send notification: %v", err)
+			}
+		})
+	}
+	b.messages = append(b.messages, message)
+}
+
+// Flush sends the batched messages right away and waits for batches being sent.
+func (s *TelegramSender) Flush() error {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.pending))
+	for key := range s.pending {
+		keys = append(keys, key)
+	}
+	s.mu.Unlock()
+
+	var errs []error
+	for _, key := range keys {
+		errs = append(errs, s.flushBatch(key))
 	}
+	s.batches.Wait()
+	return errors.Join(errs...)
+}
 
-	resp, err := s.Client.Post(url, "application/json", bytes.NewBuffer(jsonData))
+// flushBatch sends a batch, merged into as few messages as fit.
+func (s *TelegramSender) flushBatch(key string) error {
+	s.mu.Lock()
+	b := s.pending[key]
+	delete(s.pending, key)
+	s.mu.Unlock()
+	if b == nil {
+		return nil // Sent by the timer or a flush in the meantime
+	}
+	defer s.batches.Done()
+	b.timer.Stop()
+
+	var errs []error
+	for _, message := range mergeMessages(b.messages) {
+		errs = append(errs, s.sendMessage(b.job, b.severity, message))
+	}
+	return errors.Join(errs...)
+}
+
+// mergeMessages joins messages with blank lines into texts within
+// telegramMessageLimit. A longer message is kept on its own.
+func mergeMessages(messages []string) []string {
+	var merged []string
+	var current strings.Builder
+	for _, message := range messages {
+		if current.Len() > 0 && utf8.RuneCountInString(current.String())+2+utf8.RuneCountInString(message) > telegramMessageLimit {
+			merged = append(merged, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n\n")
+		}
+		current.WriteString(message)
+	}
+	if current.Len() > 0 {
+		merged = append(merged, current.String())
+	}
+	return merged
+}
+
+// SendDocument sends content as a file attachment on behalf of a job, to the
+// chats of its severity. Documents are not delivered to notifier plugins.
+func (s *TelegramSender) SendDocument(job string, severity Severity, filename string, content []byte, caption string) error {
+	if !s.Enabled() {
+		return nil // Notification disabled
+	}
+
+	var errs []error
+	for _, chat := range s.chatsFor(severity) {
+		errs = append(errs, s.sendDocument(job, chat, severity, filename, content, caption))
+	}
+	return errors.Join(errs...)
+}
+
+func (s *TelegramSender) sendDocument(job string, chat telegramChat, severity Severity, filename string, content []byte, caption string) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for field, value := range s.params(job, chat, severity) {
+		text, ok := value.(string)
+		if !ok {
+			data, err := sonic.Marshal(value)
+			if err != nil {
+				return fmt.Errorf("failed to marshal %s: %w", field, err)
+			}
+			text = string(data)
+		}
+		if err := form.WriteField(field, text); err != nil {
+			return err
+		}
+	}
+	if caption != "" {
+		if err := form.WriteField("caption", caption); err != nil {
+			return err
+		}
+	}
+	part, err := form.CreateFormFile("document", filename)
 	if err != nil {
-		return fmt.Errorf("failed to send telegram message: %w", err)
+		return err
+	}
+	if _, err := part.Write(content); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	return s.post(s.chainKey(job, chat), "sendDocument", form.FormDataContentType(), body.Bytes())
+}
+
+// chatsFor returns the chats receiving messages of a severity: chat_id and
+// the telegram.chats listing the severity, or every severity.
+func (s *TelegramSender) chatsFor(severity Severity) []telegramChat {
+	var chats []telegramChat
+	if s.ChatID != "" {
+		chats = append(chats, telegramChat{id: s.ChatID, threadID: s.threadID, main: true})
+	}
+	for _, chat := range s.chats {
+		if len(chat.severities) == 0 || slices.Contains(chat.severities, string(severity)) {
+			chats = append(chats, chat)
+		}
+	}
+	return chats
+}
+
+// params returns the chat, topic, reply and sound parameters of a message
+// of a job to a chat.
+func (s *TelegramSender) params(job string, chat telegramChat, severity Severity) map[string]interface{} {
+	params := map[string]interface{}{
+		"chat_id": chat.id,
+	}
+	threadID := chat.threadID
+	if chat.main {
+		threadID = s.topic(job)
+	}
+	if threadID != 0 {
+		params["message_thread_id"] = threadID
+	}
+	if severity == SeveritySuccess && s.silentSuccess {
+		params["disable_notification"] = true
+	}
+	if key := s.chainKey(job, chat); key != "" {
+		if replyTo := s.lastMessage(key); replyTo != 0 {
+			params["reply_parameters"] = map[string]interface{}{
+				"message_id":                  replyTo,
+				"allow_sending_without_reply": true,
+			}
+		}
 	}
-	defer resp.Body.Close()
+	return params
+}
+
+// chainKey returns the key of the previous message of a job in a chat for
+// reply chaining, or "" without chaining.
+func (s *TelegramSender) chainKey(job string, chat telegramChat) string {
+	if !s.replyChain || job == "" {
+		return ""
+	}
+	if chat.main {
+		return s.hostname + "/" + job
+	}
+	return chat.id + ":" + s.hostname + "/" + job
+}
+
+// post calls a Bot API method. When flood control answers 429 Too Many
+// Requests, the call is retried after the requested delay; meanwhile further
+// messages queue up behind it, merged into batches when batching is enabled.
+func (s *TelegramSender) post(chainKey, method, contentType string, body []byte) error {
+	s.sending.Lock()
+	defer s.sending.Unlock()
+
+	endpoint := fmt.Sprintf("https://api.telegram.org/bot%s/%s", s.BotToken, method)
+	for attempt := 0; ; attempt++ {
+		resp, err := s.Client.Post(endpoint, contentType, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to send telegram message: %w", err)
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < floodRetries {
+			wait := floodWait(resp.Body)
+			resp.Body.Close()
+			Infof("Telegram flood control: retrying in %s", wait)
+			time.Sleep(wait)
+			continue
+		}
+		defer resp.Body.Close()
+		return s.handleResponse(chainKey, resp)
+	}
+}
 
+// floodWait returns the delay requested by a 429 response, within maxFloodWait.
+func floodWait(body io.Reader) time.Duration {
+	var result struct {
+		Parameters struct {
+			RetryAfter int `json:"retry_after"`
+		} `json:"parameters"`
+	}
+	wait := 5 * time.Second
+	if data, err := io.ReadAll(body); err == nil && sonic.Unmarshal(data, &result) == nil && result.Parameters.RetryAfter > 0 {
+		wait = time.Duration(result.Parameters.RetryAfter) * time.Second
+	}
+	return min(wait, maxFloodWait)
+}
+
+// handleResponse checks the answer of an API call and records the message
+// under chainKey for reply chaining.
+func (s *TelegramSender) handleResponse(chainKey string, resp *http.Response) error {
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("telegram api returned non-200 status: %d", resp.StatusCode)
 	}
 
+	if chainKey != "" {
+		var result struct {
+			Result struct {
+				MessageID int `json:"message_id"`
+			} `json:"result"`
+		}
+		data, err := io.ReadAll(resp.Body)
+		if err == nil && sonic.Unmarshal(data, &result) == nil && result.Result.MessageID != 0 {
+			s.saveLastMessage(chainKey, result.Result.MessageID)
+		}
+	}
+
 	return nil
 }
+
+func (s *TelegramSender) topic(job string) int {
+	if job != "" {
+		for _, key := range []string{s.hostname + "/" + job, job, s.hostname} {
+			if id, ok := s.topics[key]; ok {
+				return id
+			}
+		}
+	}
+	return s.threadID
+}
+
+// lastMessage returns the ID of the previous message sent for a chain key.
+func (s *TelegramSender) lastMessage(key string) int {
+	return s.loadState()[key]
+}
+
+func (s *TelegramSender) saveLastMessage(key string, messageID int) {
+	state := s.loadState()
+	state[key] = messageID
+	data, err := sonic.Marshal(state)
+	if err == nil {
+		err = os.WriteFile(s.stateFile, data, 0644)
+	}
+	if err != nil {
+		Warnf("failed to save telegram state: %v", err)
+	}
+}
+
+func (s *TelegramSender) loadState() map[string]int {
+	state := make(map[string]int)
+	data, err := os.ReadFile(s.stateFile)
+	if err == nil {
+		_ = sonic.Unmarshal(data, &state)
+	}
+	return state
+}
@@ -0,0 +1,276 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// botCall is an API call received by a botAPI.
+type botCall struct {
+	Method  string
+	ChatID  string
+	Text    string
+	ReplyTo int // message_id of reply_parameters
+}
+
+// botAPI is a Telegram Bot API answering calls with increasing message IDs.
+// The first floods calls are refused by flood control.
+type botAPI struct {
+	*httptest.Server
+	mu     sync.Mutex
+	calls  []botCall
+	floods int
+}
+
+func newBotAPI(t *testing.T) *botAPI {
+	t.Helper()
+	api := &botAPI{}
+	api.Server = httptest.NewServer(http.HandlerFunc(api.serve))
+	t.Cleanup(api.Close)
+	return api
+}
+
+func (api *botAPI) serve(w http.ResponseWriter, r *http.Request) {
+	call := botCall{Method: r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]}
+	if call.Method == "sendDocument" {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		call.ChatID, call.Text = r.FormValue("chat_id"), r.FormValue("caption")
+	} else {
+		var payload struct {
+			ChatID          string `json:"chat_id"`
+			Text            string `json:"text"`
+			ReplyParameters struct {
+				MessageID int `json:"message_id"`
+			} `json:"reply_parameters"`
+		}
+		data, _ := io.ReadAll(r.Body)
+		if err := sonic.Unmarshal(data, &payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		call.ChatID, call.Text, call.ReplyTo = payload.ChatID, payload.Text, payload.ReplyParameters.MessageID
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if api.floods > 0 {
+		api.floods--
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"ok":false,"error_code":429,"parameters":{"retry_after":1}}`)
+		return
+	}
+	api.calls = append(api.calls, call)
+	fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d}}`, 100+len(api.calls))
+}
+
+// Calls returns the calls answered so far.
+func (api *botAPI) Calls() []botCall {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return append([]botCall(nil), api.calls...)
+}
+
+// sender returns a sender of cfg calling the API instead of api.telegram.org.
+func (api *botAPI) sender(cfg config.TelegramConfig) *TelegramSender {
+	cfg.BotToken = "token"
+	if cfg.ChatID == "" {
+		cfg.ChatID = "42"
+	}
+	sender := NewTelegramSender(cfg)
+	target, _ := url.Parse(api.URL)
+	sender.Client = &http.Client{Transport: redirectTransport{target: target}}
+	return sender
+}
+
+// redirectTransport sends requests to target whatever their host.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (rt redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = rt.target.Scheme, rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestTelegramBatching(t *testing.T) {
+	api := newBotAPI(t)
+	sender := api.sender(config.TelegramConfig{BatchWindow: "1h"})
+
+	for _, message := range []string{"dumped shop", "dumped blog"} {
+		if err := sender.Notify("mysql", SeverityInfo, message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sender.Notify("gitlab", SeverityInfo, "dumped gitlab"); err != nil {
+		t.Fatal(err)
+	}
+	if calls := api.Calls(); len(calls) != 0 {
+		t.Fatalf("sent %+v within the batch window", calls)
+	}
+
+	FlushNotifications()
+	texts := make(map[string]bool)
+	for _, call := range api.Calls() {
+		texts[call.Text] = true
+	}
+	want := map[string]bool{"dumped shop\n\ndumped blog": true, "dumped gitlab": true}
+	if len(texts) != len(want) || !texts["dumped shop\n\ndumped blog"] || !texts["dumped gitlab"] {
+		t.Errorf("flushed %v, want one message per job: %v", texts, want)
+	}
+
+	// Flushing again sends nothing
+	FlushNotifications()
+	if calls := api.Calls(); len(calls) != 2 {
+		t.Errorf("%d calls after a second flush, want 2", len(calls))
+	}
+}
+
+func TestMergeMessages(t *testing.T) {
+	long := strings.Repeat("x", telegramMessageLimit-2)
+	merged := mergeMessages([]string{"a", "b", long, "c"})
+	want := []string{"a\n\nb", long, "c"}
+	if strings.Join(merged, "|") != strings.Join(want, "|") {
+		t.Errorf("merged into %d messages, want %d within the limit", len(merged), len(want))
+	}
+}
+
+func TestTelegramFloodControl(t *testing.T) {
+	api := newBotAPI(t)
+	api.floods = 1
+	sender := api.sender(config.TelegramConfig{})
+
+	start := time.Now()
+	if err := sender.Notify("mysql", SeverityAlert, "dump failed"); err != nil {
+		t.Fatalf("Notify = %v, want it retried after the flood wait", err)
+	}
+	if waited := time.Since(start); waited < time.Second {
+		t.Errorf("retried after %s, want the requested second", waited)
+	}
+	if calls := api.Calls(); len(calls) != 1 || calls[0].Text != "dump failed" {
+		t.Errorf("delivered %+v, want the message once", calls)
+	}
+}
+
+func TestTelegramReplyChain(t *testing.T) {
+	api := newBotAPI(t)
+	cfg := config.TelegramConfig{
+		ReplyChain: true,
+		StateFile:  filepath.Join(t.TempDir(), "telegram.json"),
+		Chats:      []config.TelegramChat{{ID: "alerts", Severities: []string{"alert"}}},
+	}
+	sender := api.sender(cfg)
+
+	send := func(sender *TelegramSender, job string, severity Severity) {
+		t.Helper()
+		if err := sender.Notify(job, severity, job+" report"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send(sender, "mysql", SeverityAlert)  // 101 in chat_id, 102 in alerts
+	send(sender, "gitlab", SeverityAlert) // 103, 104: another chain
+	// A later run replies to the last message of the job in each chat
+	send(api.sender(cfg), "mysql", SeverityAlert)
+
+	calls := api.Calls()
+	if len(calls) != 6 {
+		t.Fatalf("%d calls, want 6", len(calls))
+	}
+	for i, want := range []int{0, 0, 0, 0, 101, 102} {
+		if calls[i].ReplyTo != want {
+			t.Errorf("call %d (%s to %s) replies to %d, want %d", i, calls[i].Text, calls[i].ChatID, calls[i].ReplyTo, want)
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	state := sender.loadState()
+	if state[hostname+"/mysql"] != 105 || state["alerts:"+hostname+"/mysql"] != 106 || state[hostname+"/gitlab"] != 103 {
+		t.Errorf("state = %v, want the last message of each job and chat", state)
+	}
+}
+
+func TestSendReportAsDocument(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the notifier plugin is a shell script")
+	}
+	api := newBotAPI(t)
+	sender := api.sender(config.TelegramConfig{})
+	dir := t.TempDir()
+	received := filepath.Join(dir, "received")
+	path := filepath.Join(dir, "backup-notify-record")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\ncat > '"+received+"'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	sender.SetPlugins([]Plugin{{Kind: PluginNotify, Name: "record", Path: path}})
+
+	var results []BackupResult
+	for i := 0; i < 100; i++ {
+		results = append(results, BackupResult{Database: fmt.Sprintf("database_with_a_long_name_%03d", i), Success: true, Size: 1 << 20, SHA256: strings.Repeat("ab", 32)})
+	}
+	SendReport(sender, "mysql", results, nil, len(results), 0, nil)
+
+	calls := api.Calls()
+	if len(calls) != 1 || calls[0].Method != "sendDocument" || !strings.Contains(calls[0].Text, "Total: 100") {
+		t.Fatalf("telegram calls %+v, want the report as a document", calls)
+	}
+	data, err := os.ReadFile(received)
+	if err != nil {
+		t.Fatalf("report not delivered to the plugin: %v", err)
+	}
+	if !strings.Contains(string(data), "database_with_a_long_name_099") {
+		t.Errorf("plugin received a partial report:\n%s", data)
+	}
+}
+
+func TestSendReportSeverity(t *testing.T) {
+	ok := BackupResult{Database: "shop", Success: true, Size: 1 << 20, SHA256: strings.Repeat("ab", 32)}
+	failed := BackupResult{Database: "blog", Error: errors.New("dump failed")}
+	tests := []struct {
+		name      string
+		results   []BackupResult
+		retention []RetentionResult
+		success   int
+		fail      int
+		want      Severity
+	}{
+		{"success", []BackupResult{ok}, []RetentionResult{{Backend: "s3"}}, 1, 0, SeveritySuccess},
+		{"failed backup", []BackupResult{ok, failed}, nil, 1, 1, SeverityAlert},
+		{"failed backup counted as a success", []BackupResult{failed}, nil, 1, 0, SeverityAlert},
+		{"failed retention", []BackupResult{ok}, []RetentionResult{{Backend: "s3", Error: errors.New("access denied")}}, 1, 0, SeverityAlert},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newBotAPI(t)
+			sender := api.sender(config.TelegramConfig{Chats: []config.TelegramChat{{ID: "alerts", Severities: []string{"alert"}}}})
+			SendReport(sender, "mysql", tt.results, tt.retention, tt.success, tt.fail, nil)
+
+			severity := SeveritySuccess
+			for _, call := range api.Calls() {
+				if call.ChatID == "alerts" {
+					severity = SeverityAlert
+				}
+			}
+			if severity != tt.want {
+				t.Errorf("report sent as %s, want %s", severity, tt.want)
+			}
+		})
+	}
+}
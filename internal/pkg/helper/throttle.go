@@ -0,0 +1,67 @@
+package helper
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// throttledReader limits the average read rate of the underlying reader.
+type throttledReader struct {
+	ctx         context.Context
+	r           io.Reader
+	bytesPerSec int64
+	start       time.Time
+	read        int64
+}
+
+// Throttle limits reads from r to bytesPerSec on average. A non-positive limit
+// leaves the rate unlimited. Either way reads fail once ctx is cancelled.
+func Throttle(ctx context.Context, r io.Reader, bytesPerSec int64) io.Reader {
+	if bytesPerSec <= 0 {
+		return &contextReader{ctx: ctx, r: r}
+	}
+	return &throttledReader{ctx: ctx, r: r, bytesPerSec: bytesPerSec}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if err := t.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	// Keep individual reads small so the rate stays smooth
+	if chunk := t.bytesPerSec / 10; chunk > 0 && int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+
+	due := time.Duration(float64(t.read) / float64(t.bytesPerSec) * float64(time.Second))
+	if wait := due - time.Since(t.start); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-t.ctx.Done():
+			return n, t.ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return n, err
+}
+
+// contextReader fails reads once its context is cancelled, so copies of large
+// files stop promptly.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
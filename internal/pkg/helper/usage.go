@@ -0,0 +1,148 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// usageSampleInterval is how often the temp disk usage is sampled.
+const usageSampleInterval = 5 * time.Second
+
+// Usage is the resource usage of a run.
+type Usage struct {
+	PeakRSS  int64         `json:"peak_rss"`  // Largest resident set of this process or a child (dump, zip), in bytes
+	CPUTime  time.Duration `json:"cpu_ns"`    // User and system time of this process and its children
+	TempPeak int64         `json:"temp_peak"` // High-water mark of temp disk usage, in bytes
+	Uploaded int64         `json:"uploaded"`  // Bytes uploaded to storage
+	WallTime time.Duration `json:"wall_ns"`   // Duration of the run
+	TempDir  string        `json:"temp_dir"`  // Directory whose filesystem was sampled
+}
+
+// String formats the usage for reports.
+func (u Usage) String() string {
+	return fmt.Sprintf("peak RSS %s, CPU %s, temp disk %s, uploaded %s",
+		HumanizeSize(u.PeakRSS), u.CPUTime.Round(time.Second), HumanizeSize(u.TempPeak), HumanizeSize(u.Uploaded))
+}
+
+// UsageMonitor tracks the resource usage of a run. The temp disk high-water
+// mark is measured as the largest drop in free space on the temp filesystem,
+// so other writers on that filesystem are included.
+type UsageMonitor struct {
+	tempDir  string
+	start    time.Time
+	baseline int64 // Free bytes when the run started
+	peak     atomic.Int64
+	uploaded atomic.Int64
+	stop     chan struct{}
+	once     sync.Once
+	wg       sync.WaitGroup
+}
+
+// StartUsageMonitor starts sampling the free space of tempDir.
+func StartUsageMonitor(tempDir string) *UsageMonitor {
+	m := &UsageMonitor{tempDir: tempDir, start: time.Now(), stop: make(chan struct{})}
+	free, err := freeSpace(tempDir)
+	if err != nil {
+		return m // Temp disk usage stays unknown
+	}
+	m.baseline = free
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(usageSampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.sample()
+			}
+		}
+	}()
+	return m
+}
+
+func (m *UsageMonitor) sample() {
+	free, err := freeSpace(m.tempDir)
+	if err != nil {
+		return
+	}
+	if used := m.baseline - free; used > m.peak.Load() {
+		m.peak.Store(used)
+	}
+}
+
+// AddUploaded counts bytes uploaded to storage.
+func (m *UsageMonitor) AddUploaded(n int64) {
+	if m == nil {
+		return
+	}
+	m.uploaded.Add(n)
+}
+
+// Stop ends sampling and returns the usage of the run so far. A nil monitor,
+// of a run that was never started, measured nothing.
+func (m *UsageMonitor) Stop() Usage {
+	if m == nil {
+		return Usage{}
+	}
+	m.once.Do(func() {
+		close(m.stop)
+		m.wg.Wait()
+	})
+	if m.baseline > 0 {
+		m.sample()
+	}
+
+	rss, cpu := processUsage()
+	return Usage{
+		PeakRSS:  rss,
+		CPUTime:  cpu,
+		TempPeak: m.peak.Load(),
+		Uploaded: m.uploaded.Load(),
+		WallTime: time.Since(m.start),
+		TempDir:  m.tempDir,
+	}
+}
+
+// usageRecord is a line of the metrics file.
+type usageRecord struct {
+	Time    time.Time `json:"time"`
+	Job     string    `json:"job"`
+	Success int       `json:"success"`
+	Fail    int       `json:"fail"`
+	Usage
+}
+
+// AppendUsage appends the usage of a job's run to a JSON lines file.
+func AppendUsage(path, job string, success, fail int, usage Usage) error {
+	data, err := sonic.Marshal(usageRecord{Time: time.Now(), Job: job, Success: success, Fail: fail, Usage: usage})
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// logUsage logs the usage of a run and appends it to the metrics file.
+func logUsage(metricsFile, job string, success, fail int, usage Usage) {
+	Infof("Resource usage of %s: %s", job, usage)
+	if metricsFile == "" {
+		return
+	}
+	if err := AppendUsage(metricsFile, job, success, fail, usage); err != nil {
+		Warnf("failed to write metrics: %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+
+package helper
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// processUsage returns the peak RSS and CPU time of this process and its
+// waited-for children.
+func processUsage() (int64, time.Duration) {
+	var self, children syscall.Rusage
+	syscall.Getrusage(syscall.RUSAGE_SELF, &self)
+	syscall.Getrusage(syscall.RUSAGE_CHILDREN, &children)
+
+	rss := max(int64(self.Maxrss), int64(children.Maxrss))
+	if runtime.GOOS != "darwin" {
+		rss *= 1024 // Reported in KiB everywhere but macOS
+	}
+	cpu := time.Duration(self.Utime.Nano() + self.Stime.Nano() + children.Utime.Nano() + children.Stime.Nano())
+	return rss, cpu
+}
+
+// freeSpace returns the bytes available to unprivileged users on the filesystem of dir.
+func freeSpace(dir string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
@@ -0,0 +1,16 @@
+package helper
+
+import (
+	"errors"
+	"time"
+)
+
+// processUsage is not implemented on Windows.
+func processUsage() (int64, time.Duration) {
+	return 0, 0
+}
+
+// freeSpace is not implemented on Windows.
+func freeSpace(string) (int64, error) {
+	return 0, errors.New("not supported on windows")
+}
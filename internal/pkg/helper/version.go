@@ -0,0 +1,32 @@
+package helper
+
+import "runtime/debug"
+
+// ToolVersion returns the version of this tool: the module version when
+// installed with `go install`, otherwise the VCS revision it was built from
+// (with a "-dirty" suffix for modified trees). It is empty when unknown.
+func ToolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if revision != "" && modified == "true" {
+		revision += "-dirty"
+	}
+	return revision
+}
@@ -0,0 +1,436 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+// davPropfind requests the properties List needs.
+const davPropfind = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontentlength/><d:getlastmodified/></d:prop></d:propfind>`
+
+// WebDAVStorage stores artifacts in a WebDAV collection, such as a Nextcloud
+// or ownCloud folder. Uploads go to a partial file that is moved into place
+// without overwriting. When an uploads endpoint is known, files are sent with
+// Nextcloud chunked upload, which avoids the request size and timeout limits
+// of PHP front ends.
+type WebDAVStorage struct {
+	client     *http.Client
+	baseURL    *url.URL
+	uploadsURL *url.URL // nil: single PUT uploads
+	username   string
+	password   string
+	pathPrefix string
+	layout     string
+	chunkSize  int
+
+	mu   sync.Mutex
+	dirs map[string]bool // Collections known to exist
+}
+
+// NewWebDAVStorage creates a storage for the configured WebDAV collection.
+func NewWebDAVStorage(cfg config.WebDAVConfig) (*WebDAVStorage, error) {
+	base, err := url.Parse(strings.TrimSuffix(cfg.URL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid webdav.url: %w", err)
+	}
+	s := &WebDAVStorage{
+		client:     &http.Client{},
+		baseURL:    base,
+		username:   cfg.Username,
+		password:   cfg.Password,
+		pathPrefix: cfg.PathPrefix,
+		layout:     cfg.Layout,
+		chunkSize:  cfg.ChunkSizeMB << 20,
+		dirs:       make(map[string]bool),
+	}
+
+	uploads := cfg.UploadsURL
+	if uploads == "" {
+		uploads = nextcloudUploadsURL(base)
+	}
+	if uploads != "" {
+		if s.uploadsURL, err = url.Parse(strings.TrimSuffix(uploads, "/")); err != nil {
+			return nil, fmt.Errorf("invalid webdav.uploads_url: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// nextcloudUploadsURL derives the chunked upload endpoint of a Nextcloud or
+// ownCloud files URL (.../remote.php/dav/files/<user>/...), or returns "".
+func nextcloudUploadsURL(base *url.URL) string {
+	before, after, ok := strings.Cut(base.Path, "/remote.php/dav/files/")
+	if !ok {
+		return ""
+	}
+	user, _, _ := strings.Cut(after, "/")
+	u := *base
+	u.Path = before + "/remote.php/dav/uploads/" + user
+	u.RawPath = ""
+	return u.String()
+}
+
+// webdavStatusError is a request answered with an unexpected status.
+type webdavStatusError struct {
+	code   int
+	status string
+}
+
+func (e *webdavStatusError) Error() string {
+	return e.status
+}
+
+// webdavStatus returns the status code of a failed request, or 0.
+func webdavStatus(err error) int {
+	var statusErr *webdavStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code
+	}
+	return 0
+}
+
+// url returns the URL of a key (or collection) below the base URL.
+func (s *WebDAVStorage) url(key string) string {
+	u := *s.baseURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	u.RawPath = ""
+	return u.String()
+}
+
+// key maps the href of a PROPFIND response back to its key.
+func (s *WebDAVStorage) key(href string) string {
+	if u, err := url.Parse(href); err == nil {
+		href = u.Path
+	}
+	return strings.Trim(strings.TrimPrefix(href, strings.TrimSuffix(s.baseURL.Path, "/")), "/")
+}
+
+// do sends a request. A negative size streams the body with unknown length.
+func (s *WebDAVStorage) do(ctx context.Context, method, target string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		return nil, &webdavStatusError{code: resp.StatusCode, status: method + " " + resp.Status}
+	}
+	return resp, nil
+}
+
+// request sends a request and discards the response.
+func (s *WebDAVStorage) request(ctx context.Context, method, target string, body io.Reader, size int64, header http.Header) error {
+	resp, err := s.do(ctx, method, target, body, size, header)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// mkdirAll creates the collections holding key. MKCOL answers 405 for
+// existing collections.
+func (s *WebDAVStorage) mkdirAll(ctx context.Context, key string) error {
+	dir := path.Dir(key)
+	if dir == "." {
+		return nil
+	}
+	var current string
+	for _, part := range strings.Split(dir, "/") {
+		current = path.Join(current, part)
+		s.mu.Lock()
+		known := s.dirs[current]
+		s.mu.Unlock()
+		if known {
+			continue
+		}
+		err := s.request(ctx, "MKCOL", s.url(current), nil, 0, nil)
+		if err != nil && webdavStatus(err) != http.StatusMethodNotAllowed {
+			return fmt.Errorf("failed to create collection %s: %w", current, err)
+		}
+		s.mu.Lock()
+		s.dirs[current] = true
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// move moves src to dst. Without overwrite, the server refuses to replace an
+// existing dst (412 Precondition Failed), which keeps artifacts immutable.
+func (s *WebDAVStorage) move(ctx context.Context, src, dst string, overwrite bool) error {
+	flag := "F"
+	if overwrite {
+		flag = "T"
+	}
+	header := http.Header{"Destination": {s.url(dst)}, "Overwrite": {flag}}
+	err := s.request(ctx, "MOVE", s.url(src), nil, 0, header)
+	if webdavStatus(err) == http.StatusPreconditionFailed {
+		return fmt.Errorf("%w: %s", ErrObjectExists, dst)
+	}
+	return err
+}
+
+func (s *WebDAVStorage) ObjectKey(source string, ts time.Time, filename string) string {
+	return objectKey(s.pathPrefix, s.layout, source, ts, filename)
+}
+
+// Upload writes a partial file and moves it into place without overwriting.
+func (s *WebDAVStorage) Upload(ctx context.Context, key string, content io.Reader) error {
+	exists, err := s.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%w: %s", ErrObjectExists, key)
+	}
+
+	partial, err := s.write(ctx, key, content)
+	if err != nil {
+		return err
+	}
+	if err := s.move(ctx, partial, key, false); err != nil {
+		s.request(ctx, http.MethodDelete, s.url(partial), nil, 0, nil)
+		if errors.Is(err, ErrObjectExists) {
+			return err
+		}
+		return fmt.Errorf("failed to upload object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *WebDAVStorage) Replace(ctx context.Context, key string, content io.Reader) error {
+	partial, err := s.write(ctx, key, content)
+	if err != nil {
+		return err
+	}
+	if err := s.move(ctx, partial, key, true); err != nil {
+		s.request(ctx, http.MethodDelete, s.url(partial), nil, 0, nil)
+		return fmt.Errorf("failed to upload object %s: %w", key, err)
+	}
+	return nil
+}
+
+// write uploads content to the partial file of key and returns its key.
+func (s *WebDAVStorage) write(ctx context.Context, key string, content io.Reader) (string, error) {
+	if err := s.mkdirAll(ctx, key); err != nil {
+		return "", err
+	}
+
+	partial := key + partialSuffix
+	var size int64
+	var err error
+	if s.uploadsURL != nil {
+		size, err = s.putChunked(ctx, partial, content)
+	} else {
+		counter := &countingReader{r: content}
+		err = s.request(ctx, http.MethodPut, s.url(partial), counter, -1, nil)
+		size = counter.n
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to upload object %s: %w", key, err)
+	}
+
+	Infof("Uploaded %s to %s (Size: %d)", key, s.baseURL.Host, size)
+	return partial, nil
+}
+
+// putChunked uploads content to key with Nextcloud chunked upload: chunks
+// are uploaded to a transfer collection, then assembled into the target.
+func (s *WebDAVStorage) putChunked(ctx context.Context, key string, content io.Reader) (int64, error) {
+	transfer := s.uploadsURL.JoinPath("backup-" + NewRunID() + NewRunID())
+	header := http.Header{"Destination": {s.url(key)}}
+	if err := s.request(ctx, "MKCOL", transfer.String(), nil, 0, header); err != nil {
+		return 0, fmt.Errorf("failed to start chunked upload: %w", err)
+	}
+
+	var total int64
+	buf := make([]byte, s.chunkSize)
+	for n := 1; ; n++ {
+		read, err := io.ReadFull(content, buf)
+		if err == io.EOF && n > 1 {
+			break
+		}
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			s.request(ctx, http.MethodDelete, transfer.String(), nil, 0, nil)
+			return 0, err
+		}
+		chunk := transfer.JoinPath(fmt.Sprintf("%05d", n)).String()
+		if err := s.request(ctx, http.MethodPut, chunk, bytes.NewReader(buf[:read]), int64(read), header); err != nil {
+			s.request(ctx, http.MethodDelete, transfer.String(), nil, 0, nil)
+			return 0, fmt.Errorf("failed to upload chunk %d: %w", n, err)
+		}
+		total += int64(read)
+		if read < len(buf) {
+			break
+		}
+	}
+
+	header = http.Header{
+		"Destination":     {s.url(key)},
+		"Overwrite":       {"T"},
+		"Oc-Total-Length": {strconv.FormatInt(total, 10)},
+	}
+	if err := s.request(ctx, "MOVE", transfer.JoinPath(".file").String(), nil, 0, header); err != nil {
+		s.request(ctx, http.MethodDelete, transfer.String(), nil, 0, nil)
+		return 0, fmt.Errorf("failed to assemble chunks: %w", err)
+	}
+	return total, nil
+}
+
+func (s *WebDAVStorage) Exists(ctx context.Context, key string) (bool, error) {
+	err := s.request(ctx, http.MethodHead, s.url(key), nil, 0, nil)
+	if err == nil {
+		return true, nil
+	}
+	if webdavStatus(err) == http.StatusNotFound {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to stat object %s: %w", key, err)
+}
+
+func (s *WebDAVStorage) Download(ctx context.Context, key string, w io.Writer) error {
+	resp, err := s.do(ctx, http.MethodGet, s.url(key), nil, 0, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get object %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to download object %s: %w", key, err)
+	}
+	return nil
+}
+
+// davMultistatus is the part of a PROPFIND response List reads.
+type davMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+				ContentLength string `xml:"getcontentlength"`
+				LastModified  string `xml:"getlastmodified"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// List walks the collections below the path prefix with PROPFIND (depth 1,
+// as servers commonly refuse infinite depth). Partial uploads are left out.
+func (s *WebDAVStorage) List(ctx context.Context) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := s.list(ctx, strings.Trim(s.pathPrefix, "/"), &objects)
+	if webdavStatus(err) == http.StatusNotFound {
+		return nil, nil // Nothing uploaded yet
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	return objects, nil
+}
+
+func (s *WebDAVStorage) list(ctx context.Context, dir string, objects *[]ObjectInfo) error {
+	header := http.Header{"Depth": {"1"}, "Content-Type": {"application/xml; charset=utf-8"}}
+	target := strings.TrimSuffix(s.url(dir), "/") + "/"
+	resp, err := s.do(ctx, "PROPFIND", target, strings.NewReader(davPropfind), int64(len(davPropfind)), header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var multistatus davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&multistatus); err != nil {
+		return fmt.Errorf("invalid PROPFIND response: %w", err)
+	}
+	for _, r := range multistatus.Responses {
+		key := s.key(r.Href)
+		if key == dir {
+			continue // The collection itself
+		}
+		var collection bool
+		var size int64
+		var modified time.Time
+		for _, propstat := range r.Propstat {
+			prop := propstat.Prop
+			collection = collection || prop.ResourceType.Collection != nil
+			if n, err := strconv.ParseInt(prop.ContentLength, 10, 64); err == nil {
+				size = n
+			}
+			if t, err := http.ParseTime(prop.LastModified); err == nil {
+				modified = t
+			}
+		}
+		if collection {
+			if err := s.list(ctx, key, objects); err != nil {
+				return err
+			}
+			continue
+		}
+		if strings.HasSuffix(key, partialSuffix) {
+			continue
+		}
+		*objects = append(*objects, ObjectInfo{Key: key, Size: size, LastModified: modified})
+	}
+	return nil
+}
+
+func (s *WebDAVStorage) Delete(ctx context.Context, key string) error {
+	if err := s.request(ctx, http.MethodDelete, s.url(key), nil, 0, nil); err != nil {
+		return fmt.Errorf("failed to delete object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *WebDAVStorage) EnforceRetention(ctx context.Context, retention RetentionFunc, limits RetentionLimits) (RetentionStats, error) {
+	return enforceRetention(ctx, s, retention, limits)
+}
+
+func (s *WebDAVStorage) SelfTest(ctx context.Context) error {
+	return canaryTest(ctx, s, s.Delete)
+}
+
+func (s *WebDAVStorage) PresignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return "", ErrNotSupported
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
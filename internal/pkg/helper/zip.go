@@ -1,37 +1,187 @@
 package helper
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
 	"fmt"
-	"os/exec"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/davexpro/backup/internal/config"
+)
+
+const (
+	// zip64Size is the largest size or offset a zip archive records without
+	// Zip64 extensions.
+	zip64Size = 1<<32 - 1
+	// zip64Entries is the largest number of entries a zip archive records
+	// without Zip64 extensions.
+	zip64Entries = 1<<16 - 1
+	// zipMaxGap bounds the bytes between the data of two entries: a data
+	// descriptor and the next local header with its name and extra field.
+	zipMaxGap = 24 + 30 + 2*0xFFFF
 )
 
-// ZipEncrypt zips and potentially encrypts a single file.
-func ZipEncrypt(ctx context.Context, password, srcPath, dstPath string) error {
+// zipHasZip64 and unzipHasZip64 report whether the Info-ZIP builds on this
+// host support Zip64; builds without it silently wrap sizes and offsets of
+// archives above 4 GB.
+var (
+	zipHasZip64   = sync.OnceValue(func() bool { return hasZip64("zip") })
+	unzipHasZip64 = sync.OnceValue(func() bool { return hasZip64("unzip") })
+)
+
+func hasZip64(tool string) bool {
+	output, err := Run(context.Background(), Command{Name: tool, Args: []string{"-v"}})
+	return err == nil && bytes.Contains(output, []byte("ZIP64_SUPPORT"))
+}
+
+// checkZip64 fails before zipping src when the archive will need Zip64 and
+// the zip build lacks it.
+func checkZip64(src string) error {
+	var size int64
+	var files int
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		files++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to size %s: %w", src, err)
+	}
+	if (size > zip64Size || files > zip64Entries) && !zipHasZip64() {
+		return fmt.Errorf("%s holds %s in %d files, which needs Zip64, but this zip build lacks ZIP64_SUPPORT; install Info-ZIP zip 3.0 built with it", src, HumanizeSize(size), files)
+	}
+	return nil
+}
+
+// verifyZip checks the structure of a created archive: it must open, and the
+// data of every entry must lie within the file, end before the next entry
+// and be followed by no more than the headers of the next one. Zip builds
+// mishandling large archives wrap sizes and offsets at 4 GB, which breaks
+// one of these while the zip command still succeeds.
+func verifyZip(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("created archive is unreadable: %w", err)
+	}
+	defer r.Close()
+
+	type span struct {
+		name       string
+		start, end int64
+	}
+	spans := make([]span, 0, len(r.File))
+	for _, f := range r.File {
+		start, err := f.DataOffset()
+		if err != nil {
+			return fmt.Errorf("created archive is broken at %s: %w", f.Name, err)
+		}
+		spans = append(spans, span{name: f.Name, start: start, end: start + int64(f.CompressedSize64)})
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+	for i, s := range spans {
+		next := info.Size()
+		if i+1 < len(spans) {
+			next = spans[i+1].start
+		}
+		if s.end > next || (i+1 < len(spans) && next-s.end > zipMaxGap) {
+			return fmt.Errorf("created archive is broken at %s: sizes or offsets don't add up (a zip build without Zip64 support?)", s.name)
+		}
+	}
+	return nil
+}
+
+// ZipEncrypt zips and potentially encrypts a single file. The zip process runs
+// at the given CPU/IO priority.
+func ZipEncrypt(ctx context.Context, priority config.PriorityConfig, password, srcPath, dstPath string) error {
 	args := []string{"-j"}
 	if password != "" {
 		args = append([]string{"-P", password}, args...)
 	}
 	args = append(args, dstPath, srcPath)
 
-	cmd := exec.CommandContext(ctx, "zip", args...)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("zip command failed: %w, output: %s", err, string(output))
+	if err := checkZip64(srcPath); err != nil {
+		return err
 	}
-	return nil
+	if _, err := Run(ctx, Command{Name: "zip", Args: args, Priority: priority}); err != nil {
+		return fmt.Errorf("zip command failed: %w", err)
+	}
+	return verifyZip(dstPath)
 }
 
 // ZipEncryptFolder zips and potentially encrypts a folder.
-func ZipEncryptFolder(ctx context.Context, password, srcDir, dstPath string) error {
+func ZipEncryptFolder(ctx context.Context, priority config.PriorityConfig, password, srcDir, dstPath string) error {
 	args := []string{"-r", "-j"}
 	if password != "" {
 		args = append([]string{"-P", password}, args...)
 	}
 	args = append(args, dstPath, srcDir)
 
-	cmd := exec.CommandContext(ctx, "zip", args...)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("zip command failed: %w, output: %s", err, string(output))
+	if err := checkZip64(srcDir); err != nil {
+		return err
+	}
+	if _, err := Run(ctx, Command{Name: "zip", Args: args, Priority: priority}); err != nil {
+		return fmt.Errorf("zip command failed: %w", err)
+	}
+	return verifyZip(dstPath)
+}
+
+// ZipEncryptTree zips and potentially encrypts a folder, keeping the directory
+// structure relative to srcDir.
+func ZipEncryptTree(ctx context.Context, priority config.PriorityConfig, password, srcDir, dstPath string) error {
+	absDst, err := filepath.Abs(dstPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve zip path: %w", err)
+	}
+
+	args := []string{"-r"}
+	if password != "" {
+		args = append([]string{"-P", password}, args...)
+	}
+	args = append(args, absDst, ".")
+
+	if err := checkZip64(srcDir); err != nil {
+		return err
+	}
+	if _, err := Run(ctx, Command{Name: "zip", Args: args, Dir: srcDir, Priority: priority}); err != nil {
+		return fmt.Errorf("zip command failed: %w", err)
+	}
+	return verifyZip(absDst)
+}
+
+// Unzip extracts a (potentially encrypted) zip file into dstDir. When patterns
+// are given, only matching entries are extracted. Archives above 4 GB need an
+// unzip build with Zip64 support.
+func Unzip(ctx context.Context, password, zipPath, dstDir string, patterns ...string) error {
+	if info, err := os.Stat(zipPath); err == nil && info.Size() > zip64Size && !unzipHasZip64() {
+		return fmt.Errorf("%s is %s, which needs Zip64, but this unzip build lacks ZIP64_SUPPORT; install Info-ZIP unzip 6.0 built with it", zipPath, HumanizeSize(info.Size()))
+	}
+	args := []string{"-o", zipPath}
+	if password != "" {
+		args = append([]string{"-P", password}, args...)
+	}
+	args = append(args, patterns...)
+	args = append(args, "-d", dstDir)
+
+	if _, err := Run(ctx, Command{Name: "unzip", Args: args}); err != nil {
+		return fmt.Errorf("unzip failed: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,97 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var Command = &cli.Command{
+	Name:  "plugin",
+	Usage: "External source, storage and notifier plugins",
+	Commands: []*cli.Command{
+		{
+			Name:   "list",
+			Usage:  "List the plugins found in plugins.dir",
+			Action: runList,
+		},
+		{
+			Name:      "run",
+			Usage:     "Back up with source plugins, each shipped as its own artifact",
+			ArgsUsage: "NAME...",
+			Action:    runSources,
+		},
+	},
+}
+
+func runList(ctx context.Context, c *cli.Command) error {
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	found := []helper.Plugin{}
+	for _, kind := range []string{helper.PluginSource, helper.PluginStorage, helper.PluginNotify} {
+		plugins, err := helper.FindPlugins(cfg.Plugins.Dir, kind)
+		if err != nil {
+			return err
+		}
+		found = append(found, plugins...)
+	}
+	if helper.OptionsFrom(ctx).JSON {
+		return helper.PrintJSON(found)
+	}
+	for _, plugin := range found {
+		fmt.Printf("%-8s %-20s %s\n", plugin.Kind, plugin.Name, plugin.Path)
+	}
+	if len(found) == 0 {
+		fmt.Printf("No plugins found in %s\n", cfg.Plugins.Dir)
+	}
+	return nil
+}
+
+func runSources(ctx context.Context, c *cli.Command) error {
+	// 1. Check required tools
+	if err := helper.CheckTools("zip"); err != nil {
+		return err
+	}
+
+	// 2. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if c.Args().Len() == 0 {
+		return fmt.Errorf("no source plugin given")
+	}
+	var plugins []helper.Plugin
+	for _, name := range c.Args().Slice() {
+		plugin, err := helper.FindPlugin(cfg.Plugins.Dir, helper.PluginSource, name)
+		if err != nil {
+			return err
+		}
+		plugins = append(plugins, plugin)
+	}
+
+	// 3. File locking
+	unlock, err := helper.AcquireLock(cfg.LockFile)
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+	defer unlock()
+
+	// 4. Initialize storage
+	notifier := helper.NewNotifier(cfg)
+	store, err := helper.NewStorage(cfg, helper.OptionsFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	// 5. Create and run worker
+	helper.Infof("Starting plugin backup of %d sources", len(plugins))
+	return NewWorker(cfg, store, notifier, helper.OptionsFrom(ctx)).Run(ctx, plugins)
+}
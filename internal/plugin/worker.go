@@ -0,0 +1,96 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// Worker backs up with source plugins. A source plugin is invoked with an
+// empty output directory as its only argument (also in BACKUP_OUTPUT_DIR),
+// fills it and exits 0; the directory is then shipped like any other dump.
+type Worker struct {
+	cfg      *config.Config
+	store    helper.Storage
+	notifier *helper.TelegramSender
+	pipeline *helper.Pipeline
+	onlyDump bool
+}
+
+// NewWorker creates a new plugin worker.
+func NewWorker(cfg *config.Config, store helper.Storage, notifier *helper.TelegramSender, opts helper.Options) *Worker {
+	return &Worker{
+		cfg:      cfg,
+		store:    store,
+		notifier: notifier,
+		pipeline: helper.NewPipeline(cfg, store, opts),
+		onlyDump: opts.OnlyDump,
+	}
+}
+
+// Run backs up with the given source plugins, each as its own artifact.
+func (w *Worker) Run(ctx context.Context, plugins []helper.Plugin) error {
+	if helper.CheckPaused(w.cfg, w.notifier, "plugin") {
+		return nil
+	}
+	stop := w.pipeline.Start()
+	defer stop()
+	if err := w.pipeline.SelfTest(ctx, w.notifier, "plugin"); err != nil {
+		return err
+	}
+	w.pipeline.FlushSpool(ctx)
+
+	var results []helper.BackupResult
+	successCount, failCount := 0, 0
+	for _, plugin := range plugins {
+		start := time.Now()
+		result := w.backupSource(ctx, plugin, start)
+		result.Duration = time.Since(start)
+		results = append(results, result)
+		if result.Success {
+			successCount++
+		} else {
+			failCount++
+			helper.Errorf("backup of %s failed: %v", result.Database, result.Error)
+		}
+	}
+
+	w.pipeline.PruneLocal(ctx)
+	w.pipeline.Report(w.notifier, "plugin", results, successCount, failCount)
+
+	if failCount > 0 {
+		return fmt.Errorf("plugin backup completed with %d failures", failCount)
+	}
+	return nil
+}
+
+func (w *Worker) backupSource(ctx context.Context, plugin helper.Plugin, start time.Time) helper.BackupResult {
+	name := plugin.Name
+	stageDir := filepath.Join(w.cfg.Backup.TempDir, fmt.Sprintf("%s_%s", helper.EscapeName(name), start.Format(helper.TimestampLayout)))
+	if err := os.MkdirAll(stageDir, 0700); err != nil {
+		return helper.BackupResult{Database: name, Success: false, Error: fmt.Errorf("failed to create temp dir: %w", err)}
+	}
+	defer os.RemoveAll(stageDir)
+
+	helper.Infof("Running source plugin %s", plugin.Path)
+	if err := plugin.Run(ctx, nil, os.Stdout, []string{"BACKUP_OUTPUT_DIR=" + stageDir}, stageDir); err != nil {
+		return helper.BackupResult{Database: name, Success: false, Error: fmt.Errorf("source plugin %s failed: %w", name, err)}
+	}
+
+	entries, err := os.ReadDir(stageDir)
+	if err != nil {
+		return helper.BackupResult{Database: name, Success: false, Error: err}
+	}
+	if len(entries) == 0 {
+		return helper.BackupResult{Database: name, Success: false, Error: fmt.Errorf("source plugin %s produced no files", name)}
+	}
+
+	result := w.pipeline.Ship(ctx, name, stageDir, start, false)
+	result.Database = name
+	return result
+}
@@ -0,0 +1,90 @@
+package prune
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var Command = &cli.Command{
+	Name:  "prune",
+	Usage: "Delete expired backups now, or preview what retention would delete",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Only list the backups that would be deleted",
+		},
+		&cli.DurationFlag{
+			Name:  "older-than",
+			Usage: "Delete backups older than this (e.g. 720h) instead of using retention.hours and the database profiles",
+		},
+	},
+	Action: run,
+}
+
+func run(ctx context.Context, c *cli.Command) error {
+	// 1. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	retention := helper.ProfileRetention(cfg)
+	if olderThan := c.Duration("older-than"); olderThan != 0 {
+		if olderThan < time.Hour {
+			return fmt.Errorf("--older-than must be at least 1h")
+		}
+		retention = helper.FixedRetention(int(math.Ceil(olderThan.Hours())))
+	}
+
+	// 2. File locking
+	unlock, err := helper.AcquireLock(cfg.LockFile)
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+	defer unlock()
+
+	// 3. Initialize storage
+	store, err := helper.NewStorage(cfg, helper.OptionsFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	pipeline := helper.NewPipeline(cfg, store, helper.OptionsFrom(ctx))
+
+	// 4. Preview or enforce retention
+	if c.Bool("dry-run") {
+		previews, err := pipeline.PreviewRetention(ctx, retention)
+		if helper.OptionsFrom(ctx).JSON {
+			if err := helper.PrintJSON(append([]helper.RetentionPreview{}, previews...)); err != nil {
+				return err
+			}
+		} else {
+			printPreviews(previews)
+		}
+		if !cfg.Retention.InWindow(time.Now()) {
+			helper.Infof("Note: outside the deletion window %s, a run now would delete nothing", cfg.Retention.Window)
+		}
+		return err
+	}
+	return pipeline.EnforceRetention(ctx, retention)
+}
+
+func printPreviews(previews []helper.RetentionPreview) {
+	for _, preview := range previews {
+		var size int64
+		for _, object := range preview.Expired {
+			fmt.Printf("%s  %-10s  %s\n", object.LastModified.Format(time.RFC3339), helper.HumanizeSize(object.Size), object.Key)
+			size += object.Size
+		}
+		fmt.Printf("%s: %d backups (%s) would be deleted\n", preview.Backend, len(preview.Expired), helper.HumanizeSize(size))
+		if preview.Capped {
+			fmt.Printf("%s: more backups are expired than the limits of a run allow; later runs would delete them\n", preview.Backend)
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,52 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var Command = &cli.Command{
+	Name:   "rabbitmq",
+	Usage:  "Back up RabbitMQ definitions and, optionally, the mnesia directory",
+	Action: run,
+}
+
+func run(ctx context.Context, c *cli.Command) error {
+	// 1. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// 2. Check required tools
+	tools := []string{"zip"}
+	if cfg.RabbitMQ.StopApp {
+		tools = append(tools, cfg.RabbitMQ.CtlPath)
+	}
+	if err := helper.CheckTools(tools...); err != nil {
+		return err
+	}
+
+	// 3. File locking
+	unlock, err := helper.AcquireLock(cfg.LockFile)
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+	defer unlock()
+
+	// 4. Initialize storage
+	notifier := helper.NewNotifier(cfg)
+	store, err := helper.NewStorage(cfg, helper.OptionsFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	// 5. Create and run worker
+	helper.Infof("Starting RabbitMQ backup")
+	return NewWorker(cfg, store, notifier, helper.OptionsFrom(ctx)).Run(ctx)
+}
@@ -0,0 +1,156 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// Files inside the artifact.
+const (
+	definitionsFile = "definitions.json" // Import with `rabbitmqctl import_definitions` or the management UI
+	mnesiaDir       = "mnesia"           // Copy of the node data directory
+)
+
+// Worker backs up RabbitMQ definitions and, optionally, the node data directory.
+type Worker struct {
+	cfg      *config.Config
+	store    helper.Storage
+	notifier *helper.TelegramSender
+	pipeline *helper.Pipeline
+	client   *http.Client
+	onlyDump bool
+}
+
+// NewWorker creates a new RabbitMQ worker.
+func NewWorker(cfg *config.Config, store helper.Storage, notifier *helper.TelegramSender, opts helper.Options) *Worker {
+	return &Worker{
+		cfg:      cfg,
+		store:    store,
+		notifier: notifier,
+		pipeline: helper.NewPipeline(cfg, store, opts),
+		client:   &http.Client{Timeout: 60 * time.Second},
+		onlyDump: opts.OnlyDump,
+	}
+}
+
+// Run backs up RabbitMQ as "rabbitmq".
+func (w *Worker) Run(ctx context.Context) error {
+	if helper.CheckPaused(w.cfg, w.notifier, "rabbitmq") {
+		return nil
+	}
+	stop := w.pipeline.Start()
+	defer stop()
+	if err := w.pipeline.SelfTest(ctx, w.notifier, "rabbitmq"); err != nil {
+		return err
+	}
+	w.pipeline.FlushSpool(ctx)
+
+	start := time.Now()
+	result := w.backup(ctx, start)
+	result.Duration = time.Since(start)
+
+	successCount, failCount := 1, 0
+	if !result.Success {
+		successCount, failCount = 0, 1
+	}
+	w.pipeline.PruneLocal(ctx)
+	w.pipeline.Report(w.notifier, "rabbitmq", []helper.BackupResult{result}, successCount, failCount)
+
+	if !result.Success {
+		return fmt.Errorf("rabbitmq backup failed: %v", result.Error)
+	}
+	return nil
+}
+
+func (w *Worker) backup(ctx context.Context, start time.Time) helper.BackupResult {
+	stageDir := filepath.Join(w.cfg.Backup.TempDir, fmt.Sprintf("rabbitmq_%s", start.Format(helper.TimestampLayout)))
+	if err := os.MkdirAll(stageDir, 0700); err != nil {
+		return helper.BackupResult{Database: "rabbitmq", Success: false, Error: fmt.Errorf("failed to create temp dir: %w", err)}
+	}
+	defer os.RemoveAll(stageDir)
+
+	if err := w.exportDefinitions(ctx, filepath.Join(stageDir, definitionsFile)); err != nil {
+		return helper.BackupResult{Database: "rabbitmq", Success: false, Error: err}
+	}
+	if w.cfg.RabbitMQ.MnesiaDir != "" {
+		if err := w.copyMnesia(ctx, filepath.Join(stageDir, mnesiaDir)); err != nil {
+			return helper.BackupResult{Database: "rabbitmq", Success: false, Error: err}
+		}
+	}
+
+	return w.pipeline.Ship(ctx, "rabbitmq", stageDir, start, false)
+}
+
+// exportDefinitions saves users, vhosts, permissions, policies, exchanges,
+// queues and bindings from the management API.
+func (w *Worker) exportDefinitions(ctx context.Context, path string) error {
+	url := strings.TrimRight(w.cfg.RabbitMQ.URL, "/") + "/api/definitions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(w.cfg.RabbitMQ.Username, w.cfg.RabbitMQ.Password)
+
+	helper.Infof("Exporting RabbitMQ definitions from %s", w.cfg.RabbitMQ.URL)
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("definitions export failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("definitions export failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("definitions export failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var definitions struct {
+		Vhosts    []any `json:"vhosts"`
+		Exchanges []any `json:"exchanges"`
+		Queues    []any `json:"queues"`
+	}
+	if err := sonic.Unmarshal(body, &definitions); err != nil {
+		return fmt.Errorf("invalid definitions: %w", err)
+	}
+	helper.Infof("Exported %d vhosts, %d exchanges and %d queues", len(definitions.Vhosts), len(definitions.Exchanges), len(definitions.Queues))
+
+	return os.WriteFile(path, body, 0600)
+}
+
+// copyMnesia copies the node data directory, stopping the RabbitMQ app
+// meanwhile when configured.
+func (w *Worker) copyMnesia(ctx context.Context, dst string) error {
+	if w.cfg.RabbitMQ.StopApp {
+		if _, err := helper.Run(ctx, helper.Command{Name: w.cfg.RabbitMQ.CtlPath, Args: []string{"stop_app"}}); err != nil {
+			return fmt.Errorf("rabbitmqctl stop_app failed: %w", err)
+		}
+		helper.Infof("Stopped RabbitMQ app")
+		defer func() {
+			// The broker must come back even when the backup was cancelled
+			if _, err := helper.Run(context.WithoutCancel(ctx), helper.Command{Name: w.cfg.RabbitMQ.CtlPath, Args: []string{"start_app"}}); err != nil {
+				helper.Warnf("rabbitmqctl start_app failed: %v", err)
+				return
+			}
+			helper.Infof("Started RabbitMQ app")
+		}()
+	} else {
+		helper.Warnf("copying %s while RabbitMQ is running; set stop_app for a consistent copy", w.cfg.RabbitMQ.MnesiaDir)
+	}
+
+	if err := helper.CopyTree(w.cfg.RabbitMQ.MnesiaDir, dst, nil); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", w.cfg.RabbitMQ.MnesiaDir, err)
+	}
+	return nil
+}
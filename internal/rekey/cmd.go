@@ -0,0 +1,115 @@
+package rekey
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var Command = &cli.Command{
+	Name:  "rekey",
+	Usage: "Re-encrypt stored backups with a new zip password",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "new-password",
+			Usage:   "New encryption password",
+			Sources: cli.EnvVars("BACKUP_NEW_PASSWORD"),
+		},
+		&cli.StringFlag{
+			Name:    "old-password",
+			Usage:   "Current encryption password (default: encryption.password from config)",
+			Sources: cli.EnvVars("BACKUP_OLD_PASSWORD"),
+		},
+		&cli.StringSliceFlag{
+			Name:  "key",
+			Usage: "Object key of a backup to rekey (repeatable, default: all backups)",
+		},
+		&cli.TimestampFlag{
+			Name:   "since",
+			Usage:  "Only rekey backups created at or after this date",
+			Config: cli.TimestampConfig{Layouts: []string{time.DateOnly, time.RFC3339}},
+		},
+		&cli.TimestampFlag{
+			Name:   "until",
+			Usage:  "Only rekey backups created before this date",
+			Config: cli.TimestampConfig{Layouts: []string{time.DateOnly, time.RFC3339}},
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Only list the backups that would be rekeyed",
+		},
+	},
+	Action: run,
+}
+
+func run(ctx context.Context, c *cli.Command) error {
+	newPassword := c.String("new-password")
+	if newPassword == "" {
+		return fmt.Errorf("--new-password (or BACKUP_NEW_PASSWORD) is required")
+	}
+
+	// 1. Check required tools
+	if err := helper.CheckTools("zip", "unzip"); err != nil {
+		return err
+	}
+
+	// 2. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	oldPassword := c.String("old-password")
+	if oldPassword == "" {
+		oldPassword = cfg.Encryption.Password
+	}
+
+	// 3. File locking
+	unlock, err := helper.AcquireLock(cfg.LockFile)
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+	defer unlock()
+
+	// 4. Initialize storage
+	store, err := helper.NewStorage(cfg, helper.OptionsFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	// 5. Select and rekey artifacts
+	rekeyer := NewRekeyer(cfg, store, oldPassword, newPassword)
+	keys, err := rekeyer.Select(ctx, c.StringSlice("key"), c.Timestamp("since"), c.Timestamp("until"))
+	if err != nil {
+		return err
+	}
+	if c.Bool("dry-run") {
+		if helper.OptionsFrom(ctx).JSON {
+			if err := helper.PrintJSON(append([]string{}, keys...)); err != nil {
+				return err
+			}
+		} else {
+			for _, key := range keys {
+				fmt.Println(key)
+			}
+		}
+		helper.Infof("Dry run: %d backups would be rekeyed", len(keys))
+		return nil
+	}
+
+	summary := fmt.Sprintf("rekey of %d backups", len(keys))
+	if err := helper.RequireApproval(cfg, "rekey", strings.Join(slices.Sorted(slices.Values(keys)), "\n"), len(keys), summary); err != nil {
+		return err
+	}
+	if err := rekeyer.Rekey(ctx, keys); err != nil {
+		return err
+	}
+	helper.Infof("Rekeyed %d backups. Remember to update encryption.password in %s", len(keys), c.String("config"))
+	return nil
+}
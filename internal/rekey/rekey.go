@@ -0,0 +1,146 @@
+package rekey
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// Rekeyer re-encrypts stored artifacts with a new password.
+type Rekeyer struct {
+	cfg         *config.Config
+	store       helper.Storage
+	oldPassword string
+	newPassword string
+}
+
+// NewRekeyer creates a new Rekeyer.
+func NewRekeyer(cfg *config.Config, store helper.Storage, oldPassword, newPassword string) *Rekeyer {
+	return &Rekeyer{
+		cfg:         cfg,
+		store:       store,
+		oldPassword: oldPassword,
+		newPassword: newPassword,
+	}
+}
+
+// Select returns the artifact keys to rekey. Explicit keys take precedence;
+// otherwise all artifacts created within [since, until) are selected, where
+// zero times leave the range open.
+func (r *Rekeyer) Select(ctx context.Context, keys []string, since, until time.Time) ([]string, error) {
+	if len(keys) > 0 {
+		return keys, nil
+	}
+
+	objects, err := r.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []string
+	for _, object := range objects {
+		if !helper.IsArtifactKey(object.Key) || strings.HasSuffix(object.Key, helper.ManifestSuffix) {
+			continue
+		}
+		created, ok := helper.ArtifactTime(object.Key)
+		if !ok {
+			created = object.LastModified
+		}
+		if !since.IsZero() && created.Before(since) {
+			continue
+		}
+		if !until.IsZero() && !created.Before(until) {
+			continue
+		}
+		selected = append(selected, object.Key)
+	}
+	return selected, nil
+}
+
+// Rekey re-encrypts each artifact in place and updates its manifest.
+func (r *Rekeyer) Rekey(ctx context.Context, keys []string) error {
+	var failed []string
+	for i, key := range keys {
+		helper.Infof("[%d/%d] Rekeying %s", i+1, len(keys), key)
+		if err := r.rekey(ctx, key); err != nil {
+			helper.Errorf("rekey failed for %s: %v", key, err)
+			failed = append(failed, key)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("rekey failed for %d of %d backups: %s", len(failed), len(keys), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (r *Rekeyer) rekey(ctx context.Context, key string) error {
+	workDir := filepath.Join(r.cfg.Backup.TempDir, fmt.Sprintf("rekey_%d", time.Now().UnixNano()))
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return fmt.Errorf("failed to create work dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	// 1. Download and decrypt with the old password (or the unwrapped data key)
+	var manifest *helper.Manifest
+	var buf bytes.Buffer
+	if err := r.store.Download(ctx, helper.ManifestKey(key), &buf); err == nil {
+		if manifest, err = helper.ParseManifest(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	oldPassword := r.oldPassword
+	if manifest != nil && manifest.Encryption != nil {
+		password, err := helper.ArtifactPassword(ctx, r.cfg, manifest)
+		if err != nil {
+			return err
+		}
+		oldPassword = password
+	}
+
+	oldZip := filepath.Join(workDir, "old.zip")
+	if err := helper.DownloadFile(ctx, r.store, key, oldZip); err != nil {
+		return err
+	}
+	contentDir := filepath.Join(workDir, "content")
+	if err := helper.Unzip(ctx, oldPassword, oldZip, contentDir); err != nil {
+		return fmt.Errorf("decrypt failed (wrong old password?): %w", err)
+	}
+
+	// 2. Re-encrypt with the new password, keeping the entry layout
+	newZip := filepath.Join(workDir, "new.zip")
+	if err := helper.ZipEncryptTree(ctx, r.cfg.Backup.Priority, r.newPassword, contentDir, newZip); err != nil {
+		return fmt.Errorf("encrypt failed: %w", err)
+	}
+
+	// 3. Replace the stored artifact
+	file, err := os.Open(newZip)
+	if err != nil {
+		return fmt.Errorf("open file failed: %w", err)
+	}
+	defer file.Close()
+	// Rekeying replaces the artifact in place, bypassing overwrite protection
+	uploaded := helper.NewHashingReader(helper.Throttle(ctx, file, r.cfg.Backup.IOLimitBytes()))
+	if err := r.store.Replace(ctx, key, uploaded); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+
+	// 4. Update the manifest if the artifact has one
+	if manifest == nil {
+		helper.Infof("No manifest to update for %s", key)
+		return nil
+	}
+	manifest.SHA256, manifest.Size = uploaded.Sum()
+	manifest.Encryption = nil // Now protected by the new password
+	data, err := manifest.Marshal()
+	if err != nil {
+		return err
+	}
+	return r.store.Replace(ctx, helper.ManifestKey(key), bytes.NewReader(data))
+}
@@ -0,0 +1,85 @@
+package replicate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var Command = &cli.Command{
+	Name:  "replicate",
+	Usage: "Copy the backups missing from (or changed on) another storage, for offsite redundancy",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "from",
+			Usage: "Backend to copy from (default: storage.backend)",
+		},
+		&cli.StringFlag{
+			Name:     "to",
+			Usage:    "Backend to copy to: s3, b2, sftp, ftp, webdav, gdrive, local or plugin",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "to-config",
+			Usage: "Configure the destination backend from this `FILE` instead, e.g. another account of the same provider",
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Only list the objects that would be copied",
+		},
+	},
+	Action: run,
+}
+
+func run(ctx context.Context, c *cli.Command) error {
+	// 1. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	dstCfg := cfg
+	if path := c.String("to-config"); path != "" {
+		if dstCfg, err = config.LoadConfig(path); err != nil {
+			return fmt.Errorf("failed to load destination config: %w", err)
+		}
+	}
+	from, to := c.String("from"), c.String("to")
+	if from == "" {
+		from = cfg.Storage.Backend
+	}
+	if from == to && dstCfg == cfg {
+		return fmt.Errorf("--from and --to are the same backend %s", to)
+	}
+
+	// 2. File locking
+	unlock, err := helper.AcquireLock(cfg.LockFile)
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+	defer unlock()
+
+	// 3. Initialize both storages
+	src, err := helper.NewBackend(cfg, from, helper.OptionsFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to initialize %s storage: %w", from, err)
+	}
+	dst, err := helper.NewBackend(dstCfg, to, helper.OptionsFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to initialize %s storage: %w", to, err)
+	}
+
+	// 4. Copy the missing and changed objects
+	helper.Infof("Replicating %s to %s", from, to)
+	result, err := helper.Replicate(ctx, src, dst, c.Bool("dry-run"))
+	verb := "Copied"
+	if c.Bool("dry-run") {
+		verb = "Would copy"
+	}
+	helper.Infof("%s %d new and %d changed objects (%s); %d up to date, %d failed",
+		verb, result.Copied, result.Updated, helper.HumanizeSize(result.Bytes), result.Skipped, result.Failed)
+	return err
+}
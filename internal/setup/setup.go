@@ -2,10 +2,11 @@ package setup
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"os/exec"
 	"strings"
+
+	"github.com/davexpro/backup/internal/pkg/helper"
 )
 
 // checkAndInstallForDebian checks if mysqlsh is installed and installs it on Debian if missing.
@@ -13,13 +14,13 @@ func checkAndInstallForDebian() error {
 
 	// 1. Check if mysqlsh is already installed
 	if _, err := exec.LookPath("mysqlsh"); err == nil {
-		log.Println("mysqlsh is already installed.")
+		helper.Infof("mysqlsh is already installed.")
 		// We still ensure other utils are present
 		_ = runAptInstall([]string{"zip", "unzip", "wget", "gnupg"})
 		return nil
 	}
 
-	log.Println("mysqlsh not found. Starting installation on Debian-based system...")
+	helper.Infof("mysqlsh not found. Starting installation on Debian-based system...")
 
 	// 2. Install pre-requisites
 	if err := runAptInstall([]string{"wget", "gnupg", "zip", "unzip", "lsb-release"}); err != nil {
@@ -32,7 +33,7 @@ func checkAndInstallForDebian() error {
 	repoPkg := "mysql-apt-config_0.8.36-1_all.deb"
 	repoURL := "https://dev.mysql.com/get/" + repoPkg
 
-	log.Printf("Downloading MySQL APT repository config from %s...", repoURL)
+	helper.Infof("Downloading MySQL APT repository config from %s...", repoURL)
 	wgetCmd := exec.Command("wget", "-O", "/tmp/"+repoPkg, repoURL)
 	wgetCmd.Stdout = os.Stdout
 	wgetCmd.Stderr = os.Stderr
@@ -41,7 +42,7 @@ func checkAndInstallForDebian() error {
 	}
 
 	// Install the config package non-interactively
-	log.Println("Installing MySQL APT repository config package...")
+	helper.Infof("Installing MySQL APT repository config package...")
 	// We use DEBIAN_FRONTEND=noninteractive to avoid prompts
 	dpkgCmd := exec.Command("dpkg", "-i", "/tmp/"+repoPkg)
 	dpkgCmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
@@ -56,12 +57,12 @@ func checkAndInstallForDebian() error {
 		return fmt.Errorf("failed to install mysql-shell: %w", err)
 	}
 
-	log.Println("mysqlsh installed successfully.")
+	helper.Infof("mysqlsh installed successfully.")
 	return nil
 }
 
 func runAptInstall(packages []string) error {
-	log.Printf("Running apt-get update and installing: %s", strings.Join(packages, ", "))
+	helper.Infof("Running apt-get update and installing: %s", strings.Join(packages, ", "))
 
 	updateCmd := exec.Command("apt-get", "update")
 	updateCmd.Stdout = os.Stdout
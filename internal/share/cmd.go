@@ -0,0 +1,88 @@
+package share
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/notify"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// maxExpiry is the longest validity S3 accepts for presigned URLs.
+const maxExpiry = 7 * 24 * time.Hour
+
+var Command = &cli.Command{
+	Name:  "share",
+	Usage: "Create a presigned download URL for a stored backup",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "key",
+			Usage:    "Object key of the backup to share",
+			Required: true,
+		},
+		&cli.DurationFlag{
+			Name:  "expires",
+			Value: 24 * time.Hour,
+			Usage: "Validity of the URL (at most 168h)",
+		},
+		&cli.BoolFlag{
+			Name:  "notify",
+			Usage: "Also send the URL through the configured notification channels",
+		},
+	},
+	Action: run,
+}
+
+func run(ctx context.Context, c *cli.Command) error {
+	key, expires := c.String("key"), c.Duration("expires")
+	if expires <= 0 || expires > maxExpiry {
+		return fmt.Errorf("--expires must be between 1s and %s", maxExpiry)
+	}
+
+	// 1. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// 2. Initialize storage
+	store, err := helper.NewStorage(cfg, helper.OptionsFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	// 3. Presign the artifact
+	exists, err := store.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("no backup stored under %s", key)
+	}
+	url, err := store.PresignedURL(ctx, key, expires)
+	if err != nil {
+		return err
+	}
+	if helper.OptionsFrom(ctx).JSON {
+		if err := helper.PrintJSON(map[string]interface{}{"key": key, "url": url, "expires_at": time.Now().Add(expires)}); err != nil {
+			return err
+		}
+	} else {
+		fmt.Println(url)
+	}
+
+	// 4. Notify
+	if c.Bool("notify") {
+		message := fmt.Sprintf("🔗 Backup %s shared, link valid until %s:\n%s", key, time.Now().Add(expires).Format(time.RFC3339), url)
+		for _, channel := range notify.Channels(cfg) {
+			if err := channel.Send(message); err != nil {
+				helper.Errorf("failed to send share link via %s: %v", channel.Name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package site
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/mysql"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var Command = &cli.Command{
+	Name:  "site",
+	Usage: "Back up websites (MySQL database plus web root) as one artifact per site",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "Only back up the site with this name",
+		},
+	},
+	Action: run,
+}
+
+func run(ctx context.Context, c *cli.Command) error {
+	// 1. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	sites := cfg.Sites
+	if name := c.String("name"); name != "" {
+		sites = nil
+		for _, site := range cfg.Sites {
+			if site.Name == name {
+				sites = append(sites, site)
+			}
+		}
+	}
+	if len(sites) == 0 {
+		return fmt.Errorf("no matching sites configured")
+	}
+
+	// 2. Check required tools
+	if err := helper.CheckTools("zip"); err != nil {
+		return err
+	}
+	for _, site := range sites {
+		if site.Database != "" {
+			if err := mysql.CheckShell(ctx, cfg); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	// 3. File locking
+	unlock, err := helper.AcquireLock(cfg.LockFile)
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+	defer unlock()
+
+	// 4. Initialize storage
+	notifier := helper.NewNotifier(cfg)
+	store, err := helper.NewStorage(cfg, helper.OptionsFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	// 5. Create and run worker
+	helper.Infof("Starting site backup of %d sites", len(sites))
+	return NewWorker(cfg, store, notifier, helper.OptionsFrom(ctx)).Run(ctx, sites)
+}
@@ -0,0 +1,131 @@
+package site
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/mysql"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// Directories inside a site artifact.
+const (
+	databaseDir = "database" // mysqlsh dump of the site database
+	webRootDir  = "web_root" // Copy of the document root
+)
+
+// Worker backs up websites as their database plus web root in one artifact.
+type Worker struct {
+	cfg      *config.Config
+	store    helper.Storage
+	notifier *helper.TelegramSender
+	pipeline *helper.Pipeline
+	dumper   *mysql.Worker
+	onlyDump bool
+}
+
+// NewWorker creates a new site worker.
+func NewWorker(cfg *config.Config, store helper.Storage, notifier *helper.TelegramSender, opts helper.Options) *Worker {
+	return &Worker{
+		cfg:      cfg,
+		store:    store,
+		notifier: notifier,
+		pipeline: helper.NewPipeline(cfg, store, opts),
+		dumper:   mysql.NewWorker(cfg, store, notifier, opts),
+		onlyDump: opts.OnlyDump,
+	}
+}
+
+// Run backs up the given sites, each as its own artifact.
+func (w *Worker) Run(ctx context.Context, sites []config.SiteConfig) error {
+	if helper.CheckPaused(w.cfg, w.notifier, "site") {
+		return nil
+	}
+	stop := w.pipeline.Start()
+	defer stop()
+	if err := w.pipeline.SelfTest(ctx, w.notifier, "site"); err != nil {
+		return err
+	}
+	w.pipeline.FlushSpool(ctx)
+
+	var results []helper.BackupResult
+	successCount, failCount := 0, 0
+	for _, site := range sites {
+		start := time.Now()
+		result := w.backupSite(ctx, site, start)
+		result.Duration = time.Since(start)
+		results = append(results, result)
+		if result.Success {
+			successCount++
+		} else {
+			failCount++
+			helper.Errorf("backup of %s failed: %v", result.Database, result.Error)
+		}
+	}
+
+	w.pipeline.PruneLocal(ctx)
+	w.pipeline.Report(w.notifier, "site", results, successCount, failCount)
+
+	if failCount > 0 {
+		return fmt.Errorf("site backup completed with %d failures", failCount)
+	}
+	return nil
+}
+
+func (w *Worker) backupSite(ctx context.Context, site config.SiteConfig, start time.Time) helper.BackupResult {
+	name := "site_" + site.Name
+	stageDir := filepath.Join(w.cfg.Backup.TempDir, fmt.Sprintf("%s_%s", helper.EscapeName(name), start.Format(helper.TimestampLayout)))
+	if err := os.MkdirAll(stageDir, 0700); err != nil {
+		return helper.BackupResult{Database: name, Success: false, Error: fmt.Errorf("failed to create temp dir: %w", err)}
+	}
+	defer os.RemoveAll(stageDir)
+
+	if err := w.snapshot(ctx, site, stageDir); err != nil {
+		return helper.BackupResult{Database: name, Success: false, Error: err}
+	}
+
+	result := w.pipeline.Ship(ctx, name, stageDir, start, false)
+	result.Database = name
+	return result
+}
+
+// snapshot dumps the database and copies the web root into stageDir while the
+// site is in maintenance mode, so both halves of the artifact match.
+func (w *Worker) snapshot(ctx context.Context, site config.SiteConfig, stageDir string) error {
+	if site.MaintenanceOn != "" {
+		if err := runHook(ctx, site.WebRoot, site.MaintenanceOn); err != nil {
+			return fmt.Errorf("maintenance_on hook failed: %w", err)
+		}
+		helper.Infof("Site %s is in maintenance mode", site.Name)
+	}
+	if site.MaintenanceOff != "" {
+		defer func() {
+			// The site must come back even when the backup was cancelled
+			if err := runHook(context.Background(), site.WebRoot, site.MaintenanceOff); err != nil {
+				helper.Warnf("maintenance_off hook failed for site %s: %v", site.Name, err)
+				return
+			}
+			helper.Infof("Site %s left maintenance mode", site.Name)
+		}()
+	}
+
+	if site.Database != "" {
+		if err := w.dumper.Dump(ctx, site.Database, filepath.Join(stageDir, databaseDir)); err != nil {
+			return fmt.Errorf("database dump failed: %w", err)
+		}
+	}
+	if err := helper.CopyTree(site.WebRoot, filepath.Join(stageDir, webRootDir), site.Exclude); err != nil {
+		return fmt.Errorf("failed to copy web root: %w", err)
+	}
+	return nil
+}
+
+// runHook runs a shell command in dir.
+func runHook(ctx context.Context, dir, command string) error {
+	_, err := helper.Run(ctx, helper.Command{Name: "sh", Args: []string{"-c", command}, Dir: dir})
+	return err
+}
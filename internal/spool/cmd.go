@@ -0,0 +1,89 @@
+package spool
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+var Command = &cli.Command{
+	Name:  "flush-queue",
+	Usage: "Upload backups queued while storage was unreachable",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "list",
+			Usage: "Only list the queued backups",
+		},
+		&cli.BoolFlag{
+			Name:  "ignore-window",
+			Usage: "Upload outside backup.upload_window too, and past its end",
+		},
+	},
+	Action: run,
+}
+
+func run(ctx context.Context, c *cli.Command) error {
+	// 1. Load config
+	cfg, err := config.LoadConfig(c.String("config"))
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.Backup.SpoolDir == "" {
+		return fmt.Errorf("backup.spool_dir is not configured")
+	}
+	if c.Bool("only-dump") && !c.Bool("list") {
+		return fmt.Errorf("the upload queue is only flushed to remote storage, not with --only-dump")
+	}
+	spool := helper.NewSpool(cfg.Backup.SpoolDir, cfg.Backup.UploadChunkBytes())
+
+	if c.Bool("list") {
+		entries, err := spool.Entries()
+		if err != nil {
+			return err
+		}
+		if helper.OptionsFrom(ctx).JSON {
+			if err := helper.PrintJSON(append([]helper.SpoolEntry{}, entries...)); err != nil {
+				return err
+			}
+		} else {
+			for _, entry := range entries {
+				fmt.Printf("%s  %s  (%s)\n", entry.QueuedAt.Format("2006-01-02 15:04:05"), entry.Key, entry.Error)
+			}
+		}
+		helper.Infof("%d backups queued", len(entries))
+		return nil
+	}
+
+	// 2. File locking
+	unlock, err := helper.AcquireLock(cfg.LockFile)
+	if err != nil {
+		return fmt.Errorf("could not acquire lock: %w", err)
+	}
+	defer unlock()
+
+	// 3. Initialize storage
+	store, err := helper.NewStorage(cfg, helper.OptionsFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	// 4. Upload the queue, within the upload window
+	uploadCtx := ctx
+	if !c.Bool("ignore-window") {
+		var cancel context.CancelFunc
+		if uploadCtx, cancel, err = helper.UploadWindowContext(ctx, cfg.Backup); err != nil {
+			return err
+		}
+		defer cancel()
+	}
+	uploaded, err := spool.Flush(uploadCtx, store)
+	helper.Infof("Uploaded %d queued backups", uploaded)
+	if err != nil && ctx.Err() == nil && uploadCtx.Err() != nil {
+		return fmt.Errorf("%w: it closed during the flush, the remaining backups stay queued", helper.ErrUploadWindowClosed)
+	}
+	return err
+}
@@ -0,0 +1,175 @@
+package vault
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// Worker takes raft snapshots of a HashiCorp Vault cluster.
+type Worker struct {
+	cfg      *config.Config
+	store    helper.Storage
+	notifier *helper.TelegramSender
+	pipeline *helper.Pipeline
+	onlyDump bool
+}
+
+// NewWorker creates a new Vault worker.
+func NewWorker(cfg *config.Config, store helper.Storage, notifier *helper.TelegramSender, opts helper.Options) *Worker {
+	return &Worker{
+		cfg:      cfg,
+		store:    store,
+		notifier: notifier,
+		pipeline: helper.NewPipeline(cfg, store, opts),
+		onlyDump: opts.OnlyDump,
+	}
+}
+
+// Run saves, verifies and ships a raft snapshot as "vault".
+func (w *Worker) Run(ctx context.Context) error {
+	if helper.CheckPaused(w.cfg, w.notifier, "vault") {
+		return nil
+	}
+	stop := w.pipeline.Start()
+	defer stop()
+	if err := w.pipeline.SelfTest(ctx, w.notifier, "vault"); err != nil {
+		return err
+	}
+	w.pipeline.FlushSpool(ctx)
+
+	start := time.Now()
+	result := w.backup(ctx, start)
+	result.Duration = time.Since(start)
+
+	successCount, failCount := 1, 0
+	if !result.Success {
+		successCount, failCount = 0, 1
+	}
+	w.pipeline.PruneLocal(ctx)
+	w.pipeline.Report(w.notifier, "vault", []helper.BackupResult{result}, successCount, failCount)
+
+	if !result.Success {
+		return fmt.Errorf("vault backup failed: %v", result.Error)
+	}
+	return nil
+}
+
+func (w *Worker) backup(ctx context.Context, start time.Time) helper.BackupResult {
+	stageDir := filepath.Join(w.cfg.Backup.TempDir, fmt.Sprintf("vault_%s", start.Format(helper.TimestampLayout)))
+	if err := os.MkdirAll(stageDir, 0700); err != nil {
+		return helper.BackupResult{Database: "vault", Success: false, Error: fmt.Errorf("failed to create temp dir: %w", err)}
+	}
+	defer os.RemoveAll(stageDir)
+
+	snapshotPath := filepath.Join(stageDir, "vault.snap")
+	helper.Infof("Saving Vault raft snapshot")
+	cmd := helper.Command{
+		Name: w.cfg.Vault.CLIPath,
+		Args: []string{"operator", "raft", "snapshot", "save", snapshotPath},
+		Env:  w.env(),
+	}
+	if _, err := helper.Run(ctx, cmd); err != nil {
+		return helper.BackupResult{Database: "vault", Success: false, Error: fmt.Errorf("snapshot save failed: %w", err)}
+	}
+
+	if err := verifySnapshot(snapshotPath); err != nil {
+		return helper.BackupResult{Database: "vault", Success: false, Error: fmt.Errorf("snapshot verification failed: %w", err)}
+	}
+	helper.Infof("Snapshot verified")
+
+	return w.pipeline.Ship(ctx, "vault", stageDir, start, true)
+}
+
+// env returns the configured settings of the vault CLI, which override the
+// inherited VAULT_* variables.
+func (w *Worker) env() []string {
+	var env []string
+	for key, value := range map[string]string{
+		"VAULT_ADDR":   w.cfg.Vault.Address,
+		"VAULT_TOKEN":  w.cfg.Vault.Token,
+		"VAULT_CACERT": w.cfg.Vault.CACert,
+	} {
+		if value != "" {
+			env = append(env, key+"="+value)
+		}
+	}
+	return env
+}
+
+// verifySnapshot checks a raft snapshot, a gzipped tar archive, against the
+// SHA256SUMS file it carries, the same check Vault runs before a restore.
+func verifySnapshot(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("not a gzip archive: %w", err)
+	}
+	defer gz.Close()
+
+	hashes := make(map[string]string)
+	var sums []byte
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("corrupt archive: %w", err)
+		}
+		if header.Name == "SHA256SUMS" {
+			if sums, err = io.ReadAll(tr); err != nil {
+				return fmt.Errorf("failed to read SHA256SUMS: %w", err)
+			}
+			continue
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, tr); err != nil {
+			return fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+		hashes[header.Name] = hex.EncodeToString(h.Sum(nil))
+	}
+	if sums == nil {
+		return fmt.Errorf("no SHA256SUMS in snapshot")
+	}
+
+	checked := 0
+	scanner := bufio.NewScanner(strings.NewReader(string(sums)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		want, name := fields[0], strings.TrimPrefix(fields[1], "*")
+		got, ok := hashes[name]
+		if !ok {
+			return fmt.Errorf("%s listed in SHA256SUMS is missing", name)
+		}
+		if got != want {
+			return fmt.Errorf("checksum mismatch for %s", name)
+		}
+		checked++
+	}
+	if checked == 0 {
+		return fmt.Errorf("empty SHA256SUMS in snapshot")
+	}
+	return nil
+}
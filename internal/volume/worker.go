@@ -0,0 +1,133 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/docker"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// mountPath is where the helper container mounts the volume it archives.
+const mountPath = "/volume"
+
+// Worker archives named Docker volumes.
+type Worker struct {
+	cfg      *config.Config
+	store    helper.Storage
+	notifier *helper.TelegramSender
+	pipeline *helper.Pipeline
+	onlyDump bool
+}
+
+// NewWorker creates a new Docker volume worker.
+func NewWorker(cfg *config.Config, store helper.Storage, notifier *helper.TelegramSender, opts helper.Options) *Worker {
+	return &Worker{
+		cfg:      cfg,
+		store:    store,
+		notifier: notifier,
+		pipeline: helper.NewPipeline(cfg, store, opts),
+		onlyDump: opts.OnlyDump,
+	}
+}
+
+// Run backs up every configured volume as its own "volume_<name>" artifact.
+func (w *Worker) Run(ctx context.Context) error {
+	if helper.CheckPaused(w.cfg, w.notifier, "docker-volume") {
+		return nil
+	}
+	stop := w.pipeline.Start()
+	defer stop()
+	if err := w.pipeline.SelfTest(ctx, w.notifier, "docker-volume"); err != nil {
+		return err
+	}
+	w.pipeline.FlushSpool(ctx)
+
+	client, err := docker.NewClient(w.cfg.Volumes.Host)
+	if err != nil {
+		return fmt.Errorf("failed to create docker client: %w", err)
+	}
+	if err := client.EnsureImage(ctx, w.cfg.Volumes.Image); err != nil {
+		return fmt.Errorf("failed to prepare helper image: %w", err)
+	}
+
+	var results []helper.BackupResult
+	successCount, failCount := 0, 0
+	for _, volume := range w.cfg.Volumes.Names {
+		start := time.Now()
+		result := w.backupVolume(ctx, client, volume, start)
+		result.Duration = time.Since(start)
+		results = append(results, result)
+		if result.Success {
+			successCount++
+		} else {
+			failCount++
+			helper.Errorf("backup of %s failed: %v", result.Database, result.Error)
+		}
+	}
+
+	w.pipeline.PruneLocal(ctx)
+	w.pipeline.Report(w.notifier, "docker-volume", results, successCount, failCount)
+
+	if failCount > 0 {
+		return fmt.Errorf("docker volume backup completed with %d failures", failCount)
+	}
+	return nil
+}
+
+// backupVolume archives a volume with tar in a helper container mounting it
+// read-only, copies the tarball out of the container and ships it.
+func (w *Worker) backupVolume(ctx context.Context, client *docker.Client, volume string, start time.Time) helper.BackupResult {
+	name := "volume_" + volume
+	fail := func(err error) helper.BackupResult {
+		return helper.BackupResult{Database: name, Success: false, Error: err}
+	}
+	exists, err := client.VolumeExists(ctx, volume)
+	if err != nil {
+		return fail(fmt.Errorf("failed to inspect volume: %w", err))
+	}
+	if !exists {
+		return fail(fmt.Errorf("volume %s does not exist", volume))
+	}
+
+	stageDir := filepath.Join(w.cfg.Backup.TempDir, fmt.Sprintf("%s_%s", helper.EscapeName(name), start.Format(helper.TimestampLayout)))
+	if err := os.MkdirAll(stageDir, 0700); err != nil {
+		return fail(fmt.Errorf("failed to create temp dir: %w", err))
+	}
+	defer os.RemoveAll(stageDir)
+
+	// The tarball is written inside the container, then copied out through
+	// the API, which also works with remote daemons
+	tarball := "/" + helper.EscapeName(volume) + ".tar"
+	spec := docker.ContainerSpec{
+		Image:      w.cfg.Volumes.Image,
+		Entrypoint: []string{"tar"},
+		Cmd:        []string{"-cf", tarball, "-C", mountPath, "."},
+	}
+	spec.HostConfig.Binds = []string{volume + ":" + mountPath + ":ro"}
+	id, err := client.CreateContainer(ctx, spec)
+	if err != nil {
+		return fail(fmt.Errorf("failed to create helper container: %w", err))
+	}
+	defer func() {
+		if err := client.RemoveContainer(context.WithoutCancel(ctx), id); err != nil {
+			helper.Warnf("failed to remove helper container %s: %v", id, err)
+		}
+	}()
+
+	helper.Infof("Archiving volume %s", volume)
+	if err := client.RunContainer(ctx, id); err != nil {
+		return fail(fmt.Errorf("tar failed: %w", err))
+	}
+	if err := client.CopyFileFrom(ctx, id, tarball, stageDir); err != nil {
+		return fail(fmt.Errorf("failed to copy archive out of the helper container: %w", err))
+	}
+
+	result := w.pipeline.Ship(ctx, name, stageDir, start, true)
+	result.Database = name
+	return result
+}
@@ -0,0 +1,229 @@
+// Package backup exposes the backup pipeline to other Go programs, so they can
+// embed backups instead of shelling out to the CLI.
+//
+// Data types such as Config, Manifest and Result are aliases of the ones used
+// by the CLI, so values can be passed between the two freely. Behavior is
+// reached through the interfaces of this package (Storage, Source, Pipeline,
+// MemoryStorage) and its Options. The interfaces and functions in this
+// package are kept stable; everything else in the module may change between
+// releases.
+//
+//	cfg, err := backup.LoadConfig("config.yaml")
+//	store, err := backup.NewStorage(cfg, backup.Options{})
+//	notifier := backup.NewNotifier(cfg)
+//	err = backup.MySQL(cfg, store, notifier, backup.Options{}).Run(ctx)
+package backup
+
+import (
+	"context"
+	"time"
+
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/pkg/helper"
+)
+
+// Config is the configuration shared by all sources, storages and notifiers.
+type Config = config.Config
+
+// LoadConfig reads a configuration file, applying defaults and validation.
+func LoadConfig(path string) (*Config, error) {
+	return config.LoadConfig(path)
+}
+
+// Options are the settings the CLI takes as global flags rather than from the
+// config file. The zero value backs up to the configured storage.
+type Options struct {
+	// OnlyDump keeps backups in local.dir instead of the configured storage,
+	// like --only-dump.
+	OnlyDump bool
+	// ConfirmLargeDeletes lets retention delete more backups than
+	// retention.confirm_threshold, like --confirm-large-delete.
+	ConfirmLargeDeletes bool
+}
+
+// options converts the options to those of the CLI.
+func (o Options) options() helper.Options {
+	return helper.Options{OnlyDump: o.OnlyDump, ConfirmLargeDeletes: o.ConfirmLargeDeletes}
+}
+
+// Storage is a destination for artifacts and their manifests.
+type Storage = helper.Storage
+
+// ObjectInfo describes a stored object.
+type ObjectInfo = helper.ObjectInfo
+
+// RetentionFunc returns the retention period in hours of an artifact key.
+type RetentionFunc = helper.RetentionFunc
+
+// RetentionLimits caps the deletions of a retention run.
+type RetentionLimits = helper.RetentionLimits
+
+// RetentionStats counts the artifacts deleted by a retention run.
+type RetentionStats = helper.RetentionStats
+
+// ArtifactSizeError fails an artifact that is missing, empty or smaller than
+// backup.min_artifact_bytes.
+type ArtifactSizeError = helper.ArtifactSizeError
+
+var (
+	// ErrObjectExists is returned when uploading to a key that already exists.
+	ErrObjectExists = helper.ErrObjectExists
+	// ErrNotSupported is returned by operations a storage cannot perform.
+	ErrNotSupported = helper.ErrNotSupported
+)
+
+// NewStorage creates the storage selected by storage.backend, or the local
+// storage with OnlyDump.
+func NewStorage(cfg *Config, opts Options) (Storage, error) {
+	return helper.NewStorage(cfg, opts.options())
+}
+
+// NewS3Storage creates an S3-compatible storage from the r2 section.
+func NewS3Storage(cfg *Config) (Storage, error) {
+	return helper.NewS3Storage(cfg.R2)
+}
+
+// NewB2Storage creates a Backblaze B2 storage from the b2 section.
+func NewB2Storage(cfg *Config) (Storage, error) {
+	return helper.NewB2Storage(cfg.B2, cfg.Backup.TempDir)
+}
+
+// NewSFTPStorage creates an SFTP storage from the sftp section.
+func NewSFTPStorage(cfg *Config) (Storage, error) {
+	return helper.NewSFTPStorage(cfg.SFTP)
+}
+
+// NewFTPStorage creates an FTP(S) storage from the ftp section.
+func NewFTPStorage(cfg *Config) (Storage, error) {
+	return helper.NewFTPStorage(cfg.FTP)
+}
+
+// NewWebDAVStorage creates a WebDAV storage from the webdav section.
+func NewWebDAVStorage(cfg *Config) (Storage, error) {
+	return helper.NewWebDAVStorage(cfg.WebDAV)
+}
+
+// NewGDriveStorage creates a Google Drive storage from the gdrive section.
+func NewGDriveStorage(cfg *Config) (Storage, error) {
+	return helper.NewGDriveStorage(cfg.GDrive)
+}
+
+// NewLocalStorage creates a storage in a local directory from the local section.
+func NewLocalStorage(cfg *Config) Storage {
+	return helper.NewLocalStorage(cfg.Local)
+}
+
+// MemoryStorage is a Storage keeping objects in memory, for tests and dry
+// runs.
+type MemoryStorage interface {
+	Storage
+	// SetModified backdates an object, e.g. to make it expire under retention.
+	SetModified(key string, modified time.Time)
+}
+
+// NewMemoryStorage creates an empty in-memory storage using the given key
+// layout ("" or "structured").
+func NewMemoryStorage(layout string) MemoryStorage {
+	return helper.NewMemoryStorage(layout)
+}
+
+// FixedRetention keeps every artifact for the given number of hours.
+func FixedRetention(hours int) RetentionFunc {
+	return helper.FixedRetention(hours)
+}
+
+// Progress is a snapshot of a running backup, reported through ProgressFunc.
+type Progress = helper.Progress
+
+// ProgressFunc receives progress reports. It must return quickly.
+type ProgressFunc = helper.ProgressFunc
+
+// Stages of Progress.
+const (
+	StageDump     = helper.StageDump
+	StageZip      = helper.StageZip
+	StageUpload   = helper.StageUpload
+	StageDownload = helper.StageDownload
+	StageDone     = helper.StageDone
+)
+
+// WithProgress wraps a storage so that the bytes of every upload and
+// download are reported to progress. Any source using the storage reports
+// its transfers this way.
+func WithProgress(store Storage, progress ProgressFunc) Storage {
+	return helper.WithProgress(store, progress)
+}
+
+// Notifier delivers job reports. A notifier without credentials is a no-op.
+type Notifier = helper.TelegramSender
+
+// NewNotifier creates the notifier configured in the telegram section.
+func NewNotifier(cfg *Config) *Notifier {
+	return helper.NewNotifier(cfg)
+}
+
+// MessageRecorder holds the messages of a notifier created by
+// NewMemoryNotifier.
+type MessageRecorder interface {
+	// Messages returns the texts sent so far; documents are recorded as
+	// "document: <caption>".
+	Messages() []string
+}
+
+// NewMemoryNotifier creates a notifier recording its messages in memory
+// instead of delivering them.
+func NewMemoryNotifier() (*Notifier, MessageRecorder) {
+	return helper.NewMemoryNotifier()
+}
+
+// Result is the outcome of shipping one artifact.
+type Result = helper.BackupResult
+
+// Manifest describes the content of an artifact and is stored next to it.
+type Manifest = helper.Manifest
+
+// ManifestKey returns the manifest key for an artifact key.
+func ManifestKey(artifactKey string) string {
+	return helper.ManifestKey(artifactKey)
+}
+
+// ParseManifest decodes a manifest from JSON.
+func ParseManifest(data []byte) (*Manifest, error) {
+	return helper.ParseManifest(data)
+}
+
+// ChainLink is an artifact of a full/incremental/binlog chain.
+type ChainLink = helper.ChainLink
+
+// ResolveChain returns the artifacts needed to restore key, from its full
+// artifact to key itself.
+func ResolveChain(ctx context.Context, store Storage, key string) ([]ChainLink, error) {
+	return helper.ResolveChain(ctx, store, key)
+}
+
+// Pipeline packages directories into encrypted artifacts and ships them to
+// storage. It is the building block for custom sources.
+type Pipeline interface {
+	// Start starts measuring the resource usage of a run, reported by
+	// Report. Defer the returned function, which stops the measurement.
+	Start() (stop func())
+	// SetProgress sets the function receiving the zip, upload and done
+	// stages of the artifacts shipped next.
+	SetProgress(progress ProgressFunc)
+	// Ship zips srcDir into an artifact of name, created at created, and
+	// uploads it with its manifest. With flatten, the directory structure
+	// inside srcDir is discarded.
+	Ship(ctx context.Context, name, srcDir string, created time.Time, flatten bool) Result
+	// EnforceRetention deletes the expired artifacts from the storage and
+	// its mirrors, within the limits of the retention section.
+	EnforceRetention(ctx context.Context, retention RetentionFunc) error
+	// Report sends the report of a run of job and records its results in
+	// the backup history.
+	Report(notifier *Notifier, job string, results []Result, success, fail int)
+}
+
+// NewPipeline creates a pipeline shipping to store, or to the local storage
+// with OnlyDump.
+func NewPipeline(cfg *Config, store Storage, opts Options) Pipeline {
+	return helper.NewPipeline(cfg, store, opts.options())
+}
@@ -0,0 +1,102 @@
+package backup
+
+import (
+	"context"
+
+	"github.com/davexpro/backup/internal/app"
+	"github.com/davexpro/backup/internal/chat"
+	"github.com/davexpro/backup/internal/compose"
+	"github.com/davexpro/backup/internal/config"
+	"github.com/davexpro/backup/internal/gitlab"
+	"github.com/davexpro/backup/internal/host"
+	"github.com/davexpro/backup/internal/ldap"
+	"github.com/davexpro/backup/internal/mysql"
+	"github.com/davexpro/backup/internal/rabbitmq"
+	"github.com/davexpro/backup/internal/site"
+	"github.com/davexpro/backup/internal/vault"
+	"github.com/davexpro/backup/internal/volume"
+)
+
+// Source backs up one kind of system: it dumps, ships the artifacts, enforces
+// retention and reports, exactly like the matching CLI command.
+type Source interface {
+	Run(ctx context.Context) error
+}
+
+// SourceFunc adapts a function to the Source interface.
+type SourceFunc func(ctx context.Context) error
+
+// Run calls f.
+func (f SourceFunc) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+// MySQL backs up the databases of the mysql section.
+func MySQL(cfg *Config, store Storage, notifier *Notifier, opts Options) Source {
+	return SourceFunc(mysql.NewWorker(cfg, store, notifier, opts.options()).Backup)
+}
+
+// MySQLWithProgress backs up the databases of the mysql section, reporting
+// each database dump and the zip, upload and done stages of every artifact
+// to progress.
+func MySQLWithProgress(cfg *Config, store Storage, notifier *Notifier, opts Options, progress ProgressFunc) Source {
+	w := mysql.NewWorker(cfg, store, notifier, opts.options())
+	w.SetProgress(progress)
+	return SourceFunc(w.Backup)
+}
+
+// GitLabInstance is one GitLab container to back up.
+type GitLabInstance = config.GitLabInstance
+
+// GitLab backs up one GitLab instance.
+func GitLab(cfg *Config, instance GitLabInstance, store Storage, notifier *Notifier, opts Options) Source {
+	return gitlab.NewWorker(cfg, instance, store, notifier, opts.options())
+}
+
+// Compose backs up the stacks of the compose section.
+func Compose(cfg *Config, store Storage, notifier *Notifier, opts Options) Source {
+	return compose.NewWorker(cfg, store, notifier, opts.options())
+}
+
+// DockerVolumes backs up the named volumes of the docker_volume section.
+func DockerVolumes(cfg *Config, store Storage, notifier *Notifier, opts Options) Source {
+	return volume.NewWorker(cfg, store, notifier, opts.options())
+}
+
+// Sites backs up the websites of the sites section.
+func Sites(cfg *Config, store Storage, notifier *Notifier, opts Options) Source {
+	w := site.NewWorker(cfg, store, notifier, opts.options())
+	return SourceFunc(func(ctx context.Context) error { return w.Run(ctx, cfg.Sites) })
+}
+
+// Chat backs up the servers of the chat section.
+func Chat(cfg *Config, store Storage, notifier *Notifier, opts Options) Source {
+	w := chat.NewWorker(cfg, store, notifier, opts.options())
+	return SourceFunc(func(ctx context.Context) error { return w.Run(ctx, cfg.Chat) })
+}
+
+// Apps backs up the SQLite-backed apps of the apps section.
+func Apps(cfg *Config, store Storage, notifier *Notifier, opts Options) Source {
+	w := app.NewWorker(cfg, store, notifier, opts.options())
+	return SourceFunc(func(ctx context.Context) error { return w.Run(ctx, cfg.Apps) })
+}
+
+// LDAP backs up the OpenLDAP server of the ldap section.
+func LDAP(cfg *Config, store Storage, notifier *Notifier, opts Options) Source {
+	return ldap.NewWorker(cfg, store, notifier, opts.options())
+}
+
+// Vault backs up the HashiCorp Vault cluster of the vault section.
+func Vault(cfg *Config, store Storage, notifier *Notifier, opts Options) Source {
+	return vault.NewWorker(cfg, store, notifier, opts.options())
+}
+
+// RabbitMQ backs up the broker of the rabbitmq section.
+func RabbitMQ(cfg *Config, store Storage, notifier *Notifier, opts Options) Source {
+	return rabbitmq.NewWorker(cfg, store, notifier, opts.options())
+}
+
+// Host backs up the host configuration of the host section.
+func Host(cfg *Config, store Storage, notifier *Notifier, opts Options) Source {
+	return host.NewWorker(cfg, store, notifier, opts.options())
+}